@@ -0,0 +1,318 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xyproto/files"
+	"github.com/xyproto/vt100"
+)
+
+// ArchiveEntry is a file within a zip or tar archive, that can be edited.
+// When saving, the archive is rewritten with only this file replaced.
+type ArchiveEntry struct {
+	archiveFilename string
+	name            string // the path within the archive
+}
+
+// tarExtensions maps from short extensions for compressed tar archives to the extensions of the compressed tar files
+var tarExtensions = map[string]string{
+	".tgz":  ".tar.gz",
+	".tbz":  ".tar.bz2",
+	".tbz2": ".tar.bz2",
+	".txz":  ".tar.xz",
+	".tzst": ".tar.zst",
+}
+
+// isZipArchive checks if the given filename has the extension of a zip archive
+func isZipArchive(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".zip", ".jar", ".war", ".ear":
+		return true
+	}
+	return false
+}
+
+// tarFilename returns the filename of a tar archive with the compression extension at the end,
+// like "archive.tar.gz" for "archive.tgz", so that it can be given to the compression functions.
+// Returns an empty string if the filename is not the filename of a tar archive.
+func tarFilename(filename string) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if tarExt, ok := tarExtensions[ext]; ok {
+		return strings.TrimSuffix(filename, filepath.Ext(filename)) + tarExt
+	}
+	if strings.ToLower(filepath.Ext(stripCompressionExtension(filename))) == ".tar" {
+		return filename
+	}
+	return ""
+}
+
+// isArchive checks if the given filename has the extension of a zip or tar archive
+func isArchive(filename string) bool {
+	return isZipArchive(filename) || tarFilename(filename) != ""
+}
+
+// cleanArchiveName removes "./" and "/" from the start of a path within an archive
+func cleanArchiveName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// splitArchivePath splits a filename like "archive.tar.gz:path/inside/file.txt" into an archive and a path within it.
+// Returns false if the part before the colon is not an existing archive, or if the path within it is empty.
+func splitArchivePath(filename string) (*ArchiveEntry, bool) {
+	for i := strings.Index(filename, ":"); i >= 0; {
+		if archiveFilename, name := filename[:i], filename[i+1:]; isArchive(archiveFilename) && files.IsFile(archiveFilename) {
+			if name = cleanArchiveName(name); name == "" {
+				return nil, false
+			}
+			return &ArchiveEntry{archiveFilename, name}, true
+		}
+		next := strings.Index(filename[i+1:], ":")
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return nil, false
+}
+
+// String returns the archive filename and the path within the archive, separated by a colon
+func (ae *ArchiveEntry) String() string {
+	return ae.archiveFilename + ":" + ae.name
+}
+
+// readTar decompresses the given tar archive, if needed, and returns a tar reader for it
+func readTar(filename string) (*tar.Reader, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = decompressFileData(tarFilename(filename), data); err != nil {
+		return nil, err
+	}
+	return tar.NewReader(bytes.NewReader(data)), nil
+}
+
+// ListArchive returns the paths of the regular files in the given zip or tar archive, sorted alphabetically
+func ListArchive(filename string) ([]string, error) {
+	var names []string
+	if isZipArchive(filename) {
+		r, err := zip.OpenReader(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		for _, f := range r.File {
+			if f.Mode().IsRegular() {
+				names = append(names, cleanArchiveName(f.Name))
+			}
+		}
+	} else {
+		tr, err := readTar(filename)
+		if err != nil {
+			return nil, err
+		}
+		for {
+			hdr, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			if hdr.Typeflag == tar.TypeReg {
+				names = append(names, cleanArchiveName(hdr.Name))
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Read returns the contents of the file within the archive
+func (ae *ArchiveEntry) Read() ([]byte, error) {
+	if isZipArchive(ae.archiveFilename) {
+		r, err := zip.OpenReader(ae.archiveFilename)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		for _, f := range r.File {
+			if cleanArchiveName(f.Name) != ae.name {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer rc.Close()
+			return io.ReadAll(rc)
+		}
+	} else {
+		tr, err := readTar(ae.archiveFilename)
+		if err != nil {
+			return nil, err
+		}
+		for {
+			hdr, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			if hdr.Typeflag == tar.TypeReg && cleanArchiveName(hdr.Name) == ae.name {
+				return io.ReadAll(tr)
+			}
+		}
+	}
+	return nil, errors.New("could not find " + ae.name + " in " + ae.archiveFilename)
+}
+
+// Write rewrites the archive, where the contents of this file are replaced with the given data.
+// The other files in the archive are copied as they are, with the same metadata and compression.
+func (ae *ArchiveEntry) Write(data []byte) error {
+	// Write the new archive to a temporary file, that then replaces the archive
+	return replaceFile(ae.archiveFilename, 0o644, func(w io.Writer) error {
+		if isZipArchive(ae.archiveFilename) {
+			return ae.writeZip(w, data)
+		}
+		return ae.writeTar(w, data)
+	})
+}
+
+// writeZip writes a copy of the zip archive to w, where this file is replaced with the given data
+func (ae *ArchiveEntry) writeZip(w io.Writer, data []byte) error {
+	r, err := zip.OpenReader(ae.archiveFilename)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	zw := zip.NewWriter(w)
+	if err := zw.SetComment(r.Comment); err != nil {
+		return err
+	}
+	found := false
+	for _, f := range r.File {
+		if cleanArchiveName(f.Name) != ae.name {
+			// Copy the compressed data directly
+			if err := zw.Copy(f); err != nil {
+				return err
+			}
+			continue
+		}
+		found = true
+		// Keep the name, compression method and file mode, but let the zip writer find the new sizes and checksum
+		fh := f.FileHeader
+		fh.Modified = time.Now()
+		fh.Extra = nil
+		fh.CRC32 = 0
+		fh.CompressedSize, fh.CompressedSize64 = 0, 0
+		fh.UncompressedSize, fh.UncompressedSize64 = 0, 0
+		fw, err := zw.CreateHeader(&fh)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(data); err != nil {
+			return err
+		}
+	}
+	if !found {
+		return errors.New("could not find " + ae.name + " in " + ae.archiveFilename)
+	}
+	return zw.Close()
+}
+
+// writeTar writes a copy of the tar archive to w, where this file is replaced with the given data.
+// The archive is compressed with the same compression as before, if any.
+func (ae *ArchiveEntry) writeTar(w io.Writer, data []byte) error {
+	tr, err := readTar(ae.archiveFilename)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	found := false
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeReg && cleanArchiveName(hdr.Name) == ae.name {
+			found = true
+			hdr.Size = int64(len(data))
+			hdr.ModTime = time.Now().Truncate(time.Second)
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if _, err := tw.Write(data); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+	if !found {
+		return errors.New("could not find " + ae.name + " in " + ae.archiveFilename)
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	compressed, err := compressFileData(tarFilename(ae.archiveFilename), buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(compressed)
+	return err
+}
+
+// LoadArchiveEntry reads the file within an archive, if the filename is like "archive.tar.gz:path/inside/file.txt".
+// If only the filename of an archive is given, the user can choose a file within it first.
+// Returns false if the user closed the list of files without choosing one.
+func (fnord *FilenameOrData) LoadArchiveEntry(tty *vt100.TTY, c *vt100.Canvas, theme Theme) (bool, error) {
+	if fnord.stdin || !fnord.Empty() || fnord.archive != nil {
+		return true, nil
+	}
+	if archive, ok := splitArchivePath(fnord.filename); ok {
+		fnord.archive = archive
+	} else if c != nil && tty != nil && isArchive(fnord.filename) && files.IsFile(fnord.filename) {
+		names, err := ListArchive(fnord.filename)
+		if err != nil {
+			return false, err
+		}
+		if len(names) == 0 {
+			return false, errors.New("found no files in " + fnord.filename)
+		}
+		chooser := NewSimpleEditor(80)
+		chooser.Theme = theme
+		name, ok := chooser.FuzzyChoose(c, tty, "Open file in "+filepath.Base(fnord.filename), names, nil, nil)
+		if !ok {
+			return false, nil
+		}
+		fnord.archive = &ArchiveEntry{fnord.filename, name}
+	} else {
+		return true, nil
+	}
+	fnord.filename = fnord.archive.String()
+	data, err := fnord.archive.Read()
+	if err != nil {
+		return false, err
+	}
+	fnord.data = data
+	fnord.length = len(data)
+	return true, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestZipArchiveEntry(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "release.jar")
+	modified := time.Date(2020, 1, 2, 3, 4, 6, 0, time.UTC)
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, fh := range []zip.FileHeader{
+		{Name: "META-INF/MANIFEST.MF", Method: zip.Deflate, Modified: modified},
+		{Name: "config/app.properties", Method: zip.Store, Modified: modified},
+	} {
+		w, err := zw.CreateHeader(&fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("contents of " + fh.Name + "\n"))
+	}
+	zw.SetComment("release")
+	zw.Close()
+	if err := os.WriteFile(filename, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fnord := FilenameOrData{filename + ":./config/app.properties", []byte{}, 0, false, nil}
+	if chosen, err := fnord.LoadArchiveEntry(nil, nil, NewDefaultTheme()); !chosen || err != nil {
+		t.Fatalf("expected the file within the archive to be loaded (%v)", err)
+	}
+	if fnord.filename != filename+":config/app.properties" || string(fnord.data) != "contents of config/app.properties\n" {
+		t.Errorf("unexpected filename %q or data %q", fnord.filename, fnord.data)
+	}
+	if err := fnord.archive.Write([]byte("debug=true\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if r.Comment != "release" || len(r.File) != 2 {
+		t.Fatalf("expected the comment and both files to be kept, got %q and %d files", r.Comment, len(r.File))
+	}
+	if f := r.File[0]; f.Method != zip.Deflate || !f.Modified.Equal(modified) {
+		t.Error("expected the other file to keep its compression method and modification time")
+	}
+	if f := r.File[1]; f.Method != zip.Store {
+		t.Error("expected the replaced file to keep its compression method")
+	}
+	if data, err := fnord.archive.Read(); err != nil || string(data) != "debug=true\n" {
+		t.Errorf("expected the new contents, got %q (%v)", data, err)
+	}
+
+	// All files within an archive share the lock of the archive, since saving one of them rewrites the whole archive
+	lk := NewLockKeeper(filepath.Join(t.TempDir(), "lockfile.txt"))
+	if err := lk.Lock(filename + ":config/app.properties"); err != nil {
+		t.Fatal(err)
+	}
+	if err := lk.Lock(filename + ":META-INF/MANIFEST.MF"); err == nil {
+		t.Error("expected another file within the same archive to be locked")
+	}
+	if lk.GetTimestamp(filename).IsZero() {
+		t.Error("expected the archive to be locked")
+	}
+}
+
+func TestTarArchiveEntry(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "release.tgz")
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range []string{"./release/README.md", "./release/main.go"} {
+		contents := "contents of " + name + "\n"
+		tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o755, Size: int64(len(contents)), Uname: "builder"})
+		tw.Write([]byte(contents))
+	}
+	tw.Close()
+	compressed, err := gZipData(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filename, compressed, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := ListArchive(filename)
+	if err != nil || !slices.Equal(names, []string{"release/README.md", "release/main.go"}) {
+		t.Fatalf("unexpected list of files: %v (%v)", names, err)
+	}
+	archive, ok := splitArchivePath(filename + ":release/main.go")
+	if !ok {
+		t.Fatal("expected the filename to be split into an archive and a path within it")
+	}
+	if err := archive.Write([]byte("package main\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comp := compressionByMagic(data); comp == nil || comp.name != "gzip" {
+		t.Error("expected the archive to still be compressed with gzip")
+	}
+	tr, err := readTar(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		hdr, err := tr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Mode != 0o755 || hdr.Uname != "builder" {
+			t.Errorf("expected the metadata of %s to be kept", name)
+		}
+	}
+	if data, err := archive.Read(); err != nil || string(data) != "package main\n" {
+		t.Errorf("expected the new contents, got %q (%v)", data, err)
+	}
+
+	if _, ok := splitArchivePath(filename + ":"); ok {
+		t.Error("expected an empty path within the archive to not be split")
+	}
+	if _, ok := splitArchivePath("main.go:12"); ok {
+		t.Error("expected main.go:12 to not be a file within an archive")
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xyproto/vt100"
+)
+
+var (
+	breakpointsFilename = filepath.Join(userCacheDir, "o", "breakpoints.txt")
+	breakpointHistory   BreakpointHistory // per absolute filename, for restoring breakpoints when debugging again
+)
+
+// Breakpoint is a breakpoint at a line, with an optional condition and hit count
+type Breakpoint struct {
+	Condition string // only stop if this expression is true, or "" to always stop
+	Line      LineNumber
+	HitCount  int // only stop when the breakpoint has been reached this many times, or 0 to always stop
+	Disabled  bool
+}
+
+// String returns a short description of the breakpoint, for the breakpoint menu
+func (bp Breakpoint) String() string {
+	s := "Line " + bp.Line.String()
+	if bp.Condition != "" {
+		s += " if " + bp.Condition
+	}
+	if bp.HitCount > 1 {
+		s += fmt.Sprintf(" (at hit %d)", bp.HitCount)
+	}
+	if bp.Disabled {
+		s += " [disabled]"
+	}
+	return s
+}
+
+// Breakpoints is the set of breakpoints in one file, sorted by line number
+type Breakpoints []Breakpoint
+
+// Index returns the index of the breakpoint at the given line, or -1 if there is none
+func (bps Breakpoints) Index(lineNumber LineNumber) int {
+	for i, bp := range bps {
+		if bp.Line == lineNumber {
+			return i
+		}
+	}
+	return -1
+}
+
+// Get returns the breakpoint at the given line, if there is one
+func (bps Breakpoints) Get(lineNumber LineNumber) (Breakpoint, bool) {
+	if i := bps.Index(lineNumber); i >= 0 {
+		return bps[i], true
+	}
+	return Breakpoint{}, false
+}
+
+// Set adds the given breakpoint, or replaces the breakpoint at the same line
+func (bps Breakpoints) Set(bp Breakpoint) Breakpoints {
+	if i := bps.Index(bp.Line); i >= 0 {
+		bps[i] = bp
+		return bps
+	}
+	bps = append(bps, bp)
+	sort.Slice(bps, func(i, j int) bool {
+		return bps[i].Line < bps[j].Line
+	})
+	return bps
+}
+
+// Remove removes the breakpoint at the given line, if there is one
+func (bps Breakpoints) Remove(lineNumber LineNumber) Breakpoints {
+	if i := bps.Index(lineNumber); i >= 0 {
+		return append(bps[:i], bps[i+1:]...)
+	}
+	return bps
+}
+
+// Enabled returns the breakpoints that are not disabled
+func (bps Breakpoints) Enabled() Breakpoints {
+	var enabled Breakpoints
+	for _, bp := range bps {
+		if !bp.Disabled {
+			enabled = append(enabled, bp)
+		}
+	}
+	return enabled
+}
+
+// BreakpointHistory stores the breakpoints per absolute filename
+type BreakpointHistory map[string]Breakpoints
+
+// Save will attempt to save the breakpoints for all files.
+// The format is one breakpoint per line: filename, line number, hit count, "disabled" or "enabled" and the condition, separated by tabs.
+func (breakpointHistory BreakpointHistory) Save(path string) error {
+	if noWriteToCache {
+		return nil
+	}
+	// First create the folder, if needed, in a best effort attempt
+	folderPath := filepath.Dir(path)
+	os.MkdirAll(folderPath, os.ModePerm)
+	absFilenames := make([]string, 0, len(breakpointHistory))
+	for absFilename := range breakpointHistory {
+		absFilenames = append(absFilenames, absFilename)
+	}
+	sort.Strings(absFilenames)
+	var sb strings.Builder
+	for _, absFilename := range absFilenames {
+		for _, bp := range breakpointHistory[absFilename] {
+			state := "enabled"
+			if bp.Disabled {
+				state = "disabled"
+			}
+			sb.WriteString(fmt.Sprintf("%s\t%d\t%d\t%s\t%s\n", absFilename, bp.Line, bp.HitCount, state, bp.Condition))
+		}
+	}
+	return os.WriteFile(path, []byte(sb.String()), 0o600)
+}
+
+// LoadBreakpointHistory will attempt to load the breakpoints for all files.
+// The returned map can be empty.
+func LoadBreakpointHistory(path string) (BreakpointHistory, error) {
+	breakpointHistory := make(BreakpointHistory)
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return breakpointHistory, err
+	}
+	for _, line := range strings.Split(string(contents), "\n") {
+		fields := strings.SplitN(line, "\t", 5)
+		if len(fields) != 5 || fields[0] == "" {
+			continue
+		}
+		lineNumber, err := strconv.Atoi(fields[1])
+		if err != nil || lineNumber < 1 {
+			continue
+		}
+		hitCount, err := strconv.Atoi(fields[2])
+		if err != nil {
+			continue
+		}
+		bp := Breakpoint{Line: LineNumber(lineNumber), HitCount: hitCount, Disabled: fields[3] == "disabled", Condition: fields[4]}
+		breakpointHistory[fields[0]] = breakpointHistory[fields[0]].Set(bp)
+	}
+	return breakpointHistory, nil
+}
+
+// LoadBreakpoints loads the breakpoints for the current file from the breakpoint history, if they have not been loaded already
+func (e *Editor) LoadBreakpoints() {
+	if breakpointHistory == nil {
+		breakpointHistory, _ = LoadBreakpointHistory(breakpointsFilename)
+	}
+	if e.breakpoints != nil {
+		return
+	}
+	absFilename, err := e.AbsFilename()
+	if err != nil {
+		return
+	}
+	e.breakpoints = append(Breakpoints{}, breakpointHistory[absFilename]...)
+}
+
+// SaveBreakpoints stores the breakpoints for the current file in the breakpoint history, and saves it
+func (e *Editor) SaveBreakpoints() error {
+	absFilename, err := e.AbsFilename()
+	if err != nil {
+		return err
+	}
+	if breakpointHistory == nil {
+		breakpointHistory, _ = LoadBreakpointHistory(breakpointsFilename)
+	}
+	if len(e.breakpoints) == 0 {
+		delete(breakpointHistory, absFilename)
+	} else {
+		breakpointHistory[absFilename] = append(Breakpoints{}, e.breakpoints...)
+	}
+	return breakpointHistory.Save(breakpointsFilename)
+}
+
+// updateBreakpoint replaces the breakpoint at the same line, saves the breakpoints and
+// updates the breakpoint in the debug session, if there is one in progress
+func (e *Editor) updateBreakpoint(bp Breakpoint) error {
+	e.breakpoints = e.breakpoints.Set(bp)
+	e.SaveBreakpoints()
+	if e.debugger == nil {
+		return nil
+	}
+	sourceBaseFilename := filepath.Base(e.filename)
+	if bp.Disabled {
+		return e.debugger.ClearBreakpoint(sourceBaseFilename, bp.Line)
+	}
+	return e.debugger.SetBreakpoint(sourceBaseFilename, bp)
+}
+
+// ToggleBreakpoint adds a breakpoint at the current line, or removes it if there already is one.
+// Returns true if a breakpoint was added.
+func (e *Editor) ToggleBreakpoint() (bool, error) {
+	e.LoadBreakpoints()
+	lineNumber := e.LineNumber()
+	if _, found := e.breakpoints.Get(lineNumber); found {
+		return false, e.RemoveBreakpoint(lineNumber)
+	}
+	return true, e.updateBreakpoint(Breakpoint{Line: lineNumber})
+}
+
+// RemoveBreakpoint removes the breakpoint at the given line, also from the debug session, if there is one in progress
+func (e *Editor) RemoveBreakpoint(lineNumber LineNumber) error {
+	e.breakpoints = e.breakpoints.Remove(lineNumber)
+	e.SaveBreakpoints()
+	if e.debugger == nil {
+		return nil
+	}
+	return e.debugger.ClearBreakpoint(filepath.Base(e.filename), lineNumber)
+}
+
+// BreakpointMenu lists the breakpoints in the current file, and lets the user go to, change, disable or delete one of them
+func (e *Editor) BreakpointMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) error {
+	e.LoadBreakpoints()
+	if len(e.breakpoints) == 0 {
+		return errors.New("no breakpoints, add one with ctrl-b")
+	}
+	choices := make([]string, 0, len(e.breakpoints)+1)
+	for _, bp := range e.breakpoints {
+		choices = append(choices, bp.String())
+	}
+	choices = append(choices, "Delete all breakpoints")
+	const extraDashes = false
+	selected, _ := e.Menu(status, tty, "Breakpoints", choices, e.Background, e.MenuTitleColor, e.MenuArrowColor, e.MenuTextColor, e.MenuHighlightColor, e.MenuSelectedColor, 0, extraDashes)
+	e.redraw.Store(true)
+	e.redrawCursor.Store(true)
+	if selected < 0 {
+		return nil
+	}
+	if selected == len(e.breakpoints) {
+		for len(e.breakpoints) > 0 {
+			if err := e.RemoveBreakpoint(e.breakpoints[0].Line); err != nil {
+				return err
+			}
+		}
+		status.SetMessageAfterRedraw("Deleted all breakpoints")
+		return nil
+	}
+	bp := e.breakpoints[selected]
+
+	// Let the user choose what to do with the selected breakpoint
+	toggleText := "Disable"
+	if bp.Disabled {
+		toggleText = "Enable"
+	}
+	actions := []string{"Go to line " + bp.Line.String(), "Set condition", "Set hit count", toggleText, "Delete"}
+	action, _ := e.Menu(status, tty, bp.String(), actions, e.Background, e.MenuTitleColor, e.MenuArrowColor, e.MenuTextColor, e.MenuHighlightColor, e.MenuSelectedColor, 0, extraDashes)
+	switch action {
+	case 0:
+		e.GoToLineNumber(bp.Line, c, status, true)
+	case 1:
+		condition, ok := e.UserInput(c, tty, status, "Condition for line "+bp.Line.String(), bp.Condition, []string{}, false, "")
+		if !ok {
+			return nil
+		}
+		bp.Condition = strings.TrimSpace(condition)
+		return e.updateBreakpoint(bp)
+	case 2:
+		var defaultValue string
+		if bp.HitCount > 0 {
+			defaultValue = strconv.Itoa(bp.HitCount)
+		}
+		hitCountString, ok := e.UserInput(c, tty, status, "Stop at hit number", defaultValue, []string{}, false, "")
+		if !ok {
+			return nil
+		}
+		hitCount, err := strconv.Atoi(strings.TrimSpace(hitCountString))
+		if err != nil || hitCount < 0 {
+			return fmt.Errorf("invalid hit count: %s", hitCountString)
+		}
+		bp.HitCount = hitCount
+		return e.updateBreakpoint(bp)
+	case 3:
+		bp.Disabled = !bp.Disabled
+		return e.updateBreakpoint(bp)
+	case 4:
+		status.SetMessageAfterRedraw("Deleted breakpoint at line " + bp.Line.String())
+		return e.RemoveBreakpoint(bp.Line)
+	}
+	return nil
+}
+
+// breakpointMarker returns the marker to draw at the right edge of the given line, or 0 if there is no breakpoint there
+func (e *Editor) breakpointMarker(lineNumber LineNumber) rune {
+	bp, found := e.breakpoints.Get(lineNumber)
+	switch {
+	case !found:
+		return 0
+	case bp.Disabled:
+		return '○'
+	case bp.Condition != "" || bp.HitCount > 1:
+		return '◆'
+	default:
+		return '●'
+	}
+}
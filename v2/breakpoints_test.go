@@ -0,0 +1,72 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBreakpoints(t *testing.T) {
+	var bps Breakpoints
+	bps = bps.Set(Breakpoint{Line: 20})
+	bps = bps.Set(Breakpoint{Line: 5, Condition: "x > 3"})
+	bps = bps.Set(Breakpoint{Line: 12, HitCount: 4, Disabled: true})
+	if len(bps) != 3 || bps[0].Line != 5 || bps[1].Line != 12 || bps[2].Line != 20 {
+		t.Fatalf("expected the breakpoints to be sorted by line, got %v", bps)
+	}
+	// Setting a breakpoint at the same line replaces it
+	bps = bps.Set(Breakpoint{Line: 20, Condition: "done"})
+	if bp, found := bps.Get(20); len(bps) != 3 || !found || bp.Condition != "done" {
+		t.Errorf("expected the breakpoint at line 20 to be replaced, got %v", bps)
+	}
+	if enabled := bps.Enabled(); len(enabled) != 2 || enabled[1].Line != 20 {
+		t.Errorf("unexpected enabled breakpoints: %v", enabled)
+	}
+	if s := bps[0].String(); s != "Line 5 if x > 3" {
+		t.Errorf("unexpected description: %q", s)
+	}
+	if s := bps[1].String(); s != "Line 12 (at hit 4) [disabled]" {
+		t.Errorf("unexpected description: %q", s)
+	}
+	bps = bps.Remove(12)
+	if _, found := bps.Get(12); found || len(bps) != 2 {
+		t.Errorf("expected the breakpoint at line 12 to be removed, got %v", bps)
+	}
+}
+
+func TestBreakpointHistory(t *testing.T) {
+	origNoWriteToCache := noWriteToCache
+	defer func() {
+		noWriteToCache = origNoWriteToCache
+	}()
+	noWriteToCache = false
+
+	filename := filepath.Join(t.TempDir(), "breakpoints.txt")
+	history := BreakpointHistory{
+		"/home/user/main.c":   {{Line: 3}, {Line: 9, Condition: "a == b\tc", HitCount: 2, Disabled: true}},
+		"/home/user/other.go": {{Line: 14}},
+	}
+	if err := history.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadBreakpointHistory(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 2 || len(loaded["/home/user/main.c"]) != 2 || len(loaded["/home/user/other.go"]) != 1 {
+		t.Fatalf("unexpected breakpoint history: %v", loaded)
+	}
+	if bp := loaded["/home/user/main.c"][1]; bp.Line != 9 || bp.Condition != "a == b\tc" || bp.HitCount != 2 || !bp.Disabled {
+		t.Errorf("unexpected breakpoint: %v", bp)
+	}
+}
+
+func TestGDBBreakInsertArguments(t *testing.T) {
+	if args := strings.Join(gdbBreakInsertArguments("main.c:12", Breakpoint{Line: 12}), " "); args != "main.c:12" {
+		t.Errorf("unexpected arguments: %q", args)
+	}
+	args := strings.Join(gdbBreakInsertArguments("main.c:12", Breakpoint{Line: 12, Condition: "i > 2", HitCount: 3}), " ")
+	if args != "-c i > 2 -i 2 main.c:12" {
+		t.Errorf("unexpected arguments: %q", args)
+	}
+}
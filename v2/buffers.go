@@ -0,0 +1,280 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/xyproto/files"
+	"github.com/xyproto/vt100"
+)
+
+// Buffer is an open file, with its own editor state, cursor position and undo stack
+type Buffer struct {
+	state       *Editor // a copy of the editor state while this buffer is not the active one, otherwise nil
+	undo        *Undo   // the undo history for this buffer, while it is not the active one
+	absFilename string  // the absolute path to the file
+}
+
+// BufferList is a list of open buffers, where one of them is the one that is currently being edited
+type BufferList struct {
+	buffers []*Buffer
+	current int
+}
+
+// openBuffers keeps track of all files that are open in this instance of the editor
+var openBuffers = &BufferList{}
+
+// Len returns the number of open buffers
+func (bl *BufferList) Len() int {
+	return len(bl.buffers)
+}
+
+// Index returns the index of the buffer with the given absolute filename, or -1
+func (bl *BufferList) Index(absFilename string) int {
+	for i, b := range bl.buffers {
+		if b.absFilename == absFilename {
+			return i
+		}
+	}
+	return -1
+}
+
+// Changed checks if this buffer has unsaved changes. Only works for buffers that are not active.
+func (b *Buffer) Changed() bool {
+	if b.state == nil {
+		return false
+	}
+	return b.state.changed.Load()
+}
+
+// registerCurrent makes sure that the file that is currently being edited is in the buffer list
+func (bl *BufferList) registerCurrent(e *Editor) error {
+	absFilename, err := e.AbsFilename()
+	if err != nil {
+		return err
+	}
+	if len(bl.buffers) == 0 {
+		bl.buffers = append(bl.buffers, &Buffer{absFilename: absFilename})
+		bl.current = 0
+		return nil
+	}
+	// The current file may have been changed by e.Switch, for instance when switching between .c and .h files
+	bl.buffers[bl.current].absFilename = absFilename
+	return nil
+}
+
+// remove removes the buffer with the given index from the list, which must not be the current one
+func (bl *BufferList) remove(index int) {
+	bl.buffers = append(bl.buffers[:index], bl.buffers[index+1:]...)
+	if bl.current > index {
+		bl.current--
+	}
+}
+
+// stash stores the state of the current editor and the undo stack in the active buffer
+func (bl *BufferList) stash(e *Editor) {
+	b := bl.buffers[bl.current]
+	b.state = e.Copy()
+	b.undo = undo
+	// Save the current location in the location history and write it to file
+	if locationHistory != nil {
+		e.SaveLocation(b.absFilename, locationHistory)
+	}
+}
+
+// OpenBuffer opens the given file in a new buffer, or switches to it if it is already open.
+// The current buffer is kept as it is, including any unsaved changes.
+func (e *Editor) OpenBuffer(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *LockKeeper, filename string) error {
+	filename = strings.TrimSpace(filename)
+	if filename == "" {
+		return errors.New("no filename given")
+	}
+	if strings.HasPrefix(filename, "~") {
+		fnord := FilenameOrData{filename, []byte{}, 0, false, nil}
+		fnord.ExpandUser()
+		filename = fnord.filename
+	}
+	absFilename, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+	absFilename = filepath.Clean(absFilename)
+	if files.IsDir(absFilename) {
+		return errors.New("can not open directories")
+	}
+	if err := openBuffers.registerCurrent(e); err != nil {
+		return err
+	}
+	if index := openBuffers.Index(absFilename); index >= 0 {
+		return e.SwitchToBuffer(c, tty, status, index)
+	}
+
+	// Lock the new file, if it's not already locked
+	if lk != nil {
+		lk.Load()
+		if err := lk.Lock(absFilename); err != nil {
+			return fmt.Errorf("%s is locked by another instance of this editor", filepath.Base(absFilename))
+		}
+		lk.Save()
+	}
+
+	// Create a new editor for the new file, before stashing the current one
+	fnord := FilenameOrData{filename, []byte{}, 0, false, nil}
+	e2, statusMessage, displayedImage, err := NewEditor(tty, c, fnord, LineNumber(0), ColNumber(0), e.Theme, e.syntaxHighlight, false, e.monitorAndReadOnly, e.nanoMode.Load(), e.createDirectoriesIfMissing, e.displayQuickHelp)
+	if err != nil || displayedImage || e2 == nil {
+		if lk != nil {
+			lk.Unlock(absFilename)
+			lk.Save()
+		}
+		if err == nil && displayedImage {
+			// The file was displayed as an image, or in the hex editor
+			e.redraw.Store(true)
+			e.redrawCursor.Store(true)
+			return nil
+		}
+		if err == nil {
+			err = errors.New("could not open " + filename)
+		}
+		return err
+	}
+
+	openBuffers.stash(e)
+	e.Replace(e2)
+	undo = NewUndo(defaultUndoCount, defaultUndoMemory)
+	undo.LoadHistory(e, absFilename)
+	openBuffers.buffers = append(openBuffers.buffers, &Buffer{absFilename: absFilename})
+	openBuffers.current = openBuffers.Len() - 1
+	go fnord.SetTitle()
+	e.LSPStartInBackground()
+
+	if statusMessage != "" {
+		status.SetMessageAfterRedraw(fmt.Sprintf("%s (%d/%d)", statusMessage, openBuffers.current+1, openBuffers.Len()))
+	}
+	e.redraw.Store(true)
+	e.redrawCursor.Store(true)
+	return nil
+}
+
+// SwitchToBuffer stashes the current buffer and makes the buffer with the given index the active one
+func (e *Editor) SwitchToBuffer(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, index int) error {
+	if err := openBuffers.registerCurrent(e); err != nil {
+		return err
+	}
+	if index < 0 || index >= openBuffers.Len() {
+		return errors.New("no such buffer")
+	}
+	if index == split.otherBufferIndex() {
+		// The file is shown in the other pane
+		return e.FocusOtherPane(c)
+	}
+	if index == openBuffers.current {
+		status.SetMessageAfterRedraw("Already editing " + filepath.Base(openBuffers.buffers[index].absFilename))
+		return nil
+	}
+	b := openBuffers.buffers[index]
+	openBuffers.stash(e)
+	if b.state != nil {
+		e.Replace(b.state)
+	} else {
+		// There is no stored editor state, so load the file again
+		e2, _, _, err := NewEditor(tty, c, FilenameOrData{b.absFilename, []byte{}, 0, false, nil}, LineNumber(0), ColNumber(0), e.Theme, e.syntaxHighlight, false, e.monitorAndReadOnly, e.nanoMode.Load(), e.createDirectoriesIfMissing, e.displayQuickHelp)
+		if err != nil || e2 == nil {
+			// Go back to the buffer that was active
+			e.Replace(openBuffers.buffers[openBuffers.current].state)
+			openBuffers.buffers[openBuffers.current].state = nil
+			if err == nil {
+				err = errors.New("could not open " + b.absFilename)
+			}
+			return err
+		}
+		e.Replace(e2)
+	}
+	undo = b.undo
+	b.state = nil
+	b.undo = nil
+	openBuffers.current = index
+
+	fnord := FilenameOrData{e.filename, []byte{}, 0, false, nil}
+	go fnord.SetTitle()
+	e.LSPStartInBackground()
+
+	status.SetMessageAfterRedraw(fmt.Sprintf("%s (%d/%d)", files.Relative(e.filename), index+1, openBuffers.Len()))
+	e.redraw.Store(true)
+	e.redrawCursor.Store(true)
+	return nil
+}
+
+// NextBuffer switches to the next open buffer, wrapping around at the end of the list
+func (e *Editor) NextBuffer(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) error {
+	if openBuffers.Len() < 2 {
+		return errors.New("only one buffer is open")
+	}
+	return e.SwitchToBuffer(c, tty, status, (openBuffers.current+1)%openBuffers.Len())
+}
+
+// PrevBuffer switches to the previous open buffer, wrapping around at the start of the list
+func (e *Editor) PrevBuffer(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) error {
+	if openBuffers.Len() < 2 {
+		return errors.New("only one buffer is open")
+	}
+	return e.SwitchToBuffer(c, tty, status, (openBuffers.current+openBuffers.Len()-1)%openBuffers.Len())
+}
+
+// BufferMenu lists all open buffers in a menu, and switches to the selected one
+func (e *Editor) BufferMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) error {
+	if err := openBuffers.registerCurrent(e); err != nil {
+		return err
+	}
+	choices := make([]string, openBuffers.Len())
+	for i, b := range openBuffers.buffers {
+		changed := b.Changed()
+		if i == openBuffers.current {
+			changed = e.changed.Load()
+		}
+		choices[i] = files.Relative(b.absFilename)
+		if changed {
+			choices[i] += " (modified)"
+		}
+	}
+	const extraDashes = false
+	selected, _ := e.Menu(status, tty, "Buffers", choices, e.Background, e.MenuTitleColor, e.MenuArrowColor, e.MenuTextColor, e.MenuHighlightColor, e.MenuSelectedColor, openBuffers.current, extraDashes)
+	e.redraw.Store(true)
+	e.redrawCursor.Store(true)
+	if selected < 0 || selected == openBuffers.current {
+		return nil
+	}
+	return e.SwitchToBuffer(c, tty, status, selected)
+}
+
+// UnsavedBuffers returns the filenames of the buffers that are not active and that have unsaved changes,
+// including the file in the other pane if the view is split
+func (e *Editor) UnsavedBuffers() []string {
+	var unsaved []string
+	for i, b := range openBuffers.buffers {
+		if i != openBuffers.current && b.Changed() {
+			unsaved = append(unsaved, filepath.Base(b.absFilename))
+		}
+	}
+	// The other pane may show another file, if the view is split
+	if split != nil && !split.sameFile && split.other.changed.Load() {
+		unsaved = append(unsaved, filepath.Base(split.other.filename))
+	}
+	return unsaved
+}
+
+// CloseBuffers unlocks the files of all buffers that are not active, which includes the file in the other pane
+// if the view is split. The active buffer is handled by CloseLocksAndLocationHistory.
+func (e *Editor) CloseBuffers(lk *LockKeeper) {
+	if openBuffers.Len() < 2 {
+		return
+	}
+	lk.Load()
+	for i, b := range openBuffers.buffers {
+		if i != openBuffers.current {
+			lk.Unlock(b.absFilename)
+		}
+	}
+	lk.Save()
+}
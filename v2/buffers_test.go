@@ -0,0 +1,38 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestBufferList(t *testing.T) {
+	bl := &BufferList{}
+	e := NewSimpleEditor(80)
+	e.filename = "a.txt"
+	e.InsertStringAndMove(nil, "hello")
+	if err := bl.registerCurrent(e); err != nil {
+		t.Fatal(err)
+	}
+	absFilename, _ := filepath.Abs("a.txt")
+	if bl.Len() != 1 || bl.Index(absFilename) != 0 {
+		t.Fatalf("expected a.txt to be registered as the first buffer")
+	}
+
+	// Stash the current buffer and check that the unsaved changes are remembered
+	orig := undo
+	defer func() { undo = orig }()
+	bl.stash(e)
+	if !bl.buffers[0].Changed() {
+		t.Errorf("expected the stashed buffer to have unsaved changes")
+	}
+
+	// Restore the buffer into a different editor
+	e2 := NewSimpleEditor(80)
+	e2.Replace(bl.buffers[0].state)
+	if e2.String() != "hello\n" {
+		t.Errorf("unexpected contents after restoring: %q", e2.String())
+	}
+	if bl.Index("/nonexistent") != -1 {
+		t.Errorf("expected -1 for a file that is not open")
+	}
+}
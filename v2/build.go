@@ -264,6 +264,25 @@ func (e *Editor) GenerateBuildCommand(c *vt100.Canvas, tty *vt100.TTY, filename
 			// thanks @cespare at github https://github.com/golang/go/issues/15513#issuecomment-216410016
 			cmd = exec.Command("go", "test", "-run", "xxxxxxx")
 		}
+		if e.debugMode {
+			// Build an executable without optimizations, that can be stepped through with Delve
+			const debugFlags = "-gcflags=all=-N -l"
+			if strings.HasSuffix(sourceFilename, "_test.go") {
+				testExeFirstName := exeFirstName + ".test"
+				cmd = exec.Command("go", "test", "-c", debugFlags, "-o", testExeFirstName)
+				cmd.Dir = sourceDir
+				return cmd, func() (bool, string) {
+					return files.IsFile(filepath.Join(sourceDir, testExeFirstName)), testExeFirstName
+				}, nil
+			}
+			if hasGoMod {
+				cmd = exec.Command("go", "build", debugFlags, "-o", exeFirstName)
+			} else {
+				cmd = exec.Command("go", "build", debugFlags, "-o", exeFirstName, sourceFilename)
+			}
+			cmd.Dir = sourceDir
+			return cmd, exeExists, nil
+		}
 		cmd.Dir = sourceDir
 		return cmd, everythingIsFine, nil
 	case mode.Hare:
@@ -748,6 +767,25 @@ func (e *Editor) BuildOrExport(tty *vt100.TTY, c *vt100.Canvas, status *StatusBa
 		return "", nil
 	}
 
+	// Collect all errors and warnings, so that ctrl-n and ctrl-p can jump between them
+	buildDir := cmd.Dir
+	if buildDir == "" {
+		buildDir = sourceDir
+	}
+	quickfix.Set(ParseDiagnostics(string(output), buildDir))
+	if err == nil {
+		// Don't show the panel, but keep any warnings, so that they can be shown with the errorlist command.
+		// ctrl-n and ctrl-p only jump between the diagnostics when the panel is shown.
+		quickfix.Hide()
+	}
+
+	// For compilers with well known output formats, jump to the first error in the quickfix list
+	if err != nil && quickfixModes[e.mode] {
+		if err := e.firstDiagnosticError(c, status); err != nil {
+			return "", err
+		}
+	}
+
 	// Did the command return a non-zero status code, or does the output contain "error:"?
 	if err != nil || bytes.Contains(output, []byte(errorMarker)) { // failed tests also end up here
 
@@ -1174,7 +1212,7 @@ func (e *Editor) Build(c *vt100.Canvas, status *StatusBar, tty *vt100.TTY) {
 	}
 
 	// debug stepping
-	if e.debugMode && e.gdb != nil {
+	if e.debugMode && e.debugger != nil {
 		if !programRunning {
 			e.DebugEnd()
 			status.SetMessage("Program stopped")
@@ -1184,10 +1222,12 @@ func (e *Editor) Build(c *vt100.Canvas, status *StatusBar, tty *vt100.TTY) {
 			return
 		}
 		status.ClearAll(c, false)
-		// If we have a breakpoint, continue to it
-		if e.breakpoint != nil { // exists
+		// If we have breakpoints, continue to the next one
+		if len(e.breakpoints.Enabled()) > 0 {
 			// continue forward to the end or to the next breakpoint
-			if err := e.DebugContinue(); err != nil {
+			if err := e.DebugContinue(); err == errProgramRunning {
+				status.SetMessage(capitalizeFirst(err.Error()))
+			} else if err != nil {
 				// logf("[continue] gdb output: %s\n", gdbOutput)
 				e.DebugEnd()
 				status.SetMessage("Done")
@@ -1197,7 +1237,9 @@ func (e *Editor) Build(c *vt100.Canvas, status *StatusBar, tty *vt100.TTY) {
 			}
 		} else { // if not, make one step
 			err := e.DebugStep()
-			if err != nil {
+			if err == errProgramRunning {
+				status.SetMessage(capitalizeFirst(err.Error()))
+			} else if err != nil {
 				if errorMessage := err.Error(); strings.Contains(errorMessage, "is not being run") {
 					e.DebugEnd()
 					status.SetMessage("Done stepping")
@@ -1332,6 +1374,9 @@ func (e *Editor) Build(c *vt100.Canvas, status *StatusBar, tty *vt100.TTY) {
 			// Error while building
 			status.SetError(err)
 			status.ShowNoTimeout(c, e)
+			// Show all build errors, if there are more than one
+			const repositionCursorAfterDrawing = true
+			e.DrawQuickfix(c, repositionCursorAfterDrawing)
 			e.redrawCursor.Store(true)
 			return // return from goroutine
 		}
@@ -1341,7 +1386,7 @@ func (e *Editor) Build(c *vt100.Canvas, status *StatusBar, tty *vt100.TTY) {
 		// --- success ---
 
 		// ctrl-space was pressed while in debug mode, and without a debug session running
-		if e.debugMode && e.gdb == nil {
+		if e.debugMode && e.debugger == nil {
 			if err := e.DebugStartSession(c, tty, status, outputExecutable); err != nil {
 				status.ClearAll(c, true)
 				status.SetError(err)
@@ -22,7 +22,7 @@ func ExampleEditor_BuildOrExport_goError() {
 	os.Chdir("..")
 	fmt.Printf("err.go [compilation error: %v] %s\n", err, outputExecutable)
 	// Output:
-	// err.go [compilation error:  undefined: asdfasdf]
+	// err.go [compilation error: undefined: asdfasdf]
 }
 
 func TestBuildOrExport(t *testing.T) {
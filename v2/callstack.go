@@ -0,0 +1,234 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/xyproto/vt100"
+)
+
+var (
+	selectedStackFrame int                     // the index of the selected frame in the call stack, 0 is the innermost frame
+	expandedLocals     = make(map[string]bool) // local variables that are expanded in the locals pane, by path, like "p.inner"
+)
+
+// debugPaneLayout returns the pane layout that is in use, which is the call stack and locals layout
+// if the register layouts are selected but there are no registers, like when using Delve or a DAP adapter
+func (e *Editor) debugPaneLayout() int {
+	if e.debugShowRegisters < stackWindow && e.gdbSession() == nil {
+		return stackWindow
+	}
+	return e.debugShowRegisters
+}
+
+// nextDebugPaneLayout cycles between the pane layouts that are available for the current debugger backend
+func (e *Editor) nextDebugPaneLayout() {
+	e.debugShowRegisters = e.debugPaneLayout() + 1
+	if e.debugShowRegisters > noRegisterWindow {
+		e.debugShowRegisters = smallRegisterWindow
+	}
+}
+
+// formatStackFrame returns a short description of a stack frame, like "main (main.c:12)"
+func formatStackFrame(frame StackFrame) string {
+	if frame.Filename == "" || frame.Line <= 0 {
+		return frame.Function
+	}
+	return fmt.Sprintf("%s (%s:%d)", frame.Function, filepath.Base(frame.Filename), frame.Line)
+}
+
+// flattenLocals returns one line of text per local variable, with the children of expanded variables indented below.
+// The returned paths are the paths of variables that can be expanded or collapsed, or "" for the other lines.
+func flattenLocals(locals []DebugVariable, parentPath, indentation string) (lines, paths []string) {
+	for _, v := range locals {
+		path := v.Name
+		if parentPath != "" {
+			path = parentPath + "." + v.Name
+		}
+		if len(v.Children) == 0 {
+			lines = append(lines, indentation+"  "+v.Name+": "+v.Value)
+			paths = append(paths, "")
+			continue
+		}
+		if !expandedLocals[path] {
+			lines = append(lines, indentation+"+ "+v.Name+": "+v.Value)
+			paths = append(paths, path)
+			continue
+		}
+		lines = append(lines, indentation+"- "+v.Name+":")
+		paths = append(paths, path)
+		childLines, childPaths := flattenLocals(v.Children, path, indentation+"  ")
+		lines = append(lines, childLines...)
+		paths = append(paths, childPaths...)
+	}
+	return lines, paths
+}
+
+// trimToWidth shortens the given lines so that they fit within the given width
+func trimToWidth(lines []string, width int) []string {
+	if width < 4 {
+		return lines
+	}
+	for i, line := range lines {
+		if runes := []rune(line); len(runes) > width {
+			lines[i] = string(runes[:width-3]) + "..."
+		}
+	}
+	return lines
+}
+
+// DrawCallStack will draw the call stack and the local variables of the selected frame in the lower right
+func (e *Editor) DrawCallStack(c *vt100.Canvas, repositionCursor bool) {
+	if e.debugPaneLayout() != stackWindow {
+		return
+	}
+	sd, ok := e.debugger.(stackDebugger)
+	if !ok {
+		return
+	}
+
+	defer func() {
+		// Reposition the cursor
+		if repositionCursor {
+			e.EnableAndPlaceCursor(c)
+		}
+	}()
+
+	frames := sd.StackFrames()
+	locals := sd.Locals()
+
+	// First create a box the size of the entire canvas
+	canvasBox := NewCanvasBox(c)
+
+	// Place the call stack in the upper part of the lower right area, and the local variables below it
+	const minWidth = 32
+	stackBox := NewBox()
+	stackBox.LowerRightPlacement(canvasBox, minWidth)
+	if showInstructionPane {
+		stackBox.H = int(float64(stackBox.H) * 0.9)
+	}
+	localsBox := NewBox()
+	localsBox.Fill(stackBox)
+	stackBox.H /= 2
+	localsBox.Y += stackBox.H
+	localsBox.H -= stackBox.H
+	e.redraw.Store(true)
+
+	// Get the current theme for the boxes
+	bt := e.NewBoxTheme()
+	bt.Background = &e.DebugRegistersBackground
+
+	// Draw the call stack, with the selected frame highlighted
+	listBox := NewBox()
+	listBox.FillWithMargins(stackBox, 2, 1)
+	e.DrawBox(bt, c, stackBox)
+	e.DrawTitle(bt, c, stackBox, "Call stack", true)
+	stackLines := make([]string, 0, len(frames))
+	for _, frame := range frames {
+		stackLines = append(stackLines, formatStackFrame(frame))
+	}
+	selected := selectedStackFrame
+	if len(stackLines) > listBox.H && listBox.H > 0 {
+		// Scroll down to the selected frame, if needed
+		offset := 0
+		if selected >= listBox.H {
+			offset = selected - listBox.H + 1
+		}
+		stackLines = stackLines[offset : offset+listBox.H]
+		selected -= offset
+	}
+	e.DrawList(bt, c, listBox, trimToWidth(stackLines, listBox.W), selected)
+
+	// Draw the local variables of the selected frame
+	listBox.FillWithMargins(localsBox, 2, 1)
+	e.DrawBox(bt, c, localsBox)
+	e.DrawTitle(bt, c, localsBox, "Locals", true)
+	localLines, _ := flattenLocals(locals, "", "")
+	if len(localLines) > listBox.H && listBox.H > 0 {
+		localLines = localLines[:listBox.H]
+	}
+	e.DrawList(bt, c, listBox, trimToWidth(localLines, listBox.W), -1)
+
+	// Blit
+	c.HideCursorAndDraw()
+}
+
+// SelectStackFrameMenu lets the user select a frame in the call stack, and then jumps to the source line of that frame
+func (e *Editor) SelectStackFrameMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) error {
+	sd, ok := e.debugger.(stackDebugger)
+	if !ok {
+		return errors.New("the debugger can not list the call stack")
+	}
+	frames := sd.StackFrames()
+	if len(frames) == 0 {
+		return errors.New("no call stack")
+	}
+	choices := make([]string, len(frames))
+	for i, frame := range frames {
+		choices[i] = formatStackFrame(frame)
+	}
+	initialIndex := selectedStackFrame
+	if initialIndex >= len(frames) {
+		initialIndex = 0
+	}
+	const extraDashes = false
+	selected, _ := e.Menu(status, tty, "Call stack", choices, e.Background, e.MenuTitleColor, e.MenuArrowColor, e.MenuTextColor, e.MenuHighlightColor, e.MenuSelectedColor, initialIndex, extraDashes)
+	e.redraw.Store(true)
+	e.redrawCursor.Store(true)
+	if selected < 0 {
+		return nil
+	}
+	if err := sd.SelectFrame(selected); err != nil {
+		return err
+	}
+	selectedStackFrame = selected
+
+	// Jump to the source line of the selected frame, if it is in the current file
+	frame := frames[selected]
+	if frame.Line <= 0 {
+		return nil
+	}
+	if frame.Filename != "" {
+		if absFilename, err := e.AbsFilename(); err == nil && filepath.Clean(frame.Filename) != absFilename {
+			status.SetMessageAfterRedraw(fmt.Sprintf("%s is at %s:%d", frame.Function, frame.Filename, frame.Line))
+			return nil
+		}
+	}
+	e.GoToLineNumber(frame.Line, c, status, true)
+	return nil
+}
+
+// ToggleLocalMenu lets the user select a local variable with fields or elements, and then expands or collapses it
+func (e *Editor) ToggleLocalMenu(tty *vt100.TTY, status *StatusBar) error {
+	sd, ok := e.debugger.(stackDebugger)
+	if !ok {
+		return errors.New("the debugger can not list local variables")
+	}
+	lines, paths := flattenLocals(sd.Locals(), "", "")
+	var choices, choicePaths []string
+	for i, path := range paths {
+		if path != "" {
+			choices = append(choices, strings.TrimSpace(lines[i]))
+			choicePaths = append(choicePaths, path)
+		}
+	}
+	if len(choices) == 0 {
+		return errors.New("no local variables that can be expanded")
+	}
+	const extraDashes = false
+	selected, _ := e.Menu(status, tty, "Expand or collapse", choices, e.Background, e.MenuTitleColor, e.MenuArrowColor, e.MenuTextColor, e.MenuHighlightColor, e.MenuSelectedColor, 0, extraDashes)
+	e.redraw.Store(true)
+	e.redrawCursor.Store(true)
+	if selected < 0 {
+		return nil
+	}
+	path := choicePaths[selected]
+	if expandedLocals[path] {
+		delete(expandedLocals, path)
+	} else {
+		expandedLocals[path] = true
+	}
+	return nil
+}
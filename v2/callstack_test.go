@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseGDBValue(t *testing.T) {
+	if children := parseGDBValue("42"); children != nil {
+		t.Errorf("expected no fields for a number, got %v", children)
+	}
+	children := parseGDBValue(`{x = 1, name = 0x4005d4 "a, b", inner = {a = 2, b = {3, 4}}}`)
+	if len(children) != 3 {
+		t.Fatalf("expected three fields, got %v", children)
+	}
+	if children[0].Name != "x" || children[0].Value != "1" {
+		t.Errorf("unexpected first field: %v", children[0])
+	}
+	if children[1].Name != "name" || children[1].Value != `0x4005d4 "a, b"` {
+		t.Errorf("unexpected string field: %v", children[1])
+	}
+	inner := children[2]
+	if inner.Name != "inner" || len(inner.Children) != 2 {
+		t.Fatalf("unexpected nested struct: %v", inner)
+	}
+	if elements := inner.Children[1].Children; len(elements) != 2 || elements[1].Name != "[1]" || elements[1].Value != "4" {
+		t.Errorf("unexpected array elements: %v", elements)
+	}
+}
+
+func TestFlattenLocals(t *testing.T) {
+	defer func() {
+		expandedLocals = make(map[string]bool)
+	}()
+	locals := []DebugVariable{
+		{Name: "i", Value: "3"},
+		{Name: "p", Value: "{x = 1}", Children: []DebugVariable{{Name: "x", Value: "1"}}},
+	}
+	lines, paths := flattenLocals(locals, "", "")
+	if strings.Join(lines, "|") != "  i: 3|+ p: {x = 1}" || strings.Join(paths, "|") != "|p" {
+		t.Errorf("unexpected collapsed locals: %q %q", lines, paths)
+	}
+	expandedLocals["p"] = true
+	lines, _ = flattenLocals(locals, "", "")
+	if strings.Join(lines, "|") != "  i: 3|- p:|    x: 1" {
+		t.Errorf("unexpected expanded locals: %q", lines)
+	}
+}
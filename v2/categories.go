@@ -69,3 +69,12 @@ func (e *Editor) CanRun() bool {
 	}
 	return true
 }
+
+// Prose returns true if the current mode is for text where paragraphs can be reflowed, also outside of comments
+func (e *Editor) Prose() bool {
+	switch e.mode {
+	case mode.ASCIIDoc, mode.Blank, mode.Email, mode.Git, mode.Markdown, mode.ReStructured, mode.SCDoc, mode.Text:
+		return true
+	}
+	return false
+}
@@ -50,12 +50,17 @@ func (e *Editor) UserSave(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) {
 	// Save the current location in the location history and write it to file
 	if absFilename, err := e.AbsFilename(); err == nil { // no error
 		e.SaveLocation(absFilename, locationHistory)
+		// Store the undo history together with the hash of the saved file, if persistent undo is enabled
+		undo.SaveHistory(e, absFilename)
 	}
 
 	// Status message
 	status.Clear(c, true)
 	status.SetMessage("Saved " + e.filename)
 	status.Show(c, e)
+
+	// Show any problems that are reported by the language server, when they arrive
+	e.LSPCheckDiagnostics(c, status)
 }
 
 // Add will add an action title and an action function
@@ -126,11 +131,33 @@ func (e *Editor) CommandMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar,
 	// TODO: Add the 6 first arguments to a context struct instead
 	actions.AddCommand(e, c, tty, status, bookmark, undo, "Save and quit", "savequitclear")
 
-	actions.AddCommand(e, c, tty, status, bookmark, undo, "Sort the current block of lines", "sortblock")
+	if e.selection != nil {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Sort the selected lines", "sortblock")
+	} else {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Sort the current block of lines", "sortblock")
+	}
 	actions.AddCommand(e, c, tty, status, bookmark, undo, "Sort strings on the current line", "sortwords")
 
 	actions.AddCommand(e, c, tty, status, bookmark, undo, "Insert \""+insertFilename+"\" at the current line", "insertfile", insertFilename)
 
+	// Open another file in a new buffer
+	actions.Add("Open file...", func() {
+		if filename, ok := e.UserInput(c, tty, status, "Open file", "", []string{}, false, ""); ok && strings.TrimSpace(filename) != "" {
+			if err := e.OpenBuffer(c, tty, status, lk, filename); err != nil {
+				status.SetErrorAfterRedraw(err)
+			}
+		}
+	})
+
+	// List the open buffers, if there are more than one
+	if openBuffers.Len() > 1 {
+		actions.Add(fmt.Sprintf("Switch buffer (%d open)", openBuffers.Len()), func() {
+			if err := e.BufferMenu(c, tty, status); err != nil {
+				status.SetErrorAfterRedraw(err)
+			}
+		})
+	}
+
 	actions.Add("Toggle column limit indicator", func() {
 		e.showColumnLimit = !e.showColumnLimit
 	})
@@ -192,8 +219,74 @@ func (e *Editor) CommandMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar,
 		})
 	}
 
+	// Soft wrap long lines, without changing the text
+	if e.softWrap {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Disable soft wrap", "softwrap")
+	} else {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Soft wrap long lines", "softwrap")
+	}
+
+	// Reflow the current paragraph or comment
+	if _, _, err := e.paragraphAt(e.DataY()); err == nil {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Reflow this paragraph", "reflow")
+	}
+
+	// Edit the bytes of the file in the hex editor
+	if !e.changed.Load() && files.Exists(e.filename) {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Hex edit this file", "hex")
+	}
+
+	// Convert the character encoding or the line endings that the file will be saved with
+	if !e.binaryFile {
+		if e.fileFormat.charset != charsetUTF8 || e.fileFormat.bom {
+			actions.AddCommand(e, c, tty, status, bookmark, undo, "Convert from "+e.fileFormat.charset.String()+" to UTF-8", "utf8")
+		}
+		if e.fileFormat.mixed {
+			actions.AddCommand(e, c, tty, status, bookmark, undo, "Convert the mixed line endings to LF", "lf")
+		} else if lineEndingName(e.fileFormat.lineEnding) != "LF" {
+			actions.AddCommand(e, c, tty, status, bookmark, undo, "Convert from "+lineEndingName(e.fileFormat.lineEnding)+" to LF line endings", "lf")
+		}
+		if e.HasLookalikeCharacters() {
+			actions.AddCommand(e, c, tty, status, bookmark, undo, "Replace non-breaking spaces and look-alike characters", "fixchars")
+		}
+	}
+
 	actions.AddCommand(e, c, tty, status, bookmark, undo, "Copy all text to the clipboard", "copyall")
 
+	// Start a selection, or stop the current selection
+	if e.selection != nil {
+		actions.Add("Stop selecting", func() {
+			e.ClearSelection()
+			e.redraw.Store(true)
+		})
+	} else {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Select characters", "select")
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Select lines", "selectlines")
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Select a rectangle", "selectrect")
+	}
+
+	// Add cursors, or stop editing with several cursors
+	if e.multiCursor != nil {
+		actions.Add("Stop editing with several cursors", func() {
+			e.ClearCursors()
+			e.redraw.Store(true)
+		})
+	}
+	actions.AddCommand(e, c, tty, status, bookmark, undo, "Add a cursor at the next occurrence of this word", "cursorword")
+	actions.AddCommand(e, c, tty, status, bookmark, undo, "Add a cursor on the line below", "cursorbelow")
+
+	// Fold or unfold the code
+	if _, closed := e.closedFoldAt(e.DataY()); closed {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Open this fold", "fold")
+	} else {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Fold this block", "fold")
+	}
+	if len(e.folds) > 0 {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Open all folds", "foldall")
+	} else {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Fold all blocks", "foldall")
+	}
+
 	if bookmark != nil {
 		actions.AddCommand(e, c, tty, status, bookmark, undo, "Copy text from the bookmark to the cursor", "copymark")
 	}
@@ -211,6 +304,30 @@ func (e *Editor) CommandMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar,
 				})
 			}
 		}
+		// List, change, disable or delete breakpoints
+		e.LoadBreakpoints()
+		if len(e.breakpoints) > 0 {
+			actions.Add("Breakpoints", func() {
+				if err := e.BreakpointMenu(c, tty, status); err != nil {
+					status.SetErrorAfterRedraw(err)
+				}
+			})
+		}
+		// Select a stack frame or expand local variables, if the debugger backend can list them
+		if sd, ok := e.debugger.(stackDebugger); ok && programRunning {
+			if len(sd.StackFrames()) > 1 {
+				actions.Add("Select a stack frame", func() {
+					if err := e.SelectStackFrameMenu(c, tty, status); err != nil {
+						status.SetErrorAfterRedraw(err)
+					}
+				})
+			}
+			actions.Add("Expand or collapse a local variable", func() {
+				if err := e.ToggleLocalMenu(tty, status); err != nil {
+					status.SetErrorAfterRedraw(err)
+				}
+			})
+		}
 	}
 
 	// Delete the rest of the file
@@ -228,24 +345,59 @@ func (e *Editor) CommandMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar,
 		// Get the current index and remove the rest of the lines
 		currentLineIndex := int(e.DataY())
 
-		for y := range e.lines {
-			if y >= currentLineIndex {
-				// Run the prepareFunction, but only once, if there was changes to be made
-				if prepareFunction != nil {
-					prepareFunction()
-					prepareFunction = nil
-				}
-				delete(e.lines, y)
-			}
+		if currentLineIndex < e.Len() {
+			// Run the prepareFunction, since there are changes to be made
+			prepareFunction()
+			e.lines.Truncate(currentLineIndex)
 		}
 
 		if e.changed.Load() {
-			e.MakeConsistent()
 			e.redraw.Store(true)
 			e.redrawCursor.Store(true)
 		}
 	})
 
+	// Split the view in two panes, or close the other pane
+	if split == nil {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Split view horizontally", "hsplit")
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Split view vertically", "vsplit")
+		if e.mode == mode.C || e.mode == mode.Cpp || e.mode == mode.ObjC {
+			actions.Add("Split view with the corresponding header or source file", func() {
+				correspondingFilename, err := e.CorrespondingFile()
+				if err == nil {
+					err = e.SplitView(c, tty, status, fileLock, splitVertical, correspondingFilename)
+				}
+				if err != nil {
+					status.SetErrorAfterRedraw(err)
+				}
+			})
+		}
+	} else {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Switch to the other pane", "otherpane")
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Close the other pane", "unsplit")
+	}
+
+	// Find a file in the project and open it in a new buffer
+	actions.AddCommand(e, c, tty, status, bookmark, undo, "Find file in project", "findfile")
+
+	// Search in all files in the project, and show the results of the last project search
+	actions.AddCommand(e, c, tty, status, bookmark, undo, "Search in project", "searchproject")
+	if projectSearch != nil {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Project search results", "searchresults")
+	}
+
+	// Replace in all files in the project, and revert the last project replace
+	actions.AddCommand(e, c, tty, status, bookmark, undo, "Replace in project", "replaceproject")
+	if lastProjectReplace != nil {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Revert the last project replace", "revertreplace")
+	}
+
+	// Find references and show information about the current symbol, if a language server is available
+	if e.LSPServerCommand() != nil {
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Find references", "references")
+		actions.AddCommand(e, c, tty, status, bookmark, undo, "Show info for the current symbol", "hover")
+	}
+
 	actions.Add("Block edit", func() {
 		e.blockMode = !e.blockMode
 	})
@@ -263,18 +415,18 @@ func (e *Editor) CommandMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar,
 		}
 	}
 
-	// Find the path to either "rust-gdb" or "gdb", depending on the mode, then check if it's there
-	foundGDB := e.findGDB() != ""
+	// Find the path to either "dlv", "rust-gdb", "gdb" or a DAP adapter, depending on the mode, then check if it's there
+	foundDebugger := e.findDebugger() != ""
 
-	// Debug mode on/off, if gdb is found and the mode is tested
-	if foundGDB && e.UsingGDBMightWork() {
+	// Debug mode on/off, if a debugger is found and the mode is tested
+	if foundDebugger && (e.UsingGDBMightWork() || !e.useGDB()) {
 		if e.debugMode {
 			actions.Add("Exit debug mode", func() {
 				status.Clear(c, false)
 				status.SetMessage("Debug mode disabled")
 				status.Show(c, e)
 				e.debugMode = false
-				// Also end the gdb session if there is one in progress
+				// Also end the debug session if there is one in progress
 				e.DebugEnd()
 				status.SetMessageAfterRedraw("Normal mode")
 			})
@@ -285,6 +437,8 @@ func (e *Editor) CommandMenu(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar,
 				e.UserSave(c, tty, status)
 				status.SetMessageAfterRedraw("Debug mode enabled")
 				e.debugMode = true
+				// Restore the breakpoints from earlier sessions
+				e.LoadBreakpoints()
 			})
 		}
 	}
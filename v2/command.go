@@ -33,7 +33,11 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 				cmd.Args = args[1:]
 			}
 
-			// Now run the cmd with the current block of lines as input
+			// Now run the cmd with the selected text, or the current block of lines, as input
+			input := e.Block(e.LineIndex())
+			if e.selection != nil {
+				input = e.SelectedText()
+			}
 			stdin, err := cmd.StdinPipe()
 			if err != nil {
 				status.Clear(c, false)
@@ -43,7 +47,7 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 			}
 			go func() {
 				defer stdin.Close()
-				io.WriteString(stdin, e.Block(e.LineIndex()))
+				io.WriteString(stdin, input)
 			}()
 
 			// Gather the output in the same way as CombinedOutput and Run
@@ -94,6 +98,11 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 			}
 
 			undo.Snapshot(e)
+			if e.selection != nil {
+				// The selected text has no trailing newline, and most commands add one
+				e.ReplaceSelection(c, status, strings.TrimSuffix(outputString, "\n"))
+				return
+			}
 			e.ReplaceBlock(c, status, bookmark, outputString)
 		}, nil
 	}
@@ -104,6 +113,16 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 		if len(args) != 2 {
 			return nil, fmt.Errorf("%s requires a filename as the second argument", trimmedCommand)
 		}
+	case "e", "ed", "edit", "o", "open":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("%s requires a filename as the second argument", trimmedCommand)
+		}
+	case "grep", "rg", "searchproject", "findinproject", "fip":
+		// the search query is optional
+	case "hsplit", "hs", "vsplit", "vs":
+		// the filename is optional
+	case "replaceproject", "replaceinproject", "rip":
+		// the search query is optional
 	default:
 		if len(args) != 1 {
 			return nil, fmt.Errorf("%s takes no arguments", args[0])
@@ -112,30 +131,69 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 
 	const (
 		nothing = iota
+		buffers
 		build
 		copyall
 		copymark
 		copy200
+		crlf
+		cursorbelow
+		cursorword
+		errorlist
+		findfile
+		fixchars
+		fold
+		foldall
 		gobacktofunc
 		help
+		hexedit
+		hsplit
+		hover
 		insertdate
 		insertfile
 		inserttime
 		insertdateandtime
+		lf
+		nextbuffer
+		nexterror
+		openfile
+		otherpane
+		prevbuffer
+		preverror
 		quit
+		redo
+		reflow
+		references
+		replaceproject
+		revertreplace
 		runmake
 		save
 		savequit
 		savequitclear
+		searchproject
+		searchresults
+		selectchars
+		selectlines
+		selectrect
+		softwrap
 		sortblock
 		sortstrings
 		spellcheck
 		splitline
+		undoedit
+		unsplit
+		utf8
 		version
+		vsplit
 	)
 
 	// Define args and corresponding functions
 	commandLookup := map[int]func(){
+		buffers: func() { // list the open buffers and switch to the selected one
+			if err := e.BufferMenu(c, tty, status); err != nil {
+				status.SetErrorAfterRedraw(err)
+			}
+		},
 		build: func() { // build
 			if e.Empty() {
 				// Empty file, nothing to build
@@ -245,6 +303,7 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 			}
 			const forward = false
 			const wrap = true
+			e.UseLiteralSearch()
 			e.SetSearchTerm(c, status, s, false) // no timeout
 			// Perform the actual search
 			if err := e.GoToNextMatch(c, status, wrap, forward); err == errNoSearchMatch {
@@ -256,9 +315,49 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 				}
 			}
 		},
+		cursorbelow: func() { // add a cursor on the line below the lowest cursor
+			if err := e.AddCursorBelow(); err != nil {
+				status.SetErrorAfterRedraw(err)
+				return
+			}
+			status.SetMessageAfterRedraw(fmt.Sprintf("%d cursors, esc to stop", e.MultiCursorCount()))
+			e.redraw.Store(true)
+		},
+		cursorword: func() { // add a cursor at the next occurrence of the word at the cursor
+			if err := e.AddCursorAtNextMatch(); err != nil {
+				status.SetErrorAfterRedraw(err)
+				return
+			}
+			status.SetMessageAfterRedraw(fmt.Sprintf("%d cursors, esc to stop", e.MultiCursorCount()))
+			e.redraw.Store(true)
+		},
+		fold: func() { // open the closed fold at the current line, or close the innermost fold around it
+			if err := e.ToggleFold(); err != nil {
+				status.SetErrorAfterRedraw(err)
+			}
+		},
+		foldall: func() { // open all closed folds, or close all the outermost folds
+			if n, closed := e.ToggleAllFolds(); closed {
+				status.SetMessageAfterRedraw(fmt.Sprintf("Closed %d folds", n))
+			} else {
+				status.SetMessageAfterRedraw(fmt.Sprintf("Opened %d folds", n))
+			}
+		},
+		errorlist: func() { // show the errors and warnings from the last build
+			if quickfix.Len() == 0 {
+				status.SetMessageAfterRedraw("No build errors")
+				return
+			}
+			quickfix.visible = true
+			e.redraw.Store(true)
+			e.redrawCursor.Store(true)
+		},
 		help: func() { // display an informative status message
 			// TODO: Draw the same type of box that is used in debug mode, listing all possible commands
-			status.SetMessageAfterRedraw("sq, wq, savequit, s, save, q, quit, h, help, sort, v, version, date, insertfile [filename], build")
+			status.SetMessageAfterRedraw("sq, wq, savequit, s, save, q, quit, h, help, sort, v, version, select, selectlines, selectrect, cursorbelow, cursorword, fold, foldall, reflow, softwrap, utf8, lf, crlf, fixchars, hex, date, insertfile [filename], build, errors, cn, cp, grep [text], results, rip [text], revertreplace, refs, hover, e [filename], ff, hsplit [filename], vsplit [filename], unsplit, ls, bn, undo, redo")
+		},
+		hover: func() { // show information about the symbol under the cursor, from the language server
+			e.LSPHover(status)
 		},
 		insertdate: func() { // insert the current date
 			undo.Snapshot(e)
@@ -293,6 +392,68 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 			e.InsertString(c, dateString+" "+timeString)
 			e.addSpace = true
 		},
+		searchproject: func() { // search in all files in the project
+			var err error
+			if query := strings.Join(args[1:], " "); query != "" {
+				e.searchOptions = searchOptions
+				err = e.SearchProject(c, tty, status, query)
+			} else {
+				err = e.ProjectSearchPrompt(c, tty, status)
+			}
+			if err != nil {
+				status.SetErrorAfterRedraw(err)
+			}
+			e.redraw.Store(true)
+			e.redrawCursor.Store(true)
+		},
+		replaceproject: func() { // search and replace in all files in the project, asking about each match
+			var err error
+			if query := strings.Join(args[1:], " "); query != "" {
+				e.searchOptions = searchOptions
+				if replacement, ok := e.UserInput(c, tty, status, "Replace "+query+" with", "", []string{}, false, ""); ok {
+					err = e.ReplaceInProject(c, tty, status, undo, query, replacement)
+				}
+			} else {
+				err = e.ProjectReplacePrompt(c, tty, status, undo)
+			}
+			if err != nil {
+				status.SetErrorAfterRedraw(err)
+			}
+			e.redraw.Store(true)
+			e.redrawCursor.Store(true)
+		},
+		revertreplace: func() { // revert all changes made by the last project replace
+			if err := e.RevertProjectReplace(status, undo); err != nil {
+				status.SetErrorAfterRedraw(err)
+			}
+			e.redraw.Store(true)
+			e.redrawCursor.Store(true)
+		},
+		searchresults: func() { // show the results of the last project search
+			if err := e.ProjectSearchResults(c, tty, status); err != nil {
+				status.SetErrorAfterRedraw(err)
+			}
+			e.redraw.Store(true)
+			e.redrawCursor.Store(true)
+		},
+		reflow: func() { // rewrap the paragraph or comment at the cursor to the word wrap width
+			undo.Snapshot(e)
+			if err := e.ReflowParagraph(c, status); err != nil {
+				status.SetErrorAfterRedraw(err)
+			}
+		},
+		redo: func() { // redo the edit that was undone most recently
+			if err := undo.Redo(e); err != nil {
+				status.SetErrorAfterRedraw(err)
+			}
+			e.redraw.Store(true)
+			e.redrawCursor.Store(true)
+		},
+		references: func() { // find references to the symbol under the cursor, using the language server
+			e.LSPFindReferences(c, tty, status)
+			e.redraw.Store(true)
+			e.redrawCursor.Store(true)
+		},
 		runmake: func() {
 			workDir := filepath.Dir(e.filename)
 			found := false
@@ -321,8 +482,76 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 			e.quit = true
 			clearOnQuit.Store(true)
 		},
-		sortblock: func() { // sort the current block of lines, until the next blank line or EOF
+		selectchars: func() { // start or stop a character-wise selection
+			if e.StartSelection(charSelection) {
+				status.SetMessageAfterRedraw("Selecting characters, esc to stop")
+			}
+			e.redraw.Store(true)
+		},
+		selectlines: func() { // start or stop a line-wise selection
+			if e.StartSelection(lineSelection) {
+				status.SetMessageAfterRedraw("Selecting lines, esc to stop")
+			}
+			e.redraw.Store(true)
+		},
+		softwrap: func() { // toggle wrapping long lines when drawing them, without changing the text
+			if e.ToggleSoftWrap() {
+				status.SetMessageAfterRedraw("Soft wrap enabled")
+			} else {
+				status.SetMessageAfterRedraw("Soft wrap disabled")
+			}
+		},
+		hexedit: func() { // edit the bytes of the current file in the hex editor
+			if err := e.HexEditCurrentFile(c, tty, status); err != nil {
+				status.SetErrorAfterRedraw(err)
+			}
+			e.redraw.Store(true)
+			e.redrawCursor.Store(true)
+		},
+		fixchars: func() { // replace non-breaking spaces and characters that look like tildes or semicolons
+			undo.Snapshot(e)
+			switch n := e.ReplaceLookalikeCharacters(); n {
+			case 0:
+				status.SetMessageAfterRedraw("Found no non-breaking spaces or look-alike characters")
+			case 1:
+				status.SetMessageAfterRedraw("Replaced characters on 1 line")
+			default:
+				status.SetMessageAfterRedraw(fmt.Sprintf("Replaced characters on %d lines", n))
+			}
+		},
+		utf8: func() { // save the file as UTF-8 instead of in the original character encoding
+			if err := e.ConvertToUTF8(); err != nil {
+				status.SetErrorAfterRedraw(err)
+				return
+			}
+			status.SetMessageAfterRedraw("Will be saved as " + e.FileFormatDescription())
+		},
+		lf: func() { // save the file with UNIX line endings
+			if err := e.SetLineEnding("\n"); err != nil {
+				status.SetErrorAfterRedraw(err)
+				return
+			}
+			status.SetMessageAfterRedraw("Will be saved as " + e.FileFormatDescription())
+		},
+		crlf: func() { // save the file with DOS line endings
+			if err := e.SetLineEnding("\r\n"); err != nil {
+				status.SetErrorAfterRedraw(err)
+				return
+			}
+			status.SetMessageAfterRedraw("Will be saved as " + e.FileFormatDescription())
+		},
+		selectrect: func() { // start or stop a rectangular selection
+			if e.StartSelection(rectSelection) {
+				status.SetMessageAfterRedraw("Selecting a rectangle, esc to stop")
+			}
+			e.redraw.Store(true)
+		},
+		sortblock: func() { // sort the selected text, or the current block of lines, until the next blank line or EOF
 			undo.Snapshot(e)
+			if e.selection != nil {
+				e.SortSelection(c, status)
+				return
+			}
 			e.SortBlock(c, status, bookmark)
 		},
 		sortstrings: func() { // sort the words on the current line
@@ -348,9 +577,71 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 			undo.Snapshot(e)
 			e.SmartSplitLineOnBlanks(c, status, bookmark)
 		},
+		nextbuffer: func() { // switch to the next open buffer
+			if err := e.NextBuffer(c, tty, status); err != nil {
+				status.SetErrorAfterRedraw(err)
+			}
+		},
+		prevbuffer: func() { // switch to the previous open buffer
+			if err := e.PrevBuffer(c, tty, status); err != nil {
+				status.SetErrorAfterRedraw(err)
+			}
+		},
+		nexterror: func() { // go to the next error from the last build
+			const forward = true
+			if err := e.NextDiagnostic(c, tty, status, forward); err != nil {
+				status.SetErrorAfterRedraw(err)
+			}
+		},
+		preverror: func() { // go to the previous error from the last build
+			const forward = false
+			if err := e.NextDiagnostic(c, tty, status, forward); err != nil {
+				status.SetErrorAfterRedraw(err)
+			}
+		},
+		findfile: func() { // find a file in the project by typing parts of the path, and open it in a new buffer
+			if err := e.FuzzyFindFile(c, tty, status); err != nil {
+				status.SetErrorAfterRedraw(err)
+			}
+			e.redraw.Store(true)
+			e.redrawCursor.Store(true)
+		},
+		hsplit: func() { // split the view in an upper and a lower pane, showing the same file or the given file
+			if err := e.SplitView(c, tty, status, fileLock, splitHorizontal, strings.Join(args[1:], " ")); err != nil {
+				status.SetErrorAfterRedraw(err)
+			}
+		},
+		vsplit: func() { // split the view in a left and a right pane, showing the same file or the given file
+			if err := e.SplitView(c, tty, status, fileLock, splitVertical, strings.Join(args[1:], " ")); err != nil {
+				status.SetErrorAfterRedraw(err)
+			}
+		},
+		otherpane: func() { // move the focus to the other pane, if the view is split
+			if err := e.FocusOtherPane(c); err != nil {
+				status.SetErrorAfterRedraw(err)
+			}
+		},
+		unsplit: func() { // close the other pane, and show the current file full screen
+			if err := e.Unsplit(c, fileLock); err != nil {
+				status.SetErrorAfterRedraw(err)
+			}
+		},
+		openfile: func() { // open a file in a new buffer
+			if err := e.OpenBuffer(c, tty, status, fileLock, args[1]); err != nil {
+				e.redraw.Store(true)
+				status.SetErrorAfterRedraw(err)
+			}
+		},
 		quit: func() { // quit
 			e.quit = true
 		},
+		undoedit: func() { // undo the most recent edit
+			if err := undo.Restore(e); err != nil {
+				status.SetErrorAfterRedraw(err)
+			}
+			e.redraw.Store(true)
+			e.redrawCursor.Store(true)
+		},
 		version: func() { // display the program name and version as a status message
 			status.SetMessageAfterRedraw(versionString)
 		},
@@ -364,6 +655,8 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 	switch trimmedCommand {
 	case "bye", "cu", "ee", "exit", "q", "qq", "qu", "qui", "quit", "c:17": // ctrl-q
 		functionID = quit
+	case "buffers", "bufs", "ls", "bl":
+		functionID = buffers
 	case "build", "b", "bu", "bui":
 		functionID = build
 	case "copyall", "copya":
@@ -372,10 +665,14 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 		functionID = copymark
 	case "copy200":
 		functionID = copy200
+	case "errors", "errs", "err", "quickfix", "cw", "copen":
+		functionID = errorlist
 	case "gobacktofunc":
 		functionID = gobacktofunc
 	case "h", "he", "hh", "hel", "help":
 		functionID = help
+	case "hover", "info", "doc":
+		functionID = hover
 	case "if", "i", "insertfile", "insert", "insertf":
 		functionID = insertfile
 	case "insertdate", "insertd", "id", "date", "d":
@@ -384,12 +681,72 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 		functionID = inserttime
 	case "insertdateandtime", "dateandtime", "dt", "dati", "datim":
 		functionID = insertdateandtime
+	case "bn", "bnext", "nextbuffer":
+		functionID = nextbuffer
+	case "bp", "bprev", "prevbuffer":
+		functionID = prevbuffer
+	case "e", "ed", "edit", "o", "open":
+		functionID = openfile
+	case "cn", "cnext", "nexterror", "nexterr", "ne":
+		functionID = nexterror
+	case "cp", "cprev", "preverror", "preverr", "pe":
+		functionID = preverror
 	case "make":
 		functionID = runmake
+	case "redo", "red", "re":
+		functionID = redo
+	case "references", "refs", "ref", "usages":
+		functionID = references
 	case "qs", "byes", "cus", "exitsave", "quitandsave", "quitsave", "qw", "saq", "saveandquit", "saveexit", "saveq", "savequit", "savq", "sq", "wq", "↑", "c:23": // ctrl-w, if the user keeps holding down ctrl
 		functionID = savequit
 	case "s", "sa", "sav", "save", "w", "ww", "↓", "c:19": // ctrl-s, if the user keeps holding down ctrl
 		functionID = save
+	case "ff", "findfile", "files", "fzf":
+		functionID = findfile
+	case "hsplit", "hs":
+		functionID = hsplit
+	case "vsplit", "vs":
+		functionID = vsplit
+	case "otherpane", "focus", "pane":
+		functionID = otherpane
+	case "unsplit", "only", "close":
+		functionID = unsplit
+	case "grep", "rg", "searchproject", "findinproject", "fip":
+		functionID = searchproject
+	case "results", "res", "searchresults", "grepresults":
+		functionID = searchresults
+	case "replaceproject", "replaceinproject", "rip":
+		functionID = replaceproject
+	case "revertreplace", "undoreplace":
+		functionID = revertreplace
+	case "select", "sel", "selectchars", "visual":
+		functionID = selectchars
+	case "selectlines", "sell", "linewise", "visualline":
+		functionID = selectlines
+	case "fold", "unfold", "togglefold", "za":
+		functionID = fold
+	case "foldall", "unfoldall", "togglefolds", "zm", "zr":
+		functionID = foldall
+	case "reflow", "gq", "rewrap", "fillparagraph":
+		functionID = reflow
+	case "softwrap", "softw", "wrapview":
+		functionID = softwrap
+	case "hex", "hexedit", "xxd":
+		functionID = hexedit
+	case "fixchars", "fixnbsp", "nbsp":
+		functionID = fixchars
+	case "utf8", "utf-8", "toutf8":
+		functionID = utf8
+	case "lf", "unix", "dos2unix":
+		functionID = lf
+	case "crlf", "dos", "unix2dos":
+		functionID = crlf
+	case "selectrect", "rect", "column", "visualblock":
+		functionID = selectrect
+	case "cursorbelow", "addcursor":
+		functionID = cursorbelow
+	case "cursorword", "nextcursor":
+		functionID = cursorword
 	case "sb", "so", "sor", "sort", "sortblock":
 		functionID = sortblock
 	case "spl", "split", "splitline", "smartsplit":
@@ -400,6 +757,8 @@ func (e *Editor) CommandToFunction(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 		functionID = sortstrings
 	case "sqc", "savequitclear":
 		functionID = savequitclear
+	case "u", "un", "undo":
+		functionID = undoedit
 	case "v", "ver", "vv", "version":
 		functionID = version
 	default:
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/xyproto/files"
+)
+
+// compression is a compression format for files that can be edited transparently.
+// The file is decompressed when it is loaded, and compressed again when it is saved.
+type compression struct {
+	name       string
+	extension  string
+	magic      []byte // the first bytes of a compressed file
+	decompress func([]byte) ([]byte, error)
+	compress   func([]byte) ([]byte, error)
+}
+
+// compressions are the supported compression formats. gzip and bzip2 files are decompressed by Go,
+// while the xz, zstd and bzip2 commands are used for the rest.
+var compressions = []compression{
+	{"gzip", ".gz", []byte{0x1f, 0x8b}, gUnzipData, gZipData},
+	{"bzip2", ".bz2", []byte("BZh"), bUnzip2Data, compressWithCommand("bzip2")},
+	{"xz", ".xz", []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, decompressWithCommand("xz"), compressWithCommand("xz")},
+	{"zstd", ".zst", []byte{0x28, 0xb5, 0x2f, 0xfd}, decompressWithCommand("zstd"), compressWithCommand("zstd")},
+}
+
+// compressionByExtension returns the compression format for the given filename, or nil if it is not compressed
+func compressionByExtension(filename string) *compression {
+	ext := strings.ToLower(filepath.Ext(filename))
+	for i := range compressions {
+		if compressions[i].extension == ext {
+			return &compressions[i]
+		}
+	}
+	return nil
+}
+
+// compressionByMagic returns the compression format that the given data is compressed with, or nil
+func compressionByMagic(data []byte) *compression {
+	for i := range compressions {
+		if bytes.HasPrefix(data, compressions[i].magic) {
+			return &compressions[i]
+		}
+	}
+	return nil
+}
+
+// stripCompressionExtension removes the extension of a compressed file, like ".gz" from "ls.1.gz"
+func stripCompressionExtension(filename string) string {
+	if compressionByExtension(filename) != nil {
+		return strings.TrimSuffix(filename, filepath.Ext(filename))
+	}
+	return filename
+}
+
+// decompressFileData decompresses the given data, if the filename has the extension of a compressed file.
+// Since the file is compressed by the extension when it is saved, a file where the first bytes of the data
+// are from another compression format is refused, instead of being saved in another format than it was.
+func decompressFileData(filename string, data []byte) ([]byte, error) {
+	comp := compressionByExtension(filename)
+	if comp == nil {
+		return data, nil
+	}
+	if magicComp := compressionByMagic(data); magicComp != nil && magicComp != comp {
+		return nil, fmt.Errorf("%s has the %s extension, but is compressed with %s", filepath.Base(filename), comp.extension, magicComp.name)
+	}
+	return comp.decompress(data)
+}
+
+// compressFileData compresses the given data, if the filename has the extension of a compressed file
+func compressFileData(filename string, data []byte) ([]byte, error) {
+	if comp := compressionByExtension(filename); comp != nil {
+		return comp.compress(data)
+	}
+	return data, nil
+}
+
+// bUnzip2Data decompresses bzip2 data
+func bUnzip2Data(data []byte) ([]byte, error) {
+	var resB bytes.Buffer
+	if _, err := resB.ReadFrom(bzip2.NewReader(bytes.NewReader(data))); err != nil {
+		return nil, err
+	}
+	return resB.Bytes(), nil
+}
+
+// pipeThroughCommand runs the given command with the given data on stdin, and returns what it writes to stdout
+func pipeThroughCommand(data []byte, name string, args ...string) ([]byte, error) {
+	path := files.WhichCached(name)
+	if path == "" {
+		return nil, errors.New("could not find " + name + " in the PATH")
+	}
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = bytes.NewReader(data)
+	var outBuf, errBuf bytes.Buffer
+	cmd.Stdout = &outBuf
+	cmd.Stderr = &errBuf
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(errBuf.String()); msg != "" {
+			return nil, errors.New(msg)
+		}
+		return nil, err
+	}
+	return outBuf.Bytes(), nil
+}
+
+// decompressWithCommand returns a function that decompresses data with the given command, like xz or zstd
+func decompressWithCommand(name string) func([]byte) ([]byte, error) {
+	return func(data []byte) ([]byte, error) {
+		return pipeThroughCommand(data, name, "-d", "-c", "-q")
+	}
+}
+
+// compressWithCommand returns a function that compresses data with the given command, like xz or zstd
+func compressWithCommand(name string) func([]byte) ([]byte, error) {
+	return func(data []byte) ([]byte, error) {
+		return pipeThroughCommand(data, name, "-c", "-q")
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/xyproto/files"
+)
+
+func TestCompression(t *testing.T) {
+	const text = "int main() {\n    return 0;\n}\n"
+	for _, comp := range compressions {
+		if comp.name != "gzip" && files.WhichCached(comp.name) == "" {
+			t.Logf("skipping %s, since it is not installed", comp.name)
+			continue
+		}
+		filename := "main.cpp" + comp.extension
+		compressed, err := compressFileData(filename, []byte(text))
+		if err != nil {
+			t.Fatalf("%s: %v", comp.name, err)
+		}
+		if magicComp := compressionByMagic(compressed); magicComp == nil || magicComp.name != comp.name {
+			t.Errorf("expected the %s data to be recognized by the first bytes", comp.name)
+		}
+		decompressed, err := decompressFileData(filename, compressed)
+		if err != nil {
+			t.Fatalf("%s: %v", comp.name, err)
+		}
+		if string(decompressed) != text {
+			t.Errorf("%s: expected %q, got %q", comp.name, text, decompressed)
+		}
+		// A file with the wrong extension is refused, since it would be saved with another compression format
+		if comp.name != "gzip" {
+			if _, err := decompressFileData("main.cpp.gz", compressed); err == nil {
+				t.Errorf("%s: expected data with a .gz extension to be refused", comp.name)
+			}
+		}
+	}
+
+	// gzip data with the xz extension would be saved as xz, so it is refused
+	gzipped, err := gZipData([]byte("hello\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decompressFileData("hello.txt.xz", gzipped); err == nil {
+		t.Error("expected gzip data with a .xz extension to be refused")
+	}
+
+	if got := stripCompressionExtension("ls.1.zst"); got != "ls.1" {
+		t.Errorf("expected ls.1, got %s", got)
+	}
+	if got := stripCompressionExtension("main.cpp"); got != "main.cpp" {
+		t.Errorf("expected main.cpp, got %s", got)
+	}
+}
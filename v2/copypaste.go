@@ -212,6 +212,10 @@ func (e *Editor) Paste(c *vt100.Canvas, status *StatusBar, copyLines, previousCo
 
 	} else { // Multi line paste (the rest of the lines)
 		// Pressed the second time for this line number, paste multiple lines without trimming
+
+		// Undo the single line paste and the multi line paste as one unit
+		undo.Join()
+
 		var (
 			firstLine     = (*copyLines)[0]
 			tailLines     = (*copyLines)[1:]
@@ -0,0 +1,745 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xyproto/files"
+	"github.com/xyproto/mode"
+)
+
+// dapAdapter describes a debugger that speaks the Debug Adapter Protocol over stdin and stdout
+type dapAdapter struct {
+	launchArguments map[string]interface{} // extra arguments for the launch request
+	name            string                 // the adapter ID that is sent when initializing
+	startFunction   string                 // run to the start of this function, instead of stopping at the entry point
+	command         []string               // the command for starting the adapter
+	launchSource    bool                   // launch the source file instead of a built executable, for interpreted languages
+}
+
+var (
+	lldbAdapters = []dapAdapter{
+		{name: "lldb-dap", command: []string{"lldb-dap"}, startFunction: "main"},
+		{name: "lldb-vscode", command: []string{"lldb-vscode"}, startFunction: "main"},
+	}
+
+	pythonAdapters = []dapAdapter{
+		{name: "debugpy", command: []string{"debugpy-adapter"}, launchSource: true, launchArguments: map[string]interface{}{"console": "internalConsole", "justMyCode": true}},
+		{name: "debugpy", command: []string{"python3", "-m", "debugpy.adapter"}, launchSource: true, launchArguments: map[string]interface{}{"console": "internalConsole", "justMyCode": true}},
+	}
+
+	// dapAdapters are the DAP adapters that can be used for each mode, in order of preference
+	dapAdapters = map[mode.Mode][]dapAdapter{
+		mode.C:      lldbAdapters,
+		mode.Cpp:    lldbAdapters,
+		mode.ObjC:   lldbAdapters,
+		mode.Odin:   lldbAdapters,
+		mode.Python: pythonAdapters,
+		mode.Rust:   lldbAdapters,
+		mode.Swift:  lldbAdapters,
+		mode.Zig:    lldbAdapters,
+	}
+
+	errDAPTimeout = errors.New("no response from the debug adapter")
+)
+
+// How long to wait for the debug adapter to respond. There is no limit for how long the program may run before it stops.
+const dapRequestTimeout = 10 * time.Second
+
+// findDAPAdapter returns the first available DAP adapter for the current mode
+func (e *Editor) findDAPAdapter() (dapAdapter, bool) {
+	for _, adapter := range dapAdapters[e.mode] {
+		if files.WhichCached(adapter.command[0]) != "" {
+			return adapter, true
+		}
+	}
+	return dapAdapter{}, false
+}
+
+// dapMessage is a request, response or event in the Debug Adapter Protocol
+type dapMessage struct {
+	Arguments  interface{}     `json:"arguments,omitempty"`
+	Type       string          `json:"type"`
+	Command    string          `json:"command,omitempty"`
+	Message    string          `json:"message,omitempty"`
+	Event      string          `json:"event,omitempty"`
+	Body       json.RawMessage `json:"body,omitempty"`
+	Seq        int             `json:"seq"`
+	RequestSeq int             `json:"request_seq,omitempty"`
+	Success    bool            `json:"success,omitempty"`
+}
+
+// dapClient sends requests to a debug adapter and receives responses and events
+type dapClient struct {
+	w       io.Writer
+	pending map[int]chan *dapMessage
+	events  chan *dapMessage
+	stops   []*dapMessage // stopped, terminated and exited events, which are never dropped
+	stopped chan struct{} // signals that an event has been added to stops
+	done    chan struct{}
+	mut     sync.Mutex
+	seq     int
+}
+
+// newDAPClient starts reading messages from the given reader, and sends requests with the given writer
+func newDAPClient(r io.Reader, w io.Writer) *dapClient {
+	client := &dapClient{
+		w:       w,
+		pending: make(map[int]chan *dapMessage),
+		events:  make(chan *dapMessage, 64),
+		stopped: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	go client.readLoop(bufio.NewReader(r))
+	return client
+}
+
+// readDAPMessage reads a single message, with a Content-Length header
+func readDAPMessage(r *bufio.Reader) (*dapMessage, error) {
+	contentLength := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			if contentLength >= 0 {
+				break
+			}
+			continue
+		}
+		if value, found := strings.CutPrefix(line, "Content-Length:"); found {
+			if contentLength, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	data := make([]byte, contentLength)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	var msg dapMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// writeDAPMessage writes a single message, with a Content-Length header
+func writeDAPMessage(w io.Writer, msg *dapMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	return err
+}
+
+// readLoop reads messages until the adapter closes the connection
+func (client *dapClient) readLoop(r *bufio.Reader) {
+	defer close(client.done)
+	for {
+		msg, err := readDAPMessage(r)
+		if err != nil {
+			return
+		}
+		switch msg.Type {
+		case "response":
+			client.mut.Lock()
+			responseChan, ok := client.pending[msg.RequestSeq]
+			delete(client.pending, msg.RequestSeq)
+			client.mut.Unlock()
+			if ok {
+				responseChan <- msg
+			}
+		case "event":
+			if msg.Event == "output" {
+				// Collect the output from the program that is being debugged
+				var body struct {
+					Category string `json:"category"`
+					Output   string `json:"output"`
+				}
+				if json.Unmarshal(msg.Body, &body) == nil && (body.Category == "stdout" || body.Category == "stderr") {
+					gdbOutput.WriteString(body.Output)
+				}
+				continue
+			}
+			switch msg.Event {
+			case "stopped", "terminated", "exited":
+				client.mut.Lock()
+				client.stops = append(client.stops, msg)
+				client.mut.Unlock()
+				select {
+				case client.stopped <- struct{}{}:
+				default: // already signaled
+				}
+				continue
+			}
+			select {
+			case client.events <- msg:
+			default: // drop the event if nobody is listening
+			}
+		case "request":
+			// Reverse requests, like runInTerminal, are not supported
+			client.write(&dapMessage{Type: "response", Command: msg.Command, RequestSeq: msg.Seq, Message: "not supported"})
+		}
+	}
+}
+
+// write sends a message, with the next sequence number
+func (client *dapClient) write(msg *dapMessage) (chan *dapMessage, error) {
+	client.mut.Lock()
+	defer client.mut.Unlock()
+	client.seq++
+	msg.Seq = client.seq
+	var responseChan chan *dapMessage
+	if msg.Type == "request" {
+		responseChan = make(chan *dapMessage, 1)
+		client.pending[msg.Seq] = responseChan
+	}
+	if err := writeDAPMessage(client.w, msg); err != nil {
+		delete(client.pending, msg.Seq)
+		return nil, err
+	}
+	return responseChan, nil
+}
+
+// send sends a request without waiting for the response
+func (client *dapClient) send(command string, arguments interface{}) (chan *dapMessage, error) {
+	return client.write(&dapMessage{Type: "request", Command: command, Arguments: arguments})
+}
+
+// wait waits for a response, and unmarshals the body of the response into body, if it is not nil
+func (client *dapClient) wait(responseChan chan *dapMessage, body interface{}) error {
+	select {
+	case msg := <-responseChan:
+		if !msg.Success {
+			if msg.Message != "" {
+				return errors.New(msg.Message)
+			}
+			return fmt.Errorf("%s failed", msg.Command)
+		}
+		if body != nil && len(msg.Body) > 0 {
+			return json.Unmarshal(msg.Body, body)
+		}
+		return nil
+	case <-client.done:
+		return errProgramStopped
+	case <-time.After(dapRequestTimeout):
+		return errDAPTimeout
+	}
+}
+
+// request sends a request and waits for the response
+func (client *dapClient) request(command string, arguments, body interface{}) error {
+	responseChan, err := client.send(command, arguments)
+	if err != nil {
+		return err
+	}
+	return client.wait(responseChan, body)
+}
+
+// waitForEvent waits for one of the given events, and returns it
+func (client *dapClient) waitForEvent(timeout time.Duration, events ...string) (*dapMessage, error) {
+	deadline := time.After(timeout)
+	for {
+		select {
+		case msg := <-client.events:
+			for _, event := range events {
+				if msg.Event == event {
+					return msg, nil
+				}
+			}
+		case <-client.done:
+			return nil, errProgramStopped
+		case <-deadline:
+			return nil, errDAPTimeout
+		}
+	}
+}
+
+// waitForStopEvent waits for the next stopped, terminated or exited event, for as long as it takes
+func (client *dapClient) waitForStopEvent() (*dapMessage, error) {
+	for {
+		client.mut.Lock()
+		if len(client.stops) > 0 {
+			msg := client.stops[0]
+			client.stops = client.stops[1:]
+			client.mut.Unlock()
+			return msg, nil
+		}
+		client.mut.Unlock()
+		select {
+		case <-client.stopped:
+		case <-client.done:
+			// Events that arrived right before the connection was closed are still returned
+			client.mut.Lock()
+			queued := len(client.stops)
+			client.mut.Unlock()
+			if queued == 0 {
+				return nil, errProgramStopped
+			}
+		}
+	}
+}
+
+// dapSource is a source file in the Debug Adapter Protocol
+type dapSource struct {
+	Name string `json:"name,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+// dapStackFrame is a stack frame in the Debug Adapter Protocol
+type dapStackFrame struct {
+	Source *dapSource `json:"source,omitempty"`
+	Name   string     `json:"name"`
+	ID     int        `json:"id"`
+	Line   int        `json:"line"`
+}
+
+// dapVariable is a variable in the Debug Adapter Protocol
+type dapVariable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	Type               string `json:"type,omitempty"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+// dapDebugger is a Debugger that uses a debug adapter, like debugpy or lldb-dap
+type dapDebugger struct {
+	adapter     dapAdapter
+	cmd         *exec.Cmd
+	client      *dapClient
+	sourceDir   string
+	onStop      func(filename string, lineNumber LineNumber) // called when the program stops at a line
+	onExit      func()                                       // called when the program is done running
+	breakpoints map[string]Breakpoints                       // breakpoints per absolute source filename
+	frames      []dapStackFrame                              // the call stack, from the last time the program stopped
+	locals      []DebugVariable                              // the local variables of the selected frame
+	frame       int                                          // the index of the selected frame
+	threadID    int
+	running     atomic.Bool    // true while the program runs in the background, after continuing or stepping
+	waiting     sync.WaitGroup // for the goroutine that waits for the program to stop
+}
+
+// newDAPDebugger prepares a new DAP debugger backend, but does not start the adapter
+func newDAPDebugger(adapter dapAdapter, sourceDir string, onStop func(string, LineNumber), onExit func()) *dapDebugger {
+	return &dapDebugger{adapter: adapter, sourceDir: sourceDir, onStop: onStop, onExit: onExit, breakpoints: make(map[string]Breakpoints)}
+}
+
+// Start will start the debug adapter, launch the program and run it to the start of main, or the first line
+func (d *dapDebugger) Start(sourceBaseFilename, executableBaseFilename string, breakpoints Breakpoints) error {
+	d.cmd = exec.Command(d.adapter.command[0], d.adapter.command[1:]...)
+	d.cmd.Dir = d.sourceDir
+	stdin, err := d.cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := d.cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := d.cmd.Start(); err != nil {
+		return err
+	}
+	return d.connect(newDAPClient(stdout, stdin), sourceBaseFilename, executableBaseFilename, breakpoints)
+}
+
+// connect initializes the debug adapter, launches the program and waits for it to stop at the start
+func (d *dapDebugger) connect(client *dapClient, sourceBaseFilename, executableBaseFilename string, breakpoints Breakpoints) error {
+	d.client = client
+
+	initializeArguments := map[string]interface{}{
+		"clientID":        "orbiton",
+		"clientName":      "Orbiton",
+		"adapterID":       d.adapter.name,
+		"linesStartAt1":   true,
+		"columnsStartAt1": true,
+		"pathFormat":      "path",
+	}
+	if err := d.client.request("initialize", initializeArguments, nil); err != nil {
+		return err
+	}
+
+	program := filepath.Join(d.sourceDir, executableBaseFilename)
+	if d.adapter.launchSource {
+		program = filepath.Join(d.sourceDir, sourceBaseFilename)
+	}
+	launchArguments := map[string]interface{}{
+		"program":     program,
+		"cwd":         d.sourceDir,
+		"args":        []string{},
+		"stopOnEntry": d.adapter.startFunction == "",
+	}
+	for k, v := range d.adapter.launchArguments {
+		launchArguments[k] = v
+	}
+	// Some adapters only respond to the launch request after the configuration is done
+	launchResponse, err := d.client.send("launch", launchArguments)
+	if err != nil {
+		return err
+	}
+	if _, err := d.client.waitForEvent(dapRequestTimeout, "initialized"); err != nil {
+		return err
+	}
+
+	// Pass the breakpoints that have been set with ctrl-b
+	if len(breakpoints) > 0 {
+		d.breakpoints[filepath.Join(d.sourceDir, sourceBaseFilename)] = append(Breakpoints{}, breakpoints...)
+		if err := d.sendBreakpoints(sourceBaseFilename); err != nil {
+			return err
+		}
+	}
+	if d.adapter.startFunction != "" {
+		functionBreakpoints := map[string]interface{}{"breakpoints": []map[string]string{{"name": d.adapter.startFunction}}}
+		if err := d.client.request("setFunctionBreakpoints", functionBreakpoints, nil); err != nil {
+			return err
+		}
+	}
+	if err := d.client.request("configurationDone", nil, nil); err != nil {
+		return err
+	}
+	if err := d.client.wait(launchResponse, nil); err != nil {
+		return err
+	}
+	if err := d.waitForStop(); err != nil {
+		return err
+	}
+	if d.adapter.startFunction != "" {
+		// The function breakpoint is only used for getting to the start of the program
+		return d.client.request("setFunctionBreakpoints", map[string]interface{}{"breakpoints": []string{}}, nil)
+	}
+	return nil
+}
+
+// waitForStop waits until the program stops or ends, then fetches the call stack, the local variables and the watches
+func (d *dapDebugger) waitForStop() error {
+	msg, err := d.client.waitForStopEvent()
+	return d.stopped(msg, err)
+}
+
+// stopped handles a stopped, terminated or exited event, by fetching the call stack, the local variables and the watches,
+// and then going to the line of the current frame
+func (d *dapDebugger) stopped(msg *dapMessage, err error) error {
+	if err == errProgramStopped || (err == nil && msg.Event != "stopped") {
+		programRunning = false
+		d.onExit()
+		return errProgramStopped
+	} else if err != nil {
+		return err
+	}
+	var stopped struct {
+		ThreadID int `json:"threadId"`
+	}
+	if json.Unmarshal(msg.Body, &stopped) == nil && stopped.ThreadID != 0 {
+		d.threadID = stopped.ThreadID
+	}
+
+	// Fetch the call stack, and go to the line of the current frame
+	var stackTrace struct {
+		StackFrames []dapStackFrame `json:"stackFrames"`
+	}
+	if err := d.client.request("stackTrace", map[string]interface{}{"threadId": d.threadID, "startFrame": 0, "levels": 20}, &stackTrace); err != nil {
+		return err
+	}
+	d.frames = stackTrace.StackFrames
+	d.locals = nil
+	d.frame = 0
+	if len(d.frames) == 0 {
+		return nil
+	}
+	d.loadLocals()
+	d.updateWatches()
+	if frame := d.frames[0]; frame.Source != nil && frame.Source.Path != "" && frame.Line > 0 {
+		d.onStop(frame.Source.Path, LineNumber(frame.Line))
+	}
+	return nil
+}
+
+// variables fetches the variables with the given reference
+func (d *dapDebugger) variables(variablesReference int) ([]dapVariable, error) {
+	var body struct {
+		Variables []dapVariable `json:"variables"`
+	}
+	if err := d.client.request("variables", map[string]interface{}{"variablesReference": variablesReference}, &body); err != nil {
+		return nil, err
+	}
+	return body.Variables, nil
+}
+
+// loadLocals fetches the local variables of the selected frame, including the fields of structs, one level down
+func (d *dapDebugger) loadLocals() {
+	d.locals = nil
+	if d.frame >= len(d.frames) {
+		return
+	}
+	var scopes struct {
+		Scopes []struct {
+			Name               string `json:"name"`
+			VariablesReference int    `json:"variablesReference"`
+		} `json:"scopes"`
+	}
+	if err := d.client.request("scopes", map[string]interface{}{"frameId": d.frames[d.frame].ID}, &scopes); err != nil || len(scopes.Scopes) == 0 {
+		return
+	}
+	variables, err := d.variables(scopes.Scopes[0].VariablesReference)
+	if err != nil {
+		return
+	}
+	for i, v := range variables {
+		local := DebugVariable{Name: v.Name, Value: v.Value}
+		// Only fetch the fields of the first few structs, to keep stepping fast
+		if v.VariablesReference > 0 && i < maxExpandedLocals {
+			if children, err := d.variables(v.VariablesReference); err == nil {
+				for _, child := range children {
+					local.Children = append(local.Children, DebugVariable{Name: child.Name, Value: child.Value})
+				}
+			}
+		}
+		d.locals = append(d.locals, local)
+	}
+}
+
+// eval evaluates the given expression in the selected frame
+func (d *dapDebugger) eval(expression string) (string, error) {
+	return d.evaluate(expression, "watch")
+}
+
+// evaluate evaluates the given expression in the selected frame, in the given context, like "watch" or "repl"
+func (d *dapDebugger) evaluate(expression, context string) (string, error) {
+	arguments := map[string]interface{}{"expression": expression, "context": context}
+	if d.frame < len(d.frames) {
+		arguments["frameId"] = d.frames[d.frame].ID
+	}
+	var body struct {
+		Result string `json:"result"`
+	}
+	if err := d.client.request("evaluate", arguments, &body); err != nil {
+		return "", err
+	}
+	return body.Result, nil
+}
+
+// updateWatches evaluates all watch expressions, and remembers the one that changed most recently
+func (d *dapDebugger) updateWatches() {
+	for expression, previousValue := range watchMap {
+		value, err := d.eval(expression)
+		if err != nil {
+			value = "?"
+		}
+		if value != previousValue {
+			watchMap[expression] = value
+			if err == nil {
+				lastSeenWatchVariable = expression
+			}
+		}
+	}
+}
+
+// step sends a request like "next" or "continue" for the current thread, and waits for the program to stop in the background.
+// onStop or onExit is called from the goroutine that waits, which may be long after step has returned.
+func (d *dapDebugger) step(command string, extraArguments map[string]interface{}) error {
+	if d.client == nil {
+		return errProgramStopped
+	}
+	if d.running.Load() {
+		return errProgramRunning
+	}
+	arguments := map[string]interface{}{"threadId": d.threadID}
+	for k, v := range extraArguments {
+		arguments[k] = v
+	}
+	d.running.Store(true)
+	if err := d.client.request(command, arguments, nil); err != nil {
+		d.running.Store(false)
+		return err
+	}
+	client := d.client
+	d.waiting.Add(1)
+	go func() {
+		defer d.waiting.Done()
+		msg, err := client.waitForStopEvent()
+		// If Exit has cleared the flag, the debug session is over
+		if d.running.CompareAndSwap(true, false) {
+			d.stopped(msg, err)
+		}
+	}()
+	return nil
+}
+
+// sendBreakpoints sends all breakpoints for the given source file to the debug adapter
+func (d *dapDebugger) sendBreakpoints(sourceBaseFilename string) error {
+	path := filepath.Join(d.sourceDir, sourceBaseFilename)
+	breakpoints := make([]map[string]interface{}, len(d.breakpoints[path]))
+	for i, bp := range d.breakpoints[path] {
+		breakpoints[i] = map[string]interface{}{"line": int(bp.Line)}
+		if bp.Condition != "" {
+			breakpoints[i]["condition"] = bp.Condition
+		}
+		if bp.HitCount > 1 {
+			breakpoints[i]["hitCondition"] = strconv.Itoa(bp.HitCount)
+		}
+	}
+	arguments := map[string]interface{}{
+		"source":      dapSource{Name: sourceBaseFilename, Path: path},
+		"breakpoints": breakpoints,
+	}
+	return d.client.request("setBreakpoints", arguments, nil)
+}
+
+// SetBreakpoint places a breakpoint at the given line in the given source file, or replaces the breakpoint at that line.
+// The debug adapter is sent all breakpoints for the source file.
+func (d *dapDebugger) SetBreakpoint(sourceBaseFilename string, breakpoint Breakpoint) error {
+	if d.client == nil {
+		return errProgramStopped
+	}
+	path := filepath.Join(d.sourceDir, sourceBaseFilename)
+	d.breakpoints[path] = d.breakpoints[path].Set(breakpoint)
+	return d.sendBreakpoints(sourceBaseFilename)
+}
+
+// ClearBreakpoint removes the breakpoint at the given line in the given source file, if there is one
+func (d *dapDebugger) ClearBreakpoint(sourceBaseFilename string, lineNumber LineNumber) error {
+	if d.client == nil {
+		return errProgramStopped
+	}
+	path := filepath.Join(d.sourceDir, sourceBaseFilename)
+	if _, found := d.breakpoints[path].Get(lineNumber); !found {
+		return nil
+	}
+	d.breakpoints[path] = d.breakpoints[path].Remove(lineNumber)
+	return d.sendBreakpoints(sourceBaseFilename)
+}
+
+// Continue will continue the execution to the next breakpoint or to the end
+func (d *dapDebugger) Continue() error {
+	return d.step("continue", nil)
+}
+
+// Next will continue the execution by stepping to the next line
+func (d *dapDebugger) Next(stepInto bool) error {
+	if stepInto {
+		return d.step("stepIn", nil)
+	}
+	return d.step("next", nil)
+}
+
+// NextInstruction will continue the execution by stepping to the next instruction
+func (d *dapDebugger) NextInstruction(stepInto bool) error {
+	granularity := map[string]interface{}{"granularity": "instruction"}
+	if stepInto {
+		return d.step("stepIn", granularity)
+	}
+	return d.step("next", granularity)
+}
+
+// Step will continue the execution by stepping into function calls
+func (d *dapDebugger) Step() error {
+	return d.step("stepIn", nil)
+}
+
+// Finish will "step out"
+func (d *dapDebugger) Finish() error {
+	return d.step("stepOut", nil)
+}
+
+// AddWatch evaluates the expression every time the program stops
+func (d *dapDebugger) AddWatch(expression string) error {
+	if d.client == nil || len(d.frames) == 0 {
+		return nil
+	}
+	if value, err := d.eval(expression); err == nil {
+		watchMap[expression] = value
+	}
+	return nil
+}
+
+// StackFrames returns the call stack, from the last time the program stopped
+func (d *dapDebugger) StackFrames() []StackFrame {
+	frames := make([]StackFrame, 0, len(d.frames))
+	for _, frame := range d.frames {
+		sf := StackFrame{Function: frame.Name, Line: LineNumber(frame.Line)}
+		if frame.Source != nil {
+			sf.Filename = frame.Source.Path
+		}
+		frames = append(frames, sf)
+	}
+	return frames
+}
+
+// Locals returns the local variables of the selected frame
+func (d *dapDebugger) Locals() []DebugVariable {
+	return d.locals
+}
+
+// SelectFrame selects the frame with the given index in the call stack, and fetches its local variables
+func (d *dapDebugger) SelectFrame(index int) error {
+	if d.client == nil {
+		return errProgramStopped
+	}
+	if index < 0 || index >= len(d.frames) {
+		return fmt.Errorf("no stack frame %d", index)
+	}
+	d.frame = index
+	d.loadLocals()
+	return nil
+}
+
+// Command sends the given command to the debug console of the adapter, like an lldb command or a Python expression
+func (d *dapDebugger) Command(command string) (string, error) {
+	if d.client == nil {
+		return "", errProgramStopped
+	}
+	return d.evaluate(command, "repl")
+}
+
+// Running returns true while the program runs in the background, after continuing or stepping
+func (d *dapDebugger) Running() bool {
+	return d.running.Load()
+}
+
+// Interrupt sends a pause request for the current thread, which makes the program stop at the line it is at
+func (d *dapDebugger) Interrupt() error {
+	if d.client == nil {
+		return errProgramStopped
+	}
+	return d.client.request("pause", map[string]interface{}{"threadId": d.threadID}, nil)
+}
+
+// Prompt returns the name of the debug adapter
+func (d *dapDebugger) Prompt() string {
+	return d.adapter.name
+}
+
+// Exit ends the debug session and the program that is being debugged
+func (d *dapDebugger) Exit() {
+	// Let the goroutine that waits for the program to stop know that the debug session is over
+	d.running.Store(false)
+	if d.client != nil {
+		if responseChan, err := d.client.send("disconnect", map[string]interface{}{"terminateDebuggee": true}); err == nil {
+			select {
+			case <-responseChan:
+			case <-d.client.done:
+			case <-time.After(time.Second):
+			}
+		}
+	}
+	if d.cmd != nil && d.cmd.Process != nil {
+		d.cmd.Process.Kill()
+		d.cmd.Wait()
+	}
+	d.waiting.Wait()
+	d.client = nil
+	d.cmd = nil
+}
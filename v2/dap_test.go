@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDAPAdapter is a debug adapter that steps through a list of lines, and records the requests it receives
+type fakeDAPAdapter struct {
+	w        io.Writer
+	file     string
+	lines    []int // the lines that the program stops at, one per stop
+	commands []string
+	requests map[string]map[string]interface{} // the arguments of the most recent request of each type
+	mut      sync.Mutex
+	seq      int
+	value    int
+	forever  bool // keep running after a continue request, until a pause request is received
+}
+
+func (f *fakeDAPAdapter) write(msg *dapMessage) {
+	f.seq++
+	msg.Seq = f.seq
+	writeDAPMessage(f.w, msg)
+}
+
+func (f *fakeDAPAdapter) respond(request *dapMessage, body interface{}) {
+	data, _ := json.Marshal(body)
+	f.write(&dapMessage{Type: "response", Command: request.Command, RequestSeq: request.Seq, Success: true, Body: data})
+}
+
+func (f *fakeDAPAdapter) event(event string, body interface{}) {
+	data, _ := json.Marshal(body)
+	f.write(&dapMessage{Type: "event", Event: event, Body: data})
+}
+
+// stop sends a stopped event for the next line, or a terminated event if there are no more lines
+func (f *fakeDAPAdapter) stop() {
+	if len(f.lines) == 0 {
+		f.event("terminated", map[string]interface{}{})
+		return
+	}
+	f.value++
+	f.event("stopped", map[string]interface{}{"reason": "step", "threadId": 7})
+}
+
+// serve handles requests until the client closes the connection
+func (f *fakeDAPAdapter) serve(r io.Reader) {
+	br := bufio.NewReader(r)
+	var launchRequest *dapMessage
+	for {
+		msg, err := readDAPMessage(br)
+		if err != nil {
+			return
+		}
+		f.mut.Lock()
+		f.commands = append(f.commands, msg.Command)
+		if arguments, ok := msg.Arguments.(map[string]interface{}); ok {
+			f.requests[msg.Command] = arguments
+		}
+		f.mut.Unlock()
+		switch msg.Command {
+		case "initialize":
+			f.respond(msg, map[string]interface{}{"supportsConfigurationDoneRequest": true})
+		case "launch":
+			// Like debugpy, respond to the launch request after the configuration is done
+			launchRequest = msg
+			f.event("initialized", nil)
+		case "setBreakpoints", "setFunctionBreakpoints":
+			f.respond(msg, map[string]interface{}{"breakpoints": []interface{}{}})
+		case "configurationDone":
+			f.respond(msg, nil)
+			f.respond(launchRequest, nil)
+			f.event("output", map[string]string{"category": "stdout", "output": "hello\n"})
+			f.stop()
+		case "stackTrace":
+			line := f.lines[0]
+			f.lines = f.lines[1:]
+			f.respond(msg, map[string]interface{}{"stackFrames": []dapStackFrame{
+				{ID: 1, Name: "inner", Line: line, Source: &dapSource{Path: f.file}},
+				{ID: 2, Name: "main", Line: 30, Source: &dapSource{Path: f.file}},
+			}})
+		case "scopes":
+			f.respond(msg, map[string]interface{}{"scopes": []map[string]interface{}{{"name": "Locals", "variablesReference": 100}}})
+		case "variables":
+			// Variable reference 100 is the locals scope, and 200 is the fields of p
+			if arguments, _ := msg.Arguments.(map[string]interface{}); arguments["variablesReference"] == float64(200) {
+				f.respond(msg, map[string]interface{}{"variables": []dapVariable{{Name: "x", Value: "1"}}})
+				break
+			}
+			f.respond(msg, map[string]interface{}{"variables": []dapVariable{{Name: "i", Value: "3"}, {Name: "p", Value: "Point", VariablesReference: 200}}})
+		case "evaluate":
+			f.respond(msg, map[string]interface{}{"result": strings.Repeat("x", f.value)})
+		case "next", "stepIn", "stepOut", "continue":
+			f.respond(msg, nil)
+			if msg.Command == "continue" && f.forever {
+				break
+			}
+			f.stop()
+		case "pause":
+			f.respond(msg, nil)
+			f.stop()
+		case "disconnect":
+			f.respond(msg, nil)
+			return
+		default:
+			f.write(&dapMessage{Type: "response", Command: msg.Command, RequestSeq: msg.Seq, Message: "unknown request"})
+		}
+	}
+}
+
+func TestDAPDebugger(t *testing.T) {
+	origWatchMap, origLastSeen, origProgramRunning := watchMap, lastSeenWatchVariable, programRunning
+	defer func() {
+		watchMap, lastSeenWatchVariable, programRunning = origWatchMap, origLastSeen, origProgramRunning
+		gdbOutput.Reset()
+	}()
+	watchMap = map[string]string{"x": "?"}
+	programRunning = true
+	gdbOutput.Reset()
+
+	dir := t.TempDir()
+	sourceFilename := filepath.Join(dir, "main.c")
+	clientReader, adapterWriter := io.Pipe()
+	adapterReader, clientWriter := io.Pipe()
+	fake := &fakeDAPAdapter{w: adapterWriter, file: sourceFilename, lines: []int{5, 6, 12}, requests: make(map[string]map[string]interface{})}
+	done := make(chan struct{})
+	go func() {
+		fake.serve(adapterReader)
+		close(done)
+	}()
+
+	var stops []LineNumber
+	exited := false
+	onStop := func(filename string, lineNumber LineNumber) {
+		if filename != sourceFilename {
+			t.Errorf("expected to stop in %s, got %s", sourceFilename, filename)
+		}
+		stops = append(stops, lineNumber)
+	}
+	onExit := func() {
+		exited = true
+	}
+
+	d := newDAPDebugger(lldbAdapters[0], dir, onStop, onExit)
+	breakpoints := Breakpoints{{Line: 12, Condition: "i > 2"}}
+	if err := d.connect(newDAPClient(clientReader, clientWriter), "main.c", "main", breakpoints); err != nil {
+		t.Fatal(err)
+	}
+
+	// The program should have been launched, with a breakpoint at line 12, and be stopped at the start of main
+	if program := fake.requests["launch"]["program"]; program != filepath.Join(dir, "main") {
+		t.Errorf("unexpected program: %v", program)
+	}
+	if breakpoints, ok := fake.requests["setBreakpoints"]["breakpoints"].([]interface{}); !ok || len(breakpoints) != 1 || breakpoints[0].(map[string]interface{})["line"] != float64(12) || breakpoints[0].(map[string]interface{})["condition"] != "i > 2" {
+		t.Errorf("unexpected breakpoints: %v", fake.requests["setBreakpoints"])
+	}
+	if len(stops) != 1 || stops[0] != 5 {
+		t.Errorf("expected to stop at line 5, got %v", stops)
+	}
+	if watchMap["x"] != "x" || lastSeenWatchVariable != "x" {
+		t.Errorf("expected the watch to be evaluated, got %q", watchMap["x"])
+	}
+
+	// Step over, then check the call stack and the local variables, once the program has stopped
+	if err := d.Next(false); err != nil {
+		t.Fatal(err)
+	}
+	d.waiting.Wait()
+	if watchMap["x"] != "xx" {
+		t.Errorf("expected the watch to be updated, got %q", watchMap["x"])
+	}
+	frames := d.StackFrames()
+	if len(frames) != 2 || frames[0].Function != "inner" || frames[0].Line != 6 || frames[1].Function != "main" {
+		t.Errorf("unexpected call stack: %v", frames)
+	}
+	if locals := d.Locals(); len(locals) != 2 || locals[0].Name != "i" || locals[0].Value != "3" || len(locals[1].Children) != 1 || locals[1].Children[0].Name != "x" {
+		t.Errorf("unexpected local variables: %v", locals)
+	}
+
+	// Select the outer frame, which should fetch the local variables of that frame
+	if err := d.SelectFrame(1); err != nil {
+		t.Fatal(err)
+	}
+	if frameID := fake.requests["scopes"]["frameId"]; frameID != float64(2) {
+		t.Errorf("expected the scopes of the outer frame, got frame %v", frameID)
+	}
+	if err := d.SelectFrame(2); err == nil {
+		t.Errorf("expected an error when selecting a frame that does not exist")
+	}
+	if threadID := fake.requests["next"]["threadId"]; threadID != float64(7) {
+		t.Errorf("expected the thread ID from the stopped event, got %v", threadID)
+	}
+
+	// Step out, then continue until the program ends
+	if err := d.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	d.waiting.Wait()
+	if err := d.Continue(); err != nil {
+		t.Fatal(err)
+	}
+	d.waiting.Wait()
+	if !exited || programRunning {
+		t.Errorf("expected the program to be done running")
+	}
+	if got := gdbOutput.String(); got != "hello\n" {
+		t.Errorf("expected the program output to be collected, got %q", got)
+	}
+
+	d.Exit()
+	<-done
+
+	expectedCommands := []string{
+		"initialize", "launch", "setBreakpoints", "setFunctionBreakpoints", "configurationDone",
+		"stackTrace", "scopes", "variables", "variables", "evaluate", "setFunctionBreakpoints",
+		"next", "stackTrace", "scopes", "variables", "variables", "evaluate",
+		"scopes", "variables", "variables",
+		"stepOut", "stackTrace", "scopes", "variables", "variables", "evaluate",
+		"continue", "disconnect",
+	}
+	if got := strings.Join(fake.commands, ","); got != strings.Join(expectedCommands, ",") {
+		t.Errorf("unexpected message flow:\n%s\nexpected:\n%s", got, strings.Join(expectedCommands, ","))
+	}
+}
+
+func TestDAPDebuggerPause(t *testing.T) {
+	origProgramRunning := programRunning
+	defer func() {
+		programRunning = origProgramRunning
+		gdbOutput.Reset()
+	}()
+	programRunning = true
+
+	dir := t.TempDir()
+	clientReader, adapterWriter := io.Pipe()
+	adapterReader, clientWriter := io.Pipe()
+	fake := &fakeDAPAdapter{w: adapterWriter, file: filepath.Join(dir, "main.c"), lines: []int{5, 9}, requests: make(map[string]map[string]interface{}), forever: true}
+	done := make(chan struct{})
+	go func() {
+		fake.serve(adapterReader)
+		close(done)
+	}()
+
+	var stops []LineNumber
+	d := newDAPDebugger(lldbAdapters[0], dir, func(filename string, lineNumber LineNumber) {
+		stops = append(stops, lineNumber)
+	}, func() {})
+	if err := d.connect(newDAPClient(clientReader, clientWriter), "main.c", "main", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Continue, which never stops by itself, then pause the program
+	if err := d.Continue(); err != nil {
+		t.Fatal(err)
+	}
+	if !d.Running() {
+		t.Fatal("expected the program to be running in the background")
+	}
+	if err := d.Next(false); err != errProgramRunning {
+		t.Errorf("expected stepping to wait until the program is paused, got %v", err)
+	}
+	if err := d.Interrupt(); err != nil {
+		t.Fatal(err)
+	}
+	d.waiting.Wait()
+	if d.Running() {
+		t.Errorf("expected the program to be paused")
+	}
+	if len(stops) != 2 || stops[1] != 9 {
+		t.Errorf("expected to stop at line 9 after pausing, got %v", stops)
+	}
+	if threadID := fake.requests["pause"]["threadId"]; threadID != float64(7) {
+		t.Errorf("expected the pause request to be for thread 7, got %v", threadID)
+	}
+
+	d.Exit()
+	<-done
+}
+
+func TestDAPClientKeepsStopEvents(t *testing.T) {
+	clientReader, adapterWriter := io.Pipe()
+	client := newDAPClient(clientReader, io.Discard)
+	fake := &fakeDAPAdapter{w: adapterWriter}
+
+	// Fill up the events channel before the program stops, then end the program
+	for i := 0; i < 100; i++ {
+		fake.event("thread", map[string]interface{}{"reason": "started", "threadId": i})
+	}
+	fake.event("stopped", map[string]interface{}{"reason": "breakpoint", "threadId": 1})
+	fake.event("terminated", map[string]interface{}{})
+	adapterWriter.Close()
+
+	for _, expected := range []string{"stopped", "terminated"} {
+		msg, err := client.waitForStopEvent()
+		if err != nil {
+			t.Fatalf("expected a %s event, got %v", expected, err)
+		}
+		if msg.Event != expected {
+			t.Errorf("expected a %s event, got %s", expected, msg.Event)
+		}
+	}
+	if _, err := client.waitForStopEvent(); err != errProgramStopped {
+		t.Errorf("expected the program to be stopped, got %v", err)
+	}
+}
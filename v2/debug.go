@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
 	"sort"
@@ -21,6 +20,7 @@ import (
 const (
 	smallRegisterWindow = iota
 	largeRegisterWindow
+	stackWindow
 	noRegisterWindow
 )
 
@@ -34,27 +34,59 @@ var (
 	gdbOutput                bytes.Buffer
 	lastGDBOutputLength      int
 	errProgramStopped        = errors.New("program stopped") // must contain "program stopped"
+	errProgramRunning        = errors.New("the program is running, press ctrl-c to pause it")
 	programRunning           bool
 	prevFlags                []string
 	longInstructionPaneWidth int // should the instruction pane be extra wide, if so, how wide?
 	gdbPathRust              *string
 	gdbPathRegular           *string
+	dlvPath                  *string
 )
 
-// DebugActivateBreakpoint sends break-insert to gdb together with the breakpoint in e.breakpoint, if available
-func (e *Editor) DebugActivateBreakpoint(sourceBaseFilename string) (string, error) {
-	if e.breakpoint != nil {
-		if retvalMap, err := e.gdb.CheckedSend("break-insert", fmt.Sprintf("%s:%d", sourceBaseFilename, e.breakpoint.LineNumber())); err != nil {
-			return fmt.Sprintf("%v", retvalMap), err
+// gdbSession returns the gdb session, if gdb is the debugger backend that is in use.
+// Used for the registers, flags and instructions panes, that are only available when using gdb.
+func (e *Editor) gdbSession() *gdb.Gdb {
+	if d, ok := e.debugger.(*gdbDebugger); ok {
+		return d.g
+	}
+	return nil
+}
+
+// debugStopped is called by the debugger backend when the program stops at a line
+func (e *Editor) debugStopped(filename string, lineNumber LineNumber) {
+	// The debugger backends select the innermost frame when the program stops
+	selectedStackFrame = 0
+	if filename != "" {
+		if absFilename, err := e.AbsFilename(); err == nil && filepath.Clean(filename) != absFilename {
+			// Stopped in a different file, stay at the current line
+			return
+		}
+	}
+	// Send the editor to the line, without any status messages
+	e.GoToLineNumber(lineNumber, nil, nil, true)
+}
+
+// goTestFunction finds the name and line number of the test function that contains the given line.
+// Returns an empty string if no test function was found.
+func (e *Editor) goTestFunction(y LineIndex) (string, LineNumber) {
+	for ; y >= 0; y-- {
+		line := e.Line(y)
+		if !strings.HasPrefix(line, "func Test") {
+			continue
+		}
+		name := strings.TrimPrefix(line, "func ")
+		if i := strings.Index(name, "("); i > 0 {
+			return name[:i], y.LineNumber()
 		}
-		return "", nil
+		break
 	}
-	return "", errors.New("e.breakpoint is not set")
+	return "", 0
 }
 
-// DebugStart will start a new debug session, using gdb.
-// Will end the existing session first if e.gdb != nil.
-func (e *Editor) DebugStart(sourceDir, sourceBaseFilename, executableBaseFilename string, doneFunc func()) (string, error) {
+// DebugStart will start a new debug session, using gdb, or Delve for Go.
+// Will end the existing session first if e.debugger != nil.
+// stoppedFunc is called after the program has stopped at a line, and doneFunc when it is done running.
+func (e *Editor) DebugStart(sourceDir, sourceBaseFilename, executableBaseFilename string, stoppedFunc, doneFunc func()) (string, error) {
 	if !noWriteToCache {
 		flogf(gdbLogFile, "[gdb] dir %s, src %s, exe %s\n", sourceDir, sourceBaseFilename, executableBaseFilename)
 	}
@@ -62,6 +94,9 @@ func (e *Editor) DebugStart(sourceDir, sourceBaseFilename, executableBaseFilenam
 	// End any existing sessions
 	e.DebugEnd()
 
+	// Restore the breakpoints from earlier sessions, if they have not been loaded already
+	e.LoadBreakpoints()
+
 	// Change directory to the sourcefile, temporarily
 	var err error
 	originalDirectory, err = os.Getwd()
@@ -72,95 +107,43 @@ func (e *Editor) DebugStart(sourceDir, sourceBaseFilename, executableBaseFilenam
 		}
 	}
 
-	// Find the path to either "rust-gdb" or "gdb", depending on the mode
-	gdbPath := e.findGDB()
-
-	// flogf(gdbLogFile, "[gdb] starting %s: ", gdbExecutable)
-
-	// Start a new gdb session
-	e.gdb, err = gdb.NewCustom([]string{gdbPath}, func(notification map[string]interface{}) {
-		// Handle messages from gdb, including frames that contains line numbers
-		if payload, ok := notification["payload"]; ok {
-			switch notification["type"] {
-			case "exec":
-				if payloadMap, ok := payload.(map[string]interface{}); ok {
-					if frame, ok := payloadMap["frame"]; ok {
-						if frameMap, ok := frame.(map[string]interface{}); ok {
-							if !noWriteToCache {
-								flogf(gdbLogFile, "[gdb] frame: %v\n", frameMap)
-							}
-							if lineNumberString, ok := frameMap["line"].(string); ok {
-								if lineNumber, err := strconv.Atoi(lineNumberString); err == nil { // success
-									// TODO: Fetch a different line number?
-									// Got a line number, send the editor there, without any status messages
-									e.GoToLineNumber(LineNumber(lineNumber), nil, nil, true)
-								}
-							}
-						}
-					}
-				}
-			case "console":
-				// output on stdout
-				if s, ok := payload.(string); ok {
-					gdbConsole.WriteString(s)
-				}
-			case "notify":
-				// notifications about events that are happening
-				if notification["class"] == "thread-group-exited" {
-					// gdb is done running
-					programRunning = false
-					doneFunc()
-				}
-			default:
-				// logf("[gdb] unrecognized notification: %v\n", notification)
+	// The debugger backends may call this from a different goroutine, when the program stops after a while
+	onStop := func(filename string, lineNumber LineNumber) {
+		e.debugStopped(filename, lineNumber)
+		stoppedFunc()
+	}
+
+	// Use Delve for Go, either "rust-gdb" or "gdb" for the modes gdb can handle, and a DAP adapter for the rest
+	var debugger Debugger
+	if adapter, ok := e.findDAPAdapter(); ok && !e.useGDB() {
+		debugger = newDAPDebugger(adapter, sourceDir, onStop, doneFunc)
+	} else if e.mode == mode.Go {
+		var (
+			args      []string
+			startLine LineNumber
+		)
+		if strings.HasSuffix(sourceBaseFilename, "_test.go") {
+			// Run only the test function that the cursor or the first breakpoint is in, and start at the top of it
+			testName, testLine := e.goTestFunction(e.DataY())
+			if enabled := e.breakpoints.Enabled(); testName == "" && len(enabled) > 0 {
+				testName, testLine = e.goTestFunction(enabled[0].Line.LineIndex())
+			}
+			if testName != "" {
+				args = []string{"-test.run", "^" + testName + "$"}
+				startLine = testLine
 			}
-			//} else {
-			//    logf("[gdb] callback without payload: %v\n", notification)
-		}
-	})
-	if err != nil {
-		e.gdb = nil
-		// flogf(gdbLogFile, "%s\n", "fail")
-		return "", err
-	}
-	if e.gdb == nil {
-		// flogf(gdbLogFile, "%s\n", "fail")
-		return "", errors.New("gdb.New returned no error, but e.gdb is nil")
-	}
-	// flogf(gdbLogFile, "%s\n", "ok")
-
-	// Handle output to stdout (and stderr?) from programs that are being debugged
-	go io.Copy(&gdbOutput, e.gdb)
-
-	// Load the executable file
-	if retvalMap, err := e.gdb.CheckedSend("file-exec-and-symbols", executableBaseFilename); err != nil {
-		return fmt.Sprintf("%v", retvalMap), err
-	}
-
-	// Pass in arguments
-	// e.gdb.Send("exec-arguments", "--version")
-
-	// Pass the breakpoint, if it has been set with ctrl-b
-	if e.breakpoint != nil {
-		if retvalMap, err := e.gdb.CheckedSend("break-insert", fmt.Sprintf("%s:%d", sourceBaseFilename, e.breakpoint.LineNumber())); err != nil {
-			return fmt.Sprintf("%v", retvalMap), err
 		}
+		debugger = newDelveDebugger(e.findDelve(), sourceDir, args, startLine, onStop, doneFunc)
+	} else {
+		debugger = newGDBDebugger(e.findGDB(), e.mode == mode.Assembly, onStop, doneFunc)
 	}
 
-	// Assembly specific
-	if e.mode == mode.Assembly {
-		e.gdb.Send("break-insert", "-t", "1")
-	}
-
-	// Set the disassembly style
-	e.gdb.Send("gdb-set", "disassembly-flavor", "intel")
-
-	// Start from the top
-	if _, err := e.gdb.CheckedSend("exec-run", "--start"); err != nil {
-		output := gdbOutput.String()
-		gdbOutput.Reset()
-		return output, err
+	// Start a new debug session
+	if err := debugger.Start(sourceBaseFilename, executableBaseFilename, e.breakpoints.Enabled()); err != nil {
+		debugger.Exit()
+		return "", err
 	}
+	e.debugger = debugger
 
 	// Add any existing watches
 	for varName := range watchMap {
@@ -169,57 +152,37 @@ func (e *Editor) DebugStart(sourceDir, sourceBaseFilename, executableBaseFilenam
 
 	programRunning = true
 
-	return "started gdb", nil
+	return "started debugging", nil
 }
 
 // DebugContinue will continue the execution to the next breakpoint or to the end.
-// e.gdb must not be nil.
+// e.debugger must not be nil.
 func (e *Editor) DebugContinue() error {
 	if !programRunning {
 		return errProgramStopped
 	}
-	_, err := e.gdb.CheckedSend("exec-continue")
-	return err
+	return e.debugger.Continue()
 }
 
 // DebugRun will run the current program.
-// e.gdb must not be nil.
+// e.debugger must not be nil.
 func (e *Editor) DebugRun() error {
-	_, err := e.gdb.CheckedSend("exec-run")
-	return err
+	if g := e.gdbSession(); g != nil {
+		_, err := g.CheckedSend("exec-run")
+		return err
+	}
+	return e.debugger.Continue()
 }
 
 // DebugNext will continue the execution by stepping to the next line.
-// e.gdb must not be nil.
+// e.debugger must not be nil.
 func (e *Editor) DebugNext() error {
 	if !programRunning {
 		return errProgramStopped
 	}
-	gdbMI := "exec-next"
-	if e.debugStepInto {
-		gdbMI = "exec-step"
-	}
-	if _, err := e.gdb.CheckedSend(gdbMI); err != nil {
+	if err := e.debugger.Next(e.debugStepInto); err != nil {
 		return err
 	}
-	consoleString := strings.TrimSpace(gdbConsole.String())
-	gdbConsole.Reset()
-	// Interpret consoleString and extract the new variable names and values,
-	// for variables there are watchpoints for.
-	if consoleString != "" {
-		var varName string
-		for _, line := range strings.Split(consoleString, "\n") {
-			if strings.Contains(line, "watchpoint") && strings.Contains(line, ":") {
-				fields := strings.SplitN(line, ":", 2)
-				varName = strings.TrimSpace(fields[1])
-			} else if varName != "" && strings.HasPrefix(line, "New value =") {
-				fields := strings.SplitN(line, "=", 2)
-				watchMap[varName] = strings.TrimSpace(fields[1])
-				lastSeenWatchVariable = varName
-				varName = ""
-			}
-		}
-	}
 	if !programRunning {
 		return errProgramStopped
 	}
@@ -227,38 +190,16 @@ func (e *Editor) DebugNext() error {
 }
 
 // DebugNextInstruction will continue the execution by stepping to the next instruction.
-// e.gdb must not be nil.
+// e.debugger must not be nil.
 func (e *Editor) DebugNextInstruction() error {
 	if !programRunning {
 		return errProgramStopped
 	}
-	showInstructionPane = true
-	gdbMI := "exec-next-instruction"
-	if e.debugStepInto {
-		gdbMI = "exec-step-instruction"
-	}
-	_, err := e.gdb.CheckedSend(gdbMI)
-	if err != nil {
+	// The instruction pane is only available when using gdb
+	showInstructionPane = e.gdbSession() != nil
+	if err := e.debugger.NextInstruction(e.debugStepInto); err != nil {
 		return err
 	}
-	consoleString := strings.TrimSpace(gdbConsole.String())
-	gdbConsole.Reset()
-	// Interpret consoleString and extract the new variable names and values,
-	// for variables there are watchpoints for.
-	if consoleString != "" {
-		var varName string
-		for _, line := range strings.Split(consoleString, "\n") {
-			if strings.Contains(line, "watchpoint") && strings.Contains(line, ":") {
-				fields := strings.SplitN(line, ":", 2)
-				varName = strings.TrimSpace(fields[1])
-			} else if varName != "" && strings.HasPrefix(line, "New value =") {
-				fields := strings.SplitN(line, "=", 2)
-				watchMap[varName] = strings.TrimSpace(fields[1])
-				lastSeenWatchVariable = varName
-				varName = ""
-			}
-		}
-	}
 	if !programRunning {
 		return errProgramStopped
 	}
@@ -266,32 +207,14 @@ func (e *Editor) DebugNextInstruction() error {
 }
 
 // DebugStep will continue the execution by stepping.
-// e.gdb must not be nil.
+// e.debugger must not be nil.
 func (e *Editor) DebugStep() error {
 	if !programRunning {
 		return errProgramStopped
 	}
-	if _, err := e.gdb.CheckedSend("exec-step"); err != nil {
+	if err := e.debugger.Step(); err != nil {
 		return err
 	}
-	consoleString := strings.TrimSpace(gdbConsole.String())
-	gdbConsole.Reset()
-	// Interpret consoleString and extract the new variable names and values,
-	// for variables there are watchpoints for.
-	if consoleString != "" {
-		var varName string
-		for _, line := range strings.Split(consoleString, "\n") {
-			if strings.Contains(line, "watchpoint") && strings.Contains(line, ":") {
-				fields := strings.SplitN(line, ":", 2)
-				varName = strings.TrimSpace(fields[1])
-			} else if varName != "" && strings.HasPrefix(line, "New value =") {
-				fields := strings.SplitN(line, "=", 2)
-				watchMap[varName] = strings.TrimSpace(fields[1])
-				lastSeenWatchVariable = varName
-				varName = ""
-			}
-		}
-	}
 	if !programRunning {
 		return errProgramStopped
 	}
@@ -299,42 +222,58 @@ func (e *Editor) DebugStep() error {
 }
 
 // DebugFinish will "step out".
-// e.gdb must not be nil. Returns whatever was outputted to gdb stdout.
+// e.debugger must not be nil.
 func (e *Editor) DebugFinish() error {
-	_, err := e.gdb.CheckedSend("exec-finish")
-	if err != nil {
+	if err := e.debugger.Finish(); err != nil {
 		return err
 	}
-	consoleString := strings.TrimSpace(gdbConsole.String())
-	gdbConsole.Reset()
-	// Interpret consoleString and extract the new variable names and values,
-	// for variables there are watchpoints for.
-	if consoleString != "" {
-		var varName string
-		for _, line := range strings.Split(consoleString, "\n") {
-			if strings.Contains(line, "watchpoint") && strings.Contains(line, ":") {
-				fields := strings.SplitN(line, ":", 2)
-				varName = strings.TrimSpace(fields[1])
-			} else if varName != "" && strings.HasPrefix(line, "New value =") {
-				fields := strings.SplitN(line, "=", 2)
-				watchMap[varName] = strings.TrimSpace(fields[1])
-				lastSeenWatchVariable = varName
-				varName = ""
-			}
-		}
-	}
 	if !programRunning {
 		return errProgramStopped
 	}
 	return nil
 }
 
+// DebugRunning returns true if the program is running in the background, after continuing or stepping
+func (e *Editor) DebugRunning() bool {
+	d, ok := e.debugger.(interruptDebugger)
+	return ok && d.Running()
+}
+
+// DebugInterrupt will pause the program, if it is running in the background
+func (e *Editor) DebugInterrupt() error {
+	d, ok := e.debugger.(interruptDebugger)
+	if !ok || !d.Running() {
+		return errors.New("the program is not running")
+	}
+	return d.Interrupt()
+}
+
+// DebugRedraw redraws the editor and the debug panes, after the program has stopped or ended in the background
+func (e *Editor) DebugRedraw(c *vt100.Canvas, status *StatusBar) {
+	if e.debugger == nil {
+		// The debug session is starting or ending, and will be drawn by the key loop
+		return
+	}
+	e.redraw.Store(true)
+	e.redrawCursor.Store(true)
+	e.RedrawAtEndOfKeyLoop(c, status, false, false)
+	const repositionCursor = false
+	e.DrawWatches(c, repositionCursor)
+	e.DrawRegisters(c, repositionCursor)
+	e.DrawCallStack(c, repositionCursor)
+	e.DrawGDBOutput(c, repositionCursor)
+	e.DrawInstructions(c, repositionCursor)
+	e.DrawFlags(c, repositionCursor)
+	e.EnableAndPlaceCursor(c)
+}
+
 // DebugRegisterNames will return all register names
 func (e *Editor) DebugRegisterNames() ([]string, error) {
-	if e.gdb == nil {
+	g := e.gdbSession()
+	if g == nil {
 		return []string{}, errors.New("gdb must be running")
 	}
-	notification, err := e.gdb.CheckedSend("data-list-register-names")
+	notification, err := g.CheckedSend("data-list-register-names")
 	if err != nil {
 		// flogf(gdbLogFile, "[gdb] data-list-register-names error: %s\n", err.Error())
 		return []string{}, err
@@ -360,8 +299,12 @@ func (e *Editor) DebugRegisterNames() ([]string, error) {
 
 // DebugChangedRegisters will return a list of all changed register numbers
 func (e *Editor) DebugChangedRegisters() ([]int, error) {
+	g := e.gdbSession()
+	if g == nil {
+		return []int{}, errors.New("gdb must be running")
+	}
 	// Then get the register values
-	notification, err := e.gdb.CheckedSend("data-list-changed-registers")
+	notification, err := g.CheckedSend("data-list-changed-registers")
 	if err != nil {
 		// flogf(gdbLogFile, "[gdb] data-list-changed-registers error: %s\n", err.Error())
 		return []int{}, err
@@ -389,8 +332,12 @@ func (e *Editor) DebugChangedRegisters() ([]int, error) {
 
 // DebugDisassemble will return the next N assembly instructions
 func (e *Editor) DebugDisassemble(n int) ([]string, error) {
+	g := e.gdbSession()
+	if g == nil {
+		return []string{}, errors.New("gdb must be running")
+	}
 	// Then get the register values
-	notification, err := e.gdb.CheckedSend("data-disassemble -s $pc -e \"$pc + 20\" -- 0")
+	notification, err := g.CheckedSend("data-disassemble -s $pc -e \"$pc + 20\" -- 0")
 	if err != nil {
 		// flogf(gdbLogFile, "[gdb] data-disassemble error: %s\n", err.Error())
 		return []string{}, err
@@ -434,7 +381,7 @@ func (e *Editor) DebugChangedRegisterMap() (map[string]string, error) {
 	}
 
 	// Then get the register IDs, then use them to get the register names and values
-	notification, err := e.gdb.CheckedSend("data-list-register-values", "--skip-unavailable", "x")
+	notification, err := e.gdbSession().CheckedSend("data-list-register-values", "--skip-unavailable", "x")
 	if err != nil {
 		// flogf(gdbLogFile, "[gdb] data-list-register-values error: %s\n", err.Error())
 		return nil, err
@@ -546,7 +493,7 @@ func (e *Editor) DebugRegisterMap() (map[string]string, error) {
 		return nil, err
 	}
 	// Then get the register IDs, then use them to get the register names and values
-	notification, err := e.gdb.CheckedSend("data-list-register-values", "--skip-unavailable", "x")
+	notification, err := e.gdbSession().CheckedSend("data-list-register-values", "--skip-unavailable", "x")
 	if err != nil {
 		// flogf(gdbLogFile, "[gdb] data-list-register-values error: %s\n", err.Error())
 		return nil, err
@@ -584,19 +531,21 @@ func (e *Editor) DebugRegisterMap() (map[string]string, error) {
 	return nil, errors.New("could not find the register values in the payload returned from gdb")
 }
 
-// DebugEnd will end the current gdb session, but not set debugMode to false
+// DebugEnd will end the current debug session, but not set debugMode to false
 func (e *Editor) DebugEnd() {
-	if e.gdb != nil {
-		e.gdb.Exit()
+	if e.debugger != nil {
+		e.debugger.Exit()
 	}
-	e.gdb = nil
+	e.debugger = nil
 	// Clear any existing output
 	gdbOutput.Reset()
 	gdbConsole.Reset()
 	// Clear the last seen variable
 	lastSeenWatchVariable = ""
-	// Clear the previous GDB stdout buffer length
+	// Clear the previous GDB stdout buffer length and the output pane scrolling
 	lastGDBOutputLength = 0
+	debugOutputScroll = 0
+	debugCommandsSent = false
 	// Also change to the original directory
 	if originalDirectory != "" {
 		os.Chdir(originalDirectory)
@@ -606,20 +555,21 @@ func (e *Editor) DebugEnd() {
 	// flogf(gdbLogFile, "[gdb] %s\n", "stopped")
 }
 
-// AddWatch will add a watchpoint / watch expression to gdb
+// AddWatch will add a watchpoint / watch expression to the debugger
 func (e *Editor) AddWatch(expression string) (string, error) {
 	var output string
-	if e.gdb != nil {
+	if _, ok := watchMap[expression]; !ok {
+		watchMap[expression] = "?"
+	}
+	if e.debugger != nil {
 		// flogf(gdbLogFile, "[gdb] adding watch: %s\n", expression)
-		_, err := e.gdb.CheckedSend("break-watch", "-a", expression)
-		if err != nil {
+		if err := e.debugger.AddWatch(expression); err != nil {
 			return "", err
 		}
 		output = gdbOutput.String()
 		gdbOutput.Reset()
 		// flogf(gdbLogFile, "[gdb] output after adding watch: %s\n", output)
 	}
-	watchMap[expression] = "?"
 
 	// Don't set this, the variable watch has not been seen yet
 	// lastSeenWatchVariable = expression
@@ -685,8 +635,9 @@ func (e *Editor) DrawWatches(c *vt100.Canvas, repositionCursor bool) {
 				"ctrl-f     : finish (step out)",
 				"ctrl-r     : run to end",
 				"ctrl-w     : add a watch",
-				"ctrl-p     : reg. pane layout",
+				"ctrl-p     : pane layout",
 				"ctrl-i     : toggle step into",
+				"ctrl-g     : debugger command",
 			}
 			if e.debugStepInto {
 				helpSlice[0] = "ctrl-space : step into"
@@ -704,8 +655,9 @@ func (e *Editor) DrawWatches(c *vt100.Canvas, repositionCursor bool) {
 				"ctrl-f: step out",
 				"ctrl-r: run to end",
 				"ctrl-w: add watch",
-				"ctrl-p: reg. pane",
+				"ctrl-p: pane layout",
 				"ctrl-i: toggle into",
+				"ctrl-g: command",
 			}
 			if e.debugStepInto {
 				narrowHelpSlice[0] = "ctrl-space: step into"
@@ -739,7 +691,7 @@ func (e *Editor) DrawWatches(c *vt100.Canvas, repositionCursor bool) {
 		}
 
 		// Highlight the top item if a debug session is active, and it was changed during this session
-		if foundLastSeen && e.gdb != nil {
+		if foundLastSeen && e.debugger != nil {
 			// Draw the list of watches, where the last changed one is highlighted (and at the top)
 			e.DrawList(bt, c, listBox, overview, 0)
 		} else {
@@ -762,7 +714,8 @@ func (e *Editor) DrawWatches(c *vt100.Canvas, repositionCursor bool) {
 
 // DrawFlags will draw the currently set flags (like zero, carry etc) at the bottom right
 func (e *Editor) DrawFlags(c *vt100.Canvas, repositionCursor bool) {
-	if e.gdb == nil {
+	g := e.gdbSession()
+	if g == nil {
 		return
 	}
 
@@ -777,7 +730,7 @@ func (e *Editor) DrawFlags(c *vt100.Canvas, repositionCursor bool) {
 
 	// Fetch the value of the machine flags (zero flag, carry etc)
 	// data-evalutate-expression is the same as print, output and call in gdb
-	if notification, err := e.gdb.CheckedSend("data-evaluate-expression", "$eflags"); err == nil {
+	if notification, err := g.CheckedSend("data-evaluate-expression", "$eflags"); err == nil {
 		if payload, ok := notification["payload"]; ok && notification["class"] == "done" {
 			if payloadMap, ok := payload.(map[string]interface{}); ok {
 				if flagNames, ok := payloadMap["value"]; ok {
@@ -850,7 +803,7 @@ func (e *Editor) DrawRegisters(c *vt100.Canvas, repositionCursor bool) error {
 		}
 	}()
 
-	if e.debugShowRegisters == noRegisterWindow || e.gdb == nil {
+	if e.debugPaneLayout() >= stackWindow || e.gdbSession() == nil {
 		// Don't draw anything
 		return nil
 	}
@@ -893,7 +846,7 @@ func (e *Editor) DrawRegisters(c *vt100.Canvas, repositionCursor bool) error {
 
 	e.DrawTitle(bt, c, lowerRightBox, title, true)
 
-	if e.gdb != nil {
+	if e.gdbSession() != nil {
 
 		allChangedRegisters, err := e.DebugChangedRegisterMap()
 		if err != nil {
@@ -951,7 +904,7 @@ func (e *Editor) DrawInstructions(c *vt100.Canvas, repositionCursor bool) error
 		}
 	}()
 
-	if showInstructionPane && e.gdb != nil {
+	if showInstructionPane && e.gdbSession() != nil {
 
 		// First create a box the size of the entire canvas
 		canvasBox := NewCanvasBox(c)
@@ -975,7 +928,7 @@ func (e *Editor) DrawInstructions(c *vt100.Canvas, repositionCursor bool) error
 
 		title := "Next instructions"
 
-		if e.gdb != nil {
+		if e.gdbSession() != nil {
 
 			numberOfInstructionsToFetch := 5
 			instructions, err := e.DebugDisassemble(numberOfInstructionsToFetch)
@@ -1067,11 +1020,15 @@ func (e *Editor) DrawInstructions(c *vt100.Canvas, repositionCursor bool) error
 // DrawGDBOutput will draw a pane with the 5 last lines of the collected stdoutput from GDB
 func (e *Editor) DrawGDBOutput(c *vt100.Canvas, repositionCursor bool) {
 	// Check if the output pane should be shown or not
-	if e.debugHideOutput || e.gdb == nil {
+	if e.debugHideOutput || e.debugger == nil {
 		return
 	}
 
-	const title = "stdout"
+	title := "stdout"
+	if debugCommandsSent {
+		// The output from debugger commands is also shown
+		title = "output"
+	}
 
 	// Gather the GDB stdout so far
 	collectedGDBOutput := strings.TrimSpace(gdbOutput.String())
@@ -1103,10 +1060,23 @@ func (e *Editor) DrawGDBOutput(c *vt100.Canvas, repositionCursor bool) {
 
 		e.DrawTitle(bt, c, lowerLeftBox, title, true)
 
-		// Get the last 5 lines, and create a string slice
+		// Get the last lines that fit in the box, or earlier lines if the pane is scrolled up with page up in the command prompt
 		lines := strings.Split(collectedGDBOutput, "\n")
-		if l := len(lines); l > 5 {
-			lines = lines[l-5:]
+		maxLines := 5
+		if debugCommandsSent && listBox.H > maxLines {
+			maxLines = listBox.H
+		}
+		end := len(lines) - debugOutputScroll
+		if end < 1 {
+			end = 1
+		}
+		start := end - maxLines
+		if start < 0 {
+			start = 0
+		}
+		lines = lines[start:end]
+		if debugOutputScroll > 0 {
+			title += " (scrolled)"
 		}
 
 		// Trim and shorten the lines
@@ -1138,7 +1108,7 @@ func (e *Editor) DrawGDBOutput(c *vt100.Canvas, repositionCursor bool) {
 	}
 }
 
-// DebugStartSession builds and then connects to gdb
+// DebugStartSession builds and then connects to gdb, or to Delve for Go
 func (e *Editor) DebugStartSession(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, optionalOutputExecutable string) error {
 	absFilename, err := e.AbsFilename()
 	if err != nil {
@@ -1157,6 +1127,11 @@ func (e *Editor) DebugStartSession(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 		outputExecutable = optionalOutputExecutable
 	}
 
+	// Interpreted languages, like Python, are debugged by launching the source file
+	if adapter, ok := e.findDAPAdapter(); ok && adapter.launchSource && !e.useGDB() {
+		outputExecutable = filepath.Base(absFilename)
+	}
+
 	outputExecutableClean := filepath.Clean(filepath.Join(filepath.Dir(absFilename), outputExecutable))
 	if !files.Exists(outputExecutableClean) {
 		e.debugMode = false
@@ -1164,15 +1139,19 @@ func (e *Editor) DebugStartSession(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 		return errors.New("could not find " + outputExecutableClean)
 	}
 
-	// Start GDB execution from the top
+	// Start debugging from the top
 	msg, err := e.DebugStart(filepath.Dir(absFilename), filepath.Base(absFilename), outputExecutable, func() {
-		// This happens when the program running under GDB is done running.
+		// This happens when the program stops at a line, which may be long after continuing or stepping
+		e.DebugRedraw(c, status)
+	}, func() {
+		// This happens when the program running under the debugger is done running.
 		programRunning = false
 		status.SetMessageAfterRedraw("Execution complete")
 		e.redraw.Store(true)
 		e.redrawCursor.Store(true)
+		e.DebugRedraw(c, status)
 	})
-	if err != nil || e.gdb == nil {
+	if err != nil || e.debugger == nil {
 		e.redrawCursor.Store(true)
 		if msg != "" {
 			msg += ", "
@@ -1184,15 +1163,55 @@ func (e *Editor) DebugStartSession(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 	e.GoToTop(c, nil)
 
 	status.ClearAll(c, false)
-	if e.breakpoint == nil {
+	switch enabled := e.breakpoints.Enabled(); len(enabled) {
+	case 0:
 		status.SetMessage("Running")
-	} else {
-		status.SetMessage("Running. Breakpoint at line " + e.breakpoint.LineNumber().String() + ".")
+	case 1:
+		status.SetMessage("Running. Breakpoint at line " + enabled[0].Line.String() + ".")
+	default:
+		status.SetMessage(fmt.Sprintf("Running. %d breakpoints.", len(enabled)))
 	}
 	status.Show(c, e)
 	return nil
 }
 
+// findDelve will find "dlv", in a memoized way to avoid more than one lookup
+func (e *Editor) findDelve() string {
+	if dlvPath == nil {
+		path := files.WhichCached("dlv")
+		dlvPath = &path
+		return path
+	}
+	return *dlvPath
+}
+
+// findDebugger will find the debugger that is used for the current mode: "dlv" for Go, gdb for the modes
+// that gdb can handle and a DAP adapter, like debugpy for Python, for the other modes
+func (e *Editor) findDebugger() string {
+	if e.mode == mode.Go {
+		return e.findDelve()
+	}
+	if e.useGDB() {
+		return e.findGDB()
+	}
+	if adapter, ok := e.findDAPAdapter(); ok {
+		return files.WhichCached(adapter.command[0])
+	}
+	return ""
+}
+
+// useGDB checks if gdb is available and might work for the current mode, or if there is no DAP adapter to use instead
+func (e *Editor) useGDB() bool {
+	if e.mode == mode.Go {
+		return false
+	}
+	if e.UsingGDBMightWork() && e.findGDB() != "" {
+		return true
+	}
+	_, foundAdapter := e.findDAPAdapter()
+	return !foundAdapter
+}
+
 // findGDB will find "rust-gdb" for mode.Rust or "gdb" for other
 // modes, but in a memoized way to avoid more than one lookup of each.
 func (e *Editor) findGDB() string {
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"github.com/xyproto/vt100"
+)
+
+var (
+	debugCommandHistoryFilename = filepath.Join(userCacheDir, "o", "debugcommands.txt")
+	debugCommandHistory         = NewSearchHistory(debugCommandHistoryFilename)
+	debugOutputScroll           int  // how many lines the output pane is scrolled up from the bottom
+	debugCommandsSent           bool // have commands been sent to the debugger, so that the output pane is more than stdout?
+)
+
+// scrollDebugOutput scrolls the output pane up (positive n) or down (negative n), and makes sure the pane is redrawn
+func scrollDebugOutput(n int) {
+	debugOutputScroll += n
+	if lineCount := strings.Count(strings.TrimSpace(gdbOutput.String()), "\n") + 1; debugOutputScroll >= lineCount {
+		debugOutputScroll = lineCount - 1
+	}
+	if debugOutputScroll < 0 {
+		debugOutputScroll = 0
+	}
+	lastGDBOutputLength = 0
+}
+
+// RunDebugCommand sends a free-form command to the debugger, and adds the command and its output to the output pane
+func (e *Editor) RunDebugCommand(command string) error {
+	cd, ok := e.debugger.(consoleDebugger)
+	if !ok {
+		return errors.New("the debugger does not accept commands")
+	}
+	output, err := cd.Command(command)
+	if !strings.HasSuffix(gdbOutput.String(), "\n") && gdbOutput.Len() > 0 {
+		gdbOutput.WriteString("\n")
+	}
+	gdbOutput.WriteString("(" + cd.Prompt() + ") " + command + "\n")
+	if output != "" {
+		gdbOutput.WriteString(output)
+		if !strings.HasSuffix(output, "\n") {
+			gdbOutput.WriteString("\n")
+		}
+	}
+	if err != nil {
+		gdbOutput.WriteString(err.Error() + "\n")
+	}
+	debugCommandsSent = true
+	// Show the output pane, scrolled to the bottom
+	e.debugHideOutput = false
+	debugOutputScroll = 0
+	lastGDBOutputLength = 0
+	return nil
+}
+
+// DebugCommandPrompt lets the user type in commands for the debugger, like "print x" or "x/16x $sp" for gdb,
+// until esc is pressed. The output is shown in the output pane, which can be scrolled with page up and page down.
+// Previous commands can be browsed with the arrow keys.
+func (e *Editor) DebugCommandPrompt(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) error {
+	cd, ok := e.debugger.(consoleDebugger)
+	if !ok || !programRunning {
+		return errors.New("no debug session in progress, start one with ctrl-space")
+	}
+
+	// Attempt to load the command history. Ignores errors, but does not try to load it twice if it fails.
+	if debugCommandHistory.Len() == 0 && !debugCommandHistory.FailedToLoad() {
+		debugCommandHistory = LoadSearchOrReplaceHistory(debugCommandHistoryFilename)
+	}
+
+	var (
+		prompt       = "(" + cd.Prompt() + ")"
+		entered      string
+		historyIndex = debugCommandHistory.Len()
+	)
+	const newestFirst = false
+
+	showPrompt := func() {
+		status.ClearAll(c, false)
+		status.SetMessage(prompt + " " + entered)
+		status.ShowNoTimeout(c, e)
+	}
+	drawPanes := func() {
+		const repositionCursor = false
+		e.DrawWatches(c, repositionCursor)
+		e.DrawRegisters(c, repositionCursor)
+		e.DrawCallStack(c, repositionCursor)
+		e.DrawGDBOutput(c, repositionCursor)
+		e.DrawInstructions(c, repositionCursor)
+		e.DrawFlags(c, repositionCursor)
+	}
+
+	showPrompt()
+	for {
+		drawPanes()
+		switch key := tty.String(); key {
+		case "c:27", "c:3", "c:7", "c:17": // esc, ctrl-c, ctrl-g or ctrl-q
+			status.ClearAll(c, true)
+			e.redraw.Store(true)
+			e.redrawCursor.Store(true)
+			return nil
+		case "c:8", "c:127": // ctrl-h or backspace
+			if len(entered) > 0 {
+				entered = entered[:len(entered)-1]
+				showPrompt()
+			}
+		case "c:13": // return
+			command := strings.TrimSpace(entered)
+			if command == "" {
+				break
+			}
+			entered = ""
+			debugCommandHistory.AddAndSave(command)
+			historyIndex = debugCommandHistory.Len()
+			if err := e.RunDebugCommand(command); err != nil {
+				return err
+			}
+			if !programRunning {
+				// The command ended the program
+				return errProgramStopped
+			}
+			// Commands like "set var" or "frame" may change the watches, the call stack and the current line
+			e.redraw.Store(true)
+			e.redrawCursor.Store(true)
+			e.HideCursorDrawLines(c, true, false, true)
+			showPrompt()
+		case upArrow: // previous command in the history
+			if debugCommandHistory.Empty() {
+				break
+			}
+			historyIndex--
+			if historyIndex < 0 {
+				// wraparound
+				historyIndex = debugCommandHistory.Len() - 1
+			}
+			entered = debugCommandHistory.GetIndex(historyIndex, newestFirst)
+			showPrompt()
+		case downArrow: // next command in the history
+			if debugCommandHistory.Empty() {
+				break
+			}
+			historyIndex++
+			if historyIndex >= debugCommandHistory.Len() {
+				// wraparound
+				historyIndex = 0
+			}
+			entered = debugCommandHistory.GetIndex(historyIndex, newestFirst)
+			showPrompt()
+		case pgUpKey: // scroll the output pane up
+			scrollDebugOutput(5)
+		case pgDnKey: // scroll the output pane down
+			scrollDebugOutput(-5)
+		default:
+			if key != "" && !strings.HasPrefix(key, "c:") {
+				entered += key
+				showPrompt()
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// fakeConsoleDebugger is a Debugger that only handles commands
+type fakeConsoleDebugger struct {
+	Debugger
+	commands []string
+}
+
+func (f *fakeConsoleDebugger) Command(command string) (string, error) {
+	f.commands = append(f.commands, command)
+	if command == "oops" {
+		return "", errors.New("no symbol \"oops\" in current context")
+	}
+	return "$1 = 42", nil
+}
+
+func (f *fakeConsoleDebugger) Prompt() string {
+	return "gdb"
+}
+
+func TestRunDebugCommand(t *testing.T) {
+	defer func() {
+		gdbOutput.Reset()
+		debugOutputScroll = 0
+		debugCommandsSent = false
+	}()
+	gdbOutput.Reset()
+	gdbOutput.WriteString("hello from the program")
+
+	e := NewSimpleEditor(80)
+	fake := &fakeConsoleDebugger{}
+	e.debugger = fake
+	e.debugHideOutput = true
+
+	if err := e.RunDebugCommand("print x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.RunDebugCommand("oops"); err != nil {
+		t.Fatal(err)
+	}
+	expected := "hello from the program\n(gdb) print x\n$1 = 42\n(gdb) oops\nno symbol \"oops\" in current context\n"
+	if got := gdbOutput.String(); got != expected {
+		t.Errorf("unexpected output:\n%q\nexpected:\n%q", got, expected)
+	}
+	if len(fake.commands) != 2 || !debugCommandsSent || e.debugHideOutput {
+		t.Errorf("expected the commands to be sent and the output pane to be shown")
+	}
+
+	// Scrolling is limited by the number of lines in the output
+	scrollDebugOutput(100)
+	if debugOutputScroll != 4 {
+		t.Errorf("expected to scroll up to line 1, got %d", debugOutputScroll)
+	}
+	scrollDebugOutput(-100)
+	if debugOutputScroll != 0 {
+		t.Errorf("expected to scroll down to the bottom, got %d", debugOutputScroll)
+	}
+
+	// A debugger without a console can not run commands
+	e.debugger = nil
+	if err := e.RunDebugCommand("print x"); err == nil {
+		t.Errorf("expected an error when there is no debugger")
+	}
+}
@@ -0,0 +1,460 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/cyrus-and/gdb"
+)
+
+// Debugger is a debugger backend, like gdb or Delve, that debug mode can use for running and stepping through programs.
+// Output from the program that is being debugged is collected in gdbOutput, and watch values are stored in watchMap.
+type Debugger interface {
+	// Start loads the given executable, places the breakpoints and runs the program to the start of main
+	Start(sourceBaseFilename, executableBaseFilename string, breakpoints Breakpoints) error
+	// Continue runs the program until the next breakpoint, or until it ends
+	Continue() error
+	// Next steps to the next line, or into a function call if stepInto is true
+	Next(stepInto bool) error
+	// NextInstruction steps to the next instruction, or into a function call if stepInto is true
+	NextInstruction(stepInto bool) error
+	// Step steps to the next line, into function calls
+	Step() error
+	// Finish runs the program until the current function returns
+	Finish() error
+	// SetBreakpoint places a breakpoint, or replaces the breakpoint at the same line
+	SetBreakpoint(sourceBaseFilename string, breakpoint Breakpoint) error
+	// ClearBreakpoint removes the breakpoint at the given line, if there is one
+	ClearBreakpoint(sourceBaseFilename string, lineNumber LineNumber) error
+	// AddWatch starts watching the given expression
+	AddWatch(expression string) error
+	// Exit ends the debug session
+	Exit()
+}
+
+// StackFrame is one frame in the call stack of the program that is being debugged
+type StackFrame struct {
+	Function string
+	Filename string
+	Line     LineNumber
+}
+
+// DebugVariable is a variable and its value, in the selected frame of the program that is being debugged.
+// Structs, arrays and similar have the fields or elements as children.
+type DebugVariable struct {
+	Name     string
+	Value    string
+	Children []DebugVariable
+}
+
+// stackDebugger is a Debugger that can list the call stack and the local variables of the selected frame
+type stackDebugger interface {
+	// StackFrames returns the call stack, with the innermost frame first
+	StackFrames() []StackFrame
+	// Locals returns the local variables of the selected frame
+	Locals() []DebugVariable
+	// SelectFrame selects the frame with the given index in the call stack, where 0 is the innermost frame
+	SelectFrame(index int) error
+}
+
+// consoleDebugger is a Debugger that can run free-form commands, like "print x" or "x/16x $sp" for gdb
+type consoleDebugger interface {
+	// Command runs the given command and returns the output
+	Command(command string) (string, error)
+	// Prompt returns a short name for the debugger, for the command prompt
+	Prompt() string
+}
+
+// interruptDebugger is a Debugger that runs the program in the background when continuing or stepping,
+// and then calls onStop or onExit from another goroutine, once the program stops or ends
+type interruptDebugger interface {
+	// Running returns true while the program runs in the background
+	Running() bool
+	// Interrupt pauses the program while it is running, so that it stops at the line it is at
+	Interrupt() error
+}
+
+// maxExpandedLocals is how many local variables the fields are fetched for, by debugger backends that need one request per variable
+const maxExpandedLocals = 16
+
+// gdbDebugger is a Debugger that uses gdb and its machine interface
+type gdbDebugger struct {
+	g           *gdb.Gdb
+	gdbPath     string
+	assembly    bool
+	onStop      func(filename string, lineNumber LineNumber) // called when the program stops at a line
+	onExit      func()                                       // called when the program is done running
+	breakpoints map[string]string                            // gdb breakpoint numbers, per "filename:line"
+}
+
+// newGDBDebugger prepares a new gdb debugger backend, but does not start gdb
+func newGDBDebugger(gdbPath string, assembly bool, onStop func(string, LineNumber), onExit func()) *gdbDebugger {
+	return &gdbDebugger{gdbPath: gdbPath, assembly: assembly, onStop: onStop, onExit: onExit, breakpoints: make(map[string]string)}
+}
+
+// Start will start gdb, load the executable and run the program to the start of main
+func (d *gdbDebugger) Start(sourceBaseFilename, executableBaseFilename string, breakpoints Breakpoints) error {
+	var err error
+	d.g, err = gdb.NewCustom([]string{d.gdbPath}, func(notification map[string]interface{}) {
+		// Handle messages from gdb, including frames that contains line numbers
+		if payload, ok := notification["payload"]; ok {
+			switch notification["type"] {
+			case "exec":
+				if payloadMap, ok := payload.(map[string]interface{}); ok {
+					if frame, ok := payloadMap["frame"]; ok {
+						if frameMap, ok := frame.(map[string]interface{}); ok {
+							if !noWriteToCache {
+								flogf(gdbLogFile, "[gdb] frame: %v\n", frameMap)
+							}
+							if lineNumberString, ok := frameMap["line"].(string); ok {
+								if lineNumber, err := strconv.Atoi(lineNumberString); err == nil { // success
+									// TODO: Fetch a different line number?
+									// Got a line number, send the editor there, without any status messages
+									filename, _ := frameMap["fullname"].(string)
+									d.onStop(filename, LineNumber(lineNumber))
+								}
+							}
+						}
+					}
+				}
+			case "console":
+				// output on stdout
+				if s, ok := payload.(string); ok {
+					gdbConsole.WriteString(s)
+				}
+			case "notify":
+				// notifications about events that are happening
+				if notification["class"] == "thread-group-exited" {
+					// gdb is done running
+					programRunning = false
+					d.onExit()
+				}
+			default:
+				// logf("[gdb] unrecognized notification: %v\n", notification)
+			}
+			//} else {
+			//    logf("[gdb] callback without payload: %v\n", notification)
+		}
+	})
+	if err != nil {
+		d.g = nil
+		return err
+	}
+	if d.g == nil {
+		return errors.New("gdb.New returned no error, but the gdb session is nil")
+	}
+
+	// Handle output to stdout (and stderr?) from programs that are being debugged
+	go io.Copy(&gdbOutput, d.g)
+
+	// Load the executable file
+	if retvalMap, err := d.g.CheckedSend("file-exec-and-symbols", executableBaseFilename); err != nil {
+		return fmt.Errorf("%v, %w", retvalMap, err)
+	}
+
+	// Pass in arguments
+	// d.g.Send("exec-arguments", "--version")
+
+	// Pass the breakpoints that have been set with ctrl-b
+	for _, breakpoint := range breakpoints {
+		if err := d.SetBreakpoint(sourceBaseFilename, breakpoint); err != nil {
+			return err
+		}
+	}
+
+	// Assembly specific
+	if d.assembly {
+		d.g.Send("break-insert", "-t", "1")
+	}
+
+	// Set the disassembly style
+	d.g.Send("gdb-set", "disassembly-flavor", "intel")
+
+	// Start from the top
+	if _, err := d.g.CheckedSend("exec-run", "--start"); err != nil {
+		output := gdbOutput.String()
+		gdbOutput.Reset()
+		if output != "" {
+			return fmt.Errorf("%s, %w", output, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// gdbBreakInsertArguments returns the arguments for break-insert, for the given breakpoint
+func gdbBreakInsertArguments(location string, breakpoint Breakpoint) []string {
+	var args []string
+	if breakpoint.Condition != "" {
+		args = append(args, "-c", breakpoint.Condition)
+	}
+	if breakpoint.HitCount > 1 {
+		// Ignore the breakpoint until it is reached for the given time
+		args = append(args, "-i", strconv.Itoa(breakpoint.HitCount-1))
+	}
+	return append(args, location)
+}
+
+// SetBreakpoint sends break-insert to gdb, after removing any existing breakpoint at the same line
+func (d *gdbDebugger) SetBreakpoint(sourceBaseFilename string, breakpoint Breakpoint) error {
+	if err := d.ClearBreakpoint(sourceBaseFilename, breakpoint.Line); err != nil {
+		return err
+	}
+	location := fmt.Sprintf("%s:%d", sourceBaseFilename, breakpoint.Line)
+	retvalMap, err := d.g.CheckedSend("break-insert", gdbBreakInsertArguments(location, breakpoint)...)
+	if err != nil {
+		return fmt.Errorf("%v, %w", retvalMap, err)
+	}
+	// Remember the breakpoint number, for removing the breakpoint later
+	if payloadMap, ok := retvalMap["payload"].(map[string]interface{}); ok {
+		if bkptMap, ok := payloadMap["bkpt"].(map[string]interface{}); ok {
+			if number, ok := bkptMap["number"].(string); ok {
+				d.breakpoints[location] = number
+			}
+		}
+	}
+	return nil
+}
+
+// ClearBreakpoint sends break-delete to gdb, if there is a breakpoint at the given line
+func (d *gdbDebugger) ClearBreakpoint(sourceBaseFilename string, lineNumber LineNumber) error {
+	location := fmt.Sprintf("%s:%d", sourceBaseFilename, lineNumber)
+	number, found := d.breakpoints[location]
+	if !found {
+		return nil
+	}
+	delete(d.breakpoints, location)
+	if retvalMap, err := d.g.CheckedSend("break-delete", number); err != nil {
+		return fmt.Errorf("%v, %w", retvalMap, err)
+	}
+	return nil
+}
+
+// Continue will continue the execution to the next breakpoint or to the end
+func (d *gdbDebugger) Continue() error {
+	_, err := d.g.CheckedSend("exec-continue")
+	return err
+}
+
+// send sends the given command to gdb, and then updates the watches from the console output
+func (d *gdbDebugger) send(gdbMI string) error {
+	if _, err := d.g.CheckedSend(gdbMI); err != nil {
+		return err
+	}
+	consoleString := strings.TrimSpace(gdbConsole.String())
+	gdbConsole.Reset()
+	// Interpret consoleString and extract the new variable names and values,
+	// for variables there are watchpoints for.
+	if consoleString != "" {
+		var varName string
+		for _, line := range strings.Split(consoleString, "\n") {
+			if strings.Contains(line, "watchpoint") && strings.Contains(line, ":") {
+				fields := strings.SplitN(line, ":", 2)
+				varName = strings.TrimSpace(fields[1])
+			} else if varName != "" && strings.HasPrefix(line, "New value =") {
+				fields := strings.SplitN(line, "=", 2)
+				watchMap[varName] = strings.TrimSpace(fields[1])
+				lastSeenWatchVariable = varName
+				varName = ""
+			}
+		}
+	}
+	return nil
+}
+
+// Next will continue the execution by stepping to the next line
+func (d *gdbDebugger) Next(stepInto bool) error {
+	if stepInto {
+		return d.send("exec-step")
+	}
+	return d.send("exec-next")
+}
+
+// NextInstruction will continue the execution by stepping to the next instruction
+func (d *gdbDebugger) NextInstruction(stepInto bool) error {
+	if stepInto {
+		return d.send("exec-step-instruction")
+	}
+	return d.send("exec-next-instruction")
+}
+
+// Step will continue the execution by stepping
+func (d *gdbDebugger) Step() error {
+	return d.send("exec-step")
+}
+
+// Finish will "step out"
+func (d *gdbDebugger) Finish() error {
+	return d.send("exec-finish")
+}
+
+// AddWatch will add a watchpoint to gdb
+func (d *gdbDebugger) AddWatch(expression string) error {
+	_, err := d.g.CheckedSend("break-watch", "-a", expression)
+	return err
+}
+
+// StackFrames returns the call stack, by sending stack-list-frames to gdb
+func (d *gdbDebugger) StackFrames() []StackFrame {
+	if d.g == nil || !programRunning {
+		return nil
+	}
+	notification, err := d.g.CheckedSend("stack-list-frames", "0", "19")
+	if err != nil {
+		return nil
+	}
+	payloadMap, ok := notification["payload"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	stack, ok := payloadMap["stack"].([]interface{})
+	if !ok {
+		return nil
+	}
+	var frames []StackFrame
+	for _, item := range stack {
+		itemMap, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		frameMap, ok := itemMap["frame"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		var frame StackFrame
+		frame.Function, _ = frameMap["func"].(string)
+		frame.Filename, _ = frameMap["fullname"].(string)
+		if lineNumberString, ok := frameMap["line"].(string); ok {
+			if lineNumber, err := strconv.Atoi(lineNumberString); err == nil { // success
+				frame.Line = LineNumber(lineNumber)
+			}
+		}
+		if frame.Function == "" {
+			frame.Function, _ = frameMap["addr"].(string)
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+// Locals returns the arguments and local variables of the selected frame, by sending stack-list-variables to gdb
+func (d *gdbDebugger) Locals() []DebugVariable {
+	if d.g == nil || !programRunning {
+		return nil
+	}
+	notification, err := d.g.CheckedSend("stack-list-variables", "--all-values")
+	if err != nil {
+		return nil
+	}
+	payloadMap, ok := notification["payload"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	variables, ok := payloadMap["variables"].([]interface{})
+	if !ok {
+		return nil
+	}
+	var locals []DebugVariable
+	for _, item := range variables {
+		variableMap, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := variableMap["name"].(string)
+		value, _ := variableMap["value"].(string)
+		locals = append(locals, DebugVariable{Name: name, Value: value, Children: parseGDBValue(value)})
+	}
+	return locals
+}
+
+// SelectFrame sends stack-select-frame to gdb
+func (d *gdbDebugger) SelectFrame(index int) error {
+	if d.g == nil {
+		return errProgramStopped
+	}
+	_, err := d.g.CheckedSend("stack-select-frame", strconv.Itoa(index))
+	return err
+}
+
+// Command sends the given command to the gdb console, and returns the console output
+func (d *gdbDebugger) Command(command string) (string, error) {
+	if d.g == nil {
+		return "", errProgramStopped
+	}
+	gdbConsole.Reset()
+	_, err := d.g.CheckedSend("interpreter-exec", "console", command)
+	output := gdbConsole.String()
+	gdbConsole.Reset()
+	return output, err
+}
+
+// Prompt returns "gdb"
+func (d *gdbDebugger) Prompt() string {
+	return "gdb"
+}
+
+// splitGDBValue splits a gdb value like `1, {2, 3}, "a, b"` at the commas that are not within braces or quotes
+func splitGDBValue(s string) []string {
+	var (
+		fields  []string
+		depth   int
+		start   int
+		quoted  rune
+		escaped bool
+	)
+	for i, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case quoted != 0:
+			if r == quoted {
+				quoted = 0
+			}
+		case r == '"' || r == '\'':
+			quoted = r
+		case r == '{' || r == '[' || r == '(' || r == '<':
+			depth++
+		case r == '}' || r == ']' || r == ')' || r == '>':
+			depth--
+		case r == ',' && depth == 0:
+			fields = append(fields, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" {
+		fields = append(fields, last)
+	}
+	return fields
+}
+
+// parseGDBValue parses the fields of a struct like "{x = 1, y = {a = 2}}", or the elements of an array like "{1, 2}".
+// Returns nil if the value is not a struct or an array.
+func parseGDBValue(value string) []DebugVariable {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "{") || !strings.HasSuffix(value, "}") {
+		return nil
+	}
+	var children []DebugVariable
+	for i, field := range splitGDBValue(value[1 : len(value)-1]) {
+		name, fieldValue, found := strings.Cut(field, " = ")
+		if !found || strings.HasPrefix(name, "{") || strings.HasPrefix(name, "\"") {
+			// An array element
+			name, fieldValue = "["+strconv.Itoa(i)+"]", field
+		}
+		children = append(children, DebugVariable{Name: name, Value: fieldValue, Children: parseGDBValue(fieldValue)})
+	}
+	return children
+}
+
+// Exit ends the gdb session
+func (d *gdbDebugger) Exit() {
+	if d.g != nil {
+		d.g.Exit()
+	}
+	d.g = nil
+}
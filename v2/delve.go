@@ -0,0 +1,544 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The types below mirror the parts of the Delve JSON-RPC API (github.com/go-delve/delve/service/api) that are used here
+
+type delveFunction struct {
+	Name string `json:"name"`
+}
+
+type delveThread struct {
+	Function *delveFunction `json:"function,omitempty"`
+	File     string         `json:"file"`
+	Line     int            `json:"line"`
+}
+
+type delveState struct {
+	CurrentThread *delveThread `json:"currentThread,omitempty"`
+	Running       bool
+	Exited        bool `json:"exited"`
+	ExitStatus    int  `json:"exitStatus"`
+}
+
+type delveBreakpoint struct {
+	File         string `json:"file"`
+	FunctionName string `json:"functionName,omitempty"`
+	Cond         string `json:"Cond,omitempty"`
+	HitCond      string `json:"hitCond,omitempty"`
+	ID           int    `json:"id"`
+	Line         int    `json:"line"`
+}
+
+type delveVariable struct {
+	Name     string          `json:"name"`
+	Value    string          `json:"value"`
+	Type     string          `json:"type"`
+	Children []delveVariable `json:"children"`
+	Kind     int             `json:"kind"`
+}
+
+type delveLoadConfig struct {
+	FollowPointers     bool
+	MaxVariableRecurse int
+	MaxStringLen       int
+	MaxArrayValues     int
+	MaxStructFields    int
+}
+
+type delveEvalScope struct {
+	GoroutineID  int64
+	Frame        int
+	DeferredCall int
+}
+
+type delveCommandIn struct {
+	Name string `json:"name"`
+}
+
+type delveCommandOut struct {
+	State delveState
+}
+
+type delveCreateBreakpointIn struct {
+	Breakpoint delveBreakpoint
+}
+
+type delveCreateBreakpointOut struct {
+	Breakpoint delveBreakpoint
+}
+
+type delveClearBreakpointIn struct {
+	Id int // the field name is part of the Delve API
+}
+
+type delveClearBreakpointOut struct {
+	Breakpoint *delveBreakpoint
+}
+
+type delveEvalIn struct {
+	Cfg   *delveLoadConfig
+	Expr  string
+	Scope delveEvalScope
+}
+
+type delveEvalOut struct {
+	Variable *delveVariable
+}
+
+type delveStackframe struct {
+	Function  *delveFunction `json:"function,omitempty"`
+	File      string         `json:"file"`
+	Line      int            `json:"line"`
+	Locals    []delveVariable
+	Arguments []delveVariable
+}
+
+type delveStacktraceIn struct {
+	Cfg   *delveLoadConfig
+	Id    int64 // the field name is part of the Delve API
+	Depth int
+	Full  bool
+}
+
+type delveStacktraceOut struct {
+	Locations []delveStackframe
+}
+
+type delveDetachIn struct {
+	Kill bool
+}
+
+type delveDetachOut struct{}
+
+// The reflect.Kind value that Delve uses for strings
+const delveKindString = 24
+
+// delveListeningPrefix is what a headless Delve server writes to stdout when it is ready for connections
+const delveListeningPrefix = "API server listening at: "
+
+// delveDebugger is a Debugger that uses a headless Delve server, for debugging Go programs
+type delveDebugger struct {
+	cmd           *exec.Cmd
+	client        *rpc.Client
+	dlvPath       string
+	sourceDir     string
+	args          []string                                     // arguments for the program, like -test.run for test executables
+	startLine     LineNumber                                   // where to start in the source file, or 0 to start at main.main
+	frames        []delveStackframe                            // the call stack, from the last time the program stopped
+	frame         int                                          // the index of the selected frame
+	breakpointIDs map[string]int                               // Delve breakpoint IDs, per "filename:line"
+	onStop        func(filename string, lineNumber LineNumber) // called when the program stops at a line
+	onExit        func()                                       // called when the program is done running
+	running       atomic.Bool                                  // true while the program runs in the background, after continuing or stepping
+	waiting       sync.WaitGroup                               // for the goroutine that waits for a command to return
+}
+
+// newDelveDebugger prepares a new Delve debugger backend, but does not start Delve.
+// startLine is the line in the source file where the program should first stop, like the start of a test function,
+// or 0 to stop at the start of main.main.
+func newDelveDebugger(dlvPath, sourceDir string, args []string, startLine LineNumber, onStop func(string, LineNumber), onExit func()) *delveDebugger {
+	return &delveDebugger{dlvPath: dlvPath, sourceDir: sourceDir, args: args, startLine: startLine, onStop: onStop, onExit: onExit, breakpointIDs: make(map[string]int)}
+}
+
+// Start will start a headless Delve server for the given executable, connect to it
+// and then run the program until main.main or the start of the test function
+func (d *delveDebugger) Start(sourceBaseFilename, executableBaseFilename string, breakpoints Breakpoints) error {
+	args := []string{"exec", executableBaseFilename, "--headless", "--api-version=2", "--listen=127.0.0.1:0"}
+	if len(d.args) > 0 {
+		args = append(append(args, "--"), d.args...)
+	}
+	d.cmd = exec.Command(d.dlvPath, args...)
+	d.cmd.Dir = d.sourceDir
+	stdout, err := d.cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	// Let output to stderr from both Delve and the program end up in the same pipe
+	d.cmd.Stderr = d.cmd.Stdout
+	if err := d.cmd.Start(); err != nil {
+		return err
+	}
+
+	// Wait for Delve to report which address it is listening at
+	addrChan := make(chan string, 1)
+	go func() {
+		reader := bufio.NewReader(stdout)
+		for {
+			line, err := reader.ReadString('\n')
+			if strings.HasPrefix(line, delveListeningPrefix) {
+				addrChan <- strings.TrimSpace(strings.TrimPrefix(line, delveListeningPrefix))
+				break
+			}
+			if err != nil {
+				addrChan <- ""
+				return
+			}
+		}
+		// Handle output from the program that is being debugged
+		io.Copy(&gdbOutput, reader)
+	}()
+	var addr string
+	select {
+	case addr = <-addrChan:
+	case <-time.After(10 * time.Second):
+	}
+	if addr == "" {
+		d.Exit()
+		if output := strings.TrimSpace(gdbOutput.String()); output != "" {
+			return errors.New(output)
+		}
+		return errors.New("could not start dlv")
+	}
+
+	client, err := jsonrpc.Dial("tcp", addr)
+	if err != nil {
+		d.Exit()
+		return err
+	}
+	return d.connect(client, sourceBaseFilename, breakpoints)
+}
+
+// connect uses the given client for communicating with Delve, places the breakpoints
+// and runs the program until main.main or the start of the test function
+func (d *delveDebugger) connect(client *rpc.Client, sourceBaseFilename string, breakpoints Breakpoints) error {
+	d.client = client
+
+	// Pass the breakpoints that have been set with ctrl-b
+	for _, breakpoint := range breakpoints {
+		if err := d.SetBreakpoint(sourceBaseFilename, breakpoint); err != nil {
+			return err
+		}
+	}
+
+	// Run to the start of main.main, or to the start of the test function, using a temporary breakpoint
+	start := delveBreakpoint{FunctionName: "main.main"}
+	if d.startLine > 0 {
+		start = delveBreakpoint{File: filepath.Join(d.sourceDir, sourceBaseFilename), Line: int(d.startLine)}
+	}
+	var out delveCreateBreakpointOut
+	if err := d.client.Call("RPCServer.CreateBreakpoint", delveCreateBreakpointIn{start}, &out); err != nil {
+		// The breakpoint may already be there, or there may be no main.main, just start from the top
+		return d.run("continue")
+	}
+	err := d.run("continue")
+	d.client.Call("RPCServer.ClearBreakpoint", delveClearBreakpointIn{out.Breakpoint.ID}, &delveClearBreakpointOut{})
+	return err
+}
+
+// command sends a command like "next" or "continue" to Delve in the background.
+// onStop or onExit is called from the goroutine that waits for the command, which may be long after command has returned.
+func (d *delveDebugger) command(name string) error {
+	if d.client == nil {
+		return errProgramStopped
+	}
+	if !d.running.CompareAndSwap(false, true) {
+		return errProgramRunning
+	}
+	client := d.client
+	d.waiting.Add(1)
+	go func() {
+		defer d.waiting.Done()
+		var out delveCommandOut
+		err := client.Call("RPCServer.Command", delveCommandIn{name}, &out)
+		// If Exit has cleared the flag, the debug session is over
+		if d.running.CompareAndSwap(true, false) {
+			d.stopped(&out, err)
+		}
+	}()
+	return nil
+}
+
+// run sends a command like "continue" to Delve, and waits for the program to stop
+func (d *delveDebugger) run(name string) error {
+	var out delveCommandOut
+	err := d.client.Call("RPCServer.Command", delveCommandIn{name}, &out)
+	return d.stopped(&out, err)
+}
+
+// stopped handles the state that Delve returned for a command, by loading the call stack and updating the watches,
+// and then going to the new location
+func (d *delveDebugger) stopped(out *delveCommandOut, err error) error {
+	if err != nil {
+		if strings.Contains(err.Error(), "has exited") {
+			programRunning = false
+			d.onExit()
+			return errProgramStopped
+		}
+		return err
+	}
+	if out.State.Exited {
+		programRunning = false
+		d.onExit()
+		return errProgramStopped
+	}
+	d.loadStack()
+	d.updateWatches()
+	if t := out.State.CurrentThread; t != nil && t.Line > 0 {
+		d.onStop(t.File, LineNumber(t.Line))
+	}
+	return nil
+}
+
+// formatDelveVariable returns a short string representation of the given variable
+func formatDelveVariable(v *delveVariable) string {
+	if v.Kind == delveKindString {
+		return strconv.Quote(v.Value)
+	}
+	if v.Value != "" || len(v.Children) == 0 {
+		return v.Value
+	}
+	var sb strings.Builder
+	sb.WriteString("{")
+	for i := range v.Children {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		if i >= 8 {
+			sb.WriteString("...")
+			break
+		}
+		sb.WriteString(formatDelveVariable(&v.Children[i]))
+	}
+	sb.WriteString("}")
+	return sb.String()
+}
+
+// newDelveLoadConfig returns how much of a variable Delve should load
+func newDelveLoadConfig() *delveLoadConfig {
+	return &delveLoadConfig{FollowPointers: true, MaxVariableRecurse: 1, MaxStringLen: 64, MaxArrayValues: 16, MaxStructFields: -1}
+}
+
+// loadStack fetches the call stack, including the arguments and local variables of each frame
+func (d *delveDebugger) loadStack() {
+	var out delveStacktraceOut
+	d.frames = nil
+	d.frame = 0
+	if err := d.client.Call("RPCServer.Stacktrace", delveStacktraceIn{Id: -1, Depth: 20, Full: true, Cfg: newDelveLoadConfig()}, &out); err == nil {
+		d.frames = out.Locations
+	}
+}
+
+// delveDebugVariable converts a variable from Delve, where elements of arrays and slices have no names
+func delveDebugVariable(v *delveVariable) DebugVariable {
+	dv := DebugVariable{Name: v.Name, Value: formatDelveVariable(v)}
+	for i := range v.Children {
+		child := delveDebugVariable(&v.Children[i])
+		if child.Name == "" {
+			child.Name = "[" + strconv.Itoa(i) + "]"
+		}
+		dv.Children = append(dv.Children, child)
+	}
+	return dv
+}
+
+// eval evaluates the given expression in the selected frame
+func (d *delveDebugger) eval(expression string) (string, error) {
+	in := delveEvalIn{
+		Scope: delveEvalScope{GoroutineID: -1, Frame: d.frame},
+		Expr:  expression,
+		Cfg:   newDelveLoadConfig(),
+	}
+	var out delveEvalOut
+	if err := d.client.Call("RPCServer.Eval", in, &out); err != nil {
+		return "", err
+	}
+	if out.Variable == nil {
+		return "", fmt.Errorf("could not evaluate %s", expression)
+	}
+	return formatDelveVariable(out.Variable), nil
+}
+
+// updateWatches evaluates all watch expressions, and remembers the one that changed most recently
+func (d *delveDebugger) updateWatches() {
+	for expression, previousValue := range watchMap {
+		value, err := d.eval(expression)
+		if err != nil {
+			value = "?"
+		}
+		if value != previousValue {
+			watchMap[expression] = value
+			if err == nil {
+				lastSeenWatchVariable = expression
+			}
+		}
+	}
+}
+
+// SetBreakpoint places a breakpoint at the given line in the given source file, after removing any existing breakpoint at the same line
+func (d *delveDebugger) SetBreakpoint(sourceBaseFilename string, breakpoint Breakpoint) error {
+	if err := d.ClearBreakpoint(sourceBaseFilename, breakpoint.Line); err != nil {
+		return err
+	}
+	in := delveCreateBreakpointIn{delveBreakpoint{File: filepath.Join(d.sourceDir, sourceBaseFilename), Line: int(breakpoint.Line), Cond: breakpoint.Condition}}
+	if breakpoint.HitCount > 1 {
+		in.Breakpoint.HitCond = ">= " + strconv.Itoa(breakpoint.HitCount)
+	}
+	var out delveCreateBreakpointOut
+	if err := d.client.Call("RPCServer.CreateBreakpoint", in, &out); err != nil {
+		return err
+	}
+	d.breakpointIDs[fmt.Sprintf("%s:%d", sourceBaseFilename, breakpoint.Line)] = out.Breakpoint.ID
+	return nil
+}
+
+// ClearBreakpoint removes the breakpoint at the given line in the given source file, if there is one
+func (d *delveDebugger) ClearBreakpoint(sourceBaseFilename string, lineNumber LineNumber) error {
+	if d.client == nil {
+		return errProgramStopped
+	}
+	location := fmt.Sprintf("%s:%d", sourceBaseFilename, lineNumber)
+	id, found := d.breakpointIDs[location]
+	if !found {
+		return nil
+	}
+	delete(d.breakpointIDs, location)
+	return d.client.Call("RPCServer.ClearBreakpoint", delveClearBreakpointIn{id}, &delveClearBreakpointOut{})
+}
+
+// Continue will continue the execution to the next breakpoint or to the end
+func (d *delveDebugger) Continue() error {
+	return d.command("continue")
+}
+
+// Next will continue the execution by stepping to the next line
+func (d *delveDebugger) Next(stepInto bool) error {
+	if stepInto {
+		return d.command("step")
+	}
+	return d.command("next")
+}
+
+// NextInstruction will continue the execution by stepping to the next instruction
+func (d *delveDebugger) NextInstruction(stepInto bool) error {
+	if stepInto {
+		return d.command("stepInstruction")
+	}
+	return d.command("nextInstruction")
+}
+
+// Step will continue the execution by stepping into function calls
+func (d *delveDebugger) Step() error {
+	return d.command("step")
+}
+
+// Finish will "step out"
+func (d *delveDebugger) Finish() error {
+	return d.command("stepOut")
+}
+
+// AddWatch evaluates the expression after every step, since Delve has no watchpoints for expressions
+func (d *delveDebugger) AddWatch(expression string) error {
+	if d.client == nil {
+		return nil
+	}
+	value, err := d.eval(expression)
+	if err != nil {
+		// The variable may not be in scope yet
+		return nil
+	}
+	watchMap[expression] = value
+	return nil
+}
+
+// StackFrames returns the call stack, from the last time the program stopped
+func (d *delveDebugger) StackFrames() []StackFrame {
+	frames := make([]StackFrame, 0, len(d.frames))
+	for _, frame := range d.frames {
+		sf := StackFrame{Filename: frame.File, Line: LineNumber(frame.Line)}
+		if frame.Function != nil {
+			sf.Function = frame.Function.Name
+		}
+		frames = append(frames, sf)
+	}
+	return frames
+}
+
+// Locals returns the arguments and local variables of the selected frame
+func (d *delveDebugger) Locals() []DebugVariable {
+	if d.frame >= len(d.frames) {
+		return nil
+	}
+	frame := &d.frames[d.frame]
+	locals := make([]DebugVariable, 0, len(frame.Arguments)+len(frame.Locals))
+	for i := range frame.Arguments {
+		locals = append(locals, delveDebugVariable(&frame.Arguments[i]))
+	}
+	for i := range frame.Locals {
+		locals = append(locals, delveDebugVariable(&frame.Locals[i]))
+	}
+	return locals
+}
+
+// SelectFrame selects the frame with the given index in the call stack, which is also where watches are evaluated
+func (d *delveDebugger) SelectFrame(index int) error {
+	if d.client == nil {
+		return errProgramStopped
+	}
+	if index < 0 || index >= len(d.frames) {
+		return fmt.Errorf("no stack frame %d", index)
+	}
+	d.frame = index
+	d.updateWatches()
+	return nil
+}
+
+// Command evaluates the given expression in the selected frame, since Delve has no console over JSON-RPC
+func (d *delveDebugger) Command(command string) (string, error) {
+	if d.client == nil {
+		return "", errProgramStopped
+	}
+	return d.eval(command)
+}
+
+// Running returns true while the program runs in the background, after continuing or stepping
+func (d *delveDebugger) Running() bool {
+	return d.running.Load()
+}
+
+// Interrupt sends the halt command, which makes the running command return with the location the program stopped at
+func (d *delveDebugger) Interrupt() error {
+	if d.client == nil {
+		return errProgramStopped
+	}
+	return d.client.Call("RPCServer.Command", delveCommandIn{"halt"}, &delveCommandOut{})
+}
+
+// Prompt returns "dlv"
+func (d *delveDebugger) Prompt() string {
+	return "dlv"
+}
+
+// Exit ends the Delve session and the program that is being debugged
+func (d *delveDebugger) Exit() {
+	if d.client != nil {
+		// Delve can only detach from a program that is not running.
+		// Clearing the flag also lets the goroutine that waits for the command know that the debug session is over.
+		if d.running.Swap(false) {
+			d.client.Call("RPCServer.Command", delveCommandIn{"halt"}, &delveCommandOut{})
+		}
+		d.client.Call("RPCServer.Detach", delveDetachIn{Kill: true}, &delveDetachOut{})
+		d.client.Close()
+	}
+	if d.cmd != nil && d.cmd.Process != nil {
+		d.cmd.Process.Kill()
+		d.cmd.Wait()
+	}
+	d.waiting.Wait()
+	d.client = nil
+	d.cmd = nil
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// The fake Delve server needs exported argument types, for net/rpc
+
+type FakeDelveThread struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+type FakeDelveState struct {
+	CurrentThread *FakeDelveThread `json:"currentThread,omitempty"`
+	Exited        bool             `json:"exited"`
+}
+
+type FakeDelveCommandIn struct {
+	Name string `json:"name"`
+}
+
+type FakeDelveCommandOut struct {
+	State FakeDelveState
+}
+
+type FakeDelveBreakpoint struct {
+	File         string `json:"file"`
+	FunctionName string `json:"functionName,omitempty"`
+	Cond         string `json:"Cond,omitempty"`
+	HitCond      string `json:"hitCond,omitempty"`
+	ID           int    `json:"id"`
+	Line         int    `json:"line"`
+}
+
+type FakeDelveCreateBreakpointIn struct {
+	Breakpoint FakeDelveBreakpoint
+}
+
+type FakeDelveCreateBreakpointOut struct {
+	Breakpoint FakeDelveBreakpoint
+}
+
+type FakeDelveClearBreakpointIn struct {
+	Id int
+}
+
+type FakeDelveClearBreakpointOut struct{}
+
+type FakeDelveEvalIn struct {
+	Expr string
+}
+
+type FakeDelveVariable struct {
+	Name     string              `json:"name"`
+	Value    string              `json:"value"`
+	Children []FakeDelveVariable `json:"children"`
+	Kind     int                 `json:"kind"`
+}
+
+type FakeDelveEvalOut struct {
+	Variable *FakeDelveVariable
+}
+
+type FakeDelveFunction struct {
+	Name string `json:"name"`
+}
+
+type FakeDelveStackframe struct {
+	Function  *FakeDelveFunction `json:"function,omitempty"`
+	File      string             `json:"file"`
+	Line      int                `json:"line"`
+	Locals    []FakeDelveVariable
+	Arguments []FakeDelveVariable
+}
+
+type FakeDelveStacktraceIn struct {
+	Id    int64
+	Depth int
+	Full  bool
+}
+
+type FakeDelveStacktraceOut struct {
+	Locations []FakeDelveStackframe
+}
+
+type FakeDelveDetachIn struct {
+	Kill bool
+}
+
+type FakeDelveDetachOut struct{}
+
+// FakeDelve is a Delve JSON-RPC server that steps through the lines in a list of lines
+type FakeDelve struct {
+	file        string
+	lines       []int // the lines that the program stops at, one per command
+	commands    []string
+	breakpoints []FakeDelveBreakpoint
+	cleared     []int
+	values      map[string]string
+	killed      bool
+	halt        chan struct{} // if not nil, continue keeps running until the halt command is received
+	mut         sync.Mutex
+}
+
+func (f *FakeDelve) Command(in FakeDelveCommandIn, out *FakeDelveCommandOut) error {
+	f.mut.Lock()
+	f.commands = append(f.commands, in.Name)
+	f.mut.Unlock()
+	switch {
+	case in.Name == "halt":
+		close(f.halt)
+		return nil
+	case in.Name == "continue" && f.halt != nil:
+		<-f.halt
+	}
+	if len(f.lines) == 0 {
+		out.State.Exited = true
+		return nil
+	}
+	out.State.CurrentThread = &FakeDelveThread{File: f.file, Line: f.lines[0]}
+	f.lines = f.lines[1:]
+	// Let the value of x change for every step
+	f.values["x"] += "1"
+	return nil
+}
+
+func (f *FakeDelve) CreateBreakpoint(in FakeDelveCreateBreakpointIn, out *FakeDelveCreateBreakpointOut) error {
+	in.Breakpoint.ID = len(f.breakpoints) + 1
+	f.breakpoints = append(f.breakpoints, in.Breakpoint)
+	out.Breakpoint = in.Breakpoint
+	return nil
+}
+
+func (f *FakeDelve) ClearBreakpoint(in FakeDelveClearBreakpointIn, out *FakeDelveClearBreakpointOut) error {
+	f.cleared = append(f.cleared, in.Id)
+	return nil
+}
+
+func (f *FakeDelve) Eval(in FakeDelveEvalIn, out *FakeDelveEvalOut) error {
+	out.Variable = &FakeDelveVariable{Value: f.values[in.Expr]}
+	return nil
+}
+
+func (f *FakeDelve) Stacktrace(in FakeDelveStacktraceIn, out *FakeDelveStacktraceOut) error {
+	point := FakeDelveVariable{Name: "p", Children: []FakeDelveVariable{{Name: "X", Value: "1"}, {Name: "Y", Value: "2"}}}
+	numbers := FakeDelveVariable{Name: "numbers", Children: []FakeDelveVariable{{Value: "7"}}}
+	out.Locations = []FakeDelveStackframe{
+		{Function: &FakeDelveFunction{Name: "main.inner"}, File: f.file, Line: 13, Locals: []FakeDelveVariable{point, numbers}, Arguments: []FakeDelveVariable{{Name: "n", Value: "3"}}},
+		{Function: &FakeDelveFunction{Name: "main.TestSomething"}, File: f.file, Line: 21, Locals: []FakeDelveVariable{{Name: "x", Value: "4"}}},
+	}
+	return nil
+}
+
+func (f *FakeDelve) Detach(in FakeDelveDetachIn, out *FakeDelveDetachOut) error {
+	f.killed = in.Kill
+	return nil
+}
+
+func TestDelveDebugger(t *testing.T) {
+	origWatchMap, origLastSeen, origProgramRunning := watchMap, lastSeenWatchVariable, programRunning
+	defer func() {
+		watchMap, lastSeenWatchVariable, programRunning = origWatchMap, origLastSeen, origProgramRunning
+	}()
+	watchMap = map[string]string{"x": "?"}
+	programRunning = true
+
+	dir := t.TempDir()
+	sourceFilename := filepath.Join(dir, "main_test.go")
+	fake := &FakeDelve{file: sourceFilename, lines: []int{12, 13, 20}, values: map[string]string{"x": "4"}}
+	server := rpc.NewServer()
+	if err := server.RegisterName("RPCServer", fake); err != nil {
+		t.Fatal(err)
+	}
+	serverConn, clientConn := net.Pipe()
+	go server.ServeCodec(jsonrpc.NewServerCodec(serverConn))
+
+	var stops []LineNumber
+	exited := false
+	onStop := func(filename string, lineNumber LineNumber) {
+		if filename != sourceFilename {
+			t.Errorf("expected to stop in %s, got %s", sourceFilename, filename)
+		}
+		stops = append(stops, lineNumber)
+	}
+	onExit := func() {
+		exited = true
+	}
+
+	// Start at the top of the test function on line 11, with a breakpoint on line 20
+	args := []string{"-test.run", "^TestSomething$"}
+	d := newDelveDebugger("dlv", dir, args, 11, onStop, onExit)
+	breakpoints := Breakpoints{{Line: 20, HitCount: 3}}
+	if err := d.connect(jsonrpc.NewClient(clientConn), "main_test.go", breakpoints); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.breakpoints) != 2 || fake.breakpoints[0].Line != 20 || fake.breakpoints[0].HitCond != ">= 3" || fake.breakpoints[1].Line != 11 || fake.breakpoints[1].File != sourceFilename {
+		t.Errorf("unexpected breakpoints: %v", fake.breakpoints)
+	}
+	if len(fake.cleared) != 1 || fake.cleared[0] != 2 {
+		t.Errorf("expected the temporary breakpoint to be cleared, got %v", fake.cleared)
+	}
+
+	// Step over, and wait for the program to stop
+	if err := d.Next(false); err != nil {
+		t.Fatal(err)
+	}
+	d.waiting.Wait()
+	if watchMap["x"] != "411" || lastSeenWatchVariable != "x" {
+		t.Errorf("expected the watch to be updated, got %q", watchMap["x"])
+	}
+
+	// Check the call stack and the arguments and local variables of the innermost frame
+	frames := d.StackFrames()
+	if len(frames) != 2 || frames[0].Function != "main.inner" || frames[1].Line != 21 {
+		t.Errorf("unexpected call stack: %v", frames)
+	}
+	locals := d.Locals()
+	if len(locals) != 3 || locals[0].Name != "n" || locals[1].Value != "{1, 2}" || len(locals[1].Children) != 2 || locals[2].Children[0].Name != "[0]" {
+		t.Errorf("unexpected local variables: %v", locals)
+	}
+	if err := d.SelectFrame(1); err != nil {
+		t.Fatal(err)
+	}
+	if locals := d.Locals(); len(locals) != 1 || locals[0].Name != "x" {
+		t.Errorf("unexpected local variables in the outer frame: %v", locals)
+	}
+	if err := d.SelectFrame(5); err == nil {
+		t.Errorf("expected an error when selecting a frame that does not exist")
+	}
+	if err := d.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	d.waiting.Wait()
+	if err := d.Continue(); err != nil {
+		t.Fatal(err)
+	}
+	d.waiting.Wait()
+	if !exited || programRunning {
+		t.Errorf("expected the program to be done running")
+	}
+	if got := []LineNumber{12, 13, 20}; len(stops) != len(got) || stops[0] != got[0] || stops[2] != got[2] {
+		t.Errorf("unexpected stops: %v", stops)
+	}
+	expectedCommands := []string{"continue", "next", "stepOut", "continue"}
+	if len(fake.commands) != len(expectedCommands) {
+		t.Fatalf("unexpected commands: %v", fake.commands)
+	}
+	for i, name := range expectedCommands {
+		if fake.commands[i] != name {
+			t.Errorf("expected command %d to be %s, got %s", i, name, fake.commands[i])
+		}
+	}
+
+	// Removing the breakpoint should clear it by its ID
+	if err := d.ClearBreakpoint("main_test.go", 20); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.cleared) != 2 || fake.cleared[1] != 1 {
+		t.Errorf("expected the breakpoint at line 20 to be cleared, got %v", fake.cleared)
+	}
+
+	d.Exit()
+	if !fake.killed {
+		t.Errorf("expected the program to be killed when exiting")
+	}
+}
+
+func TestDelveDebuggerHalt(t *testing.T) {
+	origProgramRunning := programRunning
+	defer func() {
+		programRunning = origProgramRunning
+	}()
+	programRunning = true
+
+	dir := t.TempDir()
+	fake := &FakeDelve{file: filepath.Join(dir, "main.go"), lines: []int{5, 9}, values: map[string]string{}}
+	server := rpc.NewServer()
+	if err := server.RegisterName("RPCServer", fake); err != nil {
+		t.Fatal(err)
+	}
+	serverConn, clientConn := net.Pipe()
+	go server.ServeCodec(jsonrpc.NewServerCodec(serverConn))
+
+	var stops []LineNumber
+	d := newDelveDebugger("dlv", dir, nil, 0, func(filename string, lineNumber LineNumber) {
+		stops = append(stops, lineNumber)
+	}, func() {})
+	if err := d.connect(jsonrpc.NewClient(clientConn), "main.go", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Continue, which never returns by itself, then halt the program
+	fake.halt = make(chan struct{})
+	if err := d.Continue(); err != nil {
+		t.Fatal(err)
+	}
+	if !d.Running() {
+		t.Fatal("expected the program to be running in the background")
+	}
+	if err := d.Next(false); err != errProgramRunning {
+		t.Errorf("expected stepping to wait until the program is halted, got %v", err)
+	}
+	if err := d.Interrupt(); err != nil {
+		t.Fatal(err)
+	}
+	d.waiting.Wait()
+	if d.Running() {
+		t.Errorf("expected the program to be halted")
+	}
+	if len(stops) != 2 || stops[1] != 9 {
+		t.Errorf("expected to stop at line 9 after halting, got %v", stops)
+	}
+	d.Exit()
+}
+
+func TestGoTestFunction(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.LoadBytes([]byte("package main\n\nimport \"testing\"\n\nfunc TestSomething(t *testing.T) {\n\tx := 1\n\t_ = x\n}\n"))
+	if name, lineNumber := e.goTestFunction(6); name != "TestSomething" || lineNumber != 5 {
+		t.Errorf("expected TestSomething at line 5, got %q at line %d", name, lineNumber)
+	}
+	if name, _ := e.goTestFunction(2); name != "" {
+		t.Errorf("expected no test function, got %q", name)
+	}
+}
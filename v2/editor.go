@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -12,7 +13,6 @@ import (
 	"time"
 	"unicode"
 
-	"github.com/cyrus-and/gdb"
 	"github.com/xyproto/clip"
 	"github.com/xyproto/env/v2"
 	"github.com/xyproto/files"
@@ -25,17 +25,22 @@ var clearOnQuit atomic.Bool // clear the terminal when quitting the editor, or n
 // Editor represents the contents and editor settings, but not settings related to the viewport or scrolling
 type Editor struct {
 	detectedTabs               *bool           // were tab or space indentations detected when loading the data?
-	breakpoint                 *Position       // for the breakpoint/jump functionality in debug mode
-	gdb                        *gdb.Gdb        // connection to gdb, if debugMode is enabled
+	debugger                   Debugger        // connection to gdb or Delve, if debugMode is enabled
 	sameFilePortal             *Portal         // a portal that points to the same file
-	lines                      map[int][]rune  // the contents of the current document
+	lines                      Lines           // the contents of the current document
+	largeFile                  *LargeFile      // the file that lines are read from, when a large file is loaded lazily
+	archiveEntry               *ArchiveEntry   // the file within a zip or tar archive that is being edited, if any
+	breakpoints                Breakpoints     // the breakpoints in the current file, for debug mode
 	macro                      *Macro          // the contents of the current macro (will be cleared when esc is pressed)
 	filename                   string          // the current filename
 	searchTerm                 string          // the current search term, used when searching
 	stickySearchTerm           string          // used when going to the next match with ctrl-n, unless esc has been pressed
+	searchOptions              SearchOptions   // regex, case and whole word options for the current search term
 	Theme                                      // editor theme, embedded struct
 	pos                        Position        // the current cursor and scroll position
 	indentation                mode.TabsSpaces // spaces or tabs, and how many spaces per tab character
+	editorConfig               EditorConfig    // properties from .editorconfig files, used when saving
+	fileFormat                 FileFormat      // the character encoding and line endings of the file, used when saving
 	wrapWidth                  int             // set to ie. 80 or 100 to trigger word wrap when typing to that column
 	mode                       mode.Mode       // a filetype mode, like for git, markdown or various programming languages
 	debugShowRegisters         int             // show no register box, show changed registers, show all changed registers
@@ -55,6 +60,7 @@ type Editor struct {
 	readOnly                   bool            // is the file read-only when initializing o?
 	debugHideOutput            bool            // hide the GDB stdout pane when in debug mode?
 	binaryFile                 bool            // is this a binary file, or a text file?
+	largeFileIndexing          bool            // are the lines of a large file still being indexed in the background?
 	wrapWhenTyping             bool            // wrap text at a certain limit when typing
 	addSpace                   bool            // add a space to the editor, once
 	debugStepInto              bool            // when stepping to the next instruction, step into instead of over
@@ -71,6 +77,11 @@ type Editor struct {
 	dirMode                    bool            // browse a directory and also interact with git
 	highlightCurrentLine       bool            // highlight the current line
 	highlightCurrentText       bool            // highlight the current text (not the entire line)
+	selection                  *Selection      // the current visual selection, or nil
+	multiCursor                *MultiCursor    // additional cursors, where typing is replicated, or nil
+	folds                      []Fold          // the closed folds, sorted by the first line
+	softWrap                   bool            // wrap long lines when drawing them, without changing the text
+	softWrapWidth              int             // the width of the view when the lines were last drawn, used when soft wrapping
 	// atomic.Bool are used for values that might be read when redrawing text asynchronously
 	changed           atomic.Bool // has the contents changed, since last save?
 	redraw            atomic.Bool // if the contents should be redrawn in the next loop
@@ -88,17 +99,22 @@ func (e *Editor) Copy() *Editor {
 		detectedTabsCopy := *e.detectedTabs
 		e2.detectedTabs = &detectedTabsCopy
 	}
-	e2.breakpoint = e.breakpoint         //.Copy()
-	e2.gdb = e.gdb                       //.Copy()
+	e2.breakpoints = e.breakpoints
+	e2.debugger = e.debugger             //.Copy()
 	e2.sameFilePortal = e.sameFilePortal //.Copy()
 	e2.lines = e.CopyLines()
+	e2.largeFile = e.largeFile
+	e2.archiveEntry = e.archiveEntry
 	e2.macro = e.macro //.Copy()
 	e2.filename = e.filename
 	e2.searchTerm = e.searchTerm
 	e2.stickySearchTerm = e.stickySearchTerm
+	e2.searchOptions = e.searchOptions
 	e2.Theme = e.Theme
 	e2.pos = e.pos
 	e2.indentation = e.indentation
+	e2.editorConfig = e.editorConfig
+	e2.fileFormat = e.fileFormat
 	e2.wrapWidth = e.wrapWidth
 	e2.mode = e.mode
 	e2.debugShowRegisters = e.debugShowRegisters
@@ -118,6 +134,7 @@ func (e *Editor) Copy() *Editor {
 	e2.readOnly = e.readOnly
 	e2.debugHideOutput = e.debugHideOutput
 	e2.binaryFile = e.binaryFile
+	e2.largeFileIndexing = e.largeFileIndexing
 	e2.wrapWhenTyping = e.wrapWhenTyping
 	e2.addSpace = e.addSpace
 	e2.debugStepInto = e.debugStepInto
@@ -135,6 +152,16 @@ func (e *Editor) Copy() *Editor {
 	e2.dirMode = e.dirMode
 	e2.highlightCurrentLine = e.highlightCurrentLine
 	e2.highlightCurrentText = e.highlightCurrentText
+	if e.selection != nil {
+		selectionCopy := *e.selection
+		e2.selection = &selectionCopy
+	}
+	if e.multiCursor != nil {
+		e2.multiCursor = &MultiCursor{slices.Clone(e.multiCursor.cursors), e.multiCursor.edited}
+	}
+	e2.folds = slices.Clone(e.folds)
+	e2.softWrap = e.softWrap
+	e2.softWrapWidth = e.softWrapWidth
 	e2.changed.Store(e.changed.Load())
 	e2.redraw.Store(e.redraw.Load())
 	e2.redrawCursor.Store(e.redrawCursor.Load())
@@ -143,57 +170,34 @@ func (e *Editor) Copy() *Editor {
 	return &e2
 }
 
-// CopyLines will create a new map[int][]rune struct that is the copy of all the lines in the editor
-func (e *Editor) CopyLines() map[int][]rune {
-	lines2 := make(map[int][]rune)
-	for key, runes := range e.lines {
-		runes2 := make([]rune, len(runes))
-		copy(runes2, runes)
-		lines2[key] = runes2
-	}
-	return lines2
+// CopyLines returns a copy of all the lines in the editor.
+// This is cheap, since Lines only copies the parts that are changed afterwards.
+func (e *Editor) CopyLines() Lines {
+	return e.lines
 }
 
 // Set will store a rune in the editor data, at the given data coordinates
 func (e *Editor) Set(x int, index LineIndex, r rune) {
 	y := int(index)
-	if e.lines == nil {
-		e.lines = make(map[int][]rune)
-	}
-	_, ok := e.lines[y]
-	if !ok {
-		e.lines[y] = make([]rune, 0, x+1)
-	}
-	l := len(e.lines[y])
-	if x < l {
-		e.lines[y][x] = r
-		e.changed.Store(true)
-		return
-	}
+	runes, _ := e.lines.Runes(y)
 	// If the line is too short, fill it up with spaces
-	if l <= x {
+	if l := len(runes); l <= x {
 		n := (x + 1) - l
-		e.lines[y] = append(e.lines[y], []rune(strings.Repeat(" ", n))...)
+		runes = append(runes, []rune(strings.Repeat(" ", n))...)
 	}
 
 	// Set the rune
-	e.lines[y][x] = r
+	runes[x] = r
+	e.lines.SetRunes(y, runes)
 	e.changed.Store(true)
 }
 
 // Get will retrieve a rune from the editor data, at the given coordinates
 func (e *Editor) Get(x int, y LineIndex) rune {
-	if e.lines == nil {
-		return ' '
+	if r, ok := e.lines.RuneAt(int(y), x); ok {
+		return r
 	}
-	runes, ok := e.lines[int(y)]
-	if !ok {
-		return ' '
-	}
-	if x >= len(runes) {
-		return ' '
-	}
-	return runes[x]
+	return ' '
 }
 
 // Changed will return true if the contents were changed since last time this function was called
@@ -203,19 +207,13 @@ func (e *Editor) Changed() bool {
 
 // Line returns the contents of line number N, counting from 0
 func (e *Editor) Line(n LineIndex) string {
-	if n < 0 {
-		return ""
-	}
-	if line, ok := e.lines[int(n)]; ok {
-		return string(line)
-	}
-	return ""
+	return e.lines.String(int(n))
 }
 
 // ScreenLine returns the screen contents of line number N, counting from 0.
 // The tabs are expanded.
 func (e *Editor) ScreenLine(n int) string {
-	if line, ok := e.lines[n]; ok {
+	if line, ok := e.lines.Line(n); ok {
 		var sb strings.Builder
 		skipX := e.pos.offsetX
 		for _, r := range line {
@@ -279,12 +277,9 @@ func (e *Editor) FirstDataPosition(n LineIndex) int {
 // CountRune will count the number of instances of the rune r in the line n
 func (e *Editor) CountRune(r rune, n LineIndex) int {
 	var counter int
-	line, ok := e.lines[int(n)]
-	if ok {
-		for _, l := range line {
-			if l == r {
-				counter++
-			}
+	for _, l := range e.lines.String(int(n)) {
+		if l == r {
+			counter++
 		}
 	}
 	return counter
@@ -292,16 +287,17 @@ func (e *Editor) CountRune(r rune, n LineIndex) int {
 
 // Len returns the number of lines
 func (e *Editor) Len() int {
-	return len(e.lines)
+	return e.lines.Len()
 }
 
 // String returns the contents of the editor
 func (e *Editor) String() string {
 	var sb strings.Builder
-	l := e.Len()
-	for i := 0; i < l; i++ {
-		sb.WriteString(e.Line(LineIndex(i)) + "\n")
-	}
+	e.lines.Each(func(_ int, line string) bool {
+		sb.WriteString(line)
+		sb.WriteByte('\n')
+		return true
+	})
 	return sb.String()
 }
 
@@ -329,7 +325,9 @@ func (e *Editor) ContentsAndReverseSearchPrefix(prefix string) (string, LineInde
 
 // Clear removes all data from the editor
 func (e *Editor) Clear() {
-	e.lines = make(map[int][]rune)
+	e.lines = Lines{}
+	e.largeFile = nil
+	e.largeFileIndexing = false
 	e.changed.Store(true)
 }
 
@@ -356,14 +354,14 @@ func (e *Editor) Load(c *vt100.Canvas, tty *vt100.TTY, fnord FilenameOrData) (st
 		if fnord.data, err = e.LoadClass(fnord.filename); err != nil {
 			return "Could not run jad", err
 		}
-		// Load the data (and make opinionated replacements if it's a text file + set e.binaryFile if it's binary)
-		e.LoadBytes(fnord.data)
-	} else if fnord.stdin {
+		// Load the data (and convert the line endings if it's a text file + set e.binaryFile if it's binary)
+		e.DecodeAndLoadBytes(fnord.data)
+	} else if fnord.stdin || fnord.archive != nil {
 		// Load the data that has already been read from stdin
-		// (and make opinionated replacements if it's a text file + set e.binaryFile if it's binary)
-		e.LoadBytes(fnord.data)
+		// (and convert the line endings if it's a text file + set e.binaryFile if it's binary)
+		e.DecodeAndLoadBytes(fnord.data)
 	} else if fnord.Empty() {
-		// Load the file (and make opinionated replacements if it's a text file + set e.binaryFile if it's binary)
+		// Load the file (and convert the line endings if it's a text file + set e.binaryFile if it's binary)
 		if err := e.ReadFileAndProcessLines(fnord.filename); err != nil {
 			return message, err
 		}
@@ -382,12 +380,6 @@ func (e *Editor) Load(c *vt100.Canvas, tty *vt100.TTY, fnord FilenameOrData) (st
 	return message, nil
 }
 
-// IndexByteLine represents a single line of text, as bytes and with a line index
-type IndexByteLine struct {
-	byteLine []byte
-	index    int
-}
-
 // PrepareEmpty prepares an empty textual representation of a given filename.
 // If it's an image, there will be text placeholders for pixels.
 // If it's anything else, it will just be blank.
@@ -449,25 +441,36 @@ func (e *Editor) SaveAs(c *vt100.Canvas, tty *vt100.TTY, filename string) error
 		}
 	}
 
+	if e.largeFile != nil {
+		// Copy the unchanged parts of the large file directly, instead of reading in all the lines
+		return e.saveLargeFile(c, tty, filename)
+	}
+
 	if e.binaryFile {
 		data = []byte(e.String())
 	} else {
-		// Strip trailing spaces on all lines
-		l := e.Len()
-		for i := 0; i < l; i++ {
-			if e.TrimRight(LineIndex(i)) {
-				changed = true
+		var s string
+		if e.trimTrailingWhitespace() {
+			// Strip trailing spaces on all lines
+			l := e.Len()
+			for i := 0; i < l; i++ {
+				if e.TrimRight(LineIndex(i)) {
+					changed = true
+				}
 			}
+			// Trim away trailing whitespace
+			s = trimRightSpace(e.String())
+		} else {
+			s = strings.TrimSuffix(e.String(), "\n")
 		}
 
-		// Trim away trailing whitespace
-		s := trimRightSpace(e.String())
-
-		// Make additional replacements, and add a final newline
-		s = opinionatedStringReplacer.Replace(s) + "\n"
+		// Add a final newline. Characters like non-breaking spaces are kept, so that saving only changes what was edited.
+		if e.insertFinalNewline() {
+			s += "\n"
+		}
 
 		// TODO: Auto-detect tabs/spaces instead of per-language assumptions
-		if e.mode.Spaces() {
+		if e.mode.Spaces() && !e.editorConfigTabs() {
 			// NOTE: This is a hack, that can only replace 10 levels deep.
 			for level := 10; level > 0; level-- {
 				fromString := "\n" + strings.Repeat("\t", level)
@@ -501,7 +504,11 @@ func (e *Editor) SaveAs(c *vt100.Canvas, tty *vt100.TTY, filename string) error
 		// (Does it either start with a shebang or reside in a common bin directory like /usr/bin?)
 		shebang = files.BinDirectory(filename) || strings.HasPrefix(s, "#!")
 
-		data = []byte(s)
+		// Write the file back with the same character encoding and line endings as it was read with
+		var err error
+		if data, err = e.fileFormat.Encode(s); err != nil {
+			return err
+		}
 	}
 
 	// Mark the data as "not changed" if it's not a binary file
@@ -537,18 +544,15 @@ func (e *Editor) SaveAs(c *vt100.Canvas, tty *vt100.TTY, filename string) error
 		// Start a spinner, in a short while
 		quitChan := Spinner(c, tty, fmt.Sprintf("Saving %s... ", filename), fmt.Sprintf("saving %s: stopped by user", filename), 200*time.Millisecond, e.ItalicsColor)
 
-		// Prepare gzipped data
-		if strings.HasSuffix(filename, ".gz") {
-			var err error
-			data, err = gZipData(data)
-			if err != nil {
-				quitChan <- true
-				return err
-			}
+		var err error
+		if e.archiveEntry != nil && filename == e.filename {
+			// Rewrite the zip or tar archive, with only this file replaced
+			err = e.archiveEntry.Write(data)
+		} else if data, err = compressFileData(filename, data); err == nil {
+			// Save the file, compressed if the file has the extension of a compressed file, like ".gz" or ".xz"
+			err = os.WriteFile(filename, data, fileMode)
 		}
-
-		// Save the file and return any errors
-		if err := os.WriteFile(filename, data, fileMode); err != nil {
+		if err != nil {
 			// Stop the spinner and return
 			quitChan <- true
 			return err
@@ -603,13 +607,12 @@ func (e *Editor) SaveAs(c *vt100.Canvas, tty *vt100.TTY, filename string) error
 // Returns true if the line was trimmed
 func (e *Editor) TrimRight(index LineIndex) bool {
 	n := int(index)
-	line, ok := e.lines[n]
+	line, ok := e.lines.Line(n)
 	if !ok {
 		return false
 	}
-	trimmedLine := []rune(trimRightSpace(string(line)))
-	if len(trimmedLine) != len(line) {
-		e.lines[n] = trimmedLine
+	if trimmedLine := trimRightSpace(line); len(trimmedLine) != len(line) {
+		e.lines.Set(n, trimmedLine)
 		return true
 	}
 	return false
@@ -620,11 +623,9 @@ func (e *Editor) TrimRight(index LineIndex) bool {
 func (e *Editor) TrimLeft(index LineIndex) bool {
 	changed := false
 	n := int(index)
-	if line, ok := e.lines[n]; ok {
-		newRunes := []rune(strings.TrimLeftFunc(string(line), unicode.IsSpace))
-		// TODO: Just compare lengths instead of contents?
-		if string(newRunes) != string(line) {
-			e.lines[n] = newRunes
+	if line, ok := e.lines.Line(n); ok {
+		if trimmedLine := strings.TrimLeftFunc(line, unicode.IsSpace); len(trimmedLine) != len(line) {
+			e.lines.Set(n, trimmedLine)
 			changed = true
 		}
 	}
@@ -650,24 +651,12 @@ func (e *Editor) DeleteRestOfLine() {
 		return
 	}
 	y := int(e.DataY())
-	if e.lines == nil {
-		e.lines = make(map[int][]rune)
-	}
-	v, ok := e.lines[y]
-	if !ok {
-		return
-	}
-	if v == nil {
-		e.lines[y] = make([]rune, 0)
-	}
-	if x > len(e.lines[y]) {
+	runes, ok := e.lines.Runes(y)
+	if !ok || x > len(runes) {
 		return
 	}
-	e.lines[y] = e.lines[y][:x]
+	e.lines.SetRunes(y, runes[:x])
 	e.changed.Store(true)
-
-	// Make sure no lines are nil
-	e.MakeConsistent()
 }
 
 // DeleteLine will delete the given line index
@@ -678,43 +667,13 @@ func (e *Editor) DeleteLine(n LineIndex) {
 	}
 	lastLineIndex := LineIndex(e.Len() - 1)
 	endOfDocument := n >= lastLineIndex
+	// Delete this line, and move all lines after n one step up
+	e.lines.Remove(int(n))
 	if endOfDocument {
-		// Just delete this line
-		delete(e.lines, int(n))
 		return
 	}
-	// TODO: Rely on the length of the hash map for finding the index instead of
-	//       searching through each line number key.
-	var maxIndex LineIndex
-	found := false
-	for k := range e.lines {
-		if LineIndex(k) > maxIndex {
-			maxIndex = LineIndex(k)
-			found = true
-		}
-	}
-	if !found {
-		// This should never happen
-		return
-	}
-	if _, ok := e.lines[int(maxIndex)]; !ok {
-		// The line numbers and the length of e.lines does not match
-		return
-	}
-	// Shift all lines after y:
-	// shift all lines after n one step closer to n, overwriting e.lines[n]
-	for index := n; index <= (maxIndex - 1); index++ {
-		i := int(index)
-		e.lines[i] = e.lines[i+1]
-	}
-	// Then delete the final item
-	delete(e.lines, int(maxIndex))
-
 	// This changes the document
 	e.changed.Store(true)
-
-	// Make sure no lines are nil
-	e.MakeConsistent()
 }
 
 // DeleteLineMoveBookmark will delete the given line index and also move the bookmark if it's after n
@@ -736,33 +695,30 @@ func (e *Editor) Delete(c *vt100.Canvas, useBlockMode bool) {
 
 	deleteThisRune := func() bool {
 		y := int(e.DataY())
-		lineLen := len(e.lines[y])
-		if _, ok := e.lines[y]; !ok || lineLen == 0 || (lineLen == 1 && unicode.IsSpace(e.lines[y][0])) {
-			// All keys in the map that are > y should be shifted -1.
-			// This also overwrites e.lines[y].
+		runes, ok := e.lines.Runes(y)
+		lineLen := len(runes)
+		if !ok || lineLen == 0 || (lineLen == 1 && unicode.IsSpace(runes[0])) {
+			// All lines after y should be moved one step up.
+			// This also removes line y.
 			e.DeleteLine(LineIndex(y))
 			e.changed.Store(true)
 			return true // continue
 		}
 		x, err := e.DataX()
-		if err != nil || x > len(e.lines[y])-1 {
+		if err != nil || x > lineLen-1 {
 			// on the last index, just use every element but x
-			e.lines[y] = e.lines[y][:x]
-			// check if the next line exists
-			if _, ok := e.lines[y+1]; ok {
-				// then add the contents of the next line, if available
-				nextLine, ok := e.lines[y+1]
-				if ok && len(nextLine) > 0 && !e.blockMode {
-					e.lines[y] = append(e.lines[y], nextLine...)
-					// then delete the next line
-					e.DeleteLine(LineIndex(y + 1))
-				}
+			e.lines.SetRunes(y, runes[:x])
+			// then add the contents of the next line, if available
+			if nextLine, ok := e.lines.Line(y + 1); ok && len(nextLine) > 0 && !e.blockMode {
+				e.lines.Set(y, string(runes[:x])+nextLine)
+				// then delete the next line
+				e.DeleteLine(LineIndex(y + 1))
 			}
 			e.changed.Store(true)
 			return true // continue
 		}
 		// Delete just this character
-		e.lines[y] = append(e.lines[y][:x], e.lines[y][x+1:]...)
+		e.lines.SetRunes(y, append(runes[:x], runes[x+1:]...))
 		return true // continue
 	}
 
@@ -773,50 +729,34 @@ func (e *Editor) Delete(c *vt100.Canvas, useBlockMode bool) {
 	}
 
 	e.changed.Store(true)
-	// Make sure no lines are nil
-	e.MakeConsistent()
 }
 
 // Empty will check if the current editor contents are empty or not.
 // If there's only one line left and it is only whitespace, that will be considered empty as well.
 func (e *Editor) Empty() bool {
-	l := len(e.lines)
+	l := e.lines.Len()
 	if l == 0 {
 		return true
 	}
 	if l == 1 {
-		// Regardless of line number key, check the contents of the one remaining trimmed line
-		for _, line := range e.lines {
-			return len(strings.TrimSpace(string(line))) == 0
-		}
+		// Check the contents of the one remaining trimmed line
+		return len(strings.TrimSpace(e.lines.String(0))) == 0
 	}
 	// > 1 lines
 	return false
 }
 
-// MakeConsistent creates an empty slice of runes for any empty lines,
-// to make sure that no line number below e.Len() points to a nil map.
-func (e *Editor) MakeConsistent() {
-	// Check if the keys in the map are consistent
-	for i := 0; i < len(e.lines); i++ {
-		if _, found := e.lines[i]; !found {
-			e.lines[i] = make([]rune, 0)
-			e.changed.Store(true)
-		}
-	}
-}
-
 // WithinLimit will check if a line is within the word wrap limit,
 // given a Y position.
 func (e *Editor) WithinLimit(y LineIndex) bool {
-	return len(e.lines[int(y)]) < e.wrapWidth
+	return e.lines.RuneCount(int(y)) < e.wrapWidth
 }
 
 // LastWord will return the last word of a line,
 // given a Y position. Returns an empty string if there is no last word.
 func (e *Editor) LastWord(y int) string {
 	// TODO: Use a faster method
-	words := strings.Fields(strings.TrimSpace(string(e.lines[y])))
+	words := strings.Fields(strings.TrimSpace(e.lines.String(y)))
 	if len(words) > 0 {
 		return words[len(words)-1]
 	}
@@ -835,8 +775,9 @@ func (e *Editor) SplitOvershoot(index LineIndex, isSpace bool) ([]rune, []rune,
 
 	// Maximum word length to not keep as one word
 	maxDistance := e.wrapWidth / 2
+	runes, _ := e.lines.Runes(y)
 	if e.WithinLimit(index) {
-		return e.lines[y], make([]rune, 0), false
+		return runes, make([]rune, 0), false
 	}
 	splitPosition := e.wrapWidth
 	if isSpace {
@@ -846,7 +787,7 @@ func (e *Editor) SplitOvershoot(index LineIndex, isSpace bool) ([]rune, []rune,
 		// If a space is reached, check if it is too far away from n to be used as a split position, or not.
 		spacePosition := -1
 		for i := splitPosition; i >= 0; i-- {
-			if i < len(e.lines[y]) && unicode.IsSpace(e.lines[y][i]) {
+			if i < len(runes) && unicode.IsSpace(runes[i]) {
 				// Found a space at position i
 				spacePosition = i
 				break
@@ -866,11 +807,11 @@ func (e *Editor) SplitOvershoot(index LineIndex, isSpace bool) ([]rune, []rune,
 
 	n := splitPosition
 	// Make space for the two parts
-	first := make([]rune, len(e.lines[y][:n]))
-	second := make([]rune, len(e.lines[y][n:]))
+	first := make([]rune, len(runes[:n]))
+	second := make([]rune, len(runes[n:]))
 	// Copy the line into first and second
-	copy(first, e.lines[y][:n])
-	copy(second, e.lines[y][n:])
+	copy(first, runes[:n])
+	copy(second, runes[n:])
 
 	// If the second part starts with a space, remove it
 	if len(second) > 0 && unicode.IsSpace(second[0]) {
@@ -898,11 +839,12 @@ func (e *Editor) WrapAllLines() bool {
 
 		if len(first) > 0 && len(second) > 0 {
 
-			e.lines[i] = first
+			e.lines.SetRunes(i, first)
 			if spaceBetween {
 				second = append(second, ' ')
 			}
-			e.lines[i+1] = append(second, e.lines[i+1]...)
+			nextLine, _ := e.lines.Runes(i + 1)
+			e.lines.SetRunes(i+1, append(second, nextLine...))
 			e.InsertLineBelowAt(LineIndex(i + 1))
 
 			// This isn't perfect, but it helps move the cursor somewhere in
@@ -921,16 +863,13 @@ func (e *Editor) WrapAllLines() bool {
 		e.pos.sy += insertedLines
 		if e.pos.sy < 0 {
 			e.pos.sy = 0
-		} else if e.pos.sy >= len(e.lines) {
-			e.pos.sy = len(e.lines) - 1
+		} else if e.pos.sy >= e.lines.Len() {
+			e.pos.sy = e.lines.Len() - 1
 		}
 		e.redraw.Store(true)
 		e.redrawCursor.Store(true)
 	}
 
-	// This appears to be needed as well
-	e.MakeConsistent()
-
 	return wrapped
 }
 
@@ -954,49 +893,17 @@ func (e *Editor) InsertLineAbove() {
 
 	y := int(lineIndex)
 
-	// Create new set of lines
-	lines2 := make(map[int][]rune)
+	// Insert a blank line above, shifting this line and all lines after it down by 1
+	e.lines.Insert(y, "")
 
-	// If at the first line, just add a line at the top
+	// If at the first line, the line at the top was just added
 	if y == 0 {
-
-		// Insert a blank line
-		lines2[0] = make([]rune, 0)
-		// Then insert all the other lines, shifted by 1
-		for k, v := range e.lines {
-			lines2[k+1] = v
-		}
 		y++
-
-	} else {
-		// For each line in the old map, if at (y-1), insert a blank line
-		// (insert a blank line above)
-		for k, v := range e.lines {
-			if k < (y - 1) {
-				lines2[k] = v
-			} else if k == (y - 1) {
-				lines2[k] = v
-				lines2[k+1] = make([]rune, 0)
-			} else if k > (y - 1) {
-				lines2[k+1] = v
-			}
-		}
 	}
 
-	// Use the new set of lines
-	e.lines = lines2
-
-	// Make sure no lines are nil
-	e.MakeConsistent()
-
 	// Skip trailing newlines after this line
-	for i := len(e.lines); i > y; i-- {
-		if len(e.lines[i]) == 0 {
-			delete(e.lines, i)
-		} else {
-			break
-		}
-	}
+	e.trimTrailingEmptyLinesAfter(y)
+
 	e.changed.Store(true)
 }
 
@@ -1013,80 +920,54 @@ func (e *Editor) InsertLineBelow() {
 func (e *Editor) InsertLineBelowAt(index LineIndex) {
 	y := int(index)
 
-	// Make sure no lines are nil
-	e.MakeConsistent()
-
 	// If we are the the last line, add an empty line at the end and return
-	if y == (len(e.lines) - 1) {
-		e.lines[int(y)+1] = make([]rune, 0)
+	if y == (e.lines.Len() - 1) {
+		e.lines.Insert(y+1, "")
 		e.changed.Store(true)
 		return
 	}
 
-	// Create new set of lines, with room for one more
-	lines2 := make(map[int][]rune, len(e.lines)+1)
-
-	// For each line in the old map, if at y, insert a blank line
-	// (insert a blank line below)
-	for k, v := range e.lines {
-		if k < y {
-			lines2[k] = v
-		} else if k == y {
-			lines2[k] = v
-			lines2[k+1] = make([]rune, 0)
-		} else if k > y {
-			lines2[k+1] = v
-		}
-	}
-	// Use the new set of lines
-	e.lines = lines2
+	// Insert a blank line below, shifting all lines after y down by 1
+	e.lines.Insert(y+1, "")
 
 	// Skip trailing newlines after this line
-	for i := len(e.lines); i > y; i-- {
-		if len(e.lines[i]) == 0 {
-			delete(e.lines, i)
-		} else {
+	e.trimTrailingEmptyLinesAfter(y)
+
+	e.changed.Store(true)
+}
+
+// trimTrailingEmptyLinesAfter removes empty lines at the end of the document, but only after line index y
+func (e *Editor) trimTrailingEmptyLinesAfter(y int) {
+	for i := e.lines.Len() - 1; i > y; i-- {
+		if line, _ := e.lines.Line(i); len(line) > 0 {
 			break
 		}
+		e.lines.Truncate(i)
 	}
-
-	e.changed.Store(true)
 }
 
-// Insert will insert a rune at the given position, with no word wrap,
-// and call MakeConsistent at the end.
+// Insert will insert a rune at the given position, with no word wrap.
 func (e *Editor) Insert(c *vt100.Canvas, r rune) {
 
 	doInsert := func() bool {
 		// Ignore it if the current position is out of bounds
 		x, _ := e.DataX()
 		y := int(e.DataY())
-		// If there are no lines, initialize and set the 0th rune to the given one
-		if e.lines == nil {
-			e.lines = make(map[int][]rune)
-			e.lines[0] = []rune{r}
-			return true // continue
-		}
-		// If the current line is empty, initialize it with a line that is just the given rune
-		_, ok := e.lines[y]
+		// If the current line is missing, initialize it with a line that is just the given rune
+		runes, ok := e.lines.Runes(y)
 		if !ok {
-			e.lines[y] = []rune{r}
+			e.lines.SetRunes(y, []rune{r})
 			return true // continue
 		}
-		if len(e.lines[y]) < x {
+		if len(runes) < x {
 			// Can only insert in the existing block of text
 			return true // continue
 		}
-		newlineLength := len(e.lines[y]) + 1
-		newline := make([]rune, newlineLength)
-		for i := 0; i < x; i++ {
-			newline[i] = e.lines[y][i]
-		}
-		newline[x] = r
-		for i := x + 1; i < newlineLength; i++ {
-			newline[i] = e.lines[y][i-1]
-		}
-		e.lines[y] = newline
+		newline := make([]rune, 0, len(runes)+1)
+		newline = append(newline, runes[:x]...)
+		newline = append(newline, r)
+		newline = append(newline, runes[x:]...)
+		e.lines.SetRunes(y, newline)
 		return true // continue
 	}
 
@@ -1097,26 +978,24 @@ func (e *Editor) Insert(c *vt100.Canvas, r rune) {
 	}
 
 	e.changed.Store(true)
-
-	// Make sure no lines are nil
-	e.MakeConsistent()
 }
 
 // CreateLineIfMissing will create a line at the given Y index, if it's missing
 func (e *Editor) CreateLineIfMissing(n LineIndex) {
-	if e.lines == nil {
-		e.lines = make(map[int][]rune)
-	}
-	_, ok := e.lines[int(n)]
-	if !ok {
-		e.lines[int(n)] = make([]rune, 0)
+	if n >= 0 && !e.lines.Has(int(n)) {
+		e.lines.Set(int(n), "")
 		e.changed.Store(true)
 	}
 }
 
 // WordCount returns the number of spaces in the text + 1
 func (e *Editor) WordCount() int {
-	return len(strings.Fields(e.String()))
+	count := 0
+	e.lines.Each(func(_ int, line string) bool {
+		count += len(strings.Fields(line))
+		return true
+	})
+	return count
 }
 
 // ToggleSyntaxHighlight toggles syntax highlighting
@@ -1137,15 +1016,11 @@ func (e *Editor) SetRainbow(rainbowParenthesis bool) {
 // SetLine will fill the given line index with the given string.
 // Any previous contents of that line is removed.
 func (e *Editor) SetLine(n LineIndex, s string) {
-	e.CreateLineIfMissing(n)
-	e.lines[int(n)] = make([]rune, 0)
-	counter := 0
-	// It's important not to use the index value when looping over a string,
-	// unless the byte index is what one's after, as opposed to the rune index.
-	for _, letter := range s {
-		e.Set(counter, n, letter)
-		counter++
+	if n < 0 {
+		return
 	}
+	e.lines.Set(int(n), s)
+	e.changed.Store(true)
 }
 
 // SetCurrentLine will replace the current line with the given string
@@ -1165,7 +1040,7 @@ func (e *Editor) SplitLine() bool {
 	y := e.DataY()
 
 	// Get the contents of this line
-	runeLine := e.lines[int(y)]
+	runeLine, _ := e.lines.Runes(int(y))
 	if len(runeLine) < 2 {
 		// Did not split
 		return false
@@ -1195,7 +1070,7 @@ func (e *Editor) DataX() (int, error) {
 	found := false
 	dataX := 0
 	runeCounter := 0
-	for _, r := range e.lines[dataY] {
+	for _, r := range e.lines.String(dataY) {
 		e.pos.mut.RLock()
 		// When we reached the correct screen position, use i as the data position
 		if screenCounter == (e.pos.sx + e.pos.offsetX) {
@@ -1238,30 +1113,18 @@ func (e *Editor) SetRune(r rune) {
 // InsertBelow will insert the given rune at the start of the line below,
 // starting a new line if required.
 func (e *Editor) InsertBelow(y int, r rune) {
-	if _, ok := e.lines[y+1]; !ok {
-		// If the next line does not exist, create one containing just "r"
-		e.lines[y+1] = []rune{r}
-	} else if len(e.lines[y+1]) > 0 {
-		// If the next line is non-empty, insert "r" at the start
-		e.lines[y+1] = append([]rune{r}, e.lines[y+1][:]...)
-	} else {
-		// The next line exists, but is of length 0, should not happen, just replace it
-		e.lines[y+1] = []rune{r}
-	}
+	e.InsertStringBelow(y, string(r))
 }
 
 // InsertStringBelow will insert the given string at the start of the line below,
 // starting a new line if required.
 func (e *Editor) InsertStringBelow(y int, s string) {
-	if _, ok := e.lines[y+1]; !ok {
-		// If the next line does not exist, create one containing the string
-		e.lines[y+1] = []rune(s)
-	} else if len(e.lines[y+1]) > 0 {
+	if nextLine, ok := e.lines.Line(y + 1); ok && len(nextLine) > 0 {
 		// If the next line is non-empty, insert the string at the start
-		e.lines[y+1] = append([]rune(s), e.lines[y+1][:]...)
+		e.lines.Set(y+1, s+nextLine)
 	} else {
-		// The next line exists, but is of length 0, should not happen, just replace it
-		e.lines[y+1] = []rune(s)
+		// If the next line does not exist or is empty, create one containing the string
+		e.lines.Set(y+1, s)
 	}
 }
 
@@ -1306,7 +1169,7 @@ func (e *Editor) LeftRune() rune {
 	x, err := e.DataX()
 	if err != nil {
 		// This is after the line contents, return the last rune
-		runes, ok := e.lines[int(y)]
+		runes, ok := e.lines.Runes(int(y))
 		if !ok || len(runes) == 0 {
 			return rune(0)
 		}
@@ -1628,7 +1491,7 @@ func (e *Editor) ScrollUp(c *vt100.Canvas, status *StatusBar, scrollSpeed int) b
 
 // PgDn will try to scroll down a full page
 func (e *Editor) PgDn(c *vt100.Canvas, status *StatusBar) bool {
-	canvasHeight := int(c.H())
+	canvasHeight := int(e.pos.ViewHeight(c))
 	scrollSpeed := canvasHeight
 	return e.ScrollDown(c, status, scrollSpeed, canvasHeight)
 }
@@ -1724,7 +1587,7 @@ func (e *Editor) AfterLineScreenContents() bool {
 func (e *Editor) AfterScreenWidth(c *vt100.Canvas) bool {
 	w := 80 // default width
 	if c != nil {
-		w = int(c.W())
+		w = int(e.pos.ViewWidth(c))
 	}
 	return e.pos.sx >= w
 }
@@ -1739,11 +1602,12 @@ func (e *Editor) WriteRune(c *vt100.Canvas) {
 	if c == nil {
 		return
 	}
+	vx, vy := e.pos.ViewOrigin()
 	if !e.blockMode {
-		c.WriteRune(uint(e.pos.sx+e.pos.offsetX), uint(e.pos.sy), e.Foreground, e.Background, e.Rune())
+		c.WriteRune(vx+uint(e.pos.sx+e.pos.offsetX), vy+uint(e.cursorScreenY()), e.Foreground, e.Background, e.Rune())
 	} else {
 		e.ForEachLineInBlock(c, func() bool {
-			c.WriteRune(uint(e.pos.sx+e.pos.offsetX), uint(e.pos.sy), e.Foreground, e.Background, e.Rune())
+			c.WriteRune(vx+uint(e.pos.sx+e.pos.offsetX), vy+uint(e.pos.sy), e.Foreground, e.Background, e.Rune())
 			return true // continue
 		})
 	}
@@ -1755,14 +1619,16 @@ func (e *Editor) WriteTab(c *vt100.Canvas) {
 		return
 	}
 	spacesPerTab := e.indentation.PerTab
+	vx, vy := e.pos.ViewOrigin()
 	if !e.blockMode {
+		sy := e.cursorScreenY()
 		for x := e.pos.sx; x < e.pos.sx+spacesPerTab; x++ {
-			c.WriteRune(uint(x+e.pos.offsetX), uint(e.pos.sy), e.Foreground, e.Background, ' ')
+			c.WriteRune(vx+uint(x+e.pos.offsetX), vy+uint(sy), e.Foreground, e.Background, ' ')
 		}
 	} else {
 		e.ForEachLineInBlock(c, func() bool {
 			for x := e.pos.sx; x < e.pos.sx+spacesPerTab; x++ {
-				c.WriteRune(uint(x+e.pos.offsetX), uint(e.pos.sy), e.Foreground, e.Background, ' ')
+				c.WriteRune(vx+uint(x+e.pos.offsetX), vy+uint(e.pos.sy), e.Foreground, e.Background, ' ')
 			}
 			return true // continue
 		})
@@ -1825,14 +1691,21 @@ func (e *Editor) AtOrBeforeStartOfTextScreenLine() bool {
 
 // Up tried to move the cursor up, and also scroll
 func (e *Editor) Up(c *vt100.Canvas, status *StatusBar) {
-	e.GoTo(e.DataY()-1, c, status)
+	// Skip the lines that are hidden by closed folds
+	e.GoTo(e.visibleLineAbove(e.DataY()), c, status)
 }
 
 // Down tries to move the cursor down, and also scroll
 // status is used for clearing status bar messages and can be nil
 // returns true if the end is reached
 func (e *Editor) Down(c *vt100.Canvas, status *StatusBar) bool {
-	_, reachedTheEnd := e.GoTo(e.DataY()+1, c, status)
+	// Skip the lines that are hidden by closed folds
+	y := e.nextVisibleLine(e.DataY())
+	if int(y) >= e.Len() && y > e.DataY()+1 {
+		// The rest of the document is folded
+		return true
+	}
+	_, reachedTheEnd := e.GoTo(y, c, status)
 	return reachedTheEnd
 }
 
@@ -1950,7 +1823,7 @@ func (e *Editor) Center(c *vt100.Canvas) {
 	// Find the terminal height
 	h := 25
 	if c != nil {
-		h = int(c.Height())
+		h = int(e.pos.ViewHeight(c))
 	}
 
 	// General information about how the positions and offsets relate:
@@ -1986,6 +1859,11 @@ func (e *Editor) Center(c *vt100.Canvas) {
 
 // CommentOn will insert a comment marker (like # or //) in front of a line
 func (e *Editor) CommentOn(commentMarker string) {
+	e.SetCurrentLine(e.commentedLine(e.CurrentLine(), commentMarker))
+}
+
+// commentedLine returns the given line with a comment marker in front
+func (e *Editor) commentedLine(line, commentMarker string) string {
 	var space string
 	switch e.mode {
 	// For config files, assume things will be toggled in and out, without a space
@@ -1994,28 +1872,12 @@ func (e *Editor) CommentOn(commentMarker string) {
 	default:
 		space = " "
 	}
-	e.SetCurrentLine(commentMarker + space + e.CurrentLine())
+	return commentMarker + space + line
 }
 
 // CommentOff will remove "//" or "// " from the front of the line if "//" is given
 func (e *Editor) CommentOff(commentMarker string) {
-	var (
-		changed      bool
-		newContents  string
-		contents     = e.CurrentLine()
-		trimContents = strings.TrimSpace(contents)
-	)
-	commentMarkerPlusSpace := commentMarker + " "
-	if strings.HasPrefix(trimContents, commentMarkerPlusSpace) {
-		// toggle off comment
-		newContents = strings.Replace(contents, commentMarkerPlusSpace, "", 1)
-		changed = true
-	} else if strings.HasPrefix(trimContents, commentMarker) {
-		// toggle off comment
-		newContents = strings.Replace(contents, commentMarker, "", 1)
-		changed = true
-	}
-	if changed {
+	if newContents, changed := uncommentedLine(e.CurrentLine(), commentMarker); changed {
 		e.SetCurrentLine(newContents)
 		// If the line was shortened and the cursor ended up after the line, move it
 		if e.AfterEndOfLine() {
@@ -2024,6 +1886,21 @@ func (e *Editor) CommentOff(commentMarker string) {
 	}
 }
 
+// uncommentedLine removes "//" or "// " from the front of the given line, if "//" is given.
+// Returns false if the line was not commented.
+func uncommentedLine(contents, commentMarker string) (string, bool) {
+	trimContents := strings.TrimSpace(contents)
+	commentMarkerPlusSpace := commentMarker + " "
+	if strings.HasPrefix(trimContents, commentMarkerPlusSpace) {
+		// toggle off comment
+		return strings.Replace(contents, commentMarkerPlusSpace, "", 1), true
+	} else if strings.HasPrefix(trimContents, commentMarker) {
+		// toggle off comment
+		return strings.Replace(contents, commentMarker, "", 1), true
+	}
+	return contents, false
+}
+
 // CurrentLineCommented checks if the current trimmed line starts with "//", if "//" is given
 func (e *Editor) CurrentLineCommented(commentMarker string) bool {
 	return strings.HasPrefix(e.TrimmedLine(), commentMarker)
@@ -2090,8 +1967,6 @@ func (e *Editor) ForEachLineInBlock(c *vt100.Canvas, f func() bool) {
 	e.pos.sx = finalX
 	e.pos.sy = firstY
 	e.pos.offsetX = finalOffsetX
-	// Make sure no lines are nil
-	e.MakeConsistent()
 }
 
 // Block will return the text from the given line until
@@ -2099,12 +1974,12 @@ func (e *Editor) ForEachLineInBlock(c *vt100.Canvas, f func() bool) {
 func (e *Editor) Block(n LineIndex) string {
 	var (
 		bb, lb strings.Builder // block string builder and line string builder
-		line   []rune
+		line   string
 		ok     bool
 		s      string
 	)
 	for {
-		line, ok = e.lines[int(n)]
+		line, ok = e.lines.Line(int(n))
 		n++
 		if !ok || len(line) == 0 {
 			// End of document, empty line or invalid line: end of block
@@ -2186,7 +2061,7 @@ func (e *Editor) HorizontalScrollIfNeeded(c *vt100.Canvas) {
 	x := e.pos.sx
 	w := 80
 	if c != nil {
-		w = int(c.W())
+		w = int(e.pos.ViewWidth(c))
 	}
 	if x < w {
 		e.pos.offsetX = 0
@@ -2203,7 +2078,7 @@ func (e *Editor) VerticalScrollIfNeeded(c *vt100.Canvas) {
 	y := e.pos.sy
 	h := 25
 	if c != nil {
-		h = int(c.H())
+		h = int(e.pos.ViewHeight(c))
 	}
 	if y < h {
 		e.pos.offsetY = 0
@@ -2264,20 +2139,24 @@ func (e *Editor) Switch(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *
 		displayedImage bool
 	)
 
-	if switchBuffer.Len() == 1 {
-		// Load the Editor from the switchBuffer if switchBuffer has length 1, then use that editor.
-		switchBuffer.Restore(e)
+	if switchBuffer != nil {
+		// Load the Editor from the switchBuffer if switchBuffer is not empty, then use that editor.
+		e.Replace(switchBuffer)
+		switchBuffer = nil
 		undo, switchUndoBackup = switchUndoBackup, undo
 	} else {
-		fnord := FilenameOrData{filenameToOpen, []byte{}, 0, false}
+		fnord := FilenameOrData{filenameToOpen, []byte{}, 0, false, nil}
 		e2, statusMessage, displayedImage, err = NewEditor(tty, c, fnord, LineNumber(0), ColNumber(0), e.Theme, e.syntaxHighlight, false, e.monitorAndReadOnly, e.nanoMode.Load(), e.createDirectoriesIfMissing, e.displayQuickHelp)
-		if err == nil { // no issue
+		if err == nil && displayedImage {
+			// The file was displayed in the hex editor, so keep editing the current file
+			e.redraw.Store(true)
+			e.redrawCursor.Store(true)
+			return nil
+		} else if err == nil { // no issue
 			// Save the current Editor to the switchBuffer if switchBuffer if empty, then use the new editor.
-			switchBuffer.Snapshot(e)
+			switchBuffer = e.Copy()
 			// Now use e2 as the current editor
-			*e = *e2
-			(*e).lines = (*e2).lines
-			(*e).pos = (*e2).pos
+			e.Replace(e2)
 		} else if displayedImage {
 			// internal error
 			panic("displayed an image while switching from one Editor struct to another")
@@ -2288,6 +2167,7 @@ func (e *Editor) Switch(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *
 		go fnord.SetTitle()
 		undo, switchUndoBackup = switchUndoBackup, undo
 	}
+	e.LSPStartInBackground()
 
 	if statusMessage != "" {
 		status.SetMessageAfterRedraw(statusMessage)
@@ -2299,6 +2179,13 @@ func (e *Editor) Switch(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *
 	return err
 }
 
+// Replace replaces the current editor with the given editor, including the lines and the cursor position
+func (e *Editor) Replace(e2 *Editor) {
+	*e = *e2
+	(*e).lines = (*e2).lines
+	(*e).pos = (*e2).pos
+}
+
 // Reload tries to load the current file again
 func (e *Editor) Reload(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *LockKeeper) error {
 	return e.Switch(c, tty, status, lk, e.filename)
@@ -2339,7 +2226,7 @@ func (e *Editor) LineContentsFromCursorPosition() string {
 // "." is included.
 func (e *Editor) CurrentWord() string {
 	y := int(e.DataY())
-	runes, ok := e.lines[y]
+	runes, ok := e.lines.Runes(y)
 	if !ok {
 		// This should never happen
 		return ""
@@ -2398,7 +2285,7 @@ func (e *Editor) CurrentWord() string {
 // AnyTextBeforeCursor checks if there is any text before the cursor, on the same line
 func (e *Editor) AnyTextBeforeCursor() bool {
 	y := int(e.DataY())
-	runes, ok := e.lines[y]
+	runes, ok := e.lines.Runes(y)
 	if !ok {
 		// This should never happen
 		return false
@@ -2416,7 +2303,7 @@ func (e *Editor) AnyTextBeforeCursor() bool {
 // LettersBeforeCursor returns the current word up until the cursor (for autocompletion)
 func (e *Editor) LettersBeforeCursor() string {
 	y := int(e.DataY())
-	runes, ok := e.lines[y]
+	runes, ok := e.lines.Runes(y)
 
 	if !ok {
 		// This should never happen
@@ -2452,7 +2339,7 @@ func (e *Editor) LettersBeforeCursor() string {
 // Will also include ".".
 func (e *Editor) LettersOrDotBeforeCursor() string {
 	y := int(e.DataY())
-	runes, ok := e.lines[y]
+	runes, ok := e.lines.Runes(y)
 	if !ok {
 		// This should never happen
 		return ""
@@ -2503,6 +2390,7 @@ func (e *Editor) UserInput(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, t
 		if e.debugMode {
 			e.DrawWatches(c, false)      // don't reposition cursor
 			e.DrawRegisters(c, false)    // don't reposition cursor
+			e.DrawCallStack(c, false)    // don't reposition cursor
 			e.DrawInstructions(c, false) // don't reposition cursor
 			e.DrawFlags(c, false)        // don't reposition cursor
 			e.DrawGDBOutput(c, false)    // don't reposition cursor
@@ -2634,6 +2522,7 @@ func (e *Editor) GoToMiddle(c *vt100.Canvas, status *StatusBar) {
 
 // GoToEnd jumps and scrolls to the end of the file
 func (e *Editor) GoToEnd(c *vt100.Canvas, status *StatusBar) {
+	e.MergeLargeFileIndex(true)
 	// Go to the last line (by line number, not by index, e.Len() returns an index which is why there is no -1)
 	e.redraw.Store(e.GoToLineNumber(LineNumber(e.Len()), c, status, true))
 }
@@ -2952,8 +2841,9 @@ func (e *Editor) JoinLineWithNext(c *vt100.Canvas, bookmark *Position) bool {
 // EnableAndPlaceCursor first sets the cursor to shown and then places it at the right position
 func (e *Editor) EnableAndPlaceCursor(c *vt100.Canvas) {
 	//e.pos.mut.Lock()
-	x := uint(e.pos.ScreenX())
-	y := uint(e.pos.ScreenY())
+	vx, vy := e.pos.ViewOrigin()
+	x := vx + uint(e.cursorScreenX())
+	y := vy + uint(e.cursorScreenY())
 	//e.pos.mut.Unlock()
 	c.ShowCursor()
 	vt100.SetXY(x, y)
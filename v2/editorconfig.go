@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// editorConfigFilename is the name of the files that are looked for in the directory of the file that is opened,
+// and in all parent directories, until a file with "root = true" is found
+const editorConfigFilename = ".editorconfig"
+
+// EditorConfig is the set of properties from .editorconfig files that apply to one file.
+// The keys and values are lowercase.
+type EditorConfig map[string]string
+
+// editorConfigSection is a section in an .editorconfig file, with a glob and properties
+type editorConfigSection struct {
+	glob       string
+	properties [][2]string // key and value, in the order they appear in the file
+}
+
+// editorConfigFile is a parsed .editorconfig file
+type editorConfigFile struct {
+	root     bool
+	sections []editorConfigSection
+}
+
+// parseEditorConfig parses the contents of an .editorconfig file
+func parseEditorConfig(data []byte) *editorConfigFile {
+	var (
+		ecf     editorConfigFile
+		section *editorConfigSection
+		scanner = bufio.NewScanner(bytes.NewReader(data))
+	)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			ecf.sections = append(ecf.sections, editorConfigSection{glob: line[1 : len(line)-1]})
+			section = &ecf.sections[len(ecf.sections)-1]
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.ToLower(strings.TrimSpace(value))
+		if section == nil {
+			// The preamble, before the first section
+			if key == "root" {
+				ecf.root = value == "true"
+			}
+			continue
+		}
+		section.properties = append(section.properties, [2]string{key, value})
+	}
+	return &ecf
+}
+
+// findClosingBrace returns the index of the '}' that matches the '{' at the given index, or -1
+func findClosingBrace(runes []rune, start int) int {
+	depth := 0
+	for i := start; i < len(runes); i++ {
+		switch runes[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitBraceAlternatives splits the contents of a {s1,s2,s3} glob at the commas that are not within nested braces
+func splitBraceAlternatives(runes []rune) []string {
+	var (
+		alternatives []string
+		depth        int
+		start        int
+	)
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				alternatives = append(alternatives, string(runes[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(alternatives, string(runes[start:]))
+}
+
+// numericRangePattern matches the contents of a {num1..num2} glob
+var numericRangePattern = regexp.MustCompile(`^([+-]?\d+)\.\.([+-]?\d+)$`)
+
+// editorConfigGlobToRegexp converts an .editorconfig glob to a regular expression, without anchors.
+// Supported are *, **, ?, [name], [!name], {s1,s2,s3} and {num1..num2}.
+func editorConfigGlobToRegexp(glob string) string {
+	var (
+		sb    strings.Builder
+		runes = []rune(glob)
+	)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch r {
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(string(runes[i])))
+			} else {
+				sb.WriteString(`\\`)
+			}
+		case '*':
+			if i+1 < len(runes) && runes[i+1] == '*' {
+				sb.WriteString(".*")
+				i++
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			end := strings.IndexRune(string(runes[i+1:]), ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			contents := []rune(string(runes[i+1:])[:end])
+			i += len(contents) + 1
+			sb.WriteString("[")
+			if len(contents) > 0 && contents[0] == '!' {
+				sb.WriteString("^")
+				contents = contents[1:]
+			}
+			sb.WriteString(strings.NewReplacer(`\`, `\\`, "[", `\[`).Replace(string(contents)))
+			sb.WriteString("]")
+		case '{':
+			end := findClosingBrace(runes, i)
+			if end < 0 {
+				sb.WriteString(`\{`)
+				continue
+			}
+			contents := runes[i+1 : end]
+			i = end
+			if m := numericRangePattern.FindStringSubmatch(string(contents)); m != nil {
+				// The number is checked to be within the range when matching
+				sb.WriteString(`([+-]?\d+)`)
+				continue
+			}
+			alternatives := splitBraceAlternatives(contents)
+			if len(alternatives) < 2 {
+				sb.WriteString(regexp.QuoteMeta("{" + string(contents) + "}"))
+				continue
+			}
+			sb.WriteString("(?:")
+			for j, alternative := range alternatives {
+				if j > 0 {
+					sb.WriteString("|")
+				}
+				sb.WriteString(editorConfigGlobToRegexp(alternative))
+			}
+			sb.WriteString(")")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	return sb.String()
+}
+
+// numericRanges returns the {num1..num2} ranges in the given glob, in the order they appear
+func numericRanges(glob string) [][2]int {
+	var ranges [][2]int
+	runes := []rune(glob)
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '\\':
+			i++
+		case '{':
+			if end := findClosingBrace(runes, i); end >= 0 {
+				if m := numericRangePattern.FindStringSubmatch(string(runes[i+1 : end])); m != nil {
+					from, _ := strconv.Atoi(m[1])
+					to, _ := strconv.Atoi(m[2])
+					ranges = append(ranges, [2]int{min(from, to), max(from, to)})
+					i = end
+				}
+			}
+		}
+	}
+	return ranges
+}
+
+// editorConfigGlobMatch checks if the given glob from a section in an .editorconfig file matches the given path,
+// which is relative to the directory of the .editorconfig file and uses forward slashes
+func editorConfigGlobMatch(glob, path string) bool {
+	var pattern string
+	if strings.Contains(glob, "/") {
+		// The glob is relative to the directory of the .editorconfig file
+		pattern = "^" + editorConfigGlobToRegexp(strings.TrimPrefix(glob, "/")) + "$"
+	} else {
+		// The glob matches the filename, in any subdirectory
+		pattern = "^(?:.*/)?" + editorConfigGlobToRegexp(glob) + "$"
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false
+	}
+	m := re.FindStringSubmatch(path)
+	if m == nil {
+		return false
+	}
+	// Check that the numbers are within the {num1..num2} ranges
+	for i, numRange := range numericRanges(glob) {
+		if i+1 >= len(m) {
+			break
+		}
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil || n < numRange[0] || n > numRange[1] {
+			return false
+		}
+	}
+	return true
+}
+
+// LoadEditorConfig finds the .editorconfig files that apply to the given filename, in the directory of the file
+// and upwards until a file with "root = true" is found, and returns the combined properties.
+// Properties in .editorconfig files closer to the file take precedence. Returns nil if no properties apply.
+func LoadEditorConfig(filename string) EditorConfig {
+	absFilename, err := filepath.Abs(filename)
+	if err != nil {
+		return nil
+	}
+	// Collect the .editorconfig files, from the closest one and upwards
+	var (
+		dirs  []string
+		files []*editorConfigFile
+	)
+	for dir := filepath.Dir(absFilename); ; dir = filepath.Dir(dir) {
+		if data, err := os.ReadFile(filepath.Join(dir, editorConfigFilename)); err == nil {
+			ecf := parseEditorConfig(data)
+			dirs = append(dirs, dir)
+			files = append(files, ecf)
+			if ecf.root {
+				break
+			}
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			break
+		}
+	}
+	// Apply the properties from the outermost file first, so that closer files and later sections take precedence
+	ec := make(EditorConfig)
+	for i := len(files) - 1; i >= 0; i-- {
+		relPath, err := filepath.Rel(dirs[i], absFilename)
+		if err != nil {
+			continue
+		}
+		relPath = filepath.ToSlash(relPath)
+		for _, section := range files[i].sections {
+			if !editorConfigGlobMatch(section.glob, relPath) {
+				continue
+			}
+			for _, property := range section.properties {
+				ec[property[0]] = property[1]
+			}
+		}
+	}
+	// A property can be set to "unset", to remove the effect of the property
+	for key, value := range ec {
+		if value == "unset" {
+			delete(ec, key)
+		}
+	}
+	if len(ec) == 0 {
+		return nil
+	}
+	return ec
+}
+
+// Int returns the given property as a positive number, if it is set to one
+func (ec EditorConfig) Int(key string) (int, bool) {
+	n, err := strconv.Atoi(ec[key])
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// Bool returns the given property as a bool, and true if the property is set to either "true" or "false"
+func (ec EditorConfig) Bool(key string) (bool, bool) {
+	switch ec[key] {
+	case "true":
+		return true, true
+	case "false":
+		return false, true
+	}
+	return false, false
+}
+
+// LineEnding returns the line ending that is given by the end_of_line property, or "\n"
+func (ec EditorConfig) LineEnding() string {
+	switch ec["end_of_line"] {
+	case "crlf":
+		return "\r\n"
+	case "cr":
+		return "\r"
+	}
+	return "\n"
+}
+
+// ApplyEditorConfig sets the indentation, the wrap width, the line endings and the charset of the editor,
+// given the properties from .editorconfig files. The properties that are used when saving are stored in the editor.
+func (e *Editor) ApplyEditorConfig(ec EditorConfig) {
+	e.editorConfig = ec
+	if ec == nil {
+		return
+	}
+	switch ec["indent_style"] {
+	case "tab":
+		e.indentation.Spaces = false
+	case "space":
+		e.indentation.Spaces = true
+	}
+	// tab_width defaults to indent_size, and an indent_size of "tab" means that tab_width is used
+	indentSize, hasIndentSize := ec.Int("indent_size")
+	tabWidth, hasTabWidth := ec.Int("tab_width")
+	if !hasIndentSize && hasTabWidth {
+		indentSize, hasIndentSize = tabWidth, true
+	}
+	if !hasTabWidth && hasIndentSize {
+		tabWidth, hasTabWidth = indentSize, true
+	}
+	// The editor uses the same width for one tab and for one level of indentation
+	if e.indentation.Spaces && hasIndentSize {
+		e.indentation.PerTab = indentSize
+	} else if !e.indentation.Spaces && hasTabWidth {
+		e.indentation.PerTab = tabWidth
+	}
+	// The line endings and the charset given by the .editorconfig files are used instead of the detected ones
+	if _, ok := ec["end_of_line"]; ok {
+		e.fileFormat.lineEnding = ec.LineEnding()
+	}
+	switch ec["charset"] {
+	case "utf-8":
+		e.fileFormat.charset, e.fileFormat.bom = charsetUTF8, false
+	case "utf-8-bom":
+		e.fileFormat.charset, e.fileFormat.bom = charsetUTF8, true
+	case "utf-16le":
+		e.fileFormat.charset = charsetUTF16LE
+	case "utf-16be":
+		e.fileFormat.charset = charsetUTF16BE
+	case "latin1":
+		e.fileFormat.charset = charsetLatin1
+	}
+	if maxLineLength, ok := ec.Int("max_line_length"); ok {
+		e.wrapWidth = maxLineLength
+	}
+}
+
+// editorConfigTabs checks if the .editorconfig files say that tabs should be used for indentation
+func (e *Editor) editorConfigTabs() bool {
+	return e.editorConfig["indent_style"] == "tab"
+}
+
+// trimTrailingWhitespace checks if trailing whitespace should be removed when saving.
+// This is the default, unless trim_trailing_whitespace is set to false in an .editorconfig file.
+func (e *Editor) trimTrailingWhitespace() bool {
+	if trim, ok := e.editorConfig.Bool("trim_trailing_whitespace"); ok {
+		return trim
+	}
+	return true
+}
+
+// insertFinalNewline checks if a final newline should be added when saving.
+// This is the default, unless insert_final_newline is set to false in an .editorconfig file.
+func (e *Editor) insertFinalNewline() bool {
+	if insert, ok := e.editorConfig.Bool("insert_final_newline"); ok {
+		return insert
+	}
+	return true
+}
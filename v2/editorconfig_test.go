@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xyproto/mode"
+)
+
+func TestEditorConfigGlobMatch(t *testing.T) {
+	tests := []struct {
+		glob, path string
+		match      bool
+	}{
+		{"*", "main.go", true},
+		{"*", "cmd/main.go", true},
+		{"*.go", "cmd/main.go", true},
+		{"*.go", "main.go.txt", false},
+		{"Makefile", "sub/Makefile", true},
+		{"*.{js,ts}", "app.ts", true},
+		{"*.{js,ts}", "app.py", false},
+		{"lib/**.js", "lib/a/b/c.js", true},
+		{"lib/*.js", "lib/a/b.js", false},
+		{"/lib/*.js", "lib/b.js", true},
+		{"lib/*.js", "src/lib/b.js", false},
+		{"file?.txt", "file1.txt", true},
+		{"file[ab].txt", "fileb.txt", true},
+		{"file[!ab].txt", "fileb.txt", false},
+		{"file{1..3}.txt", "file2.txt", true},
+		{"file{1..3}.txt", "file4.txt", false},
+		{"{a,{b,c}}.md", "c.md", true},
+	}
+	for _, test := range tests {
+		if got := editorConfigGlobMatch(test.glob, test.path); got != test.match {
+			t.Errorf("matching %q against %q: expected %v, got %v", test.glob, test.path, test.match, got)
+		}
+	}
+}
+
+func TestLoadEditorConfig(t *testing.T) {
+	dir := t.TempDir()
+	subDir := filepath.Join(dir, "sub")
+	if err := os.Mkdir(subDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	outer := "root = true\n\n[*]\nindent_style = space\nindent_size = 2\nend_of_line = CRLF\n\n[*.go]\nindent_style = tab\n"
+	inner := "# The closest file takes precedence\n[*.go]\ntab_width = 8\nmax_line_length = 100\nend_of_line = unset\n"
+	if err := os.WriteFile(filepath.Join(dir, editorConfigFilename), []byte(outer), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(subDir, editorConfigFilename), []byte(inner), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ec := LoadEditorConfig(filepath.Join(subDir, "main.go"))
+	if ec["indent_style"] != "tab" || ec["indent_size"] != "2" || ec["tab_width"] != "8" {
+		t.Errorf("unexpected properties: %v", ec)
+	}
+	if _, found := ec["end_of_line"]; found {
+		t.Errorf("expected end_of_line to be unset, got %q", ec["end_of_line"])
+	}
+	if ec := LoadEditorConfig(filepath.Join(subDir, "README.md")); ec.LineEnding() != "\r\n" {
+		t.Errorf("expected CRLF line endings, got %q", ec.LineEnding())
+	}
+
+	e := NewSimpleEditor(80)
+	e.indentation = mode.TabsSpaces{PerTab: 4, Spaces: true}
+	e.ApplyEditorConfig(ec)
+	if e.indentation.Spaces || e.indentation.PerTab != 8 || e.wrapWidth != 100 {
+		t.Errorf("expected tabs with a width of 8 and a wrap width of 100, got %+v and %d", e.indentation, e.wrapWidth)
+	}
+	if !e.trimTrailingWhitespace() || !e.insertFinalNewline() {
+		t.Error("expected trailing whitespace to be trimmed and a final newline to be inserted by default")
+	}
+}
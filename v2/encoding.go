@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	binarydetection "github.com/xyproto/binary"
+)
+
+// Charset is the character encoding of a file. The text is always UTF-8 while editing.
+type Charset int
+
+const (
+	charsetUTF8 Charset = iota
+	charsetUTF16LE
+	charsetUTF16BE
+	charsetLatin1
+)
+
+// FileFormat is the character encoding and the line ending style of a file, that is detected when loading
+// and used again when saving, so that files are written back in the same way as they were read
+type FileFormat struct {
+	charset    Charset
+	bom        bool   // does the file start with a byte order mark?
+	lineEnding string // "\n", "\r\n" or "\r"
+	mixed      bool   // were there other line endings too, that will be converted to lineEnding when saving?
+}
+
+var (
+	utf8BOM    = []byte{0xef, 0xbb, 0xbf}
+	utf16LEBOM = []byte{0xff, 0xfe}
+	utf16BEBOM = []byte{0xfe, 0xff}
+
+	// lineEndingReplacer replaces DOS and old Mac line endings with UNIX line endings
+	lineEndingReplacer = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+)
+
+// String returns the name of the charset
+func (cs Charset) String() string {
+	switch cs {
+	case charsetUTF16LE:
+		return "UTF-16LE"
+	case charsetUTF16BE:
+		return "UTF-16BE"
+	case charsetLatin1:
+		return "ISO-8859-1"
+	}
+	return "UTF-8"
+}
+
+// lineEndingName returns a short name for the given line ending
+func lineEndingName(lineEnding string) string {
+	switch lineEnding {
+	case "\r\n":
+		return "CRLF"
+	case "\r":
+		return "CR"
+	}
+	return "LF"
+}
+
+// String returns a description of the file format, like "UTF-16LE with BOM, CRLF"
+func (ff FileFormat) String() string {
+	s := ff.charset.String()
+	if ff.bom {
+		s += " with BOM"
+	}
+	if ff.mixed {
+		return s + ", mixed line endings, saved as " + lineEndingName(ff.lineEnding)
+	}
+	return s + ", " + lineEndingName(ff.lineEnding)
+}
+
+// Default checks if this is UTF-8 without a byte order mark and with only UNIX line endings
+func (ff FileFormat) Default() bool {
+	return ff.charset == charsetUTF8 && !ff.bom && (ff.lineEnding == "" || ff.lineEnding == "\n") && !ff.mixed
+}
+
+// utf16ByNULBytes checks if the given data looks like UTF-16 without a byte order mark, by checking if every
+// other byte is 0, as for text that is mostly ASCII. Returns the charset and true if this is the case.
+func utf16ByNULBytes(data []byte) (Charset, bool) {
+	const maxSampleLength = 4096
+	sample := data[:min(len(data), maxSampleLength)]
+	pairs := len(sample) / 2
+	if pairs < 2 {
+		return charsetUTF8, false
+	}
+	var evenNULs, oddNULs int
+	for i := 0; i+1 < len(sample); i += 2 {
+		if sample[i] == 0 {
+			evenNULs++
+		}
+		if sample[i+1] == 0 {
+			oddNULs++
+		}
+	}
+	switch {
+	case oddNULs*10 >= pairs*7 && evenNULs*10 < pairs:
+		return charsetUTF16LE, true
+	case evenNULs*10 >= pairs*7 && oddNULs*10 < pairs:
+		return charsetUTF16BE, true
+	}
+	return charsetUTF8, false
+}
+
+// decodeUTF16 converts UTF-16 data, without a byte order mark, to UTF-8
+func decodeUTF16(data []byte, byteOrder binary.ByteOrder) []byte {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = byteOrder.Uint16(data[i*2:])
+	}
+	return []byte(string(utf16.Decode(units)))
+}
+
+// decodeLatin1 converts ISO-8859-1 data to UTF-8
+func decodeLatin1(data []byte) []byte {
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return []byte(string(runes))
+}
+
+// detectLineEnding returns the most common line ending in the given UTF-8 data, or "\n" if there are none.
+// Also returns true if there is more than one kind of line ending.
+func detectLineEnding(data []byte) (string, bool) {
+	crlf := bytes.Count(data, []byte{'\r', '\n'})
+	lf := bytes.Count(data, []byte{'\n'}) - crlf
+	cr := bytes.Count(data, []byte{'\r'}) - crlf
+	mixed := (crlf > 0 && lf > 0) || (crlf > 0 && cr > 0) || (lf > 0 && cr > 0)
+	switch {
+	case crlf > 0 && crlf >= lf && crlf >= cr:
+		return "\r\n", mixed
+	case cr > 0 && cr > lf:
+		return "\r", mixed
+	}
+	return "\n", mixed
+}
+
+// DecodeFileData detects the character encoding and the line endings of the given data,
+// by looking for byte order marks, for NUL bytes in every other position and for invalid UTF-8.
+// Returns the detected file format and the data converted to UTF-8, without a byte order mark.
+// Binary data is returned as it is.
+func DecodeFileData(data []byte) (FileFormat, []byte) {
+	ff := FileFormat{charset: charsetUTF8}
+	switch {
+	case bytes.HasPrefix(data, utf8BOM):
+		ff.bom = true
+		data = data[len(utf8BOM):]
+	case bytes.HasPrefix(data, utf16LEBOM):
+		ff.charset, ff.bom = charsetUTF16LE, true
+		data = decodeUTF16(data[len(utf16LEBOM):], binary.LittleEndian)
+	case bytes.HasPrefix(data, utf16BEBOM):
+		ff.charset, ff.bom = charsetUTF16BE, true
+		data = decodeUTF16(data[len(utf16BEBOM):], binary.BigEndian)
+	default:
+		if charset, ok := utf16ByNULBytes(data); ok {
+			ff.charset = charset
+			if charset == charsetUTF16LE {
+				data = decodeUTF16(data, binary.LittleEndian)
+			} else {
+				data = decodeUTF16(data, binary.BigEndian)
+			}
+		} else if binarydetection.Data(data) {
+			return ff, data
+		} else if !utf8.Valid(data) {
+			ff.charset = charsetLatin1
+			data = decodeLatin1(data)
+		}
+	}
+	ff.lineEnding, ff.mixed = detectLineEnding(data)
+	return ff, data
+}
+
+// Encode converts the given UTF-8 text, with UNIX line endings, to this file format
+func (ff FileFormat) Encode(s string) ([]byte, error) {
+	if ff.lineEnding != "" && ff.lineEnding != "\n" {
+		s = strings.ReplaceAll(s, "\n", ff.lineEnding)
+	}
+	var buf bytes.Buffer
+	switch ff.charset {
+	case charsetUTF16LE, charsetUTF16BE:
+		var byteOrder binary.ByteOrder = binary.LittleEndian
+		if ff.charset == charsetUTF16BE {
+			byteOrder = binary.BigEndian
+		}
+		units := utf16.Encode([]rune(s))
+		if ff.bom {
+			units = append([]uint16{0xfeff}, units...)
+		}
+		b := make([]byte, 2)
+		for _, unit := range units {
+			byteOrder.PutUint16(b, unit)
+			buf.Write(b)
+		}
+	case charsetLatin1:
+		for _, r := range s {
+			if r > 0xff {
+				return nil, fmt.Errorf("%q can not be saved as %s, convert the file to UTF-8 first", r, ff.charset)
+			}
+			buf.WriteByte(byte(r))
+		}
+	default:
+		if ff.bom {
+			buf.Write(utf8BOM)
+		}
+		buf.WriteString(s)
+	}
+	return buf.Bytes(), nil
+}
+
+// FileFormatDescription returns a description of the character encoding and line endings of the current file
+func (e *Editor) FileFormatDescription() string {
+	return e.fileFormat.String()
+}
+
+// ConvertToUTF8 makes the file be saved as UTF-8 without a byte order mark
+func (e *Editor) ConvertToUTF8() error {
+	if e.binaryFile {
+		return errors.New("can not convert a binary file")
+	}
+	if e.fileFormat.charset == charsetUTF8 && !e.fileFormat.bom {
+		return errors.New("already UTF-8")
+	}
+	e.fileFormat.charset = charsetUTF8
+	e.fileFormat.bom = false
+	e.changed.Store(true)
+	return nil
+}
+
+// SetLineEnding makes the file be saved with the given line ending, "\n" or "\r\n"
+func (e *Editor) SetLineEnding(lineEnding string) error {
+	if e.binaryFile {
+		return errors.New("can not convert a binary file")
+	}
+	if lineEndingName(e.fileFormat.lineEnding) == lineEndingName(lineEnding) && !e.fileFormat.mixed {
+		return errors.New("already using " + lineEndingName(lineEnding) + " line endings")
+	}
+	e.fileFormat.lineEnding = lineEnding
+	e.fileFormat.mixed = false
+	e.changed.Store(true)
+	return nil
+}
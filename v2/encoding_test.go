@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecodeFileData(t *testing.T) {
+	tests := []struct {
+		data    []byte
+		format  string
+		decoded string
+	}{
+		{[]byte("a\nb\n"), "UTF-8, LF", "a\nb\n"},
+		{[]byte("a\r\nb\r\n"), "UTF-8, CRLF", "a\r\nb\r\n"},
+		{[]byte("\xef\xbb\xbfæ\n"), "UTF-8 with BOM, LF", "æ\n"},
+		{[]byte("\xff\xfea\x00\r\x00\n\x00"), "UTF-16LE with BOM, CRLF", "a\r\n"},
+		{[]byte("\x00h\x00i\x00\n\x00!"), "UTF-16BE, LF", "hi\n!"},
+		{[]byte("caf\xe9 cr\xe8me\n"), "ISO-8859-1, LF", "café crème\n"},
+	}
+	for _, test := range tests {
+		ff, decoded := DecodeFileData(test.data)
+		if ff.String() != test.format {
+			t.Errorf("expected %q to be detected as %s, got %s", test.data, test.format, ff)
+		}
+		if string(decoded) != test.decoded {
+			t.Errorf("expected %q to be decoded to %q, got %q", test.data, test.decoded, decoded)
+		}
+		encoded, err := ff.Encode(lineEndingReplacer.Replace(string(decoded)))
+		if err != nil {
+			t.Error(err)
+		} else if !bytes.Equal(encoded, test.data) {
+			t.Errorf("expected %q to be encoded back to %q, got %q", decoded, test.data, encoded)
+		}
+	}
+}
+
+func TestFileFormatConversion(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.DecodeAndLoadBytes([]byte("caf\xe9\r\nbar\r\n"))
+	if got, want := e.String(), "café\nbar\n"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if e.fileFormat.Default() {
+		t.Error("expected the file format to be detected as ISO-8859-1 with CRLF line endings")
+	}
+
+	// Text that can not be represented in ISO-8859-1 must be converted to UTF-8 before saving
+	if _, err := e.fileFormat.Encode("€\n"); err == nil {
+		t.Error("expected an error when encoding € as ISO-8859-1")
+	}
+	if err := e.ConvertToUTF8(); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.SetLineEnding("\n"); err != nil {
+		t.Fatal(err)
+	}
+	if !e.fileFormat.Default() {
+		t.Errorf("expected UTF-8 with LF line endings, got %s", e.fileFormat)
+	}
+	if err := e.SetLineEnding("\n"); err == nil {
+		t.Error("expected an error when the line endings are already LF")
+	}
+}
+
+func TestFileFormatIsKeptWhenReloading(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.DecodeAndLoadBytes([]byte("caf\xe9\r\nbar\r\n"))
+	fileFormat := e.fileFormat
+
+	// Replacing text reloads the editor contents from e.String()
+	if n, err := e.ReplaceMatches("bar", "baz", -1, NewUndo(defaultUndoCount, defaultUndoMemory)); err != nil || n != 1 {
+		t.Fatalf("expected one replacement, got %d (%v)", n, err)
+	}
+	if e.fileFormat != fileFormat {
+		t.Errorf("expected the file format to still be %s, got %s", fileFormat, e.fileFormat)
+	}
+	data, err := e.fileFormat.Encode(e.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "caf\xe9\r\nbaz\r\n"; string(data) != want {
+		t.Errorf("expected %q, got %q", want, data)
+	}
+}
+
+func TestLookalikeCharactersAreKept(t *testing.T) {
+	const text = "a\u00a0b;\u037e\n"
+	filename := filepath.Join(t.TempDir(), "nbsp.txt")
+	if err := os.WriteFile(filename, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	e := NewSimpleEditor(80)
+	e.filename = filename
+	if err := e.ReadFileAndProcessLines(filename); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Save(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filename); string(data) != text {
+		t.Errorf("expected opening and saving the file to keep it as it is, got %q", data)
+	}
+
+	// The characters are only replaced when asked to
+	if !e.HasLookalikeCharacters() {
+		t.Error("expected the non-breaking space to be found")
+	}
+	if n := e.ReplaceLookalikeCharacters(); n != 1 {
+		t.Errorf("expected one line to be changed, got %d", n)
+	}
+	if got := e.Line(0); got != "a b;;" {
+		t.Errorf("expected %q, got %q", "a b;;", got)
+	}
+	if e.HasLookalikeCharacters() {
+		t.Error("expected all look-alike characters to be replaced")
+	}
+}
+
+func TestMixedLineEndings(t *testing.T) {
+	if ff, _ := DecodeFileData([]byte("a\r\nb\n")); !ff.mixed {
+		t.Error("expected CRLF and LF line endings to be detected as mixed")
+	}
+	e := NewSimpleEditor(80)
+	e.DecodeAndLoadBytes([]byte("a\r\nb\r\nc\n"))
+	if got, want := e.FileFormatDescription(), "UTF-8, mixed line endings, saved as CRLF"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if e.fileFormat.Default() {
+		t.Error("expected mixed line endings to not be the default file format")
+	}
+	// Converting to the most common line ending is allowed, since not all lines have it
+	if err := e.SetLineEnding("\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	if e.fileFormat.mixed {
+		t.Error("expected the line endings to no longer be mixed after converting them")
+	}
+}
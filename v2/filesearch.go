@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/xyproto/files"
+	"github.com/xyproto/mode"
 )
 
 // Don't search for a corresponding header/source file for longer than ~0.5 seconds
@@ -83,3 +84,32 @@ func ExtFileSearch(absCppFilename string, headerExtensions []string, maxTime tim
 	// Return the result
 	return foundHeaderAbsPath, nil
 }
+
+// CorrespondingFile tries to find the header file for a C, C++ or Objective-C source file, or the source file for a header file.
+// Returns an error if this is not such a file, or if no corresponding file was found.
+func (e *Editor) CorrespondingFile() (string, error) {
+	if e.mode != mode.C && e.mode != mode.Cpp && e.mode != mode.ObjC {
+		return "", errors.New("not a C, C++ or Objective-C file")
+	}
+	absFilename, err := e.AbsFilename()
+	if err != nil {
+		return "", err
+	}
+	var extensions []string
+	switch ext := filepath.Ext(e.filename); {
+	case hasS([]string{".cpp", ".cc", ".c", ".cxx", ".c++", ".m", ".mm", ".M"}, ext):
+		extensions = []string{".h", ".hpp", ".h++"}
+	case hasS([]string{".h", ".hpp", ".h++"}, ext):
+		extensions = []string{".c", ".cpp", ".cxx", ".cc", ".c++"}
+	default:
+		return "", errors.New("not a source or header file: " + filepath.Base(e.filename))
+	}
+	correspondingFilename, err := ExtFileSearch(absFilename, extensions, fileSearchMaxTime)
+	if err != nil {
+		return "", err
+	}
+	if correspondingFilename == "" {
+		return "", errors.New("found no corresponding file for " + filepath.Base(e.filename))
+	}
+	return correspondingFilename, nil
+}
@@ -4,12 +4,13 @@ import (
 	"github.com/xyproto/env/v2"
 )
 
-// FilenameOrData represents either a filename, or data read in from stdin
+// FilenameOrData represents either a filename, or data read in from stdin or from a file within an archive
 type FilenameOrData struct {
 	filename string
 	data     []byte
 	length   int
 	stdin    bool
+	archive  *ArchiveEntry // the file within a zip or tar archive that the data was read from, if any
 }
 
 // ExpandUser will expand the filename if it starts with "~"
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/xyproto/mode"
+)
+
+// Fold is a region of lines that can be folded. When the fold is closed, only the first line is shown,
+// and the lines after start, up to and including end, are hidden.
+type Fold struct {
+	start LineIndex
+	end   LineIndex
+}
+
+// foldsByIndentation returns true if folds should be found by looking at the indentation instead of the brackets
+func (e *Editor) foldsByIndentation() bool {
+	switch e.mode {
+	case mode.Nim, mode.Python, mode.Mojo, mode.Starlark:
+		return true
+	case mode.Config:
+		ext := filepath.Ext(e.filename)
+		return ext == ".yml" || ext == ".yaml"
+	}
+	return false
+}
+
+// FoldRegions returns all regions that can be folded, sorted by the first line
+func (e *Editor) FoldRegions() []Fold {
+	var folds []Fold
+	if e.foldsByIndentation() {
+		folds = e.indentationFolds()
+	} else {
+		folds = e.bracketFolds()
+	}
+	sort.Slice(folds, func(i, j int) bool {
+		if folds[i].start != folds[j].start {
+			return folds[i].start < folds[j].start
+		}
+		return folds[i].end > folds[j].end
+	})
+	return folds
+}
+
+// bracketFolds finds the regions between a line that opens a bracket and the line that closes it.
+// The line with the closing bracket is not part of the fold, so that it is still shown when the fold is closed.
+func (e *Editor) bracketFolds() []Fold {
+	ignoreSingleQuotes := e.mode == mode.Lisp || e.mode == mode.Clojure || e.mode == mode.Scheme || e.mode == mode.Ini
+	q, err := NewQuoteState(e.SingleLineCommentMarker(), e.mode, ignoreSingleQuotes)
+	if err != nil {
+		return nil
+	}
+	type opening struct {
+		y     LineIndex
+		depth int // the depth before the opening bracket
+	}
+	var (
+		folds []Fold
+		stack []opening
+		depth int
+	)
+	for y := LineIndex(0); int(y) < e.Len(); y++ {
+		change, lowest := q.BracketDepth(e.TrimmedLineAt(y))
+		// Close the folds that were opened at a depth that is reached again on this line
+		for len(stack) > 0 && stack[len(stack)-1].depth >= depth+lowest {
+			start := stack[len(stack)-1].y
+			stack = stack[:len(stack)-1]
+			if y-1 > start {
+				folds = append(folds, Fold{start, y - 1})
+			}
+		}
+		// A line like "} else {" both closes and opens a fold
+		if change > lowest {
+			stack = append(stack, opening{y, depth + lowest})
+		}
+		depth += change
+	}
+	return folds
+}
+
+// indentationWidth returns the number of screen columns that the leading whitespace of the given line takes up
+func (e *Editor) indentationWidth(line string) int {
+	width := 0
+	for _, r := range getLeadingWhitespace(line) {
+		if r == '\t' {
+			width += e.indentation.PerTab
+		} else {
+			width++
+		}
+	}
+	return width
+}
+
+// indentationFolds finds the regions where the lines after a line are indented more than the line itself.
+// Blank lines at the end of a region are not part of the fold.
+func (e *Editor) indentationFolds() []Fold {
+	type opening struct {
+		y           LineIndex
+		indentation int
+	}
+	var (
+		folds        []Fold
+		stack        []opening
+		lastNonBlank LineIndex
+	)
+	closeFolds := func(indentation int) {
+		for len(stack) > 0 && stack[len(stack)-1].indentation >= indentation {
+			start := stack[len(stack)-1].y
+			stack = stack[:len(stack)-1]
+			if lastNonBlank > start {
+				folds = append(folds, Fold{start, lastNonBlank})
+			}
+		}
+	}
+	for y := LineIndex(0); int(y) < e.Len(); y++ {
+		line := e.Line(y)
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indentation := e.indentationWidth(line)
+		closeFolds(indentation)
+		stack = append(stack, opening{y, indentation})
+		lastNonBlank = y
+	}
+	closeFolds(0)
+	return folds
+}
+
+// closedFoldAt returns the closed fold that starts at the given line, if there is one
+func (e *Editor) closedFoldAt(y LineIndex) (Fold, bool) {
+	for _, fold := range e.folds {
+		if fold.start == y {
+			return fold, true
+		}
+	}
+	return Fold{}, false
+}
+
+// isHidden returns true if the given line is hidden by a closed fold
+func (e *Editor) isHidden(y LineIndex) bool {
+	for _, fold := range e.folds {
+		if y > fold.start && y <= fold.end {
+			return true
+		}
+	}
+	return false
+}
+
+// nextVisibleLine returns the line index of the first line after the given line that is not hidden by a fold
+func (e *Editor) nextVisibleLine(y LineIndex) LineIndex {
+	y++
+	for _, fold := range e.folds {
+		if y > fold.start && y <= fold.end {
+			y = fold.end + 1
+		}
+	}
+	return y
+}
+
+// visibleLineAbove returns the line index of the first line above the given line that is not hidden by a fold.
+// If the line above is hidden, the first line of the fold that hides it is returned.
+func (e *Editor) visibleLineAbove(y LineIndex) LineIndex {
+	y--
+	for i := len(e.folds) - 1; i >= 0; i-- {
+		if fold := e.folds[i]; y > fold.start && y <= fold.end {
+			y = fold.start
+		}
+	}
+	return y
+}
+
+// hiddenLinesBetween returns the number of lines from the given line, up to but not including the other given line,
+// that are hidden by closed folds
+func (e *Editor) hiddenLinesBetween(from, to LineIndex) int {
+	count := 0
+	for y := from; y < to; y++ {
+		if e.isHidden(y) {
+			count++
+		}
+	}
+	return count
+}
+
+// cursorScreenY returns the screen row of the cursor within the view, where lines that are hidden by folds are skipped
+// and soft wrapped lines may take up several rows
+func (e *Editor) cursorScreenY() int {
+	sy := e.pos.ScreenY()
+	if len(e.folds) == 0 && !e.softWrap {
+		return sy
+	}
+	offsetY := LineIndex(e.pos.OffsetY())
+	sy -= e.hiddenLinesBetween(offsetY, offsetY+LineIndex(sy))
+	if e.softWrap {
+		sy += e.softWrapRowsAbove()
+	}
+	return sy
+}
+
+// OpenFoldsAt opens the closed folds that hide the given line. Returns true if any folds were opened.
+func (e *Editor) OpenFoldsAt(y LineIndex) bool {
+	var (
+		kept   []Fold
+		opened bool
+	)
+	for _, fold := range e.folds {
+		if y > fold.start && y <= fold.end {
+			opened = true
+			continue
+		}
+		kept = append(kept, fold)
+	}
+	if opened {
+		e.folds = kept
+		e.redraw.Store(true)
+	}
+	return opened
+}
+
+// ToggleFold opens the closed fold at the current line, or closes the innermost fold that contains the current line.
+// When a fold is closed, the cursor is moved to the first line of the fold.
+func (e *Editor) ToggleFold() error {
+	y := e.DataY()
+	if fold, ok := e.closedFoldAt(y); ok {
+		e.folds = deleteFold(e.folds, fold)
+		e.redraw.Store(true)
+		return nil
+	}
+	var (
+		innermost Fold
+		found     bool
+	)
+	for _, fold := range e.FoldRegions() {
+		if y >= fold.start && y <= fold.end && (!found || fold.start >= innermost.start) {
+			if _, closed := e.closedFoldAt(fold.start); !closed {
+				innermost, found = fold, true
+			}
+		}
+	}
+	if !found {
+		return errors.New("nothing to fold here")
+	}
+	e.addFold(innermost)
+	if y != innermost.start {
+		e.GoTo(innermost.start, nil, nil)
+	}
+	e.redraw.Store(true)
+	e.redrawCursor.Store(true)
+	return nil
+}
+
+// ToggleAllFolds opens all closed folds, or closes all the outermost folds if no folds are closed.
+// Returns the number of folds that were opened or closed.
+func (e *Editor) ToggleAllFolds() (int, bool) {
+	if n := len(e.folds); n > 0 {
+		e.folds = nil
+		e.redraw.Store(true)
+		return n, false
+	}
+	var lastEnd LineIndex = -1
+	for _, fold := range e.FoldRegions() {
+		if fold.start > lastEnd {
+			e.addFold(fold)
+			lastEnd = fold.end
+		}
+	}
+	// Move the cursor out of the closed folds
+	if y := e.DataY(); e.isHidden(y) {
+		e.GoTo(e.visibleLineAbove(y+1), nil, nil)
+	}
+	e.redraw.Store(true)
+	e.redrawCursor.Store(true)
+	return len(e.folds), true
+}
+
+// addFold closes the given fold, and keeps the closed folds sorted by the first line
+func (e *Editor) addFold(fold Fold) {
+	e.folds = append(e.folds, fold)
+	sort.Slice(e.folds, func(i, j int) bool {
+		return e.folds[i].start < e.folds[j].start
+	})
+}
+
+// deleteFold returns the given folds, without the given fold
+func deleteFold(folds []Fold, fold Fold) []Fold {
+	var kept []Fold
+	for _, f := range folds {
+		if f != fold {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// AdjustFolds moves the closed folds after an edit at the given line that changed the number of lines by delta.
+// before is the edited line, as it was before the edit. The text is only searched for fold regions again,
+// for opening the folds that no longer match, if the number of lines changed or if the edited line may have
+// changed the structure of the text, so that typing within a line does not scan the whole file.
+func (e *Editor) AdjustFolds(y LineIndex, delta int, before string) {
+	if len(e.folds) == 0 {
+		return
+	}
+	for i, fold := range e.folds {
+		if fold.start > y {
+			e.folds[i].start += LineIndex(delta)
+		}
+		if fold.end > y {
+			e.folds[i].end += LineIndex(delta)
+		}
+	}
+	if delta == 0 && e.sameFoldStructure(before, e.Line(y)) {
+		return
+	}
+	e.OpenStaleFolds()
+}
+
+// OpenStaleFolds opens the closed folds that no longer match the structure of the text
+func (e *Editor) OpenStaleFolds() {
+	if len(e.folds) == 0 {
+		return
+	}
+	regions := make(map[Fold]bool)
+	for _, fold := range e.FoldRegions() {
+		regions[fold] = true
+	}
+	var kept []Fold
+	for _, fold := range e.folds {
+		if regions[fold] {
+			kept = append(kept, fold)
+		}
+	}
+	if len(kept) != len(e.folds) {
+		e.folds = kept
+		e.redraw.Store(true)
+	}
+}
+
+// sameFoldStructure checks if a line that was changed from a to b still has the same indentation, and the same
+// brackets, quotes, comment markers and other punctuation, in which case the fold regions can not have changed
+func (e *Editor) sameFoldStructure(a, b string) bool {
+	if e.indentationWidth(a) != e.indentationWidth(b) || (strings.TrimSpace(a) == "") != (strings.TrimSpace(b) == "") {
+		return false
+	}
+	punctuation := func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}
+	return strings.Map(punctuation, a) == strings.Map(punctuation, b)
+}
+
+// foldSummary returns the text that is shown after the first line of a closed fold
+func foldSummary(fold Fold) string {
+	if n := fold.end - fold.start; n > 1 {
+		return fmt.Sprintf(" ⋯ %d lines", n)
+	}
+	return " ⋯ 1 line"
+}
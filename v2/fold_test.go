@@ -0,0 +1,124 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/xyproto/mode"
+)
+
+const foldGoSource = `package main
+
+func main() {
+	s := "{"
+	if len(s) > 0 {
+		println(s)
+	} else {
+		println("}")
+	}
+}
+`
+
+func TestBracketFolds(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.mode = mode.Go
+	e.LoadBytes([]byte(foldGoSource))
+	got := e.FoldRegions()
+	want := []Fold{{2, 8}, {4, 5}, {6, 7}}
+	if !equalFolds(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestIndentationFolds(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.mode = mode.Python
+	e.LoadBytes([]byte("def f():\n    if x:\n        pass\n\n    return 1\n\nprint(f())"))
+	got := e.FoldRegions()
+	want := []Fold{{0, 4}, {1, 2}}
+	if !equalFolds(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestToggleFold(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.mode = mode.Go
+	e.LoadBytes([]byte(foldGoSource))
+
+	// Fold the innermost block around the cursor, which moves the cursor to the first line of the fold
+	e.GoTo(5, nil, nil)
+	if err := e.ToggleFold(); err != nil {
+		t.Fatal(err)
+	}
+	if e.DataY() != 4 || !e.isHidden(5) || e.isHidden(6) {
+		t.Errorf("expected line 5 to be folded and the cursor to be at line 4, got line %d", e.DataY())
+	}
+
+	// Moving down skips the hidden line
+	e.Down(nil, nil)
+	if e.DataY() != 6 {
+		t.Errorf("expected the cursor to skip the fold, got line %d", e.DataY())
+	}
+	e.Up(nil, nil)
+	if e.DataY() != 4 {
+		t.Errorf("expected the cursor to move to the first line of the fold, got line %d", e.DataY())
+	}
+
+	// Going to a hidden line opens the fold
+	e.GoToLineNumber(6, nil, nil, false)
+	if e.isHidden(5) || len(e.folds) != 0 {
+		t.Error("expected the fold to be opened")
+	}
+
+	// Fold everything, and then open everything
+	if n, closed := e.ToggleAllFolds(); !closed || n != 1 || !e.isHidden(8) {
+		t.Errorf("expected one fold to be closed, got %d", n)
+	}
+	if e.DataY() != 2 {
+		t.Errorf("expected the cursor to be moved out of the fold, got line %d", e.DataY())
+	}
+	if _, closed := e.ToggleAllFolds(); closed || len(e.folds) != 0 {
+		t.Error("expected all folds to be opened")
+	}
+}
+
+func TestAdjustFolds(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.mode = mode.Go
+	e.LoadBytes([]byte(foldGoSource))
+	e.folds = []Fold{{4, 5}}
+
+	// Insert a line above the fold
+	e.lines.Insert(1, "")
+	e.AdjustFolds(1, 1, "")
+	if len(e.folds) != 1 || e.folds[0] != (Fold{5, 6}) {
+		t.Errorf("expected the fold to be moved down, got %v", e.folds)
+	}
+
+	// Typing letters within a line does not change the fold regions, so the text is not searched again
+	e.folds = append(e.folds, Fold{2, 3})
+	e.SetLine(5, "\tif len(str) > 0 {")
+	e.AdjustFolds(5, 0, "\tif len(s) > 0 {")
+	if len(e.folds) != 2 {
+		t.Errorf("expected the folds to be kept as they are, got %v", e.folds)
+	}
+
+	// Remove the opening bracket
+	e.SetLine(5, "\tif len(str) > 0")
+	e.AdjustFolds(5, 0, "\tif len(str) > 0 {")
+	if len(e.folds) != 0 {
+		t.Errorf("expected the folds to be opened, got %v", e.folds)
+	}
+}
+
+func equalFolds(a, b []Fold) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -80,9 +80,10 @@ func (e *Editor) formatWithUtility(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 		tempFirstName = "O"
 	}
 
-	extOrBaseFilename := filepath.Ext(e.filename)
+	// Use the extension of the uncompressed file, so that the temporary file is not compressed when saving
+	extOrBaseFilename := filepath.Ext(stripCompressionExtension(e.filename))
 	if extOrBaseFilename == "" {
-		extOrBaseFilename = filepath.Base(e.filename)
+		extOrBaseFilename = filepath.Base(stripCompressionExtension(e.filename))
 	}
 
 	if f, err := os.CreateTemp(tempDir, tempFirstName+".*"+extOrBaseFilename); err == nil {
@@ -91,11 +92,12 @@ func (e *Editor) formatWithUtility(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 		defer os.Remove(tempFilename)
 		defer f.Close()
 
-		// TODO: Implement e.SaveAs
-		oldFilename := e.filename
-		e.filename = tempFilename
-		err := e.Save(c, tty)
-		e.filename = oldFilename
+		// Write the contents as UTF-8 with LF line endings, without going through e.Save,
+		// which would also change the editor and is meant for the file that is being edited
+		_, err := f.WriteString(e.String())
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
 
 		if err == nil {
 			// Add the filename of the temporary file to the command
@@ -160,7 +162,11 @@ func (e *Editor) formatWithUtility(c *vt100.Canvas, tty *vt100.TTY, status *Stat
 				return retErr
 			}
 
-			if _, err := e.Load(c, tty, FilenameOrData{tempFilename, []byte{}, 0, false}); err != nil {
+			// Keep the file format, since the temporary file is read in as if it was a new file
+			fileFormat := e.fileFormat
+			_, err = e.Load(c, tty, FilenameOrData{tempFilename, []byte{}, 0, false, nil})
+			e.fileFormat = fileFormat
+			if err != nil {
 				return err
 			}
 			// Mark the data as changed, despite just having loaded a file
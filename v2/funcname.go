@@ -182,9 +182,9 @@ func (e *Editor) WriteCurrentFunctionName(c *vt100.Canvas) {
 	}
 	s := e.FindCurrentFunctionName()
 	var (
-		canvasWidth      = c.Width()
-		x           uint = (canvasWidth - uint(len(s))) - 2 // 2 is the right side padding
-		y           uint
+		vx, y            = e.pos.ViewOrigin()
+		canvasWidth      = e.pos.ViewWidth(c)
+		x           uint = vx + (canvasWidth - uint(len(s))) - 2 // 2 is the right side padding
 	)
 	c.Write(x, y, e.Foreground, e.Background, s)
 }
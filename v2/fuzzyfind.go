@@ -0,0 +1,418 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/xyproto/binary"
+	"github.com/xyproto/files"
+	"github.com/xyproto/globi"
+	"github.com/xyproto/vt100"
+)
+
+const (
+	// Stop collecting filenames for the file finder after this many files
+	fuzzyFindMaxFiles = 50000
+
+	// How many bytes to read from the highlighted file, for the preview
+	fuzzyFindPreviewSize = 16 * 1024
+)
+
+// Scores used by the fuzzy matcher
+const (
+	fuzzyMatchScore       = 16 // for each matching rune
+	fuzzySegmentBonus     = 12 // the match is at the start of a path segment, like "o" in "v2/orbiton.go"
+	fuzzyWordBonus        = 8  // the match is at the start of a word, like "t" in "main_test.go" or "B" in "NewBox"
+	fuzzyConsecutiveBonus = 8  // the match follows right after the previous match
+	fuzzyBasenameBonus    = 2  // the match is in the filename and not in the directory
+	fuzzyGapPenalty       = 1  // for each rune that is skipped between two matches
+)
+
+// FuzzyMatcher can check if a filename approximately matches a query, where the runes in the query
+// must appear in the same order in the filename, but not necessarily right after each other.
+type FuzzyMatcher struct {
+	query      []rune
+	ignoreCase bool
+}
+
+// FuzzyMatch is a candidate that matched a fuzzy query, with a score where higher is better
+type FuzzyMatch struct {
+	Text  string
+	Score int
+}
+
+// NewFuzzyMatcher creates a new FuzzyMatcher. The matching is case-insensitive, unless the query contains uppercase letters.
+func NewFuzzyMatcher(query string) *FuzzyMatcher {
+	ignoreCase := !strings.ContainsFunc(query, unicode.IsUpper)
+	if ignoreCase {
+		query = strings.ToLower(query)
+	}
+	return &FuzzyMatcher{query: []rune(query), ignoreCase: ignoreCase}
+}
+
+// fuzzyBonus returns the bonus for matching the rune at position j in the given candidate
+func fuzzyBonus(candidate []rune, j, basenameStart int) int {
+	bonus := 0
+	if j >= basenameStart {
+		bonus += fuzzyBasenameBonus
+	}
+	if j == 0 {
+		return bonus + fuzzySegmentBonus
+	}
+	prev, r := candidate[j-1], candidate[j]
+	switch {
+	case prev == '/' || prev == '\\':
+		bonus += fuzzySegmentBonus
+	case prev == '.' || prev == '_' || prev == '-' || prev == ' ':
+		bonus += fuzzyWordBonus
+	case unicode.IsLower(prev) && unicode.IsUpper(r):
+		bonus += fuzzyWordBonus
+	}
+	return bonus
+}
+
+// Score checks if the given candidate matches the query, and returns a score where higher is better.
+// The best way to match the runes in the query is found, so that matches at the start of path segments
+// and words, and runs of consecutive matches, count the most.
+func (fm *FuzzyMatcher) Score(candidate string) (int, bool) {
+	n := len(fm.query)
+	if n == 0 {
+		return 0, true
+	}
+	original := []rune(candidate)
+	runes := original
+	if fm.ignoreCase {
+		runes = []rune(strings.ToLower(candidate))
+		if len(runes) != len(original) {
+			// Some runes changed length when lowercased, so use the original runes for the bonuses too
+			original = runes
+		}
+	}
+	m := len(runes)
+	if m < n {
+		return 0, false
+	}
+	basenameStart := strings.LastIndexAny(candidate, `/\`) + 1
+	if basenameStart > 0 {
+		basenameStart = len([]rune(candidate[:basenameStart]))
+	}
+	const impossible = math.MinInt / 2
+	// prevRow[j] is the best score where the previous rune in the query was matched at position j
+	prevRow := make([]int, m)
+	row := make([]int, m)
+	for i, q := range fm.query {
+		// bestBefore is the best score of prevRow[k] + k*fuzzyGapPenalty, for k < j-1
+		bestBefore := impossible
+		for j := range m {
+			if j >= 2 && prevRow[j-2] > impossible {
+				bestBefore = max(bestBefore, prevRow[j-2]+(j-2)*fuzzyGapPenalty)
+			}
+			row[j] = impossible
+			if runes[j] != q {
+				continue
+			}
+			score := fuzzyMatchScore + fuzzyBonus(original, j, basenameStart)
+			switch {
+			case i == 0:
+				row[j] = score
+			default:
+				best := impossible
+				if j >= 1 && prevRow[j-1] > impossible {
+					best = prevRow[j-1] + fuzzyConsecutiveBonus
+				}
+				if bestBefore > impossible {
+					best = max(best, bestBefore-(j-1)*fuzzyGapPenalty)
+				}
+				if best > impossible {
+					row[j] = best + score
+				}
+			}
+		}
+		prevRow, row = row, prevRow
+	}
+	best := impossible
+	for _, score := range prevRow {
+		best = max(best, score)
+	}
+	if best == impossible {
+		return 0, false
+	}
+	return best, true
+}
+
+// Rank returns the candidates that match the query, with the best match first.
+// bonus can be used to add to the score of a candidate, and may be nil.
+// Candidates with the same score are sorted alphabetically.
+func (fm *FuzzyMatcher) Rank(candidates []string, bonus func(string) int) []FuzzyMatch {
+	var matches []FuzzyMatch
+	for _, candidate := range candidates {
+		score, ok := fm.Score(candidate)
+		if !ok {
+			continue
+		}
+		if bonus != nil {
+			score += bonus(candidate)
+		}
+		matches = append(matches, FuzzyMatch{candidate, score})
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].Text < matches[j].Text
+	})
+	return matches
+}
+
+// recencyBonus returns a bonus for files that have been edited recently, according to the location history
+func recencyBonus(absFilename string) int {
+	lnat, found := locationHistory[absFilename]
+	if !found {
+		return 0
+	}
+	switch age := time.Since(lnat.Timestamp); {
+	case age < time.Hour:
+		return 4 * fuzzyMatchScore
+	case age < 24*time.Hour:
+		return 3 * fuzzyMatchScore
+	case age < 7*24*time.Hour:
+		return 2 * fuzzyMatchScore
+	default:
+		return fuzzyMatchScore
+	}
+}
+
+// approximateFilename tries to find an existing file when the given filename does not exist,
+// assuming that tab-completion went wrong. The candidates are ranked with the same matcher as the file finder.
+// Returns the given filename if no better match is found.
+func approximateFilename(filename string) string {
+	var (
+		pattern    string
+		minMatches = 1
+	)
+	switch {
+	case strings.HasSuffix(filename, "."):
+		// If the filename ends with "." and the file does not exist, assume this was a result of tab-completion going wrong.
+		// If there are multiple files that exist that start with the given filename, open the one first in the alphabet (.cpp before .o)
+		pattern = filename + "*"
+	case !strings.Contains(filename, ".") && allLower(filename):
+		// The filename has no ".", is written in lowercase and it does not exist,
+		// but more than one file that starts with the filename  exists. Assume tab-completion failed.
+		pattern = filename + "*"
+		minMatches = 2
+	default:
+		// Also match ie. "PKGBUILD" if just "Pk" was entered
+		pattern = strings.ToTitle(filename) + "*"
+	}
+	matches, err := globi.Glob(pattern)
+	if err != nil || len(matches) < minMatches {
+		return filename
+	}
+	// Filter out any binary files
+	matches = files.FilterOutBinaryFiles(matches)
+	if len(matches) == 0 {
+		return filename
+	}
+	// The ranking is stable, so sorting first keeps matches with the same score in alphabetical order
+	sort.Strings(matches)
+	ranked := NewFuzzyMatcher(strings.TrimSuffix(pattern, "*")).Rank(matches, func(candidate string) int {
+		// If the matches contains low priority suffixes, such as ".lock", then move it last
+		if hasSuffix(candidate, probablyDoesNotWantToEditExtensions) {
+			return math.MinInt / 4
+		}
+		return 0
+	})
+	if len(ranked) == 0 {
+		return filename
+	}
+	return ranked[0].Text
+}
+
+// projectFilenames returns the relative paths of the files in the project that starts in the given root directory,
+// skipping .gitignore'd files. Returns true if not all files were collected.
+func projectFilenames(root string, maxTime time.Duration) ([]string, bool, error) {
+	var filenames []string
+	stopped, err := walkProjectFiles(root, maxTime, func(_, relPath string, _ fs.DirEntry) bool {
+		filenames = append(filenames, relPath)
+		return len(filenames) < fuzzyFindMaxFiles
+	})
+	return filenames, stopped, err
+}
+
+// filePreview returns the first lines of the given file, or a short note if the file can not be previewed
+func filePreview(filename string, maxLines int) []string {
+	f, err := os.Open(filename)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	defer f.Close()
+	data := make([]byte, fuzzyFindPreviewSize)
+	n, err := io.ReadFull(f, data)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return []string{err.Error()}
+	}
+	data = data[:n]
+	if binary.Data(data) {
+		return []string{"(binary file)"}
+	}
+	lines := strings.Split(strings.ReplaceAll(string(data), "\t", "    "), "\n")
+	if len(lines) > maxLines {
+		lines = lines[:maxLines]
+	}
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, "\r")
+	}
+	return lines
+}
+
+// FuzzyFindFile lets the user pick a file in the current project by typing parts of the path,
+// while the first lines of the highlighted file are shown. The selected file is opened in a new buffer,
+// at the location where it was last edited.
+func (e *Editor) FuzzyFindFile(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) error {
+	dir, err := os.Getwd()
+	if absFilename, err2 := e.AbsFilename(); err2 == nil {
+		dir, err = filepath.Dir(absFilename), nil
+	}
+	if err != nil {
+		return err
+	}
+	root := projectRootDir(dir)
+	relFilenames, stopped, err := projectFilenames(root, projectSearchMaxTime)
+	if err != nil {
+		return err
+	}
+	if len(relFilenames) == 0 {
+		return errors.New("found no files in " + files.Relative(root))
+	}
+	bonus := func(relFilename string) int {
+		return recencyBonus(filepath.Join(root, filepath.FromSlash(relFilename)))
+	}
+	preview := func(relFilename string, maxLines int) []string {
+		return filePreview(filepath.Join(root, filepath.FromSlash(relFilename)), maxLines)
+	}
+	title := "Open file"
+	if stopped {
+		title += " (not all files were found)"
+	}
+	relFilename, ok := e.FuzzyChoose(c, tty, title, relFilenames, bonus, preview)
+	e.redraw.Store(true)
+	e.redrawCursor.Store(true)
+	if !ok {
+		return nil
+	}
+	return e.OpenBuffer(c, tty, status, fileLock, filepath.Join(root, filepath.FromSlash(relFilename)))
+}
+
+// FuzzyChoose lets the user choose one of the given candidates, by typing parts of it.
+// bonus is used for ranking the candidates, and preview returns the first lines of a candidate. Both may be nil.
+// Returns the chosen candidate and true, or false if the user closed the list.
+func (e *Editor) FuzzyChoose(c *vt100.Canvas, tty *vt100.TTY, title string, candidates []string, bonus func(string) int, preview func(candidate string, maxLines int) []string) (string, bool) {
+	var (
+		query    string
+		matches  = NewFuzzyMatcher(query).Rank(candidates, bonus)
+		selected int
+		offset   int
+	)
+	for {
+		canvasBox := NewCanvasBox(c)
+		outerBox := NewBox()
+		outerBox.FillWithMargins(canvasBox, 2, 1)
+		outerBox.H-- // leave room for the status bar
+
+		// Use the whole width for the list if there is no preview
+		filesBox := &Box{outerBox.X, outerBox.Y, outerBox.W, outerBox.H}
+		if preview != nil {
+			filesBox.W = outerBox.W / 2
+		}
+		previewBox := &Box{filesBox.X + filesBox.W, outerBox.Y, outerBox.W - filesBox.W, outerBox.H}
+
+		listBox := NewBox()
+		listBox.FillWithMargins(filesBox, 2, 1)
+		listBox.Y += 2 // room for the query and an empty line
+		listBox.H = max(listBox.H-2, 1)
+		visibleCount := listBox.H
+
+		textBox := NewBox()
+		textBox.FillWithMargins(previewBox, 2, 1)
+
+		// Scroll the list so that the selected candidate is visible
+		if selected < offset {
+			offset = selected
+		} else if selected >= offset+visibleCount {
+			offset = selected - visibleCount + 1
+		}
+		end := min(offset+visibleCount, len(matches))
+		items := make([]string, 0, max(end-offset, 0))
+		for _, match := range matches[offset:end] {
+			items = append(items, match.Text)
+		}
+		items = trimToWidth(items, listBox.W)
+
+		bt := e.NewBoxTheme()
+		e.DrawBox(bt, c, filesBox)
+		e.DrawTitle(bt, c, filesBox, title, true)
+		e.DrawFooter(bt, c, filesBox, fmt.Sprintf("%d/%d, return to open, esc to close", min(selected+1, len(matches)), len(matches)))
+		e.Say(bt, c, listBox.X, listBox.Y-2, trimToWidth([]string{"> " + query + "_"}, listBox.W)[0])
+		e.DrawList(bt, c, listBox, items, selected-offset)
+
+		if preview != nil {
+			e.DrawBox(bt, c, previewBox)
+			if selected < len(matches) {
+				candidate := matches[selected].Text
+				e.DrawTitle(bt, c, previewBox, trimToWidth([]string{filepath.Base(candidate)}, max(textBox.W-2, 4))[0], true)
+				e.DrawList(bt, c, textBox, trimToWidth(preview(candidate, textBox.H), textBox.W), -1)
+			}
+		}
+		c.HideCursorAndDraw()
+
+		key := tty.String()
+		switch key {
+		case upArrow, "c:16": // up or ctrl-p
+			if selected > 0 {
+				selected--
+			}
+		case downArrow, "c:14": // down or ctrl-n
+			if selected < len(matches)-1 {
+				selected++
+			}
+		case pgUpKey:
+			selected = max(selected-visibleCount, 0)
+		case pgDnKey:
+			selected = max(min(selected+visibleCount, len(matches)-1), 0)
+		case "c:8", "c:127": // ctrl-h or backspace
+			if runes := []rune(query); len(runes) > 0 {
+				query = string(runes[:len(runes)-1])
+				matches = NewFuzzyMatcher(query).Rank(candidates, bonus)
+				selected, offset = 0, 0
+			}
+		case "c:21": // ctrl-u
+			query = ""
+			matches = NewFuzzyMatcher(query).Rank(candidates, bonus)
+			selected, offset = 0, 0
+		case "c:13": // return
+			if selected >= len(matches) {
+				break
+			}
+			return matches[selected].Text, true
+		case "c:27", "c:3", "c:17": // esc, ctrl-c or ctrl-q
+			return "", false
+		default:
+			if strings.HasPrefix(key, "c:") || len([]rune(key)) != 1 {
+				// Ignore other control keys and special keys
+				break
+			}
+			query += key
+			matches = NewFuzzyMatcher(query).Rank(candidates, bonus)
+			selected, offset = 0, 0
+		}
+	}
+}
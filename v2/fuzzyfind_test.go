@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFuzzyMatcher(t *testing.T) {
+	fm := NewFuzzyMatcher("ed")
+	if _, ok := fm.Score("v2/editor.go"); !ok {
+		t.Error("expected ed to match v2/editor.go")
+	}
+	if _, ok := fm.Score("v2/main.go"); ok {
+		t.Error("expected ed to not match v2/main.go")
+	}
+	if _, ok := fm.Score("v2/Editor.go"); !ok {
+		t.Error("expected a lowercase query to be case-insensitive")
+	}
+	if _, ok := NewFuzzyMatcher("Ed").Score("v2/editor.go"); ok {
+		t.Error("expected a query with uppercase letters to be case-sensitive")
+	}
+	if score, ok := NewFuzzyMatcher("").Score("anything"); !ok || score != 0 {
+		t.Error("expected an empty query to match everything")
+	}
+
+	// Matches at the start of path segments and consecutive matches should rank higher
+	candidates := []string{
+		"cmd/internal/deep/buffer.go",
+		"v2/buffers.go",
+		"v2/about_buffers.go",
+		"v2/build.go",
+		"vendor/x/bufio.go",
+	}
+	matches := NewFuzzyMatcher("v2buf").Rank(candidates, nil)
+	if len(matches) != 2 {
+		t.Fatalf("expected 2 matches, got %v", matches)
+	}
+	if matches[0].Text != "v2/buffers.go" {
+		t.Errorf("expected v2/buffers.go to be the best match, got %v", matches)
+	}
+
+	// Recently edited files should get a bonus
+	bonus := func(candidate string) int {
+		if candidate == "v2/about_buffers.go" {
+			return 100
+		}
+		return 0
+	}
+	matches = NewFuzzyMatcher("buf").Rank(candidates, bonus)
+	if len(matches) != 4 || matches[0].Text != "v2/about_buffers.go" {
+		t.Errorf("expected v2/about_buffers.go to be the best match, got %v", matches)
+	}
+}
+
+func TestRecencyBonus(t *testing.T) {
+	saved := locationHistory
+	defer func() { locationHistory = saved }()
+	locationHistory = make(LocationHistory)
+	locationHistory.Set("/tmp/recent.go", 1)
+	locationHistory.SetWithTimestamp("/tmp/old.go", 1, time.Now().Add(-30*24*time.Hour).Unix())
+	if recent, old := recencyBonus("/tmp/recent.go"), recencyBonus("/tmp/old.go"); recent <= old || old <= 0 {
+		t.Errorf("expected recent files to get a larger bonus, got %d and %d", recent, old)
+	}
+	if bonus := recencyBonus("/tmp/never.go"); bonus != 0 {
+		t.Errorf("expected no bonus, got %d", bonus)
+	}
+}
+
+func TestApproximateFilename(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"main.cpp", "main.o", "main.lock", "PKGBUILD"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("text\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	for given, expected := range map[string]string{
+		"main.":     "main.cpp",
+		"ma":        "main.cpp",
+		"Pk":        "PKGBUILD",
+		"other.txt": "other.txt",
+	} {
+		if got := approximateFilename(given); got != expected {
+			t.Errorf("expected %s to be approximated to %s, got %s", given, expected, got)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// gitIgnorePattern is a single pattern from a .gitignore file
+type gitIgnorePattern struct {
+	re      *regexp.Regexp // matches paths relative to the directory where the search started
+	negate  bool           // the pattern started with "!", so matching paths are not ignored after all
+	dirOnly bool           // the pattern ended with "/", so only directories are matched
+}
+
+// GitIgnore is a collection of patterns from the .gitignore files in a directory tree
+type GitIgnore struct {
+	patterns []gitIgnorePattern
+}
+
+// globToRegexp converts a .gitignore glob pattern, like "*.o" or "build/**/out", to a regular expression
+func globToRegexp(glob string) string {
+	var sb strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch ch := glob[i]; ch {
+		case '*':
+			switch {
+			case strings.HasPrefix(glob[i:], "**/"):
+				sb.WriteString("(?:.*/)?")
+				i += 2
+			case strings.HasPrefix(glob[i:], "**"):
+				sb.WriteString(".*")
+				i++
+			default:
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				break
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+			}
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	return sb.String()
+}
+
+// AddPatterns adds the patterns from the contents of a .gitignore file, that was found in the given directory.
+// The directory is relative to the directory where the search started, and uses "/" as the separator.
+func (gi *GitIgnore) AddPatterns(contents, relDir string) {
+	prefix := ""
+	if relDir != "" && relDir != "." {
+		prefix = regexp.QuoteMeta(relDir) + "/"
+	}
+	for _, line := range strings.Split(contents, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if !strings.HasSuffix(line, `\ `) {
+			line = strings.TrimRight(line, " ")
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var p gitIgnorePattern
+		if strings.HasPrefix(line, "!") {
+			p.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			p.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		// A pattern with a slash at the start or in the middle is relative to the directory of the .gitignore file.
+		// Other patterns can match at any level below it.
+		anchored := strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		var expression string
+		if anchored {
+			expression = "^" + prefix + globToRegexp(line) + "$"
+		} else {
+			expression = "^" + prefix + "(?:.*/)?" + globToRegexp(line) + "$"
+		}
+		re, err := regexp.Compile(expression)
+		if err != nil {
+			continue
+		}
+		p.re = re
+		gi.patterns = append(gi.patterns, p)
+	}
+}
+
+// Load adds the patterns from the .gitignore file in the given directory, if there is one.
+// relDir is the directory relative to root.
+func (gi *GitIgnore) Load(root, relDir string) {
+	data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(relDir), ".gitignore"))
+	if err != nil {
+		return
+	}
+	gi.AddPatterns(string(data), relDir)
+}
+
+// Ignored checks if the given path, relative to the directory where the search started, should be ignored.
+// The last pattern that matches decides, just like for git.
+func (gi *GitIgnore) Ignored(relPath string, isDir bool) bool {
+	relPath = path.Clean(filepath.ToSlash(relPath))
+	ignored := false
+	for _, p := range gi.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if p.re.MatchString(relPath) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+func TestGitIgnore(t *testing.T) {
+	gi := &GitIgnore{}
+	gi.AddPatterns("# build output\n*.o\n/bin\nbuild/\n!keep.o\ndocs/**/*.tmp\n", "")
+	gi.AddPatterns("*.log\n", "sub")
+	tests := []struct {
+		path     string
+		isDir    bool
+		expected bool
+	}{
+		{"main.o", false, true},
+		{"src/main.o", false, true},
+		{"keep.o", false, false},
+		{"main.c", false, false},
+		{"bin", true, true},
+		{"src/bin", true, false},
+		{"build", true, true},
+		{"build", false, false},
+		{"src/build", true, true},
+		{"docs/a/b/x.tmp", false, true},
+		{"docs/x.tmp", false, true},
+		{"x.tmp", false, false},
+		{"sub/a.log", false, true},
+		{"sub/deeper/a.log", false, true},
+		{"a.log", false, false},
+	}
+	for _, test := range tests {
+		if got := gi.Ignored(test.path, test.isDir); got != test.expected {
+			t.Errorf("expected Ignored(%q, %v) to be %v", test.path, test.isDir, test.expected)
+		}
+	}
+}
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := map[string]string{
+		"*.go":      `[^/]*\.go`,
+		"a?c":       `a[^/]c`,
+		"[!ab]x":    `[^ab]x`,
+		"**/foo":    `(?:.*/)?foo`,
+		"foo/**":    `foo/.*`,
+		`\#hash`:    `#hash`,
+		"[unclosed": `\[unclosed`,
+	}
+	for glob, expected := range tests {
+		if got := globToRegexp(glob); got != expected {
+			t.Errorf("globToRegexp(%q): expected %q, got %q", glob, expected, got)
+		}
+	}
+}
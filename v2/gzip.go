@@ -3,14 +3,8 @@ package main
 import (
 	"bytes"
 	"compress/gzip"
-	"strings"
 )
 
-// stripGZ removes the trailing ".gz" suffix
-func stripGZ(filename string) string {
-	return strings.TrimSuffix(filename, ".gz")
-}
-
 // gUnzipData uncompressed gzip data
 func gUnzipData(data []byte) ([]byte, error) {
 	b := bytes.NewBuffer(data)
@@ -38,6 +38,7 @@ ctrl-w      for Zig, Rust, V and Go, format with the "... fmt" command
             for Markdown, toggle checkboxes or re-format tables
             for git interactive rebases, cycle the rebase keywords
 ctrl-g      jump to definition (experimental feature) or toggle the status bar
+            send a command to the debugger, if in debug mode
 ctrl-_      insert a symbol by typing in a two letter ViM-style digraph
             see https://raw.githubusercontent.com/xyproto/digraph/main/digraphs.txt
 ctrl-a      go to start of line, then start of text and then the previous line
@@ -45,9 +46,11 @@ ctrl-e      go to end of line and then the next line
 ctrl-n      to scroll down 10 lines or go to the next match if a search is active
             insert a column when in the Markdown table editor
             go to next match when searching, or next typo when spellchecking
+            go to the next build error, if the list of build errors is shown
             jump to a matching parenthesis or bracket if the arrow keys were just used
 ctrl-p      to scroll up 10 lines or go to the previous match
             remove an empty column when in the Markdown table editor
+            go to the previous build error, if the list of build errors is shown
             jump to a matching parenthesis or bracket if the arrow keys were just used
 ctrl-k      to delete characters to the end of the line, then delete the line
 ctrl-j      to join lines
@@ -57,18 +60,27 @@ ctrl-t      for C and C++, toggle between the header and implementation,
             for Agda, insert a symbol,
             for the rest, record and then play back a macro
 ctrl-c      to copy the current line, press twice to copy the current block
+            or copy the selected text
 ctrl-v      to paste one line, press twice to paste the rest
 ctrl-x      to cut the current line, press twice to cut the current block
+            or cut the selected text
 ctrl-b      to jump back after having jumped to a definition
             to toggle a bookmark for the current line, or jump to a bookmark
             to toggle a breakpoint if in debug mode
 ctrl-u      to undo (ctrl-z is also possible, but may background the application)
+ctrl-y      to redo, after having undone something
 ctrl-l      to jump to a specific line or letter (press return to jump to the top or bottom)
 ctrl-f      to find text. To search and replace, press Tab instead of Return.
             to spellcheck, search for "t", then press ctrl-a to add and ctrl-i to ignore
-ctrl-\      to toggle single-line comments for a block of code
+            while searching, ctrl-r toggles regex, ctrl-k cycles the case options and ctrl-w toggles whole word
+ctrl-\      to toggle single-line comments for a block of code, or for the selected lines
 ctrl-~      insert the current date and time
+F6          switch to the other pane if the view is split
+ctrl-pgdn   switch to the next open buffer, ctrl-pgup switches to the previous one
 esc         to redraw the screen, clear the last search and clear the current macro
+            or to hide the list of build errors, or to stop selecting, or to remove cursors
+shift-arrow to start selecting text, or to extend the selection
+alt-shift-arrow to select a rectangle, ctrl-down to add a cursor on the line below
 
 Set NO_COLOR=1 to disable colors.
 
@@ -86,6 +98,9 @@ Flags:
   -n, --no-cache                 Avoid writing the location history, search history, highscore,
                                  compilation and format command to ` + cacheDirForDoc + `.
   -d, --create-dir               When opening a new file, create directories as needed.
+  -u, --undo-history             Keep the undo history between sessions, in ` + cacheDirForDoc + `.
+                                 The history is discarded if the file is changed by something else.
+                                 Can also be enabled with O_UNDO_HISTORY=1.
   -g, --digraphs                 List all possible digraphs.
   -t, --list                     List the given file using the red/black theme and quit.
   -b, --bat                      List the given file using bat, if it exists in the PATH.
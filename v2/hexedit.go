@@ -0,0 +1,461 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/xyproto/vt100"
+)
+
+// hexBytesPerRow is the number of bytes that are shown on each row of the hex editor
+const hexBytesPerRow = 16
+
+// hexEdit is an edit in the hex editor, that can be undone.
+// An overwrite removes and inserts the same number of bytes.
+type hexEdit struct {
+	offset   int64
+	removed  []byte
+	inserted []byte
+}
+
+// HexView is the state of the hex editor, with a cursor at a byte offset
+type HexView struct {
+	hf            *HexFile
+	undo          []hexEdit
+	searchPattern []byte
+	cursor        int64 // the offset of the byte at the cursor
+	top           int64 // the offset of the first byte that is shown, a multiple of hexBytesPerRow
+	lowNibble     bool  // is the cursor at the second hex digit of the byte?
+	asciiColumn   bool  // is the cursor in the ASCII column, instead of the hex column?
+	insertMode    bool  // insert bytes instead of overwriting them
+}
+
+// NewHexView returns a hex editor view for the given file
+func NewHexView(hf *HexFile) *HexView {
+	return &HexView{hf: hf}
+}
+
+// offsetWidth returns the number of hex digits that are used for the offset column
+func (hv *HexView) offsetWidth() int {
+	return max(8, len(strconv.FormatInt(hv.hf.Size(), 16)))
+}
+
+// setCursor moves the cursor to the given offset, which may be right after the last byte
+func (hv *HexView) setCursor(offset int64) {
+	hv.cursor = min(max(offset, 0), hv.hf.Size())
+	hv.lowNibble = false
+}
+
+// scrollToCursor changes the first shown row, so that the cursor is visible, given the number of visible rows
+func (hv *HexView) scrollToCursor(rows int) {
+	cursorRow := hv.cursor / hexBytesPerRow * hexBytesPerRow
+	if cursorRow < hv.top {
+		hv.top = cursorRow
+	} else if last := hv.top + int64(max(rows-1, 0))*hexBytesPerRow; cursorRow > last {
+		hv.top = cursorRow - int64(max(rows-1, 0))*hexBytesPerRow
+	}
+}
+
+// apply performs an edit and stores it, so that it can be undone
+func (hv *HexView) apply(edit hexEdit) error {
+	var err error
+	if len(edit.removed) == len(edit.inserted) {
+		err = hv.hf.Overwrite(edit.offset, edit.inserted)
+	} else {
+		if len(edit.removed) > 0 {
+			_, err = hv.hf.Delete(edit.offset, len(edit.removed))
+		}
+		if err == nil && len(edit.inserted) > 0 {
+			err = hv.hf.Insert(edit.offset, edit.inserted)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	hv.undo = append(hv.undo, edit)
+	return nil
+}
+
+// Undo reverts the last edit, and moves the cursor to where it was made
+func (hv *HexView) Undo() error {
+	if len(hv.undo) == 0 {
+		return errors.New("nothing to undo")
+	}
+	edit := hv.undo[len(hv.undo)-1]
+	hv.undo = hv.undo[:len(hv.undo)-1]
+	var err error
+	if len(edit.removed) == len(edit.inserted) {
+		err = hv.hf.Overwrite(edit.offset, edit.removed)
+	} else {
+		if len(edit.inserted) > 0 {
+			_, err = hv.hf.Delete(edit.offset, len(edit.inserted))
+		}
+		if err == nil && len(edit.removed) > 0 {
+			err = hv.hf.Insert(edit.offset, edit.removed)
+		}
+	}
+	hv.setCursor(edit.offset)
+	return err
+}
+
+// WriteByte overwrites or inserts the given byte at the cursor, and moves the cursor to the next byte
+func (hv *HexView) WriteByte(b byte) error {
+	edit := hexEdit{offset: hv.cursor, inserted: []byte{b}}
+	if !hv.insertMode && hv.cursor < hv.hf.Size() {
+		old, err := hv.hf.ReadAt(hv.cursor, 1)
+		if err != nil {
+			return err
+		}
+		edit.removed = old
+	}
+	if err := hv.apply(edit); err != nil {
+		return err
+	}
+	hv.setCursor(hv.cursor + 1)
+	return nil
+}
+
+// WriteNibble changes one hex digit of the byte at the cursor. In insert mode, a new byte is inserted when
+// the first digit is typed. The cursor moves to the next byte after the second digit.
+func (hv *HexView) WriteNibble(digit byte) error {
+	if !hv.lowNibble {
+		var b byte
+		if !hv.insertMode && hv.cursor < hv.hf.Size() {
+			old, err := hv.hf.ReadAt(hv.cursor, 1)
+			if err != nil {
+				return err
+			}
+			b = old[0] & 0x0f
+		}
+		if err := hv.WriteByte(digit<<4 | b); err != nil {
+			return err
+		}
+		hv.cursor--
+		hv.lowNibble = true
+		return nil
+	}
+	old, err := hv.hf.ReadAt(hv.cursor, 1)
+	if err != nil {
+		return err
+	}
+	if err := hv.apply(hexEdit{offset: hv.cursor, removed: old, inserted: []byte{old[0]&0xf0 | digit}}); err != nil {
+		return err
+	}
+	hv.setCursor(hv.cursor + 1)
+	return nil
+}
+
+// DeleteByte removes the byte at the cursor
+func (hv *HexView) DeleteByte() error {
+	if hv.cursor >= hv.hf.Size() {
+		return errors.New("no byte to delete")
+	}
+	removed, err := hv.hf.ReadAt(hv.cursor, 1)
+	if err != nil {
+		return err
+	}
+	if err := hv.apply(hexEdit{offset: hv.cursor, removed: removed}); err != nil {
+		return err
+	}
+	hv.setCursor(hv.cursor)
+	return nil
+}
+
+// parseHexSearch parses a search for the hex editor. Hex bytes like "de ad be ef" or "0xcafe" are searched for
+// as bytes, while other text, or text within double quotes, is searched for as a string.
+func parseHexSearch(s string) []byte {
+	if len(s) >= 2 && strings.HasPrefix(s, "\"") && strings.HasSuffix(s, "\"") {
+		return []byte(s[1 : len(s)-1])
+	}
+	digits := strings.NewReplacer(" ", "", "0x", "", "0X", "").Replace(s)
+	if b, err := hex.DecodeString(digits); err == nil && len(b) > 0 {
+		return b
+	}
+	return []byte(s)
+}
+
+// Search moves the cursor to the first occurrence of the given bytes, from the cursor and onwards
+func (hv *HexView) Search(pattern []byte) error {
+	hv.searchPattern = pattern
+	return hv.searchFrom(hv.cursor)
+}
+
+// SearchNext moves the cursor to the next occurrence of the current search pattern, after the cursor
+func (hv *HexView) SearchNext() error {
+	return hv.searchFrom(hv.cursor + 1)
+}
+
+// searchFrom moves the cursor to the next occurrence of the current search pattern, from the given offset.
+// The search wraps around at the end of the file.
+func (hv *HexView) searchFrom(offset int64) error {
+	if len(hv.searchPattern) == 0 {
+		return errors.New("nothing to search for")
+	}
+	found, err := hv.hf.Index(hv.searchPattern, offset)
+	if err != nil {
+		return err
+	}
+	if found < 0 {
+		return fmt.Errorf("not found: % x", hv.searchPattern)
+	}
+	hv.setCursor(found)
+	return nil
+}
+
+// parseOffset parses an offset, given as a decimal number or as a hex number that starts with 0x
+func parseOffset(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		return strconv.ParseInt(s[2:], 16, 64)
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// printableByte returns the byte as a rune for the ASCII column, or "." if it is not printable
+func printableByte(b byte) rune {
+	if b >= 0x20 && b < 0x7f {
+		return rune(b)
+	}
+	return '.'
+}
+
+// Draw draws the offset column, the hex column and the ASCII column, and returns the screen position of the cursor
+func (hv *HexView) Draw(e *Editor, c *vt100.Canvas, rows int) (int, int) {
+	var (
+		w           = int(c.W())
+		offsetWidth = hv.offsetWidth()
+		hexX        = offsetWidth + 2
+		asciiX      = hexX + hexBytesPerRow*3 + 2
+		blank       = strings.Repeat(" ", w)
+		cursorX     int
+		cursorY     int
+	)
+	data, _ := hv.hf.ReadAt(hv.top, rows*hexBytesPerRow)
+	for y := 0; y < rows; y++ {
+		c.Write(0, uint(y), e.Foreground, e.Background, blank)
+		rowOffset := hv.top + int64(y*hexBytesPerRow)
+		if rowOffset > hv.hf.Size() || (rowOffset == hv.hf.Size() && rowOffset > 0 && hv.cursor < rowOffset) {
+			continue
+		}
+		c.Write(0, uint(y), e.CommentColor, e.Background, fmt.Sprintf("%0*x", offsetWidth, rowOffset))
+		c.Write(uint(asciiX-1), uint(y), e.CommentColor, e.Background, "|")
+		for i := 0; i < hexBytesPerRow; i++ {
+			x := hexX + i*3
+			if i >= hexBytesPerRow/2 {
+				x++ // an extra space between the two halves of the row
+			}
+			offset := rowOffset + int64(i)
+			if offset == hv.cursor {
+				cursorY = y
+				if hv.asciiColumn {
+					cursorX = asciiX + i
+				} else if hv.lowNibble {
+					cursorX = x + 1
+				} else {
+					cursorX = x
+				}
+			}
+			index := y*hexBytesPerRow + i
+			if index >= len(data) {
+				continue
+			}
+			b := data[index]
+			fg, asciiFg := e.Foreground, e.Foreground
+			if b == 0 {
+				fg = e.CommentColor
+			}
+			if printableByte(b) == '.' {
+				asciiFg = e.CommentColor
+			}
+			// Highlight the byte at the cursor in the column where the cursor is not
+			if offset == hv.cursor {
+				if hv.asciiColumn {
+					fg = e.SearchHighlight
+				} else {
+					asciiFg = e.SearchHighlight
+				}
+			}
+			c.Write(uint(x), uint(y), fg, e.Background, fmt.Sprintf("%02x", b))
+			c.WriteRune(uint(asciiX+i), uint(y), asciiFg, e.Background, printableByte(b))
+		}
+		c.Write(uint(asciiX+hexBytesPerRow), uint(y), e.CommentColor, e.Background, "|")
+	}
+	return cursorX, cursorY
+}
+
+// statusLine returns a description of the cursor position and the editing mode
+func (hv *HexView) statusLine(filename string) string {
+	editMode := "overwrite"
+	if hv.insertMode {
+		editMode = "insert"
+	}
+	s := fmt.Sprintf("%s: offset 0x%x (%d) of %d bytes, %s", filename, hv.cursor, hv.cursor, hv.hf.Size(), editMode)
+	if hv.hf.Modified() {
+		s += ", modified"
+	}
+	return s
+}
+
+// HexEdit shows the current file in a hex editor, with an offset column, 16 bytes per row and an ASCII column.
+// The file is read in pages when they are needed. Returns true if changes were saved.
+func (e *Editor) HexEdit(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) (bool, error) {
+	hf, err := OpenHexFile(e.filename)
+	if err != nil {
+		return false, err
+	}
+	defer hf.Close()
+
+	var (
+		hv          = NewHexView(hf)
+		saved       bool
+		message     string
+		isError     bool
+		quitWarning bool
+	)
+	for {
+		rows := max(int(c.H())-1, 1)
+		hv.scrollToCursor(rows)
+		cursorX, cursorY := hv.Draw(e, c, rows)
+		status.ClearAll(c, false)
+		if message != "" {
+			if isError {
+				status.SetErrorMessage(message)
+			} else {
+				status.SetMessage(message)
+			}
+			message, isError = "", false
+		} else {
+			status.SetMessage(hv.statusLine(e.filename))
+		}
+		status.ShowNoTimeout(c, e)
+		c.Draw()
+		vt100.SetXY(uint(cursorX), uint(cursorY))
+		vt100.ShowCursor(true)
+
+		setError := func(err error) {
+			if err != nil {
+				message, isError = err.Error(), true
+			}
+		}
+
+		key := tty.String()
+		if key != "c:27" && key != "c:17" {
+			quitWarning = false
+		}
+		switch key {
+		case leftArrow:
+			if hv.lowNibble {
+				hv.lowNibble = false
+			} else {
+				hv.setCursor(hv.cursor - 1)
+			}
+		case rightArrow:
+			hv.setCursor(hv.cursor + 1)
+		case upArrow:
+			if hv.cursor >= hexBytesPerRow {
+				hv.setCursor(hv.cursor - hexBytesPerRow)
+			}
+		case downArrow:
+			if hv.cursor+hexBytesPerRow <= hf.Size() {
+				hv.setCursor(hv.cursor + hexBytesPerRow)
+			}
+		case pgUpKey:
+			hv.setCursor(hv.cursor - int64(rows*hexBytesPerRow))
+		case pgDnKey:
+			hv.setCursor(hv.cursor + int64(rows*hexBytesPerRow))
+		case homeKey, "c:1": // home or ctrl-a, go to the start of the row
+			hv.setCursor(hv.cursor / hexBytesPerRow * hexBytesPerRow)
+		case endKey, "c:5": // end or ctrl-e, go to the end of the row
+			hv.setCursor(hv.cursor/hexBytesPerRow*hexBytesPerRow + hexBytesPerRow - 1)
+		case "c:9": // tab, switch between the hex column and the ASCII column
+			hv.asciiColumn = !hv.asciiColumn
+			hv.lowNibble = false
+		case "c:20": // ctrl-t, toggle between inserting and overwriting bytes
+			hv.insertMode = !hv.insertMode
+		case "c:4": // ctrl-d, delete the byte at the cursor
+			setError(hv.DeleteByte())
+		case "c:8", "c:127": // ctrl-h or backspace
+			if hv.cursor == 0 {
+				break
+			}
+			hv.setCursor(hv.cursor - 1)
+			if hv.insertMode {
+				setError(hv.DeleteByte())
+			}
+		case "c:26": // ctrl-z, undo
+			setError(hv.Undo())
+		case "c:12": // ctrl-l, go to offset
+			s, ok := e.UserInput(c, tty, status, "Go to offset (decimal, or hex with 0x)", "", []string{}, false, "")
+			if !ok || s == "" {
+				break
+			}
+			offset, err := parseOffset(s)
+			if err != nil {
+				setError(fmt.Errorf("invalid offset: %s", s))
+				break
+			}
+			hv.setCursor(offset)
+		case "c:6": // ctrl-f, search for hex bytes or a string
+			s, ok := e.UserInput(c, tty, status, "Search for hex bytes, or \"text\"", "", []string{}, false, "")
+			if !ok || s == "" {
+				break
+			}
+			setError(hv.Search(parseHexSearch(s)))
+		case "c:14": // ctrl-n, go to the next match
+			setError(hv.SearchNext())
+		case "c:19": // ctrl-s, save
+			if err := hf.Save(); err != nil {
+				setError(err)
+				break
+			}
+			saved = true
+			message = fmt.Sprintf("Saved %s", e.filename)
+		case "c:27", "c:17", "c:3": // esc, ctrl-q or ctrl-c
+			if hf.Modified() && !quitWarning {
+				quitWarning = true
+				message, isError = "There are unsaved changes. Press ctrl-s to save, or ctrl-q again to quit without saving.", true
+				break
+			}
+			c.Clear()
+			e.redraw.Store(true)
+			e.redrawCursor.Store(true)
+			return saved, nil
+		default:
+			if strings.HasPrefix(key, "c:") || len(key) != 1 {
+				// Ignore other control keys and special keys
+				break
+			}
+			if hv.asciiColumn {
+				setError(hv.WriteByte(key[0]))
+				break
+			}
+			if digit, err := strconv.ParseUint(key, 16, 8); err == nil {
+				setError(hv.WriteNibble(byte(digit)))
+			}
+		}
+	}
+}
+
+// HexEditCurrentFile shows the current file in the hex editor, and loads the file again if changes were saved
+func (e *Editor) HexEditCurrentFile(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) error {
+	if e.changed.Load() {
+		return errors.New("save the file before editing it in the hex editor")
+	}
+	saved, err := e.HexEdit(c, tty, status)
+	if err != nil || !saved {
+		return err
+	}
+	y := e.DataY()
+	if err := e.ReadFileAndProcessLines(e.filename); err != nil {
+		return err
+	}
+	e.changed.Store(false)
+	e.folds = nil
+	e.ClearCursors()
+	e.ClearSelection()
+	e.GoTo(min(y, LineIndex(max(e.Len()-1, 0))), c, status)
+	return nil
+}
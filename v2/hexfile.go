@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/xyproto/binary"
+)
+
+// hexPageSize is the number of bytes that are read from disk at a time by the hex editor
+const hexPageSize = 4096
+
+// hexPage is a part of a file that is edited in the hex editor
+type hexPage struct {
+	offset int64  // where the page starts in the file on disk
+	length int    // the length of the page in the file on disk
+	data   []byte // the current contents of the page, or nil if the page has not been modified
+	dirty  bool   // has the page been modified since it was read?
+}
+
+// HexFile is a file that is read in pages, on demand, instead of all at once.
+// Only the pages that are modified are kept in memory.
+type HexFile struct {
+	file     *os.File
+	filename string
+	pages    []*hexPage
+	starts   []int64 // the current offset of each page, where inserted and deleted bytes are taken into account
+	size     int64   // the current size
+}
+
+// isBinaryFile checks if the given file looks like a binary file, by reading a few parts of it.
+// UTF-16 text files are not considered to be binary.
+func isBinaryFile(filename string) bool {
+	isBinary, isUTF16, err := binary.FileAndUTF16(filename)
+	return err == nil && isBinary && !isUTF16
+}
+
+// OpenHexFile opens the given file for hex editing, without reading the contents yet
+func OpenHexFile(filename string) (*HexFile, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	hf := &HexFile{file: file, filename: filename}
+	if err := hf.reset(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return hf, nil
+}
+
+// reset divides the file on disk into unmodified pages
+func (hf *HexFile) reset() error {
+	fileInfo, err := hf.file.Stat()
+	if err != nil {
+		return err
+	}
+	hf.size = fileInfo.Size()
+	hf.pages = hf.pages[:0]
+	hf.starts = hf.starts[:0]
+	for offset := int64(0); offset < hf.size || offset == 0; offset += hexPageSize {
+		hf.pages = append(hf.pages, &hexPage{offset: offset, length: int(min(hexPageSize, hf.size-offset))})
+		hf.starts = append(hf.starts, offset)
+	}
+	return nil
+}
+
+// Close closes the file on disk
+func (hf *HexFile) Close() error {
+	return hf.file.Close()
+}
+
+// Size returns the current size, in bytes
+func (hf *HexFile) Size() int64 {
+	return hf.size
+}
+
+// Modified checks if there are changes that have not been saved
+func (hf *HexFile) Modified() bool {
+	for _, page := range hf.pages {
+		if page.dirty {
+			return true
+		}
+	}
+	return false
+}
+
+// pageLength returns the current length of the given page
+func (hf *HexFile) pageLength(i int) int {
+	if hf.pages[i].data != nil {
+		return len(hf.pages[i].data)
+	}
+	return hf.pages[i].length
+}
+
+// pageIndex returns the index of the page that contains the given offset.
+// The last page is returned for the offset right after the end of the file.
+func (hf *HexFile) pageIndex(offset int64) int {
+	i := sort.Search(len(hf.starts), func(i int) bool { return hf.starts[i] > offset }) - 1
+	return max(i, 0)
+}
+
+// updateStarts updates the offsets of the pages after the given page, after the length of the page has changed
+func (hf *HexFile) updateStarts(i int) {
+	for j := i + 1; j < len(hf.pages); j++ {
+		hf.starts[j] = hf.starts[j-1] + int64(hf.pageLength(j-1))
+	}
+	last := len(hf.pages) - 1
+	hf.size = hf.starts[last] + int64(hf.pageLength(last))
+}
+
+// pageData returns the contents of the given page, without keeping unmodified pages in memory
+func (hf *HexFile) pageData(i int) ([]byte, error) {
+	page := hf.pages[i]
+	if page.data != nil {
+		return page.data, nil
+	}
+	data := make([]byte, page.length)
+	if _, err := hf.file.ReadAt(data, page.offset); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return data, nil
+}
+
+// loadPage reads the given page into memory, so that it can be modified
+func (hf *HexFile) loadPage(i int) error {
+	if hf.pages[i].data != nil {
+		return nil
+	}
+	data, err := hf.pageData(i)
+	if err != nil {
+		return err
+	}
+	hf.pages[i].data = data
+	return nil
+}
+
+// ReadAt reads up to n bytes from the given offset. Fewer bytes are returned at the end of the file.
+func (hf *HexFile) ReadAt(offset int64, n int) ([]byte, error) {
+	if offset < 0 || offset >= hf.size || n <= 0 {
+		return nil, nil
+	}
+	n = int(min(int64(n), hf.size-offset))
+	result := make([]byte, 0, n)
+	for i := hf.pageIndex(offset); i < len(hf.pages) && len(result) < n; i++ {
+		data, err := hf.pageData(i)
+		if err != nil {
+			return result, err
+		}
+		start := int(max(offset-hf.starts[i], 0))
+		if start < len(data) {
+			result = append(result, data[start:min(len(data), start+n-len(result))]...)
+		}
+	}
+	return result, nil
+}
+
+// Overwrite replaces the bytes at the given offset with the given bytes
+func (hf *HexFile) Overwrite(offset int64, b []byte) error {
+	if offset < 0 || offset+int64(len(b)) > hf.size {
+		return errors.New("can not write past the end of the file")
+	}
+	for len(b) > 0 {
+		i := hf.pageIndex(offset)
+		if err := hf.loadPage(i); err != nil {
+			return err
+		}
+		page := hf.pages[i]
+		start := int(offset - hf.starts[i])
+		n := copy(page.data[start:], b)
+		page.dirty = true
+		b = b[n:]
+		offset += int64(n)
+	}
+	return nil
+}
+
+// Insert inserts the given bytes at the given offset
+func (hf *HexFile) Insert(offset int64, b []byte) error {
+	if offset < 0 || offset > hf.size {
+		return errors.New("can not insert past the end of the file")
+	}
+	i := hf.pageIndex(offset)
+	if err := hf.loadPage(i); err != nil {
+		return err
+	}
+	page := hf.pages[i]
+	start := int(offset - hf.starts[i])
+	page.data = append(page.data[:start:start], append(append([]byte{}, b...), page.data[start:]...)...)
+	page.dirty = true
+	hf.updateStarts(i)
+	return nil
+}
+
+// Delete removes n bytes at the given offset, and returns the removed bytes
+func (hf *HexFile) Delete(offset int64, n int) ([]byte, error) {
+	if offset < 0 || offset+int64(n) > hf.size {
+		return nil, errors.New("can not delete past the end of the file")
+	}
+	var removed []byte
+	for len(removed) < n {
+		i := hf.pageIndex(offset)
+		if err := hf.loadPage(i); err != nil {
+			return removed, err
+		}
+		page := hf.pages[i]
+		start := int(offset - hf.starts[i])
+		end := min(len(page.data), start+n-len(removed))
+		removed = append(removed, page.data[start:end]...)
+		page.data = append(page.data[:start:start], page.data[end:]...)
+		page.dirty = true
+		hf.updateStarts(i)
+	}
+	return removed, nil
+}
+
+// Index returns the offset of the next occurrence of the given bytes, searching from the given offset
+// and wrapping around at the end of the file. Returns -1 if there are no occurrences.
+func (hf *HexFile) Index(pattern []byte, from int64) (int64, error) {
+	if len(pattern) == 0 || int64(len(pattern)) > hf.size {
+		return -1, nil
+	}
+	const chunkSize = 64 * 1024
+	search := func(start, end int64) (int64, error) {
+		for offset := start; offset < end; offset += chunkSize {
+			// Read some more bytes, so that matches across chunks are found
+			chunk, err := hf.ReadAt(offset, chunkSize+len(pattern)-1)
+			if err != nil {
+				return -1, err
+			}
+			if pos := bytes.Index(chunk, pattern); pos >= 0 && offset+int64(pos) < end {
+				return offset + int64(pos), nil
+			}
+		}
+		return -1, nil
+	}
+	from = min(max(from, 0), hf.size)
+	if found, err := search(from, hf.size); found >= 0 || err != nil {
+		return found, err
+	}
+	return search(0, from)
+}
+
+// Save writes the changes to the file. If no bytes were inserted or deleted, only the modified pages are written.
+// Otherwise, the file is written to a temporary file that then replaces the original file.
+func (hf *HexFile) Save() error {
+	resized := false
+	for _, page := range hf.pages {
+		if page.data != nil && len(page.data) != page.length {
+			resized = true
+			break
+		}
+	}
+	if !resized {
+		f, err := os.OpenFile(hf.filename, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		for _, page := range hf.pages {
+			if !page.dirty {
+				continue
+			}
+			if _, err := f.WriteAt(page.data, page.offset); err != nil {
+				f.Close()
+				return err
+			}
+			page.dirty = false
+		}
+		return f.Close()
+	}
+
+	err := replaceFile(hf.filename, 0o644, func(w io.Writer) error {
+		for i := range hf.pages {
+			data, err := hf.pageData(i)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// Read the pages from the new file from now on
+	hf.file.Close()
+	if hf.file, err = os.Open(hf.filename); err != nil {
+		return err
+	}
+	return hf.reset()
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeHexTestFile writes a file with the given number of bytes, where each byte is the offset modulo 251
+func writeHexTestFile(t *testing.T, n int) (string, []byte) {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	filename := filepath.Join(t.TempDir(), "data.bin")
+	if err := os.WriteFile(filename, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return filename, data
+}
+
+func TestHexFileEditing(t *testing.T) {
+	filename, data := writeHexTestFile(t, 3*hexPageSize+100)
+	hf, err := OpenHexFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hf.Close()
+
+	// Overwrite bytes across a page boundary, and save only the modified pages
+	if err := hf.Overwrite(hexPageSize-2, []byte{0xde, 0xad, 0xbe, 0xef}); err != nil {
+		t.Fatal(err)
+	}
+	copy(data[hexPageSize-2:], []byte{0xde, 0xad, 0xbe, 0xef})
+	if got, _ := hf.ReadAt(hexPageSize-4, 8); !bytes.Equal(got, data[hexPageSize-4:hexPageSize+4]) {
+		t.Errorf("expected % x, got % x", data[hexPageSize-4:hexPageSize+4], got)
+	}
+	if hf.pages[2].data != nil {
+		t.Error("expected the unmodified pages to not be kept in memory")
+	}
+	if err := hf.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if saved, _ := os.ReadFile(filename); !bytes.Equal(saved, data) {
+		t.Error("the saved file differs from the expected contents")
+	}
+
+	// Insert and delete bytes, which changes the offsets of the following pages
+	if err := hf.Insert(10, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	removed, err := hf.Delete(2*hexPageSize, hexPageSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append(data[:10:10], append([]byte("hello"), data[10:]...)...)
+	if !bytes.Equal(removed, data[2*hexPageSize:3*hexPageSize]) {
+		t.Error("expected the removed bytes to be returned")
+	}
+	data = append(data[:2*hexPageSize:2*hexPageSize], data[3*hexPageSize:]...)
+	if hf.Size() != int64(len(data)) {
+		t.Errorf("expected the size to be %d, got %d", len(data), hf.Size())
+	}
+	if found, _ := hf.Index([]byte{0xde, 0xad, 0xbe, 0xef}, 100); found != hexPageSize-2+5 {
+		t.Errorf("expected to find the bytes at %d, got %d", hexPageSize-2+5, found)
+	}
+	if err := hf.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if saved, _ := os.ReadFile(filename); !bytes.Equal(saved, data) {
+		t.Error("the saved file differs from the expected contents")
+	}
+	if hf.Modified() {
+		t.Error("expected no unsaved changes after saving")
+	}
+}
+
+func TestHexViewUndo(t *testing.T) {
+	filename, data := writeHexTestFile(t, 40)
+	hf, err := OpenHexFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hf.Close()
+	hv := NewHexView(hf)
+
+	// Overwrite the first byte with 0xab, one hex digit at a time
+	hv.WriteNibble(0xa)
+	hv.WriteNibble(0xb)
+	// Insert a byte
+	hv.insertMode = true
+	hv.WriteByte('x')
+	if got, _ := hf.ReadAt(0, 3); !bytes.Equal(got, []byte{0xab, 'x', 0x01}) {
+		t.Errorf("expected ab 78 01, got % x", got)
+	}
+	for hv.Undo() == nil {
+	}
+	if got, _ := hf.ReadAt(0, 40); !bytes.Equal(got, data) {
+		t.Errorf("expected all edits to be undone, got % x", got)
+	}
+
+	if got, want := parseHexSearch("de ad 0xBE"), []byte{0xde, 0xad, 0xbe}; !bytes.Equal(got, want) {
+		t.Errorf("expected % x, got % x", want, got)
+	}
+	if got, want := parseHexSearch(`"cafe"`), []byte("cafe"); !bytes.Equal(got, want) {
+		t.Errorf("expected % x, got % x", want, got)
+	}
+	if err := hv.Search([]byte{0x20, 0x21}); err != nil || hv.cursor != 0x20 {
+		t.Errorf("expected to find 20 21 at offset 0x20, got 0x%x (%v)", hv.cursor, err)
+	}
+}
@@ -34,7 +34,6 @@ func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy
 
 	// TODO: Refactor this function
 	var (
-		match                              bool
 		arrowBeforeCommentMarker           bool
 		inListItem                         bool
 		inCodeBlock                        bool // used when highlighting Doc, Markdown, Python, Nim, Mojo or Starlark
@@ -48,9 +47,6 @@ func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy
 		ignoreSingleQuotes                 = e.mode == mode.Lisp || e.mode == mode.Clojure || e.mode == mode.Scheme || e.mode == mode.Ini
 		numLinesToDraw                     int
 		runeIndex                          int
-		length                             int
-		counter                            int
-		i                                  int
 		thisLineParCount, thisLineBraCount int
 		parCountBeforeThisLine             int
 		braCountBeforeThisLine             int
@@ -91,10 +87,13 @@ func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy
 		fg                                 vt100.AttributeColor
 		dottedLineColor                    vt100.AttributeColor
 		bg                                 vt100.AttributeColor = e.Background.Background()
-		ra, ra2                            textoutput.CharAttribute
-		searchTermRunes                    = []rune(e.searchTerm) // Search term highlighting
+		ra                                 textoutput.CharAttribute
+		searchMatcher                      *SearchMatcher // Search term highlighting
+		searchMatchLengths                 []int
 		runesAndAttributes                 []textoutput.CharAttribute
 		q                                  *QuoteState
+		wrapRows                           uint  // the number of additional screen rows used by soft wrapped lines so far
+		wrapBreaks                         []int // where the next visual rows of the current line start, when soft wrapping
 		escapeFunction                     = Escape
 		unEscapeFunction                   = UnEscape
 	)
@@ -103,7 +102,17 @@ func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy
 	resizeMut.Lock()
 	defer resizeMut.Unlock()
 
-	cw = c.Width()
+	if hasSearchTerm {
+		if searchMatcher, err = e.SearchMatcher(); err != nil {
+			// Not a valid regular expression, so nothing to highlight
+			hasSearchTerm = false
+		}
+	}
+
+	cw = cx + e.pos.ViewWidth(c) // the right edge of the part of the canvas where the lines are drawn
+	if e.softWrap {
+		e.softWrapWidth = int(cw - cx)
+	}
 	if fromline >= toline {
 		return // errors.New("fromline >= toline in WriteLines")
 	}
@@ -196,17 +205,45 @@ func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy
 
 	highlightCurrentLine := false
 
+	// Find the selected part of the document, if there is a selection
+	var (
+		lineSelected       bool
+		selFrom, selTo     int // the selected screen columns on the current line, with tabs expanded
+		selStartY, selEndY LineIndex
+		selStartX, selEndX int
+	)
+	if e.selection != nil {
+		selStartY, selStartX, selEndY, selEndX = e.SelectionRange()
+	}
+	cursorColumns := e.cursorColumnsByLine()
+
 	// buffer for extracting char attributes from strings with terminal codes (will be expanded if it's too small)
 	cc := make([]textoutput.CharAttribute, 256)
 
-	// Loop from 0 to numlines (used as y+offset in the loop) to draw the text
-	for y = LineIndex(0); y < LineIndex(numLinesToDraw); y++ {
+	// Loop from 0 to numlines to draw the text. dataY is the line index in the document, which is y+offsetY unless there are closed folds.
+	var dataY LineIndex
+	for y, dataY = LineIndex(0), offsetY; y < LineIndex(numLinesToDraw); y, dataY = y+1, dataY+1 {
+
+		// Stop when soft wrapped lines have filled the view
+		if int(y)+int(wrapRows) >= numLinesToDraw {
+			break
+		}
+
+		// Skip the lines that are hidden by closed folds, but keep track of the quote state
+		for len(e.folds) > 0 && e.isHidden(dataY) && int(dataY) < e.Len() {
+			q.Process(strings.TrimSpace(e.Line(dataY)))
+			dataY++
+		}
 
-		highlightCurrentLine = shouldHighlightNow && int(y) == e.pos.sy
+		highlightCurrentLine = shouldHighlightNow && int(dataY-offsetY) == e.pos.sy
+
+		if e.selection != nil {
+			selFrom, selTo, lineSelected = e.selectedColumns(dataY, selStartY, selStartX, selEndY, selEndX)
+		}
 
 		lineRuneCount = 0 // per line rune counter, for drawing spaces afterwards
 
-		line = trimRightSpace(e.Line(LineIndex(y + offsetY)))
+		line = trimRightSpace(e.Line(dataY))
 
 		// already trimmed right, just trim left
 		trimmedLine = strings.TrimLeftFunc(line, unicode.IsSpace)
@@ -214,12 +251,16 @@ func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy
 		// expand tabs
 		line = strings.ReplaceAll(line, "\t", tabString)
 
+		if e.softWrap {
+			wrapBreaks = softWrapBreaks([]rune(line), int(cw-cx))
+		}
+
 		if e.syntaxHighlight && !envNoColor {
 			// Output a syntax highlighted line. Escape any tags in the input line.
 			// textWithTags must be unescaped if there is not an error.
 			if textWithTags, err = syntax.AsText([]byte(escapeFunction(line)), e.mode); err != nil {
 				// Only output the line up to the width of the canvas
-				screenLine = e.ChopLine(line, int(cw))
+				screenLine = e.ChopLine(line, int(cw-cx))
 				// TODO: Check if just "fmt.Print" works here, for several terminal emulators
 				fmt.Println(screenLine)
 				lineRuneCount += uint(runewidth.StringWidth(screenLine))
@@ -526,8 +567,14 @@ func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy
 				e.pos.mut.Lock()
 				skipX := e.pos.offsetX
 				e.pos.mut.Unlock()
+				if e.softWrap {
+					skipX = 0
+				}
 
 				matchForAnotherN = 0
+				if hasSearchTerm {
+					searchMatchLengths = searchMatcher.MatchLengths(runesAndAttributes, searchMatchLengths)
+				}
 				untilNextJumpLetter = 0
 				letter = rune(0)
 				tx, ty = uint(0), uint(0)
@@ -537,42 +584,24 @@ func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy
 						skipX--
 						continue
 					}
-					if ra.R == ' ' {
+					if matchForAnotherN > 0 {
+						// Coloring an already found match
+						fg = e.SearchHighlight
+						matchForAnotherN--
+					} else if hasSearchTerm && searchMatchLengths[runeIndex] > 0 {
+						// The start of a search match
+						fg = e.SearchHighlight
+						matchForAnotherN = searchMatchLengths[runeIndex] - 1
+					} else if ra.R == ' ' {
 						fg = e.Foreground
 					} else {
 						fg = ra.A
 
-						if matchForAnotherN > 0 {
-							// Coloring an already found match
-							fg = e.SearchHighlight
-							matchForAnotherN--
-						} else if hasSearchTerm && ra.R == searchTermRunes[0] {
-							// Potential search highlight match
-							length = utf8.RuneCountInString(e.searchTerm)
-							counter = 0
-							match = true
-							for i = runeIndex; i < (runeIndex + length); i++ {
-								if i >= len(runesAndAttributes) {
-									match = false
-									break
-								}
-								ra2 = runesAndAttributes[i]
-								if ra2.R != []rune(e.searchTerm)[counter] {
-									// mismatch, not a hit
-									match = false
-									break
-								}
-								counter++
-							}
-							if match {
-								fg = e.SearchHighlight
-								matchForAnotherN = length - 1
-							}
-						} else if e.jumpToLetterMode {
+						if e.jumpToLetterMode {
 							letter = ra.R
 							// Highlight some letters, and make it possible for the user to jump directly to these after pressing ctrl-l
-							tx = cx + uint(lineRuneCount)           // the x position
-							ty = cy + uint(y) + uint(e.pos.offsetY) // adding offset to get the position in the file and not only on the screen
+							tx = uint(lineRuneCount) // the x position
+							ty = uint(dataY)         // the position in the file and not only on the screen
 							if untilNextJumpLetter <= 0 && !e.HasJumpLetter(letter) && e.RegisterJumpLetter(letter, ColIndex(tx), LineIndex(ty)) {
 								untilNextJumpLetter = 60
 								fg = e.JumpToLetterColor // foreground color for the highlighted "jump to letter"
@@ -583,8 +612,21 @@ func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy
 						}
 					}
 
+					// Continue on the next screen row, when soft wrapping
+					if len(wrapBreaks) > 0 && runeIndex == wrapBreaks[0] {
+						if int(y)+int(wrapRows)+1 >= numLinesToDraw {
+							break
+						}
+						if tx = cx + lineRuneCount; tx < cw {
+							c.WriteRunesB(tx, cy+uint(y)+wrapRows, e.Foreground, bg, ' ', cw-tx)
+						}
+						wrapBreaks = wrapBreaks[1:]
+						wrapRows++
+						lineRuneCount = 0
+					}
+
 					if ra.R == '\t' {
-						c.Write(cx+lineRuneCount, cy+uint(y), fg, e.Background, tabString)
+						c.Write(cx+lineRuneCount, cy+uint(y)+wrapRows, fg, e.Background, tabString)
 						lineRuneCount += uint(e.indentation.PerTab)
 					} else {
 						letter = ra.R
@@ -592,9 +634,11 @@ func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy
 							letter = controlRuneReplacement
 						}
 						tx = cx + lineRuneCount
-						ty = cy + uint(y)
+						ty = cy + uint(y) + wrapRows
 						if tx < cw {
-							if highlightCurrentLine && (e.highlightCurrentText || e.highlightCurrentLine) {
+							if lineSelected && runeIndex >= selFrom && runeIndex < selTo {
+								c.WriteRuneBNoLock(tx, ty, e.SelectionForeground, e.SelectionBackground, letter)
+							} else if highlightCurrentLine && (e.highlightCurrentText || e.highlightCurrentLine) {
 								c.WriteRuneBNoLock(tx, ty, e.HighlightForeground, e.HighlightBackground, letter)
 							} else {
 								c.WriteRuneBNoLock(tx, ty, fg, bg, letter)
@@ -609,27 +653,84 @@ func (e *Editor) WriteLines(c *vt100.Canvas, fromline, toline LineIndex, cx, cy
 			if e.mode == mode.ManPage {
 				line = handleManPageEscape(line)
 			}
-			// Output a regular line, scrolled to the current e.pos.offsetX
-			screenLine = e.ChopLine(line, int(cw))
-			c.Write(cx+lineRuneCount, cy+uint(y), e.Foreground, e.Background, screenLine)
+			// Output a regular line, scrolled to the current e.pos.offsetX, or soft wrapped
+			if e.softWrap {
+				runes := []rune(line)
+				start := 0
+				for _, brk := range wrapBreaks {
+					if int(y)+int(wrapRows)+1 >= numLinesToDraw {
+						break
+					}
+					c.Write(cx, cy+uint(y)+wrapRows, e.Foreground, e.Background, string(runes[start:brk]))
+					c.WriteRunesB(cx+uint(brk-start), cy+uint(y)+wrapRows, e.Foreground, bg, ' ', cw-cx-uint(brk-start))
+					start = brk
+					wrapRows++
+				}
+				screenLine = string(runes[start:min(len(runes), start+int(cw-cx))])
+			} else {
+				screenLine = e.ChopLine(line, int(cw-cx))
+			}
+			c.Write(cx+lineRuneCount, cy+uint(y)+wrapRows, e.Foreground, e.Background, screenLine)
 			lineRuneCount += uint(utf8.RuneCountInString(screenLine)) // rune count
+			// Mark the selected part of the line
+			if lineSelected {
+				for x := max(selFrom-e.pos.offsetX, 0); x < selTo-e.pos.offsetX && cx+uint(x) < cw; x++ {
+					c.WriteBackground(cx+uint(x), cy+uint(y)+wrapRows, e.SelectionBackground)
+				}
+			}
 		}
 
 		// Fill the rest of the line on the canvas with "blanks"
 		// TODO: This may draw the wrong number of blanks, since lineRuneCount should really be the number of visible glyphs at this point. This is problematic for emojis.
-		yp = cy + uint(y)
+		yp = cy + uint(y) + wrapRows
 		xp = cx + lineRuneCount
-		if int(cw-lineRuneCount) > 0 {
-			if highlightCurrentLine && e.highlightCurrentLine {
-				c.WriteRunesB(xp, yp, e.HighlightForeground, e.HighlightBackground, ' ', cw-lineRuneCount)
+
+		// Show a summary after the first line of a closed fold
+		if len(e.folds) > 0 && xp < cw {
+			if fold, ok := e.closedFoldAt(dataY); ok {
+				summary := foldSummary(fold)
+				c.Write(xp, yp, e.CommentColor, e.Background, summary)
+				xp += uint(utf8.RuneCountInString(summary))
+			}
+		}
+
+		if xp < cw {
+			if lineSelected && e.selection.kind == lineSelection {
+				c.WriteRunesB(xp, yp, e.SelectionForeground, e.SelectionBackground, ' ', cw-xp)
+			} else if highlightCurrentLine && e.highlightCurrentLine {
+				c.WriteRunesB(xp, yp, e.HighlightForeground, e.HighlightBackground, ' ', cw-xp)
 			} else {
-				c.WriteRunesB(xp, yp, e.Foreground, bg, ' ', cw-lineRuneCount)
+				c.WriteRunesB(xp, yp, e.Foreground, bg, ' ', cw-xp)
+			}
+			// Show that the newline is selected, for character-wise selections that continue on the next line
+			if lineSelected && e.selection.kind == charSelection && dataY < selEndY {
+				c.WriteRuneB(xp, yp, e.SelectionForeground, e.SelectionBackground, ' ')
+			}
+			// Rectangular selections may continue after the end of the line
+			if lineSelected && e.selection.kind == rectSelection {
+				for x := max(selFrom-e.pos.offsetX, int(lineRuneCount)); x < selTo-e.pos.offsetX && cx+uint(x) < cw; x++ {
+					c.WriteBackground(cx+uint(x), yp, e.SelectionBackground)
+				}
+			}
+		}
+
+		// Mark the additional cursors, if there are several cursors
+		for _, col := range cursorColumns[dataY] {
+			if x := col - e.pos.offsetX; x >= 0 && cx+uint(x) < cw {
+				c.WriteBackground(cx+uint(x), yp, e.SelectionBackground)
 			}
 		}
 
 		// Draw a dotted line to remind the user of where the N-column limit is
-		if (e.showColumnLimit || e.mode == mode.Git) && lineRuneCount <= uint(e.wrapWidth) {
-			c.WriteRune(uint(e.wrapWidth), yp, dottedLineColor, bg, '·')
+		if (e.showColumnLimit || e.mode == mode.Git) && lineRuneCount <= uint(e.wrapWidth) && cx+uint(e.wrapWidth) < cw {
+			c.WriteRune(cx+uint(e.wrapWidth), yp, dottedLineColor, bg, '·')
+		}
+
+		// Draw a marker at the right edge if there is a breakpoint at this line
+		if e.debugMode && len(e.breakpoints) > 0 && cw > 0 {
+			if letter = e.breakpointMarker(dataY.LineNumber()); letter != 0 {
+				c.WriteRune(cw-1, yp, e.StatusErrorForeground, bg, letter)
+			}
 		}
 
 	}
@@ -50,7 +50,7 @@ func (e *Editor) InsertRune(c *vt100.Canvas, r rune) bool {
 
 		h := 80
 		if c != nil {
-			h = int(c.Height())
+			h = int(e.pos.ViewHeight(c))
 		}
 		if e.pos.sy >= (h - 1) {
 			e.ScrollDown(c, nil, 1, h)
@@ -69,7 +69,7 @@ func (e *Editor) InsertRune(c *vt100.Canvas, r rune) bool {
 	// Scroll right when reaching 95% of the terminal width
 	wf := 80.0
 	if c != nil {
-		wf = float64(c.Width())
+		wf = float64(e.pos.ViewWidth(c))
 	}
 	if e.pos.sx > int(wf*0.95) {
 		// scroll
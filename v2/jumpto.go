@@ -78,6 +78,10 @@ func (e *Editor) GoTo(dataY LineIndex, c *vt100.Canvas, status *StatusBar) (bool
 		return true, false
 	}
 	reachedTheEnd := false
+	// For large files, wait for all the lines to be indexed before going past the lines that are indexed so far
+	if dataY >= LineIndex(e.Len()) {
+		e.MergeLargeFileIndex(true)
+	}
 	// Out of bounds checking for y
 	if dataY < 0 {
 		dataY = 0
@@ -86,10 +90,13 @@ func (e *Editor) GoTo(dataY LineIndex, c *vt100.Canvas, status *StatusBar) (bool
 		reachedTheEnd = true
 	}
 
+	// Open the folds that hide the line
+	e.OpenFoldsAt(dataY)
+
 	h := 25
 	if c != nil {
 		// Get the current terminal height
-		h = int(c.Height())
+		h = int(e.pos.ViewHeight(c))
 	}
 
 	// Is the place we want to go within the current scroll window?
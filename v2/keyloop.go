@@ -33,6 +33,22 @@ const (
 	homeKey = "⇱" // home
 	endKey  = "⇲" // end
 	copyKey = "⎘" // ctrl-insert
+
+	// Key sequences that are not translated by the vt100 package
+	shiftUpArrow    = "\x1b[1;2A"
+	shiftDownArrow  = "\x1b[1;2B"
+	shiftRightArrow = "\x1b[1;2C"
+	shiftLeftArrow  = "\x1b[1;2D"
+	shiftTabKey     = "\x1b[Z"
+
+	altShiftUpArrow    = "\x1b[1;4A"
+	altShiftDownArrow  = "\x1b[1;4B"
+	altShiftRightArrow = "\x1b[1;4C"
+	altShiftLeftArrow  = "\x1b[1;4D"
+	ctrlDownArrow      = "\x1b[1;5B"
+	ctrlPgUpKey        = "\x1b[5;5~"
+	ctrlPgDnKey        = "\x1b[6;5~"
+	f6Key              = "\x1b[17~"
 )
 
 // Create a LockKeeper for keeping track of which files are being edited
@@ -160,6 +176,13 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 	e.previousX = 1
 	e.previousY = 1
 
+	// Load the undo history from the previous session, if persistent undo is enabled
+	if !fnord.stdin {
+		undo.LoadHistory(e, absFilename)
+		// Start the language server for this file, if there is one, so that it is ready when it is needed
+		e.LSPStartInBackground()
+	}
+
 	tty.SetTimeout(2 * time.Millisecond)
 
 	var (
@@ -246,9 +269,13 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 	for !e.quit {
 
 		if e.macro == nil || (e.playBackMacroCount == 0 && !e.macro.Recording) {
+			// Keep a running language server up to date with the current text
+			e.LSPSyncInBackground()
 			// Read the next key in the regular way
 			key = tty.String()
 			undo.IgnoreSnapshots(false)
+			// End the undo group for the macro playback, if the macro was cleared while playing back
+			undo.EndGroup(e)
 		} else {
 			if e.macro.Recording {
 				undo.IgnoreSnapshots(true)
@@ -259,17 +286,47 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 					e.macro.Add(key)
 				}
 			} else if e.playBackMacroCount > 0 {
-				undo.IgnoreSnapshots(true)
 				key = e.macro.Next()
 				if key == "" || key == "c:20" { // ctrl-t
 					e.macro.Home()
 					e.playBackMacroCount--
+					if e.playBackMacroCount == 0 {
+						// The macro playback is done, so it can be undone as one unit
+						undo.EndGroup(e)
+					}
 					// No more macro keys. Read the next key.
 					key = tty.String()
 				}
 			}
 		}
 
+		// Add the lines of a large file that have been indexed in the background since the last key press
+		e.MergeLargeFileIndex(false)
+
+		// Shift and an arrow key starts a selection, if needed, and then moves the cursor
+		if arrowKey, ok := shiftArrowKeys[key]; ok {
+			if e.selection == nil {
+				e.StartSelection(charSelection)
+			}
+			key = arrowKey
+		}
+
+		// Alt, shift and an arrow key starts a rectangular selection, if needed, and then moves the cursor
+		if arrowKey, ok := altShiftArrowKeys[key]; ok {
+			if e.selection == nil || e.selection.kind != rectSelection {
+				e.ClearSelection()
+				e.StartSelection(rectSelection)
+			}
+			key = arrowKey
+		}
+
+		// Remember where the cursor was, how many lines there were and the current line,
+		// for moving the closed folds after editing
+		foldY, foldLineCount, foldLine := e.DataY(), e.Len(), ""
+		if len(e.folds) > 0 {
+			foldLine = e.Line(foldY)
+		}
+
 		switch key {
 		case "c:17": // ctrl-q, quit
 
@@ -280,6 +337,14 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 				break
 			}
 
+			// If other buffers have unsaved changes, ctrl-q must be pressed twice
+			if unsaved := e.UnsavedBuffers(); len(unsaved) > 0 && !kh.PrevIs("c:17") {
+				status.ClearAll(c, false)
+				status.SetErrorMessage("Unsaved changes in " + strings.Join(unsaved, ", ") + ". Press ctrl-q again to quit.")
+				status.ShowNoTimeout(c, e)
+				break
+			}
+
 			e.quit = true
 		case "c:23": // ctrl-w, format or insert template (or if in git mode, cycle interactive rebase keywords)
 
@@ -295,6 +360,13 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			// Clear the search term
 			e.ClearSearch()
 
+			// Format only the selected text, if there is a selection
+			if e.selection != nil {
+				status.ClearAll(c, true)
+				e.FormatSelection(c, tty, status, &jsonFormatToggle)
+				break
+			}
+
 			// First check if we are editing Markdown and are in a Markdown table (and that this is not the previous thing that we did)
 			if e.mode == mode.Markdown && e.InTable() && !kh.PrevIs("c:23") {
 				e.GoToStartOfTextLine(c)
@@ -370,12 +442,14 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 
 			// If in Debug mode, let ctrl-f mean "finish"
 			if e.debugMode {
-				if e.gdb == nil { // success
+				if e.debugger == nil { // success
 					status.SetMessageAfterRedraw("Not running")
 					break
 				}
 				status.ClearAll(c, false)
-				if err := e.DebugFinish(); err != nil {
+				if err := e.DebugFinish(); err == errProgramRunning {
+					status.SetMessage(capitalizeFirst(err.Error()))
+				} else if err != nil {
 					e.DebugEnd()
 					status.SetMessage(err.Error())
 					e.GoToEnd(c, nil)
@@ -579,6 +653,7 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 				status.Show(c, e)
 			} else if e.playBackMacroCount > 0 {
 				undo.IgnoreSnapshots(false)
+				undo.EndGroup(e)
 				status.Clear(c, false)
 				status.SetMessage("Stopped macro") // stop macro playback
 				status.Show(c, e)
@@ -586,14 +661,19 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 				e.macro.Home()
 			} else { // && e.macro != nil && e.playBackMacroCount == 0 // start macro playback
 				undo.IgnoreSnapshots(false)
-				undo.Snapshot(e)
+				// Undo the entire macro playback as one unit
+				undo.BeginGroup(e)
 				status.ClearAll(c, false)
 				// Play back the macro, once
 				e.playBackMacroCount = 1
 			}
-		case "c:28": // ctrl-\, toggle comment for this block
+		case "c:28": // ctrl-\, toggle comment for this block, or for the selected lines
 			undo.Snapshot(e)
-			e.ToggleCommentBlock(c)
+			if e.selection != nil {
+				e.ToggleCommentSelection()
+			} else {
+				e.ToggleCommentBlock(c)
+			}
 			e.redraw.Store(true)
 			e.redrawCursor.Store(true)
 		case "c:15": // ctrl-o, launch the command menu
@@ -702,10 +782,17 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 
 			if !e.nanoMode.Load() {
 				if e.debugMode {
-					// e.showRegisters has three states, 0 (SmallRegisterWindow), 1 (LargeRegisterWindow) and 2 (NoRegisterWindow)
-					e.debugShowRegisters++
-					if e.debugShowRegisters > noRegisterWindow {
-						e.debugShowRegisters = smallRegisterWindow
+					// e.debugShowRegisters has four states: smallRegisterWindow, largeRegisterWindow, stackWindow and noRegisterWindow.
+					// The register layouts are skipped if the debugger backend has no registers.
+					e.nextDebugPaneLayout()
+					break
+				}
+				// If the build errors are shown, go to the previous one
+				if quickfix.Visible() {
+					const forward = false
+					if err := e.NextDiagnostic(c, tty, status, forward); err != nil {
+						status.SetError(err)
+						status.Show(c, e)
 					}
 					break
 				}
@@ -786,6 +873,14 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 				break
 			}
 
+			// Move up one visual row, if long lines are soft wrapped
+			if e.softWrap {
+				if e.SoftWrapUp(c, status) {
+					e.redraw.Store(true)
+				}
+				break
+			}
+
 			if e.DataY() > 0 {
 				// Move the position up in the current screen
 				if e.UpEnd(c) != nil {
@@ -827,7 +922,7 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 
 				// If in Debug mode, let ctrl-n mean "next instruction"
 				if e.debugMode {
-					if e.gdb != nil {
+					if e.debugger != nil {
 						if !programRunning {
 							e.DebugEnd()
 							status.SetMessage("Program stopped")
@@ -836,7 +931,9 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 							e.redrawCursor.Store(true)
 							break
 						}
-						if err := e.DebugNextInstruction(); err != nil {
+						if err := e.DebugNextInstruction(); err == errProgramRunning {
+							status.SetMessage(capitalizeFirst(err.Error()))
+						} else if err != nil {
 							if errorMessage := err.Error(); strings.Contains(errorMessage, "is not being run") {
 								e.DebugEnd()
 								status.SetMessage("Could not start GDB")
@@ -859,7 +956,7 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 						e.redrawCursor.Store(true)
 						status.SetMessageAfterRedraw(status.Message())
 						break
-					} // e.gdb == nil
+					} // e.debugger == nil
 					// Build or export the current file
 					outputExecutable, err := e.BuildOrExport(tty, c, status)
 					// All clear when it comes to status messages and redrawing
@@ -904,6 +1001,15 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 					}
 					break
 				}
+				// If the build errors are shown, go to the next one
+				if quickfix.Visible() {
+					const forward = true
+					if err := e.NextDiagnostic(c, tty, status, forward); err != nil {
+						status.SetError(err)
+						status.Show(c, e)
+					}
+					break
+				}
 				e.UseStickySearchTerm()
 				if e.SearchTerm() != "" {
 					// Go to next match
@@ -937,7 +1043,7 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 					justJumpedToMatchingP = false
 
 					// Scroll down
-					h := int(c.Height())
+					h := int(e.pos.ViewHeight(c))
 					redraw := e.ScrollDown(c, status, e.pos.scrollSpeed, h)
 					e.redraw.Store(redraw)
 					// If redraw is false, the end of file is reached
@@ -994,13 +1100,21 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 				break
 			}
 
+			// Move down one visual row, if long lines are soft wrapped
+			if e.softWrap {
+				if e.SoftWrapDown(c, status) {
+					e.redraw.Store(true)
+				}
+				break
+			}
+
 			if e.DataY() < LineIndex(e.Len()) {
 				// Move the position down in the current screen
 				if e.DownEnd(c) != nil {
 					// If at the bottom, don't move down, but scroll the contents
 					// Output a helpful message
 					if !e.AfterEndOfDocument() {
-						canvasHeight := int(c.Height())
+						canvasHeight := int(e.pos.ViewHeight(c))
 						e.redraw.Store(e.ScrollDown(c, status, 1, canvasHeight))
 						e.pos.Up()
 						e.DownEnd(c)
@@ -1055,7 +1169,7 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 					e.drawProgress.Store(true)
 					e.drawFuncName.Store(false)
 				case scrollDownAction:
-					canvasHeight := int(c.Height())
+					canvasHeight := int(e.pos.ViewHeight(c))
 					e.redraw.Store(e.ScrollDown(c, status, e.pos.scrollSpeed, canvasHeight))
 					e.redrawCursor.Store(true)
 					if e.AfterLineScreenContents() {
@@ -1075,6 +1189,8 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			fallthrough // nano: ctrl-l to refresh
 		case "c:27": // esc, clear search term (but not the sticky search term), reset, clean and redraw
 			e.blockMode = false
+			e.ClearSelection()
+			e.ClearCursors()
 			// If o is used as a man page viewer, exit at the press of esc
 			if e.mode == mode.ManPage {
 				clearOnQuit.Store(false)
@@ -1090,6 +1206,13 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 				e.redrawCursor.Store(true)
 				break
 			}
+			// Hide the build errors, if they are shown
+			if quickfix.Visible() {
+				quickfix.Hide()
+				e.redraw.Store(true)
+				e.redrawCursor.Store(true)
+				break
+			}
 			// Reset the cut/copy/paste double-keypress detection
 			lastCopyY = -1
 			lastPasteY = -1
@@ -1166,6 +1289,9 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 				lastPasteY++
 			}
 
+			// Pressing return ends the editing with several cursors
+			e.ClearCursors()
+
 			undo.Snapshot(e)
 
 			e.ReturnPressed(c, status)
@@ -1193,8 +1319,20 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 				// break
 			}
 
+			// Delete to the left of every cursor, if there are several cursors
+			if e.multiCursor != nil {
+				e.BackspaceAtCursors(undo)
+				break
+			}
+
 			undo.Snapshot(e)
 
+			// Delete the selected text, if there is a selection
+			if e.selection != nil {
+				e.DeleteSelection(c, status)
+				break
+			}
+
 			e.Backspace(c, bookmark)
 
 			e.redrawCursor.Store(true)
@@ -1224,6 +1362,19 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 				break
 			}
 
+			// Indent at every cursor, if there are several cursors
+			if e.multiCursor != nil {
+				e.TabAtCursors(undo)
+				break
+			}
+
+			// Indent the selected lines, if there is a selection
+			if e.selection != nil {
+				undo.Snapshot(e)
+				e.IndentSelection(false)
+				break
+			}
+
 			y := int(e.DataY())
 			r := e.Rune()
 			leftRune := e.LeftRune()
@@ -1366,7 +1517,7 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			e.redraw.Store(true)
 
 		case pgUpKey: // page up
-			h := int(c.H())
+			h := int(e.pos.ViewHeight(c))
 			e.redraw.Store(e.ScrollUp(c, status, int(float64(h)*0.9)))
 			e.redrawCursor.Store(true)
 			if e.AfterLineScreenContents() {
@@ -1376,7 +1527,7 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			e.drawFuncName.Store(true)
 
 		case pgDnKey: // page down
-			h := int(c.H())
+			h := int(e.pos.ViewHeight(c))
 			redraw := e.ScrollDown(c, status, int(float64(h)*0.9), h)
 			e.redraw.Store(redraw)
 			// If redraw is false, the end of file is reached
@@ -1392,10 +1543,10 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			e.drawProgress.Store(true)
 			e.drawFuncName.Store(true)
 
-		case "c:25": // ctrl-y
+		case "c:25": // ctrl-y, redo if the previous key was undo or redo
 
 			if e.nanoMode.Load() { // nano: ctrl-y, page up
-				h := int(c.H())
+				h := int(e.pos.ViewHeight(c))
 				e.redraw.Store(e.ScrollUp(c, status, h))
 				e.redrawCursor.Store(true)
 				if e.AfterLineScreenContents() {
@@ -1404,6 +1555,19 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 				break
 			}
 
+			if kh.PrevIs("c:21", "c:26", "c:25") {
+				// Try to redo the edit that was just undone
+				if err := undo.Redo(e); err == nil {
+					e.EnableAndPlaceCursor(c)
+					e.redrawCursor.Store(true)
+					e.redraw.Store(true)
+				} else {
+					status.SetMessage("Nothing more to redo")
+					status.Show(c, e)
+				}
+				break
+			}
+
 			fallthrough
 		case "c:1", homeKey: // ctrl-a, home (or ctrl-y for scrolling up in the st terminal)
 
@@ -1470,7 +1634,9 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			e.SaveX(true)
 		case "c:4": // ctrl-d, delete
 			undo.Snapshot(e)
-			if e.Empty() {
+			if e.selection != nil {
+				e.DeleteSelection(c, status)
+			} else if e.Empty() {
 				status.SetMessage("Empty")
 				status.Show(c, e)
 			} else {
@@ -1483,8 +1649,15 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 				spellCheckFunc()
 			}
 		case "c:19": // ctrl-s, save (or step, if in debug mode)
+			if e.fileFormat.mixed {
+				// Tell the user before the mixed line endings are converted, and convert them if ctrl-s is pressed again
+				e.fileFormat.mixed = false
+				status.SetErrorMessage("The line endings are mixed. Press ctrl-s again to save with only " + lineEndingName(e.fileFormat.lineEnding) + " line endings.")
+				status.Show(c, e)
+				break
+			}
 			e.UserSave(c, tty, status)
-		case "c:7": // ctrl-g, either go to definition OR jump to matching parent/bracket OR toggle the status bar
+		case "c:7": // ctrl-g, either go to definition OR jump to matching parent/bracket OR toggle the status bar. In debug mode, send commands to the debugger.
 
 			if e.nanoMode.Load() { // nano: ctrl-g, help
 				status.ClearAll(c, false)
@@ -1493,6 +1666,18 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 				break
 			}
 
+			if e.debugMode {
+				if err := e.DebugCommandPrompt(c, tty, status); err == errProgramStopped {
+					e.DebugEnd()
+					status.SetMessageAfterRedraw("Program stopped")
+				} else if err != nil {
+					status.SetErrorAfterRedraw(err)
+				}
+				e.redraw.Store(true)
+				e.redrawCursor.Store(true)
+				break
+			}
+
 			// If a search is in progress, clear the search first
 			if e.searchTerm != "" {
 				e.ClearSearch()
@@ -1504,8 +1689,9 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			oldLineIndex := e.LineIndex()
 
 			// func prefix must exist for this language/mode for GoToDefinition to be supported
+			// Ask the language server first, if one is installed, then fall back to searching
 			if e.ProgrammingLanguage() {
-				jumpedToDefinition := e.FuncPrefix() != "" && e.GoToDefinition(tty, c, status)
+				jumpedToDefinition := e.LSPGoToDefinition(c, tty, status) || (e.FuncPrefix() != "" && e.GoToDefinition(tty, c, status))
 				if jumpedToDefinition {
 					break
 				}
@@ -1555,6 +1741,9 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			lastPasteY = -1
 			lastCopyY = -1
 
+			// The positions of the additional cursors are not kept in the undo buffer
+			e.ClearCursors()
+
 			// Try to restore the previous editor state in the undo buffer
 			if err := undo.Restore(e); err == nil {
 				e.EnableAndPlaceCursor(c)
@@ -1587,6 +1776,16 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			// Prepare to cut
 			undo.Snapshot(e)
 
+			// Cut the selected text, if there is a selection
+			if e.selection != nil {
+				lastCutY, lastCopyY, lastPasteY = -1, -1, -1
+				if _, err := e.CopySelection(&copyLines); err != nil {
+					status.SetErrorAfterRedraw(err)
+				}
+				e.DeleteSelection(c, status)
+				break
+			}
+
 			// First try a single line cut
 			if y, multilineCut := e.CutSingleLine(status, bookmark, &lastCutY, &lastCopyY, &lastPasteY, &copyLines, &firstCopyAction); multilineCut { // Multi line cut (add to the clipboard, since it's the second press)
 				lastCutY = y
@@ -1645,6 +1844,35 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			// ctrl-c might interrupt the program, but saving at the wrong time might be just as destructive.
 			// e.Save(c, tty)
 
+			// If in Debug mode, let ctrl-c pause the program while it is running
+			if e.debugMode && e.DebugRunning() {
+				if err := e.DebugInterrupt(); err != nil {
+					status.SetError(err)
+					status.Show(c, e)
+					break
+				}
+				status.SetMessageAfterRedraw("Pause")
+				break
+			}
+
+			// Copy the selected text, if there is a selection
+			if e.selection != nil {
+				lastCutY, lastCopyY, lastPasteY = -1, -1, -1
+				lineCount, err := e.CopySelection(&copyLines)
+				e.ClearSelection()
+				e.redraw.Store(true)
+				plural := "s"
+				if lineCount == 1 {
+					plural = ""
+				}
+				if err != nil {
+					status.SetMessageAfterRedraw(fmt.Sprintf("Copied %d line%s to internal buffer", lineCount, plural))
+				} else {
+					status.SetMessageAfterRedraw(fmt.Sprintf("Copied %d line%s to the clipboard", lineCount, plural))
+				}
+				break
+			}
+
 			go func() {
 
 				y := e.DataY()
@@ -1688,7 +1916,7 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 						status.Show(c, e)
 						// Go to the end of the line, for easy line duplication with ctrl-c, enter, ctrl-v,
 						// but only if the copied line is shorter than the terminal width.
-						if uint(len(trimmed)) < c.Width() {
+						if uint(len(trimmed)) < e.pos.ViewWidth(c) {
 							e.End(c)
 						}
 					}
@@ -1723,7 +1951,7 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 		case "c:22": // ctrl-v, paste
 
 			if e.nanoMode.Load() { // nano: ctrl-v, page down
-				h := int(c.H())
+				h := int(e.pos.ViewHeight(c))
 				e.redraw.Store(e.ScrollDown(c, status, h, h))
 				e.redrawCursor.Store(true)
 				if e.AfterLineScreenContents() {
@@ -1732,6 +1960,13 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 				break
 			}
 
+			// Paste a rectangle at the cursor column, if the last copied text was a rectangular selection
+			if lines := e.RectangleToPaste(copyLines); lines != nil {
+				undo.Snapshot(e)
+				e.PasteRectangle(lines)
+				break
+			}
+
 			// paste from the portal, clipboard or line buffer. Takes an undo snapshot if text is pasted.
 			e.Paste(c, status, &copyLines, &previousCopyLines, &firstPasteAction, &lastCopyY, &lastPasteY, &lastCutY, kh.PrevIs("c:13"))
 
@@ -1813,31 +2048,18 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			}
 
 			if e.debugMode {
-				if e.breakpoint == nil {
-					e.breakpoint = e.pos.Copy()
-					_, err := e.DebugActivateBreakpoint(filepath.Base(e.filename))
-					if err != nil {
-						status.SetError(err)
-						break
-					}
+				// Toggle a breakpoint at the current line. The breakpoints can be listed with ctrl-o.
+				added, err := e.ToggleBreakpoint()
+				e.redraw.Store(true)
+				if err != nil {
+					status.SetErrorAfterRedraw(err)
+					break
+				}
+				if added {
 					s := "Placed breakpoint at line " + e.LineNumber().String()
-					status.SetMessage("  " + s + "  ")
-				} else if e.breakpoint.LineNumber() == e.LineNumber() {
-					// setting a breakpoint at the same line twice: remove the breakpoint
-					s := "Removed breakpoint at line " + e.breakpoint.LineNumber().String()
-					status.SetMessage(s)
-					e.breakpoint = nil
+					status.SetMessageAfterRedraw("  " + s + "  ")
 				} else {
-					undo.Snapshot(e)
-					// Go to the breakpoint position
-					e.GoToPosition(c, status, *e.breakpoint)
-					// TODO: Just use status.SetMessageAfterRedraw instead?
-					// Do the redraw manually before showing the status message
-					e.HideCursorDrawLines(c, true, false, true)
-					e.redraw.Store(false)
-					// Show the status message
-					s := "Jumped to breakpoint at line " + e.LineNumber().String()
-					status.SetMessage(s)
+					status.SetMessageAfterRedraw("Removed breakpoint at line " + e.LineNumber().String())
 				}
 			} else {
 				status.ClearAll(c, true)
@@ -1901,8 +2123,45 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			if kh.Prev() == "c:10" {
 				e.GoToStartOfTextLine(c)
 			}
+		case ctrlDownArrow: // ctrl-down, add a cursor below
+			if err := e.AddCursorBelow(); err != nil {
+				status.SetError(err)
+				status.Show(c, e)
+				break
+			}
+			e.redraw.Store(true)
+		case f6Key: // F6, move the focus to the other pane, if the view is split
+			if err := e.FocusOtherPane(c); err != nil {
+				status.SetErrorAfterRedraw(err)
+			}
+		case ctrlPgDnKey, ctrlPgUpKey: // ctrl-pgdn or ctrl-pgup, switch to the next or previous open buffer
+			var err error
+			if key == ctrlPgDnKey {
+				err = e.NextBuffer(c, tty, status)
+			} else {
+				err = e.PrevBuffer(c, tty, status)
+			}
+			if err != nil {
+				status.SetErrorAfterRedraw(err)
+			}
+		case shiftTabKey: // shift-tab, dedent the selected lines
+			if e.selection != nil {
+				undo.Snapshot(e)
+				e.IndentSelection(true)
+			}
 		default: // any other key
 			keyRunes := []rune(key)
+			if len(keyRunes) > 0 && unicode.IsGraphic(keyRunes[0]) {
+				// Typing text with a rectangular selection inserts the text on every selected line
+				e.AddCursorsInSelection()
+				// Typing text ends the selection
+				e.ClearSelection()
+				// Type the text at every cursor, if there are several cursors
+				if e.multiCursor != nil {
+					e.InsertAtCursors(undo, key)
+					break
+				}
+			}
 			if len(keyRunes) > 0 && unicode.IsLetter(keyRunes[0]) { // letter
 				if keyRunes[0] == 'n' && kh.TwoLastAre("c:14") && kh.PrevWithin(500*time.Millisecond) {
 					// Avoid inserting "n" if the user very recently pressed ctrl-n twice
@@ -1989,6 +2248,20 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			e.addSpace = false
 		}
 
+		// Keep the closed folds in place after editing, and open the fold that the cursor may have ended up within
+		if len(e.folds) > 0 {
+			e.AdjustFolds(foldY, e.Len()-foldLineCount, foldLine)
+			e.OpenFoldsAt(e.DataY())
+		}
+
+		// Scroll down if soft wrapped lines have pushed the cursor below the view
+		e.ScrollToCursorWhenWrapping(c)
+
+		// The cursor may have moved, so the selection needs to be redrawn
+		if e.selection != nil {
+			e.redraw.Store(true)
+		}
+
 		// Clear the key history, if needed
 		if clearKeyHistory {
 			kh.Clear()
@@ -2060,19 +2333,39 @@ func Loop(tty *vt100.TTY, fnord FilenameOrData, lineNumber LineNumber, colNumber
 			const repositionCursor = false
 			e.DrawWatches(c, repositionCursor)
 			e.DrawRegisters(c, repositionCursor)
+			e.DrawCallStack(c, repositionCursor)
 			e.DrawGDBOutput(c, repositionCursor)
 			e.DrawInstructions(c, repositionCursor)
 			e.DrawFlags(c, repositionCursor)
 		}
 
+		// Also draw the build errors, if there are more than one
+		if quickfix.Visible() {
+			const repositionCursor = false
+			e.DrawQuickfix(c, repositionCursor)
+		}
+
 		// Repositions the cursor
 		e.EnableAndPlaceCursor(c)
 
 	} // end of main loop
 
+	// Unlock the files of all other open buffers, then close the lock of the active buffer
+	if openBuffers.Len() > 1 {
+		if canUseLocks {
+			e.CloseBuffers(fileLock)
+		}
+		if filename, err := e.AbsFilename(); err == nil { // success
+			absFilename = filename
+		}
+	}
+
 	var closeLocksWaitGroup sync.WaitGroup
 	e.CloseLocksAndLocationHistory(canUseLocks, absFilename, lockTimestamp, forceFlag, &closeLocksWaitGroup)
 
+	// Shut down any language servers that were started
+	StopLSPClients()
+
 	// Quit everything that has to do with the terminal
 	if clearOnQuit.Load() {
 		vt100.Clear()
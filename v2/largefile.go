@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xyproto/binary"
+	"github.com/xyproto/vt100"
+)
+
+const (
+	// largeFileThreshold is the file size, in bytes, from where files are loaded lazily, a few lines at a time
+	largeFileThreshold = 32 * 1024 * 1024
+
+	// largeFileHeadSize is roughly how many bytes are indexed before the file is displayed.
+	// The rest of the file is indexed in the background.
+	largeFileHeadSize = 1024 * 1024
+
+	// largeFileCacheSize is the number of leaves with lines that are kept in memory
+	largeFileCacheSize = 256
+
+	// largeFileChunkSize is the number of bytes that are read at a time when indexing the lines
+	largeFileChunkSize = 64 * 1024
+)
+
+// LargeFile is a text file that is too large to be read all at once.
+// The offsets of the lines are indexed in the background, and only the lines that are in use are read from disk.
+type LargeFile struct {
+	file       *os.File
+	filename   string
+	size       int64
+	modTime    time.Time              // the modification time when the file was opened
+	onDisk     os.FileInfo            // the file at filename, as it was when it was opened or last saved
+	lineEnding string                 // the line ending that was detected when opening the file
+	mut        sync.Mutex             // for the cache
+	cache      map[*lazyLeaf][]string // lines that have been read from the file
+	cacheOrder []*lazyLeaf            // the order the lines were read in, for removing the oldest ones from the cache
+	done       chan struct{}          // closed when the whole file has been indexed
+	tail       Lines                  // the lines that were indexed in the background
+	err        error                  // an error that occurred while indexing in the background
+}
+
+// lazyLeaf is a range of a large file, that contains a number of lines
+type lazyLeaf struct {
+	lf     *LargeFile
+	offset int64
+	length int64
+	count  int  // the number of lines
+	last   bool // is this the end of the file, where the last line is not followed by a newline?
+}
+
+// isLargeFile checks if the given file is large enough to be loaded lazily
+func isLargeFile(filename string) bool {
+	fileInfo, err := os.Stat(filename)
+	return err == nil && fileInfo.Mode().IsRegular() && fileInfo.Size() >= largeFileThreshold && compressionByExtension(filename) == nil
+}
+
+// OpenLargeFile indexes the first lines of the given file and returns them, while the rest of the lines are indexed
+// in the background. Returns nil and no error if the file is not a UTF-8 text file, which must then be read normally.
+func OpenLargeFile(filename string) (*LargeFile, Lines, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, Lines{}, err
+	}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, Lines{}, err
+	}
+	head := make([]byte, min(largeFileHeadSize, fileInfo.Size()))
+	if _, err := io.ReadFull(file, head); err != nil {
+		file.Close()
+		return nil, Lines{}, err
+	}
+	// Only UTF-8 text files without a BOM can be loaded lazily, since the lines are read directly from the file.
+	// Skip the last line, since it may end in the middle of a rune.
+	if i := bytes.LastIndexByte(head, '\n'); i >= 0 {
+		head = head[:i+1]
+	}
+	ff, decoded := DecodeFileData(head)
+	if ff.charset != charsetUTF8 || ff.bom || len(decoded) != len(head) || binary.Data(head) {
+		file.Close()
+		return nil, Lines{}, nil
+	}
+	lf := &LargeFile{
+		file:       file,
+		filename:   filename,
+		size:       fileInfo.Size(),
+		modTime:    fileInfo.ModTime(),
+		onDisk:     fileInfo,
+		lineEnding: ff.lineEnding,
+		cache:      make(map[*lazyLeaf][]string),
+		done:       make(chan struct{}),
+	}
+	leaves, offset, err := lf.index(0, largeFileHeadSize)
+	if err != nil {
+		file.Close()
+		return nil, Lines{}, err
+	}
+	go func() {
+		defer close(lf.done)
+		tailLeaves, _, err := lf.index(offset, lf.size)
+		if err != nil {
+			lf.err = err
+			return
+		}
+		lf.tail = newLinesFromLeaves(tailLeaves)
+	}()
+	return lf, newLinesFromLeaves(leaves), nil
+}
+
+// index finds the lines from the given offset, and returns leaves with linesLeafSize lines each.
+// It stops at the first leaf that ends after the given limit, and returns the offset where the next leaf starts.
+// The end of the file is always in a leaf of its own, which may contain only an empty line.
+func (lf *LargeFile) index(offset, limit int64) ([]*linesNode, int64, error) {
+	var (
+		leaves []*linesNode
+		start  = offset
+		count  int
+		buf    = make([]byte, largeFileChunkSize)
+	)
+	for offset < lf.size {
+		n, err := lf.file.ReadAt(buf, offset)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, 0, err
+		}
+		chunk := buf[:n]
+		for {
+			i := bytes.IndexByte(chunk, '\n')
+			if i < 0 {
+				break
+			}
+			count++
+			chunk = chunk[i+1:]
+			if count == linesLeafSize {
+				end := offset + int64(n-len(chunk))
+				leaves = append(leaves, &linesNode{lazy: &lazyLeaf{lf: lf, offset: start, length: end - start, count: count}, count: count})
+				start, count = end, 0
+				if end >= limit && end < lf.size {
+					return leaves, end, nil
+				}
+			}
+		}
+		if n == 0 {
+			break
+		}
+		offset += int64(n)
+	}
+	// The last leaf contains the lines after the last full leaf, and the line after the last newline
+	leaves = append(leaves, &linesNode{lazy: &lazyLeaf{lf: lf, offset: start, length: lf.size - start, count: count + 1, last: true}, count: count + 1})
+	return leaves, lf.size, nil
+}
+
+// Lines returns the lines in this leaf, by reading them from the file, if they are not already cached.
+// If the file can not be read, or has been changed, empty lines are returned instead.
+func (ll *lazyLeaf) Lines() []string {
+	lf := ll.lf
+	lf.mut.Lock()
+	defer lf.mut.Unlock()
+	if lines, ok := lf.cache[ll]; ok {
+		return lines
+	}
+	data := make([]byte, ll.length)
+	if _, err := lf.file.ReadAt(data, ll.offset); err != nil && !errors.Is(err, io.EOF) {
+		data = data[:0]
+	}
+	lines := strings.Split(string(data), "\n")
+	if !ll.last {
+		// Skip the empty string after the final newline
+		lines = lines[:len(lines)-1]
+	}
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	// Keep the number of lines the same as when the file was indexed
+	if len(lines) > ll.count {
+		lines = lines[:ll.count:ll.count]
+	}
+	for len(lines) < ll.count {
+		lines = append(lines, "")
+	}
+	if len(lf.cacheOrder) >= largeFileCacheSize {
+		delete(lf.cache, lf.cacheOrder[0])
+		lf.cacheOrder = lf.cacheOrder[1:]
+	}
+	lf.cache[ll] = lines
+	lf.cacheOrder = append(lf.cacheOrder, ll)
+	return lines
+}
+
+// Indexed checks if the whole file has been indexed
+func (lf *LargeFile) Indexed() bool {
+	select {
+	case <-lf.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Wait waits until the whole file has been indexed
+func (lf *LargeFile) Wait() error {
+	<-lf.done
+	return lf.err
+}
+
+// Close closes the file on disk
+func (lf *LargeFile) Close() error {
+	return lf.file.Close()
+}
+
+// Changed checks if the file has been changed on disk since it was opened or last saved, either in place,
+// in which case the lines that are read from it may be wrong, or by being replaced by another file,
+// like when another program writes a new file and then renames it
+func (lf *LargeFile) Changed() bool {
+	fileInfo, err := lf.file.Stat()
+	if err != nil || fileInfo.Size() != lf.size || !fileInfo.ModTime().Equal(lf.modTime) {
+		return true
+	}
+	pathInfo, err := os.Stat(lf.filename)
+	if os.IsNotExist(err) {
+		// The file has been removed, so saving it will not overwrite anything
+		return false
+	}
+	return err != nil || !os.SameFile(pathInfo, lf.onDisk) || pathInfo.Size() != lf.onDisk.Size() || !pathInfo.ModTime().Equal(lf.onDisk.ModTime())
+}
+
+// Save writes the given lines to the given file, with the given line ending after all lines but the last one.
+// Lines that are still lazily loaded from this file are copied directly from it, without reading them in.
+// The lines are first written to a temporary file, that then replaces the given file.
+func (lf *LargeFile) Save(filename string, lines Lines, lineEnding string, fileMode os.FileMode) error {
+	if lf.Changed() {
+		return errors.New(lf.filename + " has been changed by another program, refusing to save")
+	}
+	leaves := lines.leaves()
+	err := replaceFile(filename, fileMode, func(w io.Writer) error {
+		for i, n := range leaves {
+			lastLeaf := i == len(leaves)-1
+			if ll := n.lazy; ll != nil && ll.lf == lf && lineEnding == lf.lineEnding && (!lastLeaf || ll.last) {
+				// Copy the range of the file as it is, which also keeps any mixed line endings
+				if _, err := io.Copy(w, io.NewSectionReader(lf.file, ll.offset, ll.length)); err != nil {
+					return err
+				}
+				if ll.last && !lastLeaf {
+					if _, err := io.WriteString(w, lineEnding); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			s := strings.Join(n.leafLines(), lineEnding)
+			if !lastLeaf {
+				s += lineEnding
+			}
+			if _, err := io.WriteString(w, s); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// Remember the file that was just written, so that only changes by other programs are detected
+	if filename == lf.filename {
+		if fileInfo, err := os.Stat(filename); err == nil {
+			lf.onDisk = fileInfo
+		}
+	}
+	return nil
+}
+
+// LoadLargeFile loads the given file lazily, and indexes the lines in the background.
+// Returns false if the file is not a UTF-8 text file, and must be read in the usual way.
+func (e *Editor) LoadLargeFile(filename string) (bool, error) {
+	lf, lines, err := OpenLargeFile(filename)
+	if err != nil || lf == nil {
+		return false, err
+	}
+	e.Clear()
+	e.lines = lines
+	e.largeFile = lf
+	e.largeFileIndexing = true
+	e.fileFormat = FileFormat{charset: charsetUTF8, lineEnding: lf.lineEnding}
+	e.binaryFile = false
+	e.changed.Store(true)
+	return true, nil
+}
+
+// MergeLargeFileIndex adds the lines that have been indexed in the background, if the indexing is done.
+// If wait is true, it waits for the indexing to complete first. Returns true if lines were added.
+func (e *Editor) MergeLargeFileIndex(wait bool) bool {
+	lf := e.largeFile
+	if lf == nil || !e.largeFileIndexing {
+		return false
+	}
+	if wait {
+		lf.Wait()
+	} else if !lf.Indexed() {
+		return false
+	}
+	e.largeFileIndexing = false
+	e.lines.Append(lf.tail)
+	// Also add the lines to the undo base, so that they are not recorded as an edit
+	undo.mut.Lock()
+	if undo.hasBase {
+		undo.base.Append(lf.tail)
+	}
+	undo.mut.Unlock()
+	return true
+}
+
+// saveLargeFile saves a large file by copying the parts of the file that have not been changed
+func (e *Editor) saveLargeFile(c *vt100.Canvas, tty *vt100.TTY, filename string) error {
+	quitChan := Spinner(c, tty, fmt.Sprintf("Saving %s... ", filename), fmt.Sprintf("saving %s: stopped by user", filename), 200*time.Millisecond, e.ItalicsColor)
+	defer func() {
+		quitChan <- true
+	}()
+	e.MergeLargeFileIndex(true)
+	if err := e.largeFile.err; err != nil {
+		return err
+	}
+	var fileMode os.FileMode = 0o644
+	if fileInfo, err := os.Stat(filename); err == nil {
+		fileMode = fileInfo.Mode().Perm()
+	}
+	if err := e.largeFile.Save(filename, e.lines, e.fileFormat.lineEnding, fileMode); err != nil {
+		return err
+	}
+	e.changed.Store(false)
+	e.readOnly = false
+	return nil
+}
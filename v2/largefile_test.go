@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLargeFile(t *testing.T) {
+	const n = 200000
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d", i)
+	}
+	lines[n-1] = "the end"
+	filename := filepath.Join(t.TempDir(), "large.log")
+	if err := os.WriteFile(filename, []byte(strings.Join(lines, "\r\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewSimpleEditor(80)
+	if loaded, err := e.LoadLargeFile(filename); !loaded || err != nil {
+		t.Fatalf("expected the file to be loaded lazily (%v)", err)
+	}
+	defer e.largeFile.Close()
+	if e.fileFormat.lineEnding != "\r\n" {
+		t.Errorf("expected CRLF line endings, got %q", e.fileFormat.lineEnding)
+	}
+	if e.Len() >= n || e.Len()%linesLeafSize != 0 {
+		t.Errorf("expected only the first whole leaves to be indexed at first, got %d lines", e.Len())
+	}
+	e.MergeLargeFileIndex(true)
+	if e.Len() != n {
+		t.Fatalf("expected %d lines, got %d", n, e.Len())
+	}
+	if got := e.Line(n - 2); got != "line 199998" {
+		t.Errorf("expected line 199998, got %q", got)
+	}
+	if got := e.Line(n - 1); got != "the end" {
+		t.Errorf("expected the last line to be \"the end\", got %q", got)
+	}
+
+	// Modify a few lines, and save the file, which copies the unmodified lines directly
+	e.lines.Set(150000, "changed")
+	e.lines.Remove(10)
+	e.lines.Insert(n-2, "inserted")
+	lines[150000] = "changed"
+	lines = slices.Delete(lines, 10, 11)
+	lines = slices.Insert(lines, n-2, "inserted")
+	if err := e.largeFile.Save(filename, e.lines, e.fileFormat.lineEnding, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filename); string(data) != strings.Join(lines, "\r\n") {
+		t.Error("the saved file differs from the expected contents")
+	}
+	if len(e.largeFile.cache) > largeFileCacheSize {
+		t.Errorf("expected at most %d leaves to be cached, got %d", largeFileCacheSize, len(e.largeFile.cache))
+	}
+
+	// Saving again is fine, since the file was replaced and not changed in place
+	if err := e.largeFile.Save(filename, e.lines, e.fileFormat.lineEnding, 0o644); err != nil {
+		t.Error(err)
+	}
+
+	// Refuse to save if the file has been changed by another program, since the lines may then be read wrongly
+	changedFilename := filepath.Join(t.TempDir(), "changed.log")
+	if err := os.WriteFile(changedFilename, []byte("one\ntwo\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	e2 := NewSimpleEditor(80)
+	if loaded, err := e2.LoadLargeFile(changedFilename); !loaded || err != nil {
+		t.Fatalf("expected the file to be loaded lazily (%v)", err)
+	}
+	defer e2.largeFile.Close()
+	if err := os.WriteFile(changedFilename, []byte("one\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := e2.largeFile.Save(changedFilename, e2.lines, "\n", 0o644); err == nil {
+		t.Error("expected an error when saving a file that has been changed by another program")
+	}
+	if data, _ := os.ReadFile(changedFilename); string(data) != "one\n" {
+		t.Errorf("expected the changed file to be left as it is, got %q", data)
+	}
+
+	// Also refuse to save if another program has replaced the file, by writing a new file and renaming it
+	replacedFilename := filepath.Join(t.TempDir(), "replaced.log")
+	if err := os.WriteFile(replacedFilename, []byte("one\ntwo\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	e3 := NewSimpleEditor(80)
+	if loaded, err := e3.LoadLargeFile(replacedFilename); !loaded || err != nil {
+		t.Fatalf("expected the file to be loaded lazily (%v)", err)
+	}
+	defer e3.largeFile.Close()
+	if err := writeFileAtomically(replacedFilename, []byte("one\nTWO\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := e3.largeFile.Save(replacedFilename, e3.lines, "\n", 0o644); err == nil {
+		t.Error("expected an error when saving a file that has been replaced by another program")
+	}
+	if data, _ := os.ReadFile(replacedFilename); string(data) != "one\nTWO\n" {
+		t.Errorf("expected the replaced file to be left as it is, got %q", data)
+	}
+
+	// Files that are not UTF-8 are read in the usual way
+	latin1Filename := filepath.Join(t.TempDir(), "latin1.txt")
+	if err := os.WriteFile(latin1Filename, []byte("caf\xe9\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, _ := e.LoadLargeFile(latin1Filename); loaded {
+		t.Error("expected an ISO-8859-1 file to not be loaded lazily")
+	}
+}
@@ -0,0 +1,481 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	linesLeafSize = 128 // the maximum number of lines in a leaf node
+	linesNodeSize = 32  // the maximum number of children of an inner node
+)
+
+// Lines is a rope of lines, that is used for storing the contents of the editor.
+// The lines are stored as strings in the leaves of a balanced tree, where nodes are never modified
+// after they have been created. Changing, inserting or removing a line only copies the nodes on the
+// path from the root to the leaf, so copying a Lines value (for the undo buffer, for instance) is O(1),
+// and each copy only costs as much memory as the edits that have been made since.
+// When loading a file, the lines are substrings of the file contents, like the original buffer in a piece table.
+// The zero value is an empty document.
+type Lines struct {
+	root *linesNode
+}
+
+// linesNode is a node in the rope. Leaves have lines, inner nodes have children.
+// Leaves for large files may instead have a lazy reference to a range of the file, that is read when needed.
+type linesNode struct {
+	children []*linesNode
+	lines    []string
+	lazy     *lazyLeaf
+	count    int // the number of lines in this subtree
+}
+
+// leafLines returns the lines of this leaf, reading them from the file first, if needed
+func (n *linesNode) leafLines() []string {
+	if n.lazy != nil {
+		return n.lazy.Lines()
+	}
+	return n.lines
+}
+
+// NewLines creates a new Lines value from the given lines, by building a balanced tree bottom-up.
+// The given slice must not be modified afterwards.
+func NewLines(lines []string) Lines {
+	if len(lines) == 0 {
+		return Lines{}
+	}
+	var nodes []*linesNode
+	for i := 0; i < len(lines); i += linesLeafSize {
+		end := min(i+linesLeafSize, len(lines))
+		nodes = append(nodes, &linesNode{lines: lines[i:end:end], count: end - i})
+	}
+	return newLinesFromLeaves(nodes)
+}
+
+// newLinesFromLeaves creates a new Lines value from the given leaf nodes, by building a balanced tree bottom-up
+func newLinesFromLeaves(nodes []*linesNode) Lines {
+	if len(nodes) == 0 {
+		return Lines{}
+	}
+	for len(nodes) > 1 {
+		var parents []*linesNode
+		for i := 0; i < len(nodes); i += linesNodeSize {
+			end := min(i+linesNodeSize, len(nodes))
+			parent := &linesNode{children: nodes[i:end:end]}
+			for _, child := range parent.children {
+				parent.count += child.count
+			}
+			parents = append(parents, parent)
+		}
+		nodes = parents
+	}
+	return Lines{nodes[0]}
+}
+
+// LinesFromString splits the given string on newlines. The lines share memory with the given string.
+func LinesFromString(s string) Lines {
+	return NewLines(strings.Split(s, "\n"))
+}
+
+// Len returns the number of lines
+func (l *Lines) Len() int {
+	if l.root == nil {
+		return 0
+	}
+	return l.root.count
+}
+
+// Has checks if there is a line at the given index
+func (l *Lines) Has(i int) bool {
+	return i >= 0 && i < l.Len()
+}
+
+// leaf returns the leaf node that contains line i, and the index of the line within that leaf
+func (l *Lines) leaf(i int) (*linesNode, int) {
+	n := l.root
+	for n.children != nil {
+		for _, child := range n.children {
+			if i < child.count {
+				n = child
+				break
+			}
+			i -= child.count
+		}
+	}
+	return n, i
+}
+
+// Line returns line i and true, or an empty string and false if there is no such line
+func (l *Lines) Line(i int) (string, bool) {
+	if !l.Has(i) {
+		return "", false
+	}
+	n, j := l.leaf(i)
+	return n.leafLines()[j], true
+}
+
+// String returns line i, or an empty string
+func (l *Lines) String(i int) string {
+	s, _ := l.Line(i)
+	return s
+}
+
+// Runes returns line i as a new slice of runes, that can be modified by the caller.
+// Returns nil and false if there is no such line.
+func (l *Lines) Runes(i int) ([]rune, bool) {
+	s, ok := l.Line(i)
+	if !ok {
+		return nil, false
+	}
+	return []rune(s), true
+}
+
+// RuneCount returns the number of runes in line i
+func (l *Lines) RuneCount(i int) int {
+	return utf8.RuneCountInString(l.String(i))
+}
+
+// RuneAt returns rune x in line i, and true, or false if there is no such rune
+func (l *Lines) RuneAt(i, x int) (rune, bool) {
+	if x < 0 {
+		return 0, false
+	}
+	counter := 0
+	for _, r := range l.String(i) {
+		if counter == x {
+			return r, true
+		}
+		counter++
+	}
+	return 0, false
+}
+
+// set returns a copy of this subtree, where line i is replaced
+func (n *linesNode) set(i int, s string) *linesNode {
+	if n.children == nil {
+		lines := make([]string, n.count)
+		copy(lines, n.leafLines())
+		lines[i] = s
+		return &linesNode{lines: lines, count: n.count}
+	}
+	children := make([]*linesNode, len(n.children))
+	copy(children, n.children)
+	for ci, child := range children {
+		if i < child.count {
+			children[ci] = child.set(i, s)
+			break
+		}
+		i -= child.count
+	}
+	return &linesNode{children: children, count: n.count}
+}
+
+// insert returns a copy of this subtree, where s is inserted before line i.
+// If the node grows too large, it is split in two, and the second half is also returned.
+func (n *linesNode) insert(i int, s string) (*linesNode, *linesNode) {
+	if n.children == nil {
+		leafLines := n.leafLines()
+		lines := make([]string, 0, n.count+1)
+		lines = append(lines, leafLines[:i]...)
+		lines = append(lines, s)
+		lines = append(lines, leafLines[i:]...)
+		if len(lines) <= linesLeafSize {
+			return &linesNode{lines: lines, count: len(lines)}, nil
+		}
+		half := len(lines) / 2
+		return &linesNode{lines: lines[:half:half], count: half}, &linesNode{lines: lines[half:], count: len(lines) - half}
+	}
+	ci := len(n.children) - 1
+	for j, child := range n.children {
+		if i <= child.count {
+			ci = j
+			break
+		}
+		i -= child.count
+	}
+	newChild, split := n.children[ci].insert(i, s)
+	children := make([]*linesNode, 0, len(n.children)+1)
+	children = append(children, n.children[:ci]...)
+	children = append(children, newChild)
+	if split != nil {
+		children = append(children, split)
+	}
+	children = append(children, n.children[ci+1:]...)
+	if len(children) <= linesNodeSize {
+		return &linesNode{children: children, count: n.count + 1}, nil
+	}
+	half := len(children) / 2
+	first := &linesNode{children: children[:half:half]}
+	second := &linesNode{children: children[half:]}
+	for _, child := range first.children {
+		first.count += child.count
+	}
+	second.count = n.count + 1 - first.count
+	return first, second
+}
+
+// remove returns a copy of this subtree, where line i is removed, or nil if the subtree becomes empty
+func (n *linesNode) remove(i int) *linesNode {
+	if n.children == nil {
+		if n.count == 1 {
+			return nil
+		}
+		leafLines := n.leafLines()
+		lines := make([]string, 0, n.count-1)
+		lines = append(lines, leafLines[:i]...)
+		lines = append(lines, leafLines[i+1:]...)
+		return &linesNode{lines: lines, count: len(lines)}
+	}
+	children := make([]*linesNode, 0, len(n.children))
+	for ci, child := range n.children {
+		if i >= 0 && i < child.count {
+			if newChild := child.remove(i); newChild != nil {
+				children = append(children, newChild)
+			}
+			children = append(children, n.children[ci+1:]...)
+			break
+		}
+		i -= child.count
+		children = append(children, child)
+	}
+	if len(children) == 0 {
+		return nil
+	}
+	return &linesNode{children: children, count: n.count - 1}
+}
+
+// truncate returns a copy of this subtree, with only the first k lines
+func (n *linesNode) truncate(k int) *linesNode {
+	if n.children == nil {
+		return &linesNode{lines: n.leafLines()[:k:k], count: k}
+	}
+	var children []*linesNode
+	count := 0
+	for _, child := range n.children {
+		if count+child.count <= k {
+			children = append(children, child)
+			count += child.count
+			continue
+		}
+		if rest := k - count; rest > 0 {
+			children = append(children, child.truncate(rest))
+			count += rest
+		}
+		break
+	}
+	return &linesNode{children: children, count: count}
+}
+
+// Set replaces line i with the given string.
+// If i is after the last line, empty lines are added up to line i.
+func (l *Lines) Set(i int, s string) {
+	if i < 0 {
+		return
+	}
+	for l.Len() < i {
+		l.Insert(l.Len(), "")
+	}
+	if i == l.Len() {
+		l.Insert(i, s)
+		return
+	}
+	l.root = l.root.set(i, s)
+}
+
+// SetRunes replaces line i with the given runes
+func (l *Lines) SetRunes(i int, runes []rune) {
+	l.Set(i, string(runes))
+}
+
+// Insert inserts a line before line i, so that the new line gets index i.
+// If i is the number of lines, the line is added at the end.
+func (l *Lines) Insert(i int, s string) {
+	if i < 0 || i > l.Len() {
+		return
+	}
+	if l.root == nil {
+		l.root = &linesNode{lines: []string{s}, count: 1}
+		return
+	}
+	first, second := l.root.insert(i, s)
+	if second == nil {
+		l.root = first
+		return
+	}
+	l.root = &linesNode{children: []*linesNode{first, second}, count: first.count + second.count}
+}
+
+// Append adds the given lines at the end, without copying any of the nodes
+func (l *Lines) Append(other Lines) {
+	switch {
+	case other.root == nil:
+	case l.root == nil:
+		l.root = other.root
+	default:
+		l.root = &linesNode{children: []*linesNode{l.root, other.root}, count: l.root.count + other.root.count}
+	}
+}
+
+// Remove removes line i, and moves all lines after it one step up
+func (l *Lines) Remove(i int) {
+	if !l.Has(i) {
+		return
+	}
+	l.root = l.root.remove(i)
+	// Make the tree shallower if the root only has one child
+	for l.root != nil && len(l.root.children) == 1 {
+		l.root = l.root.children[0]
+	}
+}
+
+// Truncate removes all lines from line n and out
+func (l *Lines) Truncate(n int) {
+	switch {
+	case n <= 0:
+		l.root = nil
+	case n < l.Len():
+		l.root = l.root.truncate(n)
+	}
+}
+
+// Each calls the given function for each line, in order, until the function returns false
+func (l *Lines) Each(f func(i int, s string) bool) {
+	if l.root == nil {
+		return
+	}
+	i := 0
+	var walk func(n *linesNode) bool
+	walk = func(n *linesNode) bool {
+		if n.children == nil {
+			for _, s := range n.leafLines() {
+				if !f(i, s) {
+					return false
+				}
+				i++
+			}
+			return true
+		}
+		for _, child := range n.children {
+			if !walk(child) {
+				return false
+			}
+		}
+		return true
+	}
+	walk(l.root)
+}
+
+// Strings returns all lines as a slice of strings
+func (l *Lines) Strings() []string {
+	lines := make([]string, 0, l.Len())
+	l.Each(func(_ int, s string) bool {
+		lines = append(lines, s)
+		return true
+	})
+	return lines
+}
+
+// Bytes returns the number of bytes used by the lines (not including the newlines)
+func (l *Lines) Bytes() uint64 {
+	var sum uint64
+	l.Each(func(_ int, s string) bool {
+		sum += uint64(len(s))
+		return true
+	})
+	return sum
+}
+
+// Slice returns the lines from line i up to, but not including, line j
+func (l *Lines) Slice(i, j int) []string {
+	i, j = max(i, 0), min(j, l.Len())
+	if i >= j {
+		return nil
+	}
+	lines := make([]string, 0, j-i)
+	for k := i; k < j; k++ {
+		lines = append(lines, l.String(k))
+	}
+	return lines
+}
+
+// Replace replaces n lines, starting at line i, with the given lines
+func (l *Lines) Replace(i, n int, lines []string) {
+	for k := 0; k < n && l.Has(i); k++ {
+		l.Remove(i)
+	}
+	for k, s := range lines {
+		l.Insert(i+k, s)
+	}
+}
+
+// leaves returns all leaf nodes, in order
+func (l *Lines) leaves() []*linesNode {
+	var leaves []*linesNode
+	var walk func(n *linesNode)
+	walk = func(n *linesNode) {
+		if n.children == nil {
+			leaves = append(leaves, n)
+			return
+		}
+		for _, child := range n.children {
+			walk(child)
+		}
+	}
+	if l.root != nil {
+		walk(l.root)
+	}
+	return leaves
+}
+
+// diffLines finds the range of lines that differs between a and b.
+// Lines [start, aEnd) in a have been replaced by lines [start, bEnd) in b.
+// Leaves that are shared between a and b are skipped without comparing the lines in them.
+func diffLines(a, b *Lines) (start, aEnd, bEnd int) {
+	la, lb := a.leaves(), b.leaves()
+	// Find the length of the common prefix
+	ia, ib, oa, ob := 0, 0, 0, 0
+	for ia < len(la) && ib < len(lb) {
+		if oa == 0 && ob == 0 && la[ia] == lb[ib] {
+			start += la[ia].count
+			ia++
+			ib++
+			continue
+		}
+		if la[ia].leafLines()[oa] != lb[ib].leafLines()[ob] {
+			break
+		}
+		start++
+		if oa++; oa == la[ia].count {
+			ia, oa = ia+1, 0
+		}
+		if ob++; ob == lb[ib].count {
+			ib, ob = ib+1, 0
+		}
+	}
+	// Find the length of the common suffix, that does not overlap with the prefix
+	var (
+		maxSuffix = min(a.Len(), b.Len()) - start
+		suffix    int
+		ja, jb    = len(la) - 1, len(lb) - 1
+		ra, rb    int // the number of lines that have been compared at the end of leaf ja and jb
+	)
+	for suffix < maxSuffix && ja >= 0 && jb >= 0 {
+		if ra == 0 && rb == 0 && la[ja] == lb[jb] && suffix+la[ja].count <= maxSuffix {
+			suffix += la[ja].count
+			ja--
+			jb--
+			continue
+		}
+		if la[ja].leafLines()[la[ja].count-1-ra] != lb[jb].leafLines()[lb[jb].count-1-rb] {
+			break
+		}
+		suffix++
+		if ra++; ra == la[ja].count {
+			ja, ra = ja-1, 0
+		}
+		if rb++; rb == lb[jb].count {
+			jb, rb = jb-1, 0
+		}
+	}
+	return start, a.Len() - suffix, b.Len() - suffix
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	var l Lines
+	if l.Len() != 0 || l.Has(0) {
+		t.Fatalf("expected the zero value to be empty")
+	}
+	// Set past the end pads with empty lines
+	l.Set(2, "c")
+	if l.Len() != 3 || l.String(0) != "" || l.String(2) != "c" {
+		t.Fatalf("unexpected lines: %q", l.Strings())
+	}
+	l.Set(0, "a")
+	l.Set(1, "b")
+	l.Insert(1, "x")
+	if got := strings.Join(l.Strings(), ","); got != "a,x,b,c" {
+		t.Errorf("unexpected lines after insert: %s", got)
+	}
+	l.Remove(1)
+	if got := strings.Join(l.Strings(), ","); got != "a,b,c" {
+		t.Errorf("unexpected lines after remove: %s", got)
+	}
+	l.Truncate(2)
+	if got := strings.Join(l.Strings(), ","); got != "a,b" {
+		t.Errorf("unexpected lines after truncate: %s", got)
+	}
+	if r, ok := l.RuneAt(1, 0); !ok || r != 'b' {
+		t.Errorf("expected b, got %c", r)
+	}
+	if _, ok := l.RuneAt(1, 1); ok {
+		t.Errorf("expected no rune after the end of the line")
+	}
+}
+
+func TestLinesLarge(t *testing.T) {
+	const n = 10000
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d", i)
+	}
+	l := NewLines(lines)
+
+	// Take a snapshot, then modify the lines, enough to split and merge nodes
+	snapshot := l
+	for i := 0; i < 1000; i++ {
+		l.Insert(500, "inserted")
+	}
+	for i := 0; i < 2000; i++ {
+		l.Remove(0)
+	}
+	l.Set(0, "changed")
+
+	if l.Len() != n-1000 {
+		t.Fatalf("expected %d lines, got %d", n-1000, l.Len())
+	}
+	if l.String(0) != "changed" || l.String(l.Len()-1) != fmt.Sprintf("line %d", n-1) {
+		t.Errorf("unexpected first or last line: %q, %q", l.String(0), l.String(l.Len()-1))
+	}
+	// 2000 lines were removed from the top, of which 1000 were inserted, so original line 2000 is now line 1000
+	if s := l.String(1000); s != "line 2000" {
+		t.Errorf("expected line 2000, got %q", s)
+	}
+
+	// The snapshot must not be affected by the changes
+	if snapshot.Len() != n {
+		t.Fatalf("expected the snapshot to have %d lines, got %d", n, snapshot.Len())
+	}
+	for i, s := range snapshot.Strings() {
+		if s != lines[i] {
+			t.Fatalf("the snapshot was modified at line %d: %q", i, s)
+		}
+	}
+}
+
+func TestEditorLines(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.LoadBytes([]byte("abc\ndef\nghi\n"))
+	if e.Len() != 3 || e.Line(1) != "def" {
+		t.Fatalf("unexpected contents: %q", e.String())
+	}
+	e.Set(5, 0, 'x')
+	if e.Line(0) != "abc  x" {
+		t.Errorf("unexpected line after Set: %q", e.Line(0))
+	}
+	if e.Get(1, 2) != 'h' || e.Get(10, 2) != ' ' {
+		t.Errorf("unexpected result from Get")
+	}
+	e.InsertLineBelowAt(0)
+	e.DeleteLine(2)
+	if got := e.String(); got != "abc  x\n\nghi\n" {
+		t.Errorf("unexpected contents: %q", got)
+	}
+}
+
+// multiMegabyteLines returns the lines of a document of roughly the given size, with 80 columns
+func multiMegabyteLines(size int) []byte {
+	var sb strings.Builder
+	line := strings.Repeat("abcdefghij", 8)
+	for sb.Len() < size {
+		sb.WriteString(line)
+		sb.WriteByte('\n')
+	}
+	return []byte(sb.String())
+}
+
+// loadLineMap loads data the way the editor used to, into a map of rune slices
+func loadLineMap(data []byte) map[int][]rune {
+	m := make(map[int][]rune)
+	for i, line := range strings.Split(string(data), "\n") {
+		m[i] = []rune(line)
+	}
+	return m
+}
+
+// copyLineMap deep-copies a map of rune slices, the way the undo buffer used to
+func copyLineMap(m map[int][]rune) map[int][]rune {
+	m2 := make(map[int][]rune, len(m))
+	for k, runes := range m {
+		runes2 := make([]rune, len(runes))
+		copy(runes2, runes)
+		m2[k] = runes2
+	}
+	return m2
+}
+
+var benchmarkSizes = []int{1 << 20, 8 << 20}
+
+func BenchmarkLoadLineMap(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		data := multiMegabyteLines(size)
+		b.Run(fmt.Sprintf("%dMB", size>>20), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				_ = loadLineMap(data)
+			}
+		})
+	}
+}
+
+func BenchmarkLoadLines(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		data := multiMegabyteLines(size)
+		b.Run(fmt.Sprintf("%dMB", size>>20), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				_ = LinesFromString(string(data))
+			}
+		})
+	}
+}
+
+// BenchmarkEditAndSnapshotLineMap changes a line and takes an undo snapshot, the way the editor used to
+func BenchmarkEditAndSnapshotLineMap(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		m := loadLineMap(multiMegabyteLines(size))
+		b.Run(fmt.Sprintf("%dMB", size>>20), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				y := (i * 7919) % len(m)
+				m[y] = append(m[y][:0], []rune("changed")...)
+				_ = copyLineMap(m)
+			}
+		})
+	}
+}
+
+// BenchmarkEditAndSnapshotLines changes a line and takes an undo snapshot
+func BenchmarkEditAndSnapshotLines(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		l := LinesFromString(string(multiMegabyteLines(size)))
+		b.Run(fmt.Sprintf("%dMB", size>>20), func(b *testing.B) {
+			b.ReportAllocs()
+			snapshots := make([]Lines, 0, b.N)
+			for i := 0; i < b.N; i++ {
+				l.Set((i*7919)%l.Len(), "changed")
+				snapshots = append(snapshots, l)
+			}
+		})
+	}
+}
+
+// BenchmarkUndoMemoryFootprint reports the memory used by 100 undo snapshots with one change each
+func BenchmarkUndoMemoryFootprint(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		data := multiMegabyteLines(size)
+		b.Run(fmt.Sprintf("%dMB", size>>20), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				u := NewUndo(100, 0)
+				e := NewSimpleEditor(80)
+				e.LoadBytes(data)
+				for j := 0; j < 100; j++ {
+					e.SetLine(LineIndex(j*100), "changed")
+					u.Snapshot(e)
+				}
+				b.ReportMetric(float64(u.MemoryFootprint()), "undo-bytes")
+			}
+		})
+	}
+}
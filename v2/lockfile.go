@@ -74,9 +74,19 @@ func (lk *LockKeeper) Save() error {
 	return err
 }
 
+// lockName returns the filename that is used when locking the given file.
+// Files within an archive share the lock of the archive, since saving one of them rewrites the whole archive.
+func lockName(filename string) string {
+	if archive, ok := splitArchivePath(filename); ok {
+		return archive.archiveFilename
+	}
+	return filename
+}
+
 // Lock marks the given absolute filename as locked.
 // If the file is already locked, an error is returned.
 func (lk *LockKeeper) Lock(filename string) error {
+	filename = lockName(filename)
 
 	// TODO: Make sure not to lock "-" or "/dev/*" files
 
@@ -100,6 +110,7 @@ func (lk *LockKeeper) Lock(filename string) error {
 // Unlock marks the given absolute filename as unlocked.
 // If the file is already unlocked, an error is returned.
 func (lk *LockKeeper) Unlock(filename string) error {
+	filename = lockName(filename)
 	var has bool
 	lk.mut.RLock()
 	_, has = lk.lockedFiles[filename]
@@ -120,6 +131,7 @@ func (lk *LockKeeper) Unlock(filename string) error {
 
 // GetTimestamp assumes that the file is locked. A blank timestamp may be returned if not.
 func (lk *LockKeeper) GetTimestamp(filename string) time.Time {
+	filename = lockName(filename)
 	var timestamp time.Time
 
 	lk.mut.RLock()
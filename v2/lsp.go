@@ -0,0 +1,886 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+
+	"github.com/xyproto/env/v2"
+	"github.com/xyproto/files"
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+const (
+	lspRequestTimeout     = 3 * time.Second        // how long to wait for a reply from the language server
+	lspInitializeTimeout  = 10 * time.Second       // some language servers are slow to start
+	lspDiagnosticsTimeout = 800 * time.Millisecond // how long to wait for diagnostics after saving
+	lspSyncInterval       = time.Second            // how often the text is sent to the language server while editing
+)
+
+var (
+	// lspServers lists the language server commands that are tried for each mode, in order
+	lspServers = map[mode.Mode][][]string{
+		mode.C:          {{"clangd"}},
+		mode.Cpp:        {{"clangd"}},
+		mode.Go:         {{"gopls"}},
+		mode.Haskell:    {{"haskell-language-server-wrapper", "--lsp"}},
+		mode.JavaScript: {{"typescript-language-server", "--stdio"}},
+		mode.Lua:        {{"lua-language-server"}},
+		mode.OCaml:      {{"ocamllsp"}},
+		mode.Python:     {{"pyright-langserver", "--stdio"}, {"pylsp"}},
+		mode.Rust:       {{"rust-analyzer"}},
+		mode.Shell:      {{"bash-language-server", "start"}},
+		mode.TypeScript: {{"typescript-language-server", "--stdio"}},
+		mode.Zig:        {{"zls"}},
+	}
+
+	// lspLanguageIDs maps from a mode to a language identifier, as used by the Language Server Protocol
+	lspLanguageIDs = map[mode.Mode]string{
+		mode.C:          "c",
+		mode.Cpp:        "cpp",
+		mode.Go:         "go",
+		mode.Haskell:    "haskell",
+		mode.JavaScript: "javascript",
+		mode.Lua:        "lua",
+		mode.OCaml:      "ocaml",
+		mode.Python:     "python",
+		mode.Rust:       "rust",
+		mode.Shell:      "shellscript",
+		mode.TypeScript: "typescript",
+		mode.Zig:        "zig",
+	}
+
+	// lspRootMarkers are filenames that indicate the root directory of a project
+	lspRootMarkers = []string{"go.mod", "Cargo.toml", "compile_commands.json", "pyproject.toml", "setup.py", "package.json", "build.zig", "dune-project", ".git"}
+
+	// lspClients holds the language servers that are running or starting, with "command@rootdir" as the key
+	lspClients    = make(map[string]*lspServer)
+	lspClientsMut sync.Mutex
+
+	// lspLastSync is when the text was last sent to the language server while editing
+	lspLastSync time.Time
+
+	// noLSP can be set to disable the use of language servers
+	noLSP = env.Bool("NO_LSP")
+
+	errNoLSPServer = errors.New("no language server available")
+)
+
+// LSPPosition is a zero-based line and character offset, where the character offset is counted in UTF-16 code units
+type LSPPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// LSPRange is a range within a text document
+type LSPRange struct {
+	Start LSPPosition `json:"start"`
+	End   LSPPosition `json:"end"`
+}
+
+// LSPLocation is a range within a document, given by an URI
+type LSPLocation struct {
+	URI   string   `json:"uri"`
+	Range LSPRange `json:"range"`
+}
+
+// LSPDiagnostic is an error, warning or hint from the language server
+type LSPDiagnostic struct {
+	Range    LSPRange `json:"range"`
+	Severity int      `json:"severity"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+// lspMessage is used both for incoming responses, notifications and requests
+type lspMessage struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *lspError        `json:"error,omitempty"`
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (le *lspError) Error() string {
+	return fmt.Sprintf("language server error %d: %s", le.Code, le.Message)
+}
+
+// LSPClient is a client for a language server that is running as a separate process,
+// communicating with JSON-RPC over stdin and stdout.
+type LSPClient struct {
+	cmd             *exec.Cmd
+	w               io.WriteCloser
+	r               *bufio.Reader
+	pending         map[int]chan lspMessage
+	diagnostics     map[string][]LSPDiagnostic // diagnostics per document URI
+	diagnosticsTime map[string]time.Time       // when the diagnostics were last received, per document URI
+	documents       map[string]string          // the last text that was sent, per document URI
+	versions        map[string]int             // document versions, per document URI
+	done            chan struct{}
+	rootDir         string
+	nextID          int
+	mut             sync.Mutex
+	writeMut        sync.Mutex
+}
+
+// newLSPClient prepares a new LSPClient that writes requests to w and reads responses from r,
+// then starts reading messages in the background.
+func newLSPClient(w io.WriteCloser, r io.Reader, rootDir string) *LSPClient {
+	lc := &LSPClient{
+		w:               w,
+		r:               bufio.NewReader(r),
+		pending:         make(map[int]chan lspMessage),
+		diagnostics:     make(map[string][]LSPDiagnostic),
+		diagnosticsTime: make(map[string]time.Time),
+		documents:       make(map[string]string),
+		versions:        make(map[string]int),
+		done:            make(chan struct{}),
+		rootDir:         rootDir,
+	}
+	go lc.readLoop()
+	return lc
+}
+
+// StartLSPClient starts the given language server command in the given project directory,
+// and performs the initialize handshake.
+func StartLSPClient(command []string, rootDir string) (*LSPClient, error) {
+	if len(command) == 0 {
+		return nil, errNoLSPServer
+	}
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Dir = rootDir
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	// Language servers can be chatty on stderr, discard it
+	cmd.Stderr = nil
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	lc := newLSPClient(stdin, stdout, rootDir)
+	lc.cmd = cmd
+	if err := lc.Initialize(); err != nil {
+		lc.Shutdown()
+		return nil, err
+	}
+	return lc, nil
+}
+
+// writeMessage writes a single JSON-RPC message, with a Content-Length header
+func (lc *LSPClient) writeMessage(msg any) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	lc.writeMut.Lock()
+	defer lc.writeMut.Unlock()
+	if _, err := fmt.Fprintf(lc.w, "Content-Length: %d\r\n\r\n", len(data)); err != nil {
+		return err
+	}
+	_, err = lc.w.Write(data)
+	return err
+}
+
+// readLSPMessage reads a single JSON-RPC message, with headers
+func readLSPMessage(r *bufio.Reader) ([]byte, error) {
+	contentLength := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			if contentLength, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if contentLength < 0 {
+		return nil, errors.New("missing Content-Length header")
+	}
+	data := make([]byte, contentLength)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// readLoop reads messages from the language server until the connection is closed
+func (lc *LSPClient) readLoop() {
+	defer close(lc.done)
+	for {
+		data, err := readLSPMessage(lc.r)
+		if err != nil {
+			return
+		}
+		var msg lspMessage
+		if json.Unmarshal(data, &msg) != nil {
+			continue
+		}
+		switch {
+		case msg.ID != nil && msg.Method != "":
+			// A request from the server, like "workspace/configuration". Reply with an empty result,
+			// without blocking the reading of messages.
+			go lc.writeMessage(map[string]any{"jsonrpc": "2.0", "id": msg.ID, "result": nil})
+		case msg.ID != nil:
+			var id int
+			if json.Unmarshal(*msg.ID, &id) != nil {
+				continue
+			}
+			lc.mut.Lock()
+			ch, ok := lc.pending[id]
+			delete(lc.pending, id)
+			lc.mut.Unlock()
+			if ok {
+				ch <- msg
+			}
+		case msg.Method == "textDocument/publishDiagnostics":
+			var params struct {
+				URI         string          `json:"uri"`
+				Diagnostics []LSPDiagnostic `json:"diagnostics"`
+			}
+			if json.Unmarshal(msg.Params, &params) != nil {
+				continue
+			}
+			lc.mut.Lock()
+			lc.diagnostics[params.URI] = params.Diagnostics
+			lc.diagnosticsTime[params.URI] = time.Now()
+			lc.mut.Unlock()
+		}
+	}
+}
+
+// Call sends a request to the language server and waits for the result
+func (lc *LSPClient) Call(method string, params any, timeout time.Duration) (json.RawMessage, error) {
+	ch := make(chan lspMessage, 1)
+	lc.mut.Lock()
+	lc.nextID++
+	id := lc.nextID
+	lc.pending[id] = ch
+	lc.mut.Unlock()
+	if err := lc.writeMessage(map[string]any{"jsonrpc": "2.0", "id": id, "method": method, "params": params}); err != nil {
+		lc.mut.Lock()
+		delete(lc.pending, id)
+		lc.mut.Unlock()
+		return nil, err
+	}
+	select {
+	case msg := <-ch:
+		if msg.Error != nil {
+			return nil, msg.Error
+		}
+		return msg.Result, nil
+	case <-lc.done:
+		return nil, errors.New("the language server stopped")
+	case <-time.After(timeout):
+		lc.mut.Lock()
+		delete(lc.pending, id)
+		lc.mut.Unlock()
+		return nil, errors.New(method + " timed out")
+	}
+}
+
+// Notify sends a notification to the language server, without waiting for a reply
+func (lc *LSPClient) Notify(method string, params any) error {
+	return lc.writeMessage(map[string]any{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+// Initialize performs the initialize handshake with the language server
+func (lc *LSPClient) Initialize() error {
+	params := map[string]any{
+		"processId": os.Getpid(),
+		"rootUri":   pathToURI(lc.rootDir),
+		"workspaceFolders": []map[string]string{
+			{"uri": pathToURI(lc.rootDir), "name": filepath.Base(lc.rootDir)},
+		},
+		"capabilities": map[string]any{
+			"textDocument": map[string]any{
+				"synchronization":    map[string]any{"didSave": true},
+				"definition":         map[string]any{"linkSupport": true},
+				"references":         map[string]any{},
+				"hover":              map[string]any{"contentFormat": []string{"plaintext", "markdown"}},
+				"publishDiagnostics": map[string]any{},
+			},
+		},
+	}
+	if _, err := lc.Call("initialize", params, lspInitializeTimeout); err != nil {
+		return err
+	}
+	return lc.Notify("initialized", map[string]any{})
+}
+
+// Shutdown asks the language server to shut down and then stops the process
+func (lc *LSPClient) Shutdown() {
+	select {
+	case <-lc.done:
+	default:
+		lc.Call("shutdown", nil, lspRequestTimeout)
+		lc.Notify("exit", nil)
+	}
+	lc.w.Close()
+	if lc.cmd != nil && lc.cmd.Process != nil {
+		select {
+		case <-lc.done:
+		case <-time.After(lspRequestTimeout):
+			lc.cmd.Process.Kill()
+		}
+		lc.cmd.Wait()
+	}
+}
+
+// SyncDocument sends the given text to the language server, either with textDocument/didOpen
+// (if this is the first time) or with textDocument/didChange (if the text has changed).
+func (lc *LSPClient) SyncDocument(uri, languageID, text string) error {
+	lc.mut.Lock()
+	prevText, opened := lc.documents[uri]
+	if opened && prevText == text {
+		lc.mut.Unlock()
+		return nil
+	}
+	lc.documents[uri] = text
+	lc.versions[uri]++
+	version := lc.versions[uri]
+	lc.mut.Unlock()
+	if !opened {
+		return lc.Notify("textDocument/didOpen", map[string]any{
+			"textDocument": map[string]any{"uri": uri, "languageId": languageID, "version": version, "text": text},
+		})
+	}
+	return lc.Notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": uri, "version": version},
+		"contentChanges": []map[string]string{{"text": text}},
+	})
+}
+
+// DidSave notifies the language server that the document was saved
+func (lc *LSPClient) DidSave(uri string) error {
+	return lc.Notify("textDocument/didSave", map[string]any{"textDocument": map[string]string{"uri": uri}})
+}
+
+// textDocumentPosition returns parameters that are used by several textDocument requests
+func textDocumentPosition(uri string, pos LSPPosition) map[string]any {
+	return map[string]any{"textDocument": map[string]string{"uri": uri}, "position": pos}
+}
+
+// Definition returns the locations where the symbol at the given position is defined
+func (lc *LSPClient) Definition(uri string, pos LSPPosition) ([]LSPLocation, error) {
+	result, err := lc.Call("textDocument/definition", textDocumentPosition(uri, pos), lspRequestTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return parseLSPLocations(result)
+}
+
+// References returns the locations where the symbol at the given position is used
+func (lc *LSPClient) References(uri string, pos LSPPosition) ([]LSPLocation, error) {
+	params := textDocumentPosition(uri, pos)
+	params["context"] = map[string]bool{"includeDeclaration": true}
+	result, err := lc.Call("textDocument/references", params, lspRequestTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return parseLSPLocations(result)
+}
+
+// Hover returns a plain text description of the symbol at the given position
+func (lc *LSPClient) Hover(uri string, pos LSPPosition) (string, error) {
+	result, err := lc.Call("textDocument/hover", textDocumentPosition(uri, pos), lspRequestTimeout)
+	if err != nil {
+		return "", err
+	}
+	var hover struct {
+		Contents json.RawMessage `json:"contents"`
+	}
+	if len(result) == 0 || string(result) == "null" {
+		return "", nil
+	}
+	if err := json.Unmarshal(result, &hover); err != nil {
+		return "", err
+	}
+	return parseLSPHoverContents(hover.Contents), nil
+}
+
+// Diagnostics returns the latest diagnostics that were published for the given document URI
+func (lc *LSPClient) Diagnostics(uri string) []LSPDiagnostic {
+	lc.mut.Lock()
+	defer lc.mut.Unlock()
+	return lc.diagnostics[uri]
+}
+
+// WaitForDiagnostics waits until diagnostics for the given URI has been received after the given time, or until the timeout
+func (lc *LSPClient) WaitForDiagnostics(uri string, after time.Time, timeout time.Duration) ([]LSPDiagnostic, bool) {
+	deadline := time.Now().Add(timeout)
+	for {
+		lc.mut.Lock()
+		received, diagnostics := lc.diagnosticsTime[uri], lc.diagnostics[uri]
+		lc.mut.Unlock()
+		if received.After(after) {
+			return diagnostics, true
+		}
+		if time.Now().After(deadline) {
+			return diagnostics, false
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// parseLSPLocations can parse a Location, a list of Location or a list of LocationLink
+func parseLSPLocations(result json.RawMessage) ([]LSPLocation, error) {
+	if len(result) == 0 || string(result) == "null" {
+		return nil, nil
+	}
+	var location LSPLocation
+	if json.Unmarshal(result, &location) == nil && location.URI != "" {
+		return []LSPLocation{location}, nil
+	}
+	var links []struct {
+		LSPLocation
+		TargetURI            string   `json:"targetUri"`
+		TargetSelectionRange LSPRange `json:"targetSelectionRange"`
+	}
+	if err := json.Unmarshal(result, &links); err != nil {
+		return nil, err
+	}
+	locations := make([]LSPLocation, 0, len(links))
+	for _, link := range links {
+		if link.TargetURI != "" {
+			locations = append(locations, LSPLocation{link.TargetURI, link.TargetSelectionRange})
+		} else if link.URI != "" {
+			locations = append(locations, link.LSPLocation)
+		}
+	}
+	return locations, nil
+}
+
+// parseLSPHoverContents can parse MarkupContent, MarkedString or a list of MarkedString
+func parseLSPHoverContents(contents json.RawMessage) string {
+	var s string
+	if json.Unmarshal(contents, &s) == nil {
+		return strings.TrimSpace(s)
+	}
+	var marked struct {
+		Value string `json:"value"`
+	}
+	if json.Unmarshal(contents, &marked) == nil && marked.Value != "" {
+		return strings.TrimSpace(marked.Value)
+	}
+	var list []json.RawMessage
+	if json.Unmarshal(contents, &list) == nil {
+		var parts []string
+		for _, item := range list {
+			if part := parseLSPHoverContents(item); part != "" {
+				parts = append(parts, part)
+			}
+		}
+		return strings.Join(parts, "\n")
+	}
+	return ""
+}
+
+// pathToURI converts an absolute path to a file:// URI
+func pathToURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// uriToPath converts a file:// URI to a path
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return strings.TrimPrefix(uri, "file://")
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+// utf16Offset converts a rune index within the given line to a character offset in UTF-16 code units
+func utf16Offset(line string, runeIndex int) int {
+	runes := []rune(line)
+	if runeIndex > len(runes) {
+		runeIndex = len(runes)
+	}
+	return len(utf16.Encode(runes[:runeIndex]))
+}
+
+// runeOffset converts a character offset in UTF-16 code units to a rune index within the given line
+func runeOffset(line string, utf16Index int) int {
+	counter := 0
+	for i, r := range []rune(line) {
+		if counter >= utf16Index {
+			return i
+		}
+		counter += utf16.RuneLen(r)
+	}
+	return len([]rune(line))
+}
+
+// lspRootDir finds the project root for the given file, by looking for files like go.mod or Cargo.toml
+func lspRootDir(absFilename string) string {
+	fileDir := filepath.Dir(absFilename)
+	for dir := fileDir; ; dir = filepath.Dir(dir) {
+		for _, marker := range lspRootMarkers {
+			if files.Exists(filepath.Join(dir, marker)) {
+				return dir
+			}
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			break
+		}
+	}
+	return fileDir
+}
+
+// LSPServerCommand returns the command for the first language server that is installed for the current mode, or nil
+func (e *Editor) LSPServerCommand() []string {
+	if noLSP {
+		return nil
+	}
+	for _, command := range lspServers[e.mode] {
+		if files.WhichCached(command[0]) != "" {
+			return command
+		}
+	}
+	return nil
+}
+
+// lspServer is a language server that is either starting or running
+type lspServer struct {
+	lc    *LSPClient
+	err   error         // an error that occurred while starting the server
+	ready chan struct{} // closed when the server has started, or failed to start
+}
+
+// lspServerFor returns the language server for the given command and project directory, which may still be starting.
+// If the server is not running, it is started in the background if start is true, or else nil is returned.
+// The lock is not held while the server starts, since that can take up to lspInitializeTimeout.
+func lspServerFor(command []string, rootDir string, start bool) *lspServer {
+	key := strings.Join(command, " ") + "@" + rootDir
+
+	lspClientsMut.Lock()
+	defer lspClientsMut.Unlock()
+	if server, ok := lspClients[key]; ok {
+		select {
+		case <-server.ready:
+			if server.err == nil {
+				select {
+				case <-server.lc.done: // the server has stopped, start a new one
+				default:
+					return server
+				}
+			}
+			delete(lspClients, key)
+		default: // the server is still starting
+			return server
+		}
+	}
+	if !start {
+		return nil
+	}
+	server := &lspServer{ready: make(chan struct{})}
+	lspClients[key] = server
+	go func() {
+		server.lc, server.err = StartLSPClient(command, rootDir)
+		close(server.ready)
+	}()
+	return server
+}
+
+// lspClient returns the language server client for the given command and project directory.
+// If start is true, the server is started if needed, and this waits until it is ready.
+// If start is false and the server is not running and ready, errNoLSPServer is returned right away.
+func lspClient(command []string, rootDir string, start bool) (*LSPClient, error) {
+	server := lspServerFor(command, rootDir, start)
+	if server == nil {
+		return nil, errNoLSPServer
+	}
+	if !start {
+		select {
+		case <-server.ready:
+		default:
+			return nil, errNoLSPServer
+		}
+	}
+	<-server.ready
+	return server.lc, server.err
+}
+
+// LSPStartInBackground starts the language server for the current file in the background, if it is not already
+// running, so that it is ready by the time it is needed
+func (e *Editor) LSPStartInBackground() {
+	command := e.LSPServerCommand()
+	if command == nil {
+		return
+	}
+	absFilename, err := e.AbsFilename()
+	if err != nil {
+		return
+	}
+	lspServerFor(command, lspRootDir(absFilename), true)
+}
+
+// LSPSync returns a language server client where the current text has been sent, together with the document URI.
+// The language server is started if needed, and this waits until it is ready.
+func (e *Editor) LSPSync() (*LSPClient, string, error) {
+	return e.lspSync(true)
+}
+
+// lspSync sends the current text to the language server, and returns the client and the document URI.
+// If start is false and the language server is not running and ready, errNoLSPServer is returned right away.
+func (e *Editor) lspSync(start bool) (*LSPClient, string, error) {
+	command := e.LSPServerCommand()
+	if command == nil {
+		return nil, "", errNoLSPServer
+	}
+	absFilename, err := e.AbsFilename()
+	if err != nil {
+		return nil, "", err
+	}
+	lc, err := lspClient(command, lspRootDir(absFilename), start)
+	if err != nil {
+		return nil, "", err
+	}
+	uri := pathToURI(absFilename)
+	if err := lc.SyncDocument(uri, lspLanguageIDs[e.mode], e.String()); err != nil {
+		return nil, "", err
+	}
+	return lc, uri, nil
+}
+
+// LSPPosition returns the current cursor position, as used by the Language Server Protocol
+func (e *Editor) LSPPosition() LSPPosition {
+	x, _ := e.DataX()
+	return LSPPosition{int(e.DataY()), utf16Offset(e.CurrentLine(), x)}
+}
+
+// LSPGoToLocation jumps to the given location, switching files if needed, and pushes a function for going back
+func (e *Editor) LSPGoToLocation(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, location LSPLocation) {
+	oldFilename := e.filename
+	oldLineIndex := e.LineIndex()
+
+	targetFilename := uriToPath(location.URI)
+	if absFilename, err := e.AbsFilename(); err == nil && absFilename != targetFilename {
+		if err := e.Switch(c, tty, status, fileLock, targetFilename); err != nil {
+			status.SetError(err)
+			status.Show(c, e)
+			return
+		}
+	}
+
+	y := LineIndex(location.Range.Start.Line)
+	x := ColIndex(runeOffset(e.Line(y), location.Range.Start.Character))
+	const center = true
+	const handleTabExpansion = true
+	e.redraw.Store(e.GoToLineIndexAndColIndex(y, x, c, status, center, handleTabExpansion))
+	e.redrawCursor.Store(true)
+
+	// Push a function for how to go back
+	backFunctions = append(backFunctions, func() {
+		if e.filename != oldFilename {
+			e.Switch(c, tty, status, fileLock, oldFilename)
+		}
+		redraw, _ := e.GoTo(oldLineIndex, c, status)
+		e.redraw.Store(redraw)
+	})
+}
+
+// LSPGoToDefinition asks the language server for the definition of the symbol under the cursor, and jumps there.
+// Returns false if no language server is ready or if no definition was found,
+// so that the regular GoToDefinition can be used as a fallback.
+func (e *Editor) LSPGoToDefinition(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) bool {
+	// Don't wait for the language server to start, since this is done from the key loop
+	lc, uri, err := e.lspSync(false)
+	if err != nil {
+		e.LSPStartInBackground()
+		return false
+	}
+	locations, err := lc.Definition(uri, e.LSPPosition())
+	if err != nil || len(locations) == 0 {
+		return false
+	}
+	e.LSPGoToLocation(c, tty, status, locations[0])
+	return true
+}
+
+// LSPFindReferences asks the language server for all references to the symbol under the cursor,
+// lets the user select one of them from a menu and then jumps there.
+func (e *Editor) LSPFindReferences(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) {
+	lc, uri, err := e.LSPSync()
+	if err != nil {
+		status.SetErrorAfterRedraw(err)
+		return
+	}
+	locations, err := lc.References(uri, e.LSPPosition())
+	if err != nil {
+		status.SetErrorAfterRedraw(err)
+		return
+	}
+	if len(locations) == 0 {
+		status.SetErrorMessageAfterRedraw("No references found")
+		return
+	}
+	choices := make([]string, len(locations))
+	for i, location := range locations {
+		choices[i] = fmt.Sprintf("%s:%d", files.Relative(uriToPath(location.URI)), location.Range.Start.Line+1)
+	}
+	const extraDashes = false
+	selected, _ := e.Menu(status, tty, fmt.Sprintf("%d references", len(locations)), choices, e.Background, e.MenuTitleColor, e.MenuArrowColor, e.MenuTextColor, e.MenuHighlightColor, e.MenuSelectedColor, 0, extraDashes)
+	if selected < 0 || selected >= len(locations) {
+		return
+	}
+	e.LSPGoToLocation(c, tty, status, locations[selected])
+}
+
+// LSPHover asks the language server for information about the symbol under the cursor and displays it in the status bar
+func (e *Editor) LSPHover(status *StatusBar) {
+	lc, uri, err := e.LSPSync()
+	if err != nil {
+		status.SetErrorAfterRedraw(err)
+		return
+	}
+	text, err := lc.Hover(uri, e.LSPPosition())
+	if err != nil {
+		status.SetErrorAfterRedraw(err)
+		return
+	}
+	// Use the first line that is not a code fence
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "```") {
+			status.SetMessageAfterRedraw(line)
+			return
+		}
+	}
+	status.SetErrorMessageAfterRedraw("No information")
+}
+
+// LSPDiagnosticsMessage returns a status message that summarizes the given diagnostics,
+// preferring a diagnostic on the given line. Returns an empty string if there are no errors or warnings.
+func LSPDiagnosticsMessage(diagnostics []LSPDiagnostic, lineIndex LineIndex) string {
+	var problems []LSPDiagnostic
+	for _, d := range diagnostics {
+		// 1 is error, 2 is warning, 0 is unspecified
+		if d.Severity <= 2 {
+			problems = append(problems, d)
+		}
+	}
+	if len(problems) == 0 {
+		return ""
+	}
+	chosen := problems[0]
+	for _, d := range problems {
+		if d.Range.Start.Line == int(lineIndex) {
+			chosen = d
+			break
+		}
+	}
+	firstLine, _, _ := strings.Cut(chosen.Message, "\n")
+	msg := fmt.Sprintf("%d: %s", chosen.Range.Start.Line+1, firstLine)
+	if len(problems) > 1 {
+		msg = fmt.Sprintf("%s (%d problems)", msg, len(problems))
+	}
+	return msg
+}
+
+// LSPSyncInBackground sends the current text to the language server for this file, if one is already running,
+// so that it is kept up to date while editing. It is only done once per lspSyncInterval, and never starts a server.
+func (e *Editor) LSPSyncInBackground() {
+	if !e.changed.Load() || e.largeFile != nil || time.Since(lspLastSync) < lspSyncInterval {
+		return
+	}
+	command := e.LSPServerCommand()
+	if command == nil {
+		return
+	}
+	absFilename, err := e.AbsFilename()
+	if err != nil {
+		return
+	}
+	lc, err := lspClient(command, lspRootDir(absFilename), false)
+	if err != nil {
+		return
+	}
+	lspLastSync = time.Now()
+	languageID, text := lspLanguageIDs[e.mode], e.String()
+	go lc.SyncDocument(pathToURI(absFilename), languageID, text)
+}
+
+// LSPCheckDiagnostics tells the language server that the file has been saved, then waits a short while for diagnostics
+// and shows a summary in the status bar, if there are any problems. This is done in the background, since starting
+// a language server for the first time can take a while.
+func (e *Editor) LSPCheckDiagnostics(c *vt100.Canvas, status *StatusBar) {
+	command := e.LSPServerCommand()
+	if command == nil || e.largeFile != nil {
+		return
+	}
+	absFilename, err := e.AbsFilename()
+	if err != nil {
+		return
+	}
+	languageID, text, lineIndex := lspLanguageIDs[e.mode], e.String(), e.DataY()
+	go func() {
+		lc, err := lspClient(command, lspRootDir(absFilename), true)
+		if err != nil {
+			return
+		}
+		uri := pathToURI(absFilename)
+		syncTime := time.Now()
+		if err := lc.SyncDocument(uri, languageID, text); err != nil {
+			return
+		}
+		lc.DidSave(uri)
+		// If no new diagnostics arrive, the latest ones are used, since the text may already have been sent while editing
+		diagnostics, _ := lc.WaitForDiagnostics(uri, syncTime, lspDiagnosticsTimeout)
+		msg := LSPDiagnosticsMessage(diagnostics, lineIndex)
+		if msg == "" {
+			return
+		}
+		// Only show the message if the same file is still being edited
+		if currentFilename, err := e.AbsFilename(); err == nil && currentFilename == absFilename {
+			status.SetErrorMessage(msg)
+			status.Show(c, e)
+		}
+	}()
+}
+
+// StopLSPClients shuts down all running language servers
+func StopLSPClients() {
+	lspClientsMut.Lock()
+	defer lspClientsMut.Unlock()
+	var wg sync.WaitGroup
+	for key, server := range lspClients {
+		wg.Add(1)
+		go func(server *lspServer) {
+			defer wg.Done()
+			<-server.ready
+			if server.err == nil {
+				server.lc.Shutdown()
+			}
+		}(server)
+		delete(lspClients, key)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/xyproto/files"
+)
+
+// runStubLSPServer is a minimal language server that answers initialize, definition, references and hover,
+// and publishes a diagnostic when a document is opened or changed.
+func runStubLSPServer(r io.Reader, w io.WriteCloser) {
+	defer w.Close()
+	br := bufio.NewReader(r)
+	send := func(msg any) {
+		data, _ := json.Marshal(msg)
+		fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	}
+	for {
+		data, err := readLSPMessage(br)
+		if err != nil {
+			return
+		}
+		var msg struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if json.Unmarshal(data, &msg) != nil {
+			return
+		}
+		switch msg.Method {
+		case "initialize":
+			send(map[string]any{"jsonrpc": "2.0", "id": msg.ID, "result": map[string]any{"capabilities": map[string]any{}}})
+			// Also send a request to the client, which should be answered
+			send(map[string]any{"jsonrpc": "2.0", "id": "cfg", "method": "workspace/configuration", "params": map[string]any{}})
+		case "textDocument/didOpen", "textDocument/didChange":
+			var params struct {
+				TextDocument struct {
+					URI string `json:"uri"`
+				} `json:"textDocument"`
+			}
+			json.Unmarshal(msg.Params, &params)
+			send(map[string]any{"jsonrpc": "2.0", "method": "textDocument/publishDiagnostics", "params": map[string]any{
+				"uri": params.TextDocument.URI,
+				"diagnostics": []map[string]any{
+					{"range": map[string]any{"start": map[string]int{"line": 2, "character": 1}, "end": map[string]int{"line": 2, "character": 4}}, "severity": 1, "message": "undefined: x\nmore details"},
+					{"range": map[string]any{"start": map[string]int{"line": 0, "character": 0}, "end": map[string]int{"line": 0, "character": 1}}, "severity": 3, "message": "just a hint"},
+				},
+			}})
+		case "textDocument/definition":
+			send(map[string]any{"jsonrpc": "2.0", "id": msg.ID, "result": []map[string]any{
+				{"targetUri": "file:///tmp/other.go", "targetSelectionRange": map[string]any{"start": map[string]int{"line": 9, "character": 5}, "end": map[string]int{"line": 9, "character": 8}}},
+			}})
+		case "textDocument/references":
+			send(map[string]any{"jsonrpc": "2.0", "id": msg.ID, "result": []map[string]any{
+				{"uri": "file:///tmp/main.go", "range": map[string]any{"start": map[string]int{"line": 1, "character": 0}, "end": map[string]int{"line": 1, "character": 3}}},
+				{"uri": "file:///tmp/other.go", "range": map[string]any{"start": map[string]int{"line": 9, "character": 5}, "end": map[string]int{"line": 9, "character": 8}}},
+			}})
+		case "textDocument/hover":
+			send(map[string]any{"jsonrpc": "2.0", "id": msg.ID, "result": map[string]any{"contents": map[string]string{"kind": "markdown", "value": "```go\nfunc hello()\n```"}}})
+		case "shutdown":
+			send(map[string]any{"jsonrpc": "2.0", "id": msg.ID, "result": nil})
+		case "exit":
+			return
+		}
+	}
+}
+
+func TestLSPClient(t *testing.T) {
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+	go runStubLSPServer(serverReader, serverWriter)
+
+	lc := newLSPClient(clientWriter, clientReader, "/tmp")
+	defer lc.Shutdown()
+
+	if err := lc.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	const uri = "file:///tmp/main.go"
+	syncTime := time.Now()
+	if err := lc.SyncDocument(uri, "go", "package main\n\nfunc main() {}\n"); err != nil {
+		t.Fatal(err)
+	}
+	diagnostics, ok := lc.WaitForDiagnostics(uri, syncTime, time.Second)
+	if !ok || len(diagnostics) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %v", diagnostics)
+	}
+	if msg := LSPDiagnosticsMessage(diagnostics, 0); msg != "3: undefined: x" {
+		t.Errorf("unexpected diagnostics message: %q", msg)
+	}
+
+	locations, err := lc.Definition(uri, LSPPosition{2, 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locations) != 1 || uriToPath(locations[0].URI) != "/tmp/other.go" || locations[0].Range.Start.Line != 9 {
+		t.Errorf("unexpected definition: %v", locations)
+	}
+
+	locations, err = lc.References(uri, LSPPosition{2, 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locations) != 2 {
+		t.Errorf("expected 2 references, got %v", locations)
+	}
+
+	text, err := lc.Hover(uri, LSPPosition{2, 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "```go\nfunc hello()\n```" {
+		t.Errorf("unexpected hover text: %q", text)
+	}
+}
+
+func TestUTF16Offsets(t *testing.T) {
+	const line = "a😀b"
+	if n := utf16Offset(line, 2); n != 3 {
+		t.Errorf("expected 3, got %d", n)
+	}
+	if n := runeOffset(line, 3); n != 2 {
+		t.Errorf("expected 2, got %d", n)
+	}
+	if uri := pathToURI("/tmp/a b.go"); uri != "file:///tmp/a%20b.go" {
+		t.Errorf("unexpected URI: %s", uri)
+	}
+	if path := uriToPath("file:///tmp/a%20b.go"); path != "/tmp/a b.go" {
+		t.Errorf("unexpected path: %s", path)
+	}
+}
+
+func TestLSPClientIsNotStarted(t *testing.T) {
+	// Syncing while editing must never start a language server
+	if _, err := lspClient([]string{"no-such-language-server"}, t.TempDir(), false); !errors.Is(err, errNoLSPServer) {
+		t.Errorf("expected errNoLSPServer, got %v", err)
+	}
+}
+
+func TestLSPClientDoesNotWaitForStart(t *testing.T) {
+	if files.WhichCached("sleep") == "" {
+		t.Skip("sleep is not installed")
+	}
+	// A language server that never responds to the initialize request, and then exits
+	command := []string{"sleep", "1"}
+	rootDir := t.TempDir()
+	defer StopLSPClients()
+	if server := lspServerFor(command, rootDir, true); server == nil {
+		t.Fatal("expected the language server to be started")
+	}
+	start := time.Now()
+	if _, err := lspClient(command, rootDir, false); !errors.Is(err, errNoLSPServer) {
+		t.Errorf("expected errNoLSPServer while the language server is starting, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected to not wait for the language server to start, waited %v", elapsed)
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"io"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
 	"sync"
 	"syscall"
@@ -16,7 +15,6 @@ import (
 	"github.com/xyproto/digraph"
 	"github.com/xyproto/env/v2"
 	"github.com/xyproto/files"
-	"github.com/xyproto/globi"
 	"github.com/xyproto/ollamaclient/v2"
 	"github.com/xyproto/usermodel"
 	"github.com/xyproto/vt100"
@@ -77,6 +75,7 @@ func main() {
 		buildFlag              bool
 		noApproxMatchFlag      bool
 		listDigraphsFlag       bool
+		undoHistoryFlag        bool
 	)
 
 	pflag.BoolVarP(&copyFlag, "copy", "c", false, "copy a file into the clipboard and quit")
@@ -99,6 +98,7 @@ func main() {
 	pflag.BoolVarP(&buildFlag, "build", "b", false, "Try to build the file instead of editing it")
 	pflag.BoolVarP(&noApproxMatchFlag, "noapprox", "x", false, "Disable approximate filename matching")
 	pflag.BoolVarP(&listDigraphsFlag, "digraphs", "g", false, "List digraphs")
+	pflag.BoolVarP(&undoHistoryFlag, "undo-history", "u", env.Bool("O_UNDO_HISTORY"), "keep the undo history between sessions")
 
 	pflag.Parse()
 
@@ -155,6 +155,7 @@ func main() {
 	}
 
 	noWriteToCache = noCacheFlag || monitorAndReadOnlyFlag
+	persistentUndo = undoHistoryFlag
 
 	var (
 		executableName          string
@@ -192,7 +193,7 @@ func main() {
 		}
 		if catFlag {
 			// List the file in a colorful way and quit
-			quitCat(&FilenameOrData{filename, []byte{}, 0, false})
+			quitCat(&FilenameOrData{filename, []byte{}, 0, false, nil})
 		} else if batFlag {
 			// List the file in a colorful way, using bat, and quit
 			quitBat(filename)
@@ -226,7 +227,7 @@ func main() {
 		}
 		if catFlag {
 			// List the file in a colorful way and quit
-			quitCat(&FilenameOrData{filename, []byte{}, 0, false})
+			quitCat(&FilenameOrData{filename, []byte{}, 0, false, nil})
 		} else if batFlag {
 			// List the file in a colorful way, using bat, and quit
 			quitBat(filename)
@@ -336,62 +337,9 @@ func main() {
 		// If the filename starts with "~", then expand it
 		fnord.ExpandUser()
 
-		// Check if the given filename is not a file or a symlink
-		if !noApproxMatchFlag {
-			if !files.IsFileOrSymlink(fnord.filename) {
-				if strings.HasSuffix(fnord.filename, ".") {
-					// If the filename ends with "." and the file does not exist, assume this was a result of tab-completion going wrong.
-					// If there are multiple files that exist that start with the given filename, open the one first in the alphabet (.cpp before .o)
-					matches, err := globi.Glob(fnord.filename + "*")
-					if err == nil && len(matches) > 0 { // no error and at least 1 match
-						// Filter out any binary files
-						matches = files.FilterOutBinaryFiles(matches)
-						if len(matches) > 0 {
-							sort.Strings(matches)
-							// If the matches contains low priority suffixes, such as ".lock", then move it last
-							matchesRegular := make([]string, len(matches))
-							matchesLowPri := make([]string, len(matches))
-							for _, fn := range matches {
-								if !hasSuffix(fn, probablyDoesNotWantToEditExtensions) {
-									matchesRegular = append(matchesRegular, fn)
-								} else {
-									// Store as a low-priority match
-									matchesLowPri = append(matchesLowPri, fn)
-								}
-							}
-							// Combine the regular and the low-priority matches
-							matches = append(matchesRegular, matchesLowPri...)
-							if len(matches) > 0 && len(matches[0]) > 0 {
-								// Use the first filename in the list of matches
-								fnord.filename = matches[0]
-							}
-						}
-					}
-				} else if !strings.Contains(fnord.filename, ".") && allLower(fnord.filename) {
-					// The filename has no ".", is written in lowercase and it does not exist,
-					// but more than one file that starts with the filename  exists. Assume tab-completion failed.
-					matches, err := globi.Glob(fnord.filename + "*")
-					if err == nil && len(matches) > 1 { // no error and more than 1 match
-						// Use the first non-binary match of the sorted results
-						matches = files.FilterOutBinaryFiles(matches)
-						if len(matches) > 0 {
-							sort.Strings(matches)
-							fnord.filename = matches[0]
-						}
-					}
-				} else {
-					// Also match ie. "PKGBUILD" if just "Pk" was entered
-					matches, err := globi.Glob(strings.ToTitle(fnord.filename) + "*")
-					if err == nil && len(matches) >= 1 { // no error and at least 1 match
-						// Use the first non-binary match of the sorted results
-						matches = files.FilterOutBinaryFiles(matches)
-						if len(matches) > 0 {
-							sort.Strings(matches)
-							fnord.filename = matches[0]
-						}
-					}
-				}
-			} // !noApproxMatchFlag
+		// Check if the given filename is not a file or a symlink, nor a file within an archive
+		if _, inArchive := splitArchivePath(fnord.filename); !noApproxMatchFlag && !inArchive && !files.IsFileOrSymlink(fnord.filename) {
+			fnord.filename = approximateFilename(fnord.filename)
 		}
 	}
 
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"unicode/utf8"
+)
+
+// Cursor is the position of an additional cursor, as a line index and a screen column where tabs are expanded
+type Cursor struct {
+	y   LineIndex
+	col int
+}
+
+// MultiCursor is a list of additional cursors. Typing, backspace and tab are replicated at every cursor.
+type MultiCursor struct {
+	cursors []Cursor
+	edited  bool // has the text been edited at the cursors, so that the next edit can be undone together with the previous ones
+}
+
+// primaryCursor returns the position of the regular cursor
+func (e *Editor) primaryCursor() Cursor {
+	return Cursor{e.DataY(), e.cursorColumn()}
+}
+
+// allCursors returns the regular cursor and the additional cursors, sorted by line and column
+func (e *Editor) allCursors() []Cursor {
+	cursors := []Cursor{e.primaryCursor()}
+	if e.multiCursor != nil {
+		cursors = append(cursors, e.multiCursor.cursors...)
+	}
+	sort.Slice(cursors, func(i, j int) bool {
+		if cursors[i].y != cursors[j].y {
+			return cursors[i].y < cursors[j].y
+		}
+		return cursors[i].col < cursors[j].col
+	})
+	// The regular cursor may have been moved to the position of an additional cursor
+	return slices.Compact(cursors)
+}
+
+// MultiCursorCount returns the number of cursors, including the regular cursor
+func (e *Editor) MultiCursorCount() int {
+	if e.multiCursor == nil {
+		return 1
+	}
+	return len(e.multiCursor.cursors) + 1
+}
+
+// ClearCursors removes the additional cursors. Returns true if there were any.
+func (e *Editor) ClearCursors() bool {
+	hadCursors := e.multiCursor != nil
+	e.multiCursor = nil
+	return hadCursors
+}
+
+// addCursor adds a cursor at the given position, unless there already is one there.
+// Returns false if there already was a cursor at the given position.
+func (e *Editor) addCursor(cursor Cursor) bool {
+	for _, existing := range e.allCursors() {
+		if existing == cursor {
+			return false
+		}
+	}
+	if e.multiCursor == nil {
+		e.multiCursor = &MultiCursor{}
+	}
+	e.multiCursor.cursors = append(e.multiCursor.cursors, cursor)
+	return true
+}
+
+// lastCursor returns the cursor that was added last, or the regular cursor if there are no additional cursors
+func (e *Editor) lastCursor() Cursor {
+	if e.multiCursor == nil || len(e.multiCursor.cursors) == 0 {
+		return e.primaryCursor()
+	}
+	return e.multiCursor.cursors[len(e.multiCursor.cursors)-1]
+}
+
+// AddCursorBelow adds a cursor at the column of the regular cursor, on the line below the lowest cursor
+func (e *Editor) AddCursorBelow() error {
+	cursors := e.allCursors()
+	y := cursors[len(cursors)-1].y + 1
+	if int(y) >= e.Len() {
+		return errors.New("no more lines below")
+	}
+	e.addCursor(Cursor{y, e.cursorColumn()})
+	return nil
+}
+
+// AddCursorsInSelection replaces a rectangular selection with a cursor at the left edge of the rectangle,
+// on every selected line. Returns false if there is no rectangular selection.
+func (e *Editor) AddCursorsInSelection() bool {
+	if e.selection == nil || e.selection.kind != rectSelection {
+		return false
+	}
+	startY, endY, fromCol, _ := e.SelectedRectangle()
+	e.selection = nil
+	// Move the regular cursor to the top left corner of the rectangle
+	e.GoTo(startY, nil, nil)
+	e.pos.mut.Lock()
+	e.pos.sx = fromCol - e.pos.offsetX
+	e.pos.mut.Unlock()
+	for y := startY + 1; y <= endY; y++ {
+		e.addCursor(Cursor{y, fromCol})
+	}
+	return true
+}
+
+// AddCursorAtNextMatch adds a cursor at the next occurrence of the word at the regular cursor,
+// after the cursor that was added last. The search wraps around at the end of the document.
+func (e *Editor) AddCursorAtNextMatch() error {
+	word := e.CurrentWord()
+	if word == "" {
+		return errors.New("no word at the cursor")
+	}
+	m, err := NewSearchMatcher(word, SearchOptions{Case: searchCaseSensitive, WholeWord: true}, false)
+	if err != nil {
+		return err
+	}
+
+	// Find where the cursor is within the word
+	offset := 0
+	currentLine := e.CurrentLine()
+	cursorX := e.cursorRuneIndex()
+	for _, match := range m.FindAll(currentLine) {
+		start, end := utf8.RuneCountInString(currentLine[:match[0]]), utf8.RuneCountInString(currentLine[:match[1]])
+		if cursorX >= start && cursorX < end {
+			offset = cursorX - start
+			break
+		}
+	}
+
+	// Search from the cursor that was added last, and wrap around
+	last := e.lastCursor()
+	lineCount := e.Len()
+	for i := 0; i <= lineCount; i++ {
+		y := LineIndex((int(last.y) + i) % lineCount)
+		line := e.Line(y)
+		for _, match := range m.FindAll(line) {
+			x := utf8.RuneCountInString(line[:match[0]])
+			cursor := Cursor{y, e.screenColumn(y, x+offset)}
+			if i == 0 && cursor.col <= last.col {
+				continue
+			}
+			if e.addCursor(cursor) {
+				return nil
+			}
+		}
+	}
+	return errors.New("no more occurrences of " + word)
+}
+
+// cursorColumnsByLine returns the screen columns of the additional cursors, for each line that has any
+func (e *Editor) cursorColumnsByLine() map[LineIndex][]int {
+	if e.multiCursor == nil {
+		return nil
+	}
+	columns := make(map[LineIndex][]int)
+	for _, cursor := range e.multiCursor.cursors {
+		columns[cursor.y] = append(columns[cursor.y], cursor.col)
+	}
+	return columns
+}
+
+// snapshotMultiCursorEdit takes an undo snapshot before an edit at the cursors,
+// so that all edits made with the same cursors are undone as one step
+func (e *Editor) snapshotMultiCursorEdit(undo *Undo) {
+	undo.Snapshot(e)
+	if e.multiCursor.edited {
+		undo.Join()
+	}
+	e.multiCursor.edited = true
+}
+
+// editAtCursors calls the given function for each cursor, from the start to the end of the document.
+// The function gets the line index and the rune index of the cursor, where the line has been padded with
+// spaces if the cursor is after the end of the line, and returns the new line and the new rune index.
+func (e *Editor) editAtCursors(f func(y LineIndex, x int, line []rune) ([]rune, int)) {
+	var (
+		cursors   = e.allCursors()
+		primary   = e.primaryCursor()
+		shift     int // how many runes the previous cursors on the same line have added
+		prevY     = LineIndex(-1)
+		newCursor []Cursor
+	)
+	// Pad the lines first, so that the rune indices of the cursors are known before editing
+	for i := len(cursors) - 1; i >= 0; i-- {
+		e.padToColumn(cursors[i].y, cursors[i].col)
+	}
+	xs := make([]int, len(cursors))
+	for i, cursor := range cursors {
+		xs[i] = e.runeIndexAtColumn(cursor.y, cursor.col)
+	}
+	for i, cursor := range cursors {
+		if cursor.y != prevY {
+			shift = 0
+			prevY = cursor.y
+		}
+		runes, _ := e.lines.Runes(int(cursor.y))
+		x := xs[i] + shift
+		newRunes, newX := f(cursor.y, x, runes)
+		shift += newX - x
+		e.SetLine(cursor.y, string(newRunes))
+		newCursor = append(newCursor, Cursor{cursor.y, e.screenColumn(cursor.y, newX)})
+	}
+	// Update the positions of the regular and the additional cursors
+	e.multiCursor.cursors = e.multiCursor.cursors[:0]
+	primaryFound := false
+	for i, cursor := range cursors {
+		if cursor == primary && !primaryFound {
+			primaryFound = true
+			e.pos.mut.Lock()
+			e.pos.sx = max(newCursor[i].col-e.pos.offsetX, 0)
+			e.pos.mut.Unlock()
+			continue
+		}
+		e.multiCursor.cursors = append(e.multiCursor.cursors, newCursor[i])
+	}
+	e.redraw.Store(true)
+	e.redrawCursor.Store(true)
+}
+
+// InsertAtCursors inserts the given string at every cursor
+func (e *Editor) InsertAtCursors(undo *Undo, s string) {
+	e.snapshotMultiCursorEdit(undo)
+	insert := []rune(s)
+	e.editAtCursors(func(_ LineIndex, x int, line []rune) ([]rune, int) {
+		newLine := make([]rune, 0, len(line)+len(insert))
+		newLine = append(newLine, line[:x]...)
+		newLine = append(newLine, insert...)
+		newLine = append(newLine, line[x:]...)
+		return newLine, x + len(insert)
+	})
+}
+
+// BackspaceAtCursors deletes the rune to the left of every cursor, but does not join lines
+func (e *Editor) BackspaceAtCursors(undo *Undo) {
+	e.snapshotMultiCursorEdit(undo)
+	e.editAtCursors(func(_ LineIndex, x int, line []rune) ([]rune, int) {
+		if x == 0 {
+			return line, x
+		}
+		return append(line[:x-1:x-1], line[x:]...), x - 1
+	})
+}
+
+// TabAtCursors inserts one indentation at every cursor
+func (e *Editor) TabAtCursors(undo *Undo) {
+	e.InsertAtCursors(undo, e.indentation.String())
+}
@@ -0,0 +1,62 @@
+package main
+
+import "testing"
+
+func TestInsertAtCursors(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.LoadBytes([]byte("Name string\nAge int\nID"))
+	u := NewUndo(defaultUndoCount, defaultUndoMemory)
+
+	// Add a cursor below twice, at column 4, where the last line is too short
+	e.pos.sx = 4
+	for i := 0; i < 2; i++ {
+		if err := e.AddCursorBelow(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.AddCursorBelow(); err == nil {
+		t.Error("expected an error when adding a cursor below the last line")
+	}
+	if n := e.MultiCursorCount(); n != 3 {
+		t.Fatalf("expected 3 cursors, got %d", n)
+	}
+
+	e.InsertAtCursors(u, "|")
+	e.InsertAtCursors(u, "|")
+	e.BackspaceAtCursors(u)
+	if got, want := e.String(), "Name| string\nAge |int\nID  |\n"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if e.cursorColumn() != 5 {
+		t.Errorf("expected the regular cursor to be at column 5, got %d", e.cursorColumn())
+	}
+
+	// All the edits made with the same cursors are undone as one step
+	if err := u.Restore(e); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := e.String(), "Name string\nAge int\nID\n"; got != want {
+		t.Errorf("expected %q after undo, got %q", want, got)
+	}
+}
+
+func TestAddCursorAtNextMatch(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.LoadBytes([]byte("a := b\nab := b + b\n"))
+	u := NewUndo(defaultUndoCount, defaultUndoMemory)
+
+	// Start at the "b" on the first line
+	e.pos.sx = 5
+	for i := 0; i < 2; i++ {
+		if err := e.AddCursorAtNextMatch(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.AddCursorAtNextMatch(); err == nil {
+		t.Error("expected an error when there are no more occurrences")
+	}
+	e.InsertAtCursors(u, "c")
+	if got, want := e.String(), "a := cb\nab := cb + cb\n"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
@@ -28,12 +28,20 @@ var (
 )
 
 // NewEditor takes a filename and a line number to jump to (may be 0)
-// Returns an Editor, a status message for the user, a bool that is true if an image was displayed instead and the finally an error type.
+// Returns an Editor, a status message for the user, a bool that is true if an image or the hex editor was displayed instead
+// (or if the list of files in an archive was closed without choosing one) and the finally an error type.
 func NewEditor(tty *vt100.TTY, c *vt100.Canvas, fnord FilenameOrData, lineNumber LineNumber, colNumber ColNumber, theme Theme, origSyntaxHighlight, discoverBGColor, monitorAndReadOnly, nanoMode, createDirectoriesIfMissing, displayQuickHelp bool) (*Editor, string, bool, error) {
 	if inVTEGUI {
 		noDrawUntilResize.Store(true)
 	}
 
+	// Read the file within an archive, like "archive.tar.gz:path/inside/file.txt", or let the user choose one
+	if chosen, err := fnord.LoadArchiveEntry(tty, c, theme); err != nil {
+		return nil, "", false, err
+	} else if !chosen {
+		return nil, "", true, nil
+	}
+
 	var (
 		startTime          = time.Now()
 		createdNewFile     bool   // used for indicating that a new file was created
@@ -47,15 +55,21 @@ func NewEditor(tty *vt100.TTY, c *vt100.Canvas, fnord FilenameOrData, lineNumber
 		syntaxHighlight    bool
 	)
 
-	ext := strings.ToLower(filepath.Ext(fnord.filename))
-
 	// Check if the given filename is an image
-	switch ext {
+	switch strings.ToLower(filepath.Ext(fnord.filename)) {
 	case ".png", ".jpg", ".jpeg", ".ico", ".gif", ".bmp", ".webp":
 		const waitForKeypress = true
 		return nil, "", true, displayImage(c, fnord.filename, waitForKeypress)
 	}
 
+	// For compressed files, use the extension of the file within, like ".1" for "ls.1.gz".
+	// For files within archives, use the path within the archive.
+	detectFilename := stripCompressionExtension(fnord.filename)
+	if fnord.archive != nil {
+		detectFilename = fnord.archive.name
+	}
+	ext := strings.ToLower(filepath.Ext(detectFilename))
+
 	if parentIsMan == nil {
 		b := parentProcessIs("man")
 		parentIsMan = &b
@@ -72,7 +86,7 @@ func NewEditor(tty *vt100.TTY, c *vt100.Canvas, fnord FilenameOrData, lineNumber
 		if *parentIsMan {
 			m = mode.ManPage
 		} else {
-			m = mode.Detect(stripGZ(fnord.filename)) // Note that mode.Detect can check for the full path, like /etc/fstab
+			m = mode.Detect(detectFilename) // Note that mode.Detect can check for the full path, like /etc/fstab
 		}
 		syntaxHighlight = origSyntaxHighlight && m != mode.Text && (m != mode.Blank || ext != "")
 	}
@@ -124,6 +138,7 @@ func NewEditor(tty *vt100.TTY, c *vt100.Canvas, fnord FilenameOrData, lineNumber
 
 	// Set the editor filename
 	e.filename = fnord.filename
+	e.archiveEntry = fnord.archive
 
 	// emulate Nano?
 	e.nanoMode.Store(nanoMode)
@@ -138,7 +153,7 @@ func NewEditor(tty *vt100.TTY, c *vt100.Canvas, fnord FilenameOrData, lineNumber
 	// Use os.Stat to check if the file exists, and load the file if it does
 	var warningMessage string
 
-	if fnord.stdin && !fnord.Empty() { // we have data from stdin
+	if (fnord.stdin && !fnord.Empty()) || fnord.archive != nil { // we have data from stdin or from a file within an archive
 
 		warningMessage, err = e.Load(c, tty, fnord)
 		if err != nil {
@@ -196,6 +211,12 @@ func NewEditor(tty *vt100.TTY, c *vt100.Canvas, fnord FilenameOrData, lineNumber
 			return e, "", false, errors.New("can not open directories")
 		}
 
+		// Binary files are opened in the hex editor, which reads the file in pages instead of all at once
+		if c != nil && tty != nil && fnord.Empty() && !monitorAndReadOnly && isBinaryFile(e.filename) && compressionByExtension(e.filename) == nil && !(ext == ".class" && files.WhichCached("jad") != "") {
+			_, err := e.HexEdit(c, tty, e.NewStatusBar(2700*time.Millisecond, ""))
+			return e, "", true, err
+		}
+
 		warningMessage, err = e.Load(c, tty, fnord)
 		if err != nil {
 			return e, "", false, err
@@ -218,7 +239,7 @@ func NewEditor(tty *vt100.TTY, c *vt100.Canvas, fnord FilenameOrData, lineNumber
 						e.mode = m
 					}
 				}
-			} else if e.mode == mode.Assembly { // Check if it could be Go/Plan9 style Assembly
+			} else if e.mode == mode.Assembly && e.largeFile == nil { // Check if it could be Go/Plan9 style Assembly
 				if m, found := mode.DetectFromContents(e.mode, e.String(), e.String); found {
 					e.mode = m
 				}
@@ -286,6 +307,11 @@ func NewEditor(tty *vt100.TTY, c *vt100.Canvas, fnord FilenameOrData, lineNumber
 		e.indentation.Spaces = !detectedTabs
 	}
 
+	// Settings from .editorconfig files take precedence over the detected indentation
+	if e.filename != "" && e.filename != "-" {
+		e.ApplyEditorConfig(LoadEditorConfig(e.filename))
+	}
+
 	switch e.mode {
 	case mode.ASCIIDoc, mode.Blank, mode.Email, mode.Markdown, mode.Text, mode.ReStructured, mode.SCDoc:
 		e.rainbowParenthesis = false
@@ -315,6 +341,11 @@ func NewEditor(tty *vt100.TTY, c *vt100.Canvas, fnord FilenameOrData, lineNumber
 		e.syntaxHighlight = true
 	}
 
+	// Syntax highlighting needs to process all lines above the ones that are displayed, so disable it for large files
+	if e.largeFile != nil {
+		e.syntaxHighlight = false
+	}
+
 	// Use a light theme if XTERM_VERSION (and not running with "og") or
 	// TERMINAL_EMULATOR is set to "JetBrains-JediTerm",
 	// because $COLORFGBG is "15;0" even though the background is white.
@@ -497,6 +528,11 @@ func NewEditor(tty *vt100.TTY, c *vt100.Canvas, fnord FilenameOrData, lineNumber
 		}
 		if e.binaryFile {
 			statusMessage += " (binary)"
+		} else if !e.fileFormat.Default() {
+			statusMessage += " (" + e.FileFormatDescription() + ")"
+		}
+		if e.largeFileIndexing {
+			statusMessage += " (large file, indexing lines in the background)"
 		}
 
 		// Take not of the startup duration, in milliseconds
@@ -537,7 +573,6 @@ func NewEditor(tty *vt100.TTY, c *vt100.Canvas, fnord FilenameOrData, lineNumber
 func NewCustomEditor(indentation mode.TabsSpaces, scrollSpeed int, m mode.Mode, theme Theme, syntaxHighlight, rainbowParenthesis, monitorAndReadOnly, createDirectoriesIfMissing, displayQuickHelp bool) *Editor {
 	e := &Editor{}
 	e.SetTheme(theme)
-	e.lines = make(map[int][]rune)
 	e.indentation = indentation
 	e.syntaxHighlight = syntaxHighlight
 	e.rainbowParenthesis = rainbowParenthesis
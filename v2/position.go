@@ -16,16 +16,41 @@ type Position struct {
 	offsetY     int           // how far one has scrolled along the Y axis
 	scrollSpeed int           // how many lines to scroll, when scrolling up and down
 	savedX      int           // for smart down cursor movement
+	view        *Box          // the part of the canvas where this view is drawn, or nil for the whole canvas
 }
 
 // NewPosition returns a new Position struct
 func NewPosition(scrollSpeed int) *Position {
-	return &Position{&sync.RWMutex{}, 0, 0, 0, 0, scrollSpeed, 0}
+	return &Position{&sync.RWMutex{}, 0, 0, 0, 0, scrollSpeed, 0, nil}
 }
 
 // Copy will create a new Position struct that is a copy of this one
 func (p *Position) Copy() *Position {
-	return &Position{p.mut, p.sx, p.sy, p.offsetX, p.offsetY, p.scrollSpeed, p.savedX}
+	return &Position{p.mut, p.sx, p.sy, p.offsetX, p.offsetY, p.scrollSpeed, p.savedX, p.view}
+}
+
+// ViewWidth returns the width of the part of the canvas where this view is drawn
+func (p *Position) ViewWidth(c *vt100.Canvas) uint {
+	if p.view != nil {
+		return uint(p.view.W)
+	}
+	return c.W()
+}
+
+// ViewHeight returns the height of the part of the canvas where this view is drawn
+func (p *Position) ViewHeight(c *vt100.Canvas) uint {
+	if p.view != nil {
+		return uint(p.view.H)
+	}
+	return c.H()
+}
+
+// ViewOrigin returns the upper left corner of the part of the canvas where this view is drawn
+func (p *Position) ViewOrigin() (uint, uint) {
+	if p.view != nil {
+		return uint(p.view.X), uint(p.view.Y)
+	}
+	return 0, 0
 }
 
 // ScreenX returns the screen X position in the current view
@@ -72,7 +97,7 @@ func (p *Position) SetX(c *vt100.Canvas, x int) {
 	p.sx = x
 	w := 80 // default width
 	if c != nil {
-		w = int(c.W())
+		w = int(p.ViewWidth(c))
 	}
 	if x < w {
 		p.offsetX = 0
@@ -108,7 +133,7 @@ func (p *Position) IncY(c *vt100.Canvas) {
 
 	h := 25 // default height
 	if c != nil {
-		h = int(c.H())
+		h = int(p.ViewHeight(c))
 	}
 
 	p.sy++
@@ -150,7 +175,7 @@ func (p *Position) Down(c *vt100.Canvas) error {
 	defer p.mut.Unlock()
 	h := 25 // default height
 	if c != nil {
-		h = int(c.H())
+		h = int(p.ViewHeight(c))
 	}
 	if p.sy >= h-1 {
 		return errors.New("already at the bottom of the canvas")
@@ -207,7 +232,7 @@ func (p *Position) Right(c *vt100.Canvas) {
 
 	w := 80 // default width
 	if c != nil {
-		w = int(c.Width())
+		w = int(p.ViewWidth(c))
 	}
 	if p.sx < (w - 1) {
 		p.sx++
@@ -4,14 +4,15 @@ import (
 	"github.com/xyproto/vt100"
 )
 
-// WriteProgress draws a small progress indicator on the right hand side, but does not draw/redraw the canvas
+// WriteProgress draws a small progress indicator on the right hand side of the view, but does not draw/redraw the canvas
 func (e *Editor) WriteProgress(c *vt100.Canvas) {
 	var (
-		canvasWidth   = c.Width()
-		canvasHeight  = float64(c.Height())
+		vx, vy        = e.pos.ViewOrigin()
+		canvasWidth   = e.pos.ViewWidth(c)
+		canvasHeight  = float64(e.pos.ViewHeight(c))
 		lineNumberTop = float64(e.LineIndex())
 		allLines      = float64(e.Len())
-		x             = canvasWidth - 1
+		x             = vx + canvasWidth - 1
 		bottomLine    = canvasHeight - 1
 		y             = bottomLine
 	)
@@ -21,5 +22,5 @@ func (e *Editor) WriteProgress(c *vt100.Canvas) {
 			y = bottomLine
 		}
 	}
-	c.WriteBackground(x, uint(y), e.MenuArrowColor.Background())
+	c.WriteBackground(x, vy+uint(y), e.MenuArrowColor.Background())
 }
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/xyproto/files"
+	"github.com/xyproto/vt100"
+)
+
+// replaceDecision is what the user wants to do with a match, when replacing in all files in a project
+type replaceDecision int
+
+const (
+	replaceYes        replaceDecision = iota // replace this match
+	replaceNo                                // skip this match
+	replaceRestOfFile                        // replace this match and the rest of the matches in this file
+	replaceEverything                        // replace this match and all the remaining matches, in all files
+	replaceSkipFile                          // skip this match and the rest of the matches in this file
+	replaceStop                              // skip this match and stop, but keep the replacements that are already done
+)
+
+// the number of lines to show above and below a match, when asking if it should be replaced
+const replaceContextLines = 2
+
+// ReplaceMatch is a match that may be replaced, with a few lines of context
+type ReplaceMatch struct {
+	Filename string // absolute path
+	Old      string // the line before the replacement
+	New      string // the line with only this match replaced
+	Before   []string
+	After    []string
+	Line     LineNumber
+}
+
+// ReplacedFile is a file that was changed by a project replace, with the contents before and after
+type ReplacedFile struct {
+	Filename string // absolute path
+	Original []byte
+	Replaced []byte
+	Count    int // the number of replaced matches
+}
+
+// ProjectReplace is a search and replace in all files in a project, that can be reverted
+type ProjectReplace struct {
+	Query       string
+	Replacement string
+	Files       []ReplacedFile
+	Skipped     []string // files that were skipped because they are locked by another instance of o, or open in another buffer
+	Options     SearchOptions
+}
+
+// lastProjectReplace is the most recent project replace, that can be reverted
+var lastProjectReplace *ProjectReplace
+
+// writeLockedFile writes the given file atomically, while holding the lock for it, unless the file is
+// already locked by another instance of o. openFiles are the files that are open in this instance, which
+// are already locked by this instance.
+func writeLockedFile(lk *LockKeeper, openFiles map[string]bool, filename string, data []byte) error {
+	if lk == nil || openFiles[filename] {
+		return writeFileAtomically(filename, data)
+	}
+	lk.Load()
+	if err := lk.Lock(filename); err != nil {
+		return fmt.Errorf("%s is locked by another instance of this editor", filepath.Base(filename))
+	}
+	lk.Save()
+	defer func() {
+		lk.Unlock(filename)
+		lk.Save()
+	}()
+	return writeFileAtomically(filename, data)
+}
+
+// lockedElsewhere checks if the given file is locked by another instance of o
+func lockedElsewhere(lk *LockKeeper, openFiles map[string]bool, filename string) bool {
+	if lk == nil {
+		return false
+	}
+	if _, found := openFiles[filename]; found {
+		return false
+	}
+	lk.Load()
+	return !lk.GetTimestamp(filename).IsZero()
+}
+
+// Run asks decide what to do with each match in the given files, then writes the files where matches were replaced.
+// openFiles are the files that are open in this instance of o, where only the files that are set to true may be changed.
+// ignoreCaseByDefault is used if the search options does not say if the case should be ignored or not.
+func (pr *ProjectReplace) Run(filenames []string, ignoreCaseByDefault bool, lk *LockKeeper, openFiles map[string]bool, decide func(ReplaceMatch) replaceDecision) error {
+	m, err := NewSearchMatcher(pr.Query, pr.Options, ignoreCaseByDefault)
+	if err != nil {
+		return err
+	}
+	replaceAll := false
+NEXTFILE:
+	for _, filename := range filenames {
+		if mayChange, open := openFiles[filename]; (open && !mayChange) || lockedElsewhere(lk, openFiles, filename) {
+			pr.Skipped = append(pr.Skipped, filename)
+			continue
+		}
+		original, err := os.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		// Decode UTF-16 and ISO-8859-1 files, but keep the line endings as they are, since they may be mixed
+		ff, text := DecodeFileData(original)
+		ff.lineEnding = "\n"
+		var (
+			lines       = strings.Split(string(text), "\n")
+			count       int
+			replaceFile = replaceAll
+			skipFile    bool
+			stop        bool
+		)
+		for y, line := range lines {
+			matches := m.findAllSubmatches(line)
+			if len(matches) == 0 {
+				continue
+			}
+			var (
+				sb   strings.Builder
+				last int
+			)
+			for _, match := range matches {
+				if match[1] == match[0] {
+					// Skip empty matches
+					continue
+				}
+				replacement := m.replacementFor(line, pr.Replacement, match)
+				accept := replaceFile
+				if !replaceFile && !skipFile && !stop {
+					rm := ReplaceMatch{
+						Filename: filename,
+						Old:      line,
+						New:      line[:match[0]] + replacement + line[match[1]:],
+						Before:   lines[max(y-replaceContextLines, 0):y],
+						After:    lines[y+1 : min(y+1+replaceContextLines, len(lines))],
+						Line:     LineIndex(y).LineNumber(),
+					}
+					switch decide(rm) {
+					case replaceYes:
+						accept = true
+					case replaceRestOfFile:
+						accept, replaceFile = true, true
+					case replaceEverything:
+						accept, replaceFile, replaceAll = true, true, true
+					case replaceSkipFile:
+						skipFile = true
+					case replaceStop:
+						stop = true
+					}
+				}
+				if !accept {
+					continue
+				}
+				sb.WriteString(line[last:match[0]])
+				sb.WriteString(replacement)
+				last = match[1]
+				count++
+			}
+			if last > 0 {
+				sb.WriteString(line[last:])
+				lines[y] = sb.String()
+			}
+			if skipFile || stop {
+				break
+			}
+		}
+		if count > 0 {
+			replaced, err := ff.Encode(strings.Join(lines, "\n"))
+			if err == nil {
+				err = writeLockedFile(lk, openFiles, filename, replaced)
+			}
+			if err != nil {
+				pr.Skipped = append(pr.Skipped, filename)
+			} else {
+				pr.Files = append(pr.Files, ReplacedFile{filename, original, replaced, count})
+			}
+		}
+		if stop {
+			break NEXTFILE
+		}
+	}
+	return nil
+}
+
+// Count returns the number of replaced matches, in all files
+func (pr *ProjectReplace) Count() int {
+	total := 0
+	for _, rf := range pr.Files {
+		total += rf.Count
+	}
+	return total
+}
+
+// Summary returns a short description of what was replaced, for the status bar
+func (pr *ProjectReplace) Summary() string {
+	extraS, filesS := "es", "s"
+	if pr.Count() == 1 {
+		extraS = ""
+	}
+	if len(pr.Files) == 1 {
+		filesS = ""
+	}
+	s := fmt.Sprintf("Replaced %d match%s in %d file%s", pr.Count(), extraS, len(pr.Files), filesS)
+	if len(pr.Skipped) > 0 {
+		s += fmt.Sprintf(", skipped %d locked or open file", len(pr.Skipped))
+		if len(pr.Skipped) != 1 {
+			s += "s"
+		}
+	}
+	return s
+}
+
+// Revert writes back the original contents of the files that were changed, unless they have been changed since.
+// Returns the files that were reverted.
+func (pr *ProjectReplace) Revert(lk *LockKeeper, openFiles map[string]bool) ([]ReplacedFile, error) {
+	var (
+		reverted []ReplacedFile
+		changed  []string
+	)
+	for _, rf := range pr.Files {
+		if mayChange, open := openFiles[rf.Filename]; (open && !mayChange) || lockedElsewhere(lk, openFiles, rf.Filename) {
+			changed = append(changed, filepath.Base(rf.Filename))
+			continue
+		}
+		current, err := os.ReadFile(rf.Filename)
+		if err != nil || !bytes.Equal(current, rf.Replaced) {
+			changed = append(changed, filepath.Base(rf.Filename))
+			continue
+		}
+		if err := writeLockedFile(lk, openFiles, rf.Filename, rf.Original); err != nil {
+			changed = append(changed, filepath.Base(rf.Filename))
+			continue
+		}
+		reverted = append(reverted, rf)
+	}
+	if len(changed) > 0 {
+		return reverted, errors.New("could not revert " + strings.Join(changed, ", ") + ", since they are locked or have been changed")
+	}
+	return reverted, nil
+}
+
+// openFilesForReplace returns the files that are open in this instance of o. The current file may be changed
+// when replacing in all files in the project, since the editor contents are updated afterwards, but files that
+// are open in other buffers are left alone.
+func (e *Editor) openFilesForReplace() map[string]bool {
+	openFiles := make(map[string]bool)
+	for _, b := range openBuffers.buffers {
+		openFiles[b.absFilename] = false
+	}
+	if absFilename, err := e.AbsFilename(); err == nil {
+		openFiles[absFilename] = true
+	}
+	return openFiles
+}
+
+// reloadReplacedFile updates the editor contents if the current file is one of the given files,
+// in a way that can be undone in a single step
+func (e *Editor) reloadReplacedFile(replacedFiles []ReplacedFile, undo *Undo, reverting bool) {
+	absFilename, err := e.AbsFilename()
+	if err != nil {
+		return
+	}
+	for _, rf := range replacedFiles {
+		if rf.Filename != absFilename {
+			continue
+		}
+		data := rf.Replaced
+		if reverting {
+			data = rf.Original
+		}
+		// Decode the data, but keep the file format of the editor
+		_, data = DecodeFileData(data)
+		undo.Snapshot(e)
+		e.LoadBytes(data)
+		undo.Snapshot(e)
+		// The contents are the same as in the file
+		e.changed.Store(false)
+		e.redraw.Store(true)
+		e.redrawCursor.Store(true)
+	}
+}
+
+// AskToReplace shows a match with some lines of context, and asks what the user wants to do with it
+func (e *Editor) AskToReplace(c *vt100.Canvas, tty *vt100.TTY, rm ReplaceMatch) replaceDecision {
+	canvasBox := NewCanvasBox(c)
+	previewBox := NewBox()
+	previewBox.LowerPlacement(canvasBox, 40)
+	previewBox.H = min(previewBox.H, 2*replaceContextLines+6)
+	previewBox.Y = max((canvasBox.H-previewBox.H)/2, 0)
+
+	listBox := NewBox()
+	listBox.FillWithMargins(previewBox, 2, 1)
+
+	var (
+		items       []string
+		lineNumber  = int(rm.Line) - len(rm.Before)
+		numberWidth = len(fmt.Sprintf("%d", int(rm.Line)+len(rm.After)))
+	)
+	for _, line := range rm.Before {
+		items = append(items, fmt.Sprintf("  %*d  %s", numberWidth, lineNumber, line))
+		lineNumber++
+	}
+	items = append(items, fmt.Sprintf("- %*d  %s", numberWidth, lineNumber, rm.Old))
+	selected := len(items)
+	items = append(items, fmt.Sprintf("+ %*d  %s", numberWidth, lineNumber, rm.New))
+	for _, line := range rm.After {
+		lineNumber++
+		items = append(items, fmt.Sprintf("  %*d  %s", numberWidth, lineNumber, line))
+	}
+	items = trimToWidth(items, listBox.W)
+
+	bt := e.NewBoxTheme()
+	e.DrawBox(bt, c, previewBox)
+	e.DrawTitle(bt, c, previewBox, files.Relative(rm.Filename)+":"+rm.Line.String(), true)
+	e.DrawFooter(bt, c, previewBox, "y: replace, n: skip, a: rest of file, A: all, s: skip file, q: stop")
+	e.DrawList(bt, c, listBox, strings.Split(strings.ReplaceAll(strings.Join(items, "\n"), "\t", "    "), "\n"), selected)
+	c.HideCursorAndDraw()
+
+	for {
+		switch tty.String() {
+		case "y", "Y", "c:13": // y or return
+			return replaceYes
+		case "n", "N", " ": // n or space
+			return replaceNo
+		case "a":
+			return replaceRestOfFile
+		case "A", "!":
+			return replaceEverything
+		case "s", "S":
+			return replaceSkipFile
+		case "q", "Q", "c:27", "c:3", "c:17": // q, esc, ctrl-c or ctrl-q
+			return replaceStop
+		}
+	}
+}
+
+// ProjectReplacePrompt asks for something to search for and a replacement, then asks about each match in all files in the project
+func (e *Editor) ProjectReplacePrompt(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, undo *Undo) error {
+	query, ok := e.projectSearchQuery(c, tty, status, "Replace in project:")
+	if !ok {
+		return nil
+	}
+	replacement, ok := e.UserInput(c, tty, status, "Replace "+query+" with", "", []string{}, false, "")
+	if !ok {
+		return nil
+	}
+	return e.ReplaceInProject(c, tty, status, undo, query, replacement)
+}
+
+// ReplaceInProject replaces the given query with the given replacement in all files in the project,
+// after asking about each match. The changed files are written atomically, and the whole batch can be reverted.
+func (e *Editor) ReplaceInProject(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, undo *Undo, query, replacement string) error {
+	absFilename, err := e.AbsFilename()
+	if err != nil {
+		return err
+	}
+	root := projectRootDir(filepath.Dir(absFilename))
+
+	// Find the files with matches
+	ps := NewProjectSearch(root, query, e.searchOptions)
+	if err := ps.Run(e.IgnoreCaseByDefault(), projectSearchMaxTime); err != nil {
+		return err
+	}
+	if len(ps.Results) == 0 {
+		return errors.New(query + " not found in " + files.Relative(root))
+	}
+	var filenames []string
+	for _, r := range ps.Results {
+		if len(filenames) == 0 || filenames[len(filenames)-1] != r.Filename {
+			filenames = append(filenames, r.Filename)
+		}
+	}
+
+	// Save the current file first, so that unsaved changes are not lost
+	if e.changed.Load() && hasS(filenames, absFilename) {
+		if err := e.Save(c, tty); err != nil {
+			return err
+		}
+	}
+
+	pr := &ProjectReplace{Query: query, Replacement: replacement, Options: e.searchOptions}
+	decide := func(rm ReplaceMatch) replaceDecision {
+		return e.AskToReplace(c, tty, rm)
+	}
+	err = pr.Run(filenames, e.IgnoreCaseByDefault(), fileLock, e.openFilesForReplace(), decide)
+	e.redraw.Store(true)
+	e.redrawCursor.Store(true)
+	if err != nil {
+		return err
+	}
+	e.reloadReplacedFile(pr.Files, undo, false)
+	if len(pr.Files) > 0 {
+		lastProjectReplace = pr
+	}
+	if trimmedReplacement := strings.TrimSpace(replacement); trimmedReplacement != "" && !e.slowLoad {
+		replaceHistory.AddAndSave(trimmedReplacement)
+	}
+	summary := pr.Summary()
+	if ps.Stopped {
+		summary += " (stopped searching, not all files were searched)"
+	}
+	status.SetMessageAfterRedraw(summary)
+	return nil
+}
+
+// RevertProjectReplace writes back the original contents of the files that were changed by the last project replace
+func (e *Editor) RevertProjectReplace(status *StatusBar, undo *Undo) error {
+	if lastProjectReplace == nil {
+		return errors.New("nothing to revert")
+	}
+	reverted, err := lastProjectReplace.Revert(fileLock, e.openFilesForReplace())
+	e.reloadReplacedFile(reverted, undo, true)
+	lastProjectReplace = nil
+	e.redraw.Store(true)
+	e.redrawCursor.Store(true)
+	if err != nil {
+		return err
+	}
+	extraS := "s"
+	if len(reverted) == 1 {
+		extraS = ""
+	}
+	status.SetMessageAfterRedraw(fmt.Sprintf("Reverted %d file%s", len(reverted), extraS))
+	return nil
+}
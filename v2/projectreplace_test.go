@@ -0,0 +1,146 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProjectReplace(t *testing.T) {
+	root := t.TempDir()
+	write := func(name, contents string) string {
+		filename := filepath.Join(root, name)
+		if err := os.WriteFile(filename, []byte(contents), 0o640); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+	read := func(filename string) string {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	a := write("a.txt", "one cat, two cats\nno match\ncat\n")
+	b := write("b.txt", "cat cat\n")
+	c := write("c.txt", "cat\n")
+	d := write("d.txt", "cat\n")
+
+	// c.txt is locked by another instance of the editor, and d.txt is open in another buffer
+	lk := NewLockKeeper(filepath.Join(t.TempDir(), "lockfile.txt"))
+	lk.Lock(c)
+	lk.Save()
+	openFiles := map[string]bool{a: true, d: false}
+
+	var (
+		asked     []ReplaceMatch
+		decisions = []replaceDecision{replaceYes, replaceNo, replaceSkipFile}
+	)
+	decide := func(rm ReplaceMatch) replaceDecision {
+		asked = append(asked, rm)
+		decision := decisions[0]
+		decisions = decisions[1:]
+		return decision
+	}
+	pr := &ProjectReplace{Query: "cat", Replacement: "dog", Options: SearchOptions{WholeWord: true}}
+	if err := pr.Run([]string{a, b, c, d}, false, lk, openFiles, decide); err != nil {
+		t.Fatal(err)
+	}
+	if len(asked) != 3 {
+		t.Fatalf("expected to be asked about 3 matches, got %d", len(asked))
+	}
+	if asked[0].Old != "one cat, two cats" || asked[0].New != "one dog, two cats" || asked[0].Line != 1 || len(asked[0].After) != 2 {
+		t.Errorf("unexpected first match: %+v", asked[0])
+	}
+	if asked[1].Line != 3 || asked[1].Before[0] != "one dog, two cats" {
+		t.Errorf("unexpected second match: %+v", asked[1])
+	}
+	if got := read(a); got != "one dog, two cats\nno match\ncat\n" {
+		t.Errorf("unexpected contents of a.txt: %q", got)
+	}
+	if got := read(b); got != "cat cat\n" {
+		t.Errorf("b.txt should be unchanged, got %q", got)
+	}
+	if got := read(c); got != "cat\n" {
+		t.Errorf("the locked c.txt should be unchanged, got %q", got)
+	}
+	if got := read(d); got != "cat\n" {
+		t.Errorf("d.txt, that is open in another buffer, should be unchanged, got %q", got)
+	}
+	if len(pr.Files) != 1 || pr.Count() != 1 || len(pr.Skipped) != 2 {
+		t.Errorf("unexpected result: %d files, %d matches, %d skipped", len(pr.Files), pr.Count(), len(pr.Skipped))
+	}
+	if s := pr.Summary(); s != "Replaced 1 match in 1 file, skipped 2 locked or open files" {
+		t.Errorf("unexpected summary: %s", s)
+	}
+
+	// Replace everything, with a regular expression
+	decide = func(ReplaceMatch) replaceDecision { return replaceEverything }
+	pr = &ProjectReplace{Query: `(c)a(t)`, Replacement: "${2}a$1", Options: SearchOptions{Regex: true}}
+	if err := pr.Run([]string{a, b}, false, lk, openFiles, decide); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(a); got != "one dog, two tacs\nno match\ntac\n" {
+		t.Errorf("unexpected contents of a.txt: %q", got)
+	}
+	if got := read(b); got != "tac tac\n" {
+		t.Errorf("unexpected contents of b.txt: %q", got)
+	}
+	if pr.Count() != 4 {
+		t.Errorf("expected 4 replacements, got %d", pr.Count())
+	}
+	if fi, err := os.Stat(b); err != nil || fi.Mode().Perm() != 0o640 {
+		t.Errorf("expected the file permissions to be kept, got %v", fi.Mode().Perm())
+	}
+	if !lk.GetTimestamp(b).IsZero() {
+		t.Error("b.txt should be unlocked after it has been written")
+	}
+
+	// Revert the batch, but not b.txt, which has been changed since
+	write("b.txt", "changed\n")
+	reverted, err := pr.Revert(lk, openFiles)
+	if err == nil {
+		t.Error("expected an error, since b.txt has been changed")
+	}
+	if len(reverted) != 1 || reverted[0].Filename != a {
+		t.Errorf("expected only a.txt to be reverted, got %v", reverted)
+	}
+	if got := read(a); got != "one dog, two cats\nno match\ncat\n" {
+		t.Errorf("unexpected contents of a.txt after reverting: %q", got)
+	}
+	if got := read(b); got != "changed\n" {
+		t.Errorf("b.txt should not be reverted, got %q", got)
+	}
+}
+
+func TestProjectReplaceKeepsSymlinksAndEncoding(t *testing.T) {
+	root := t.TempDir()
+	target := filepath.Join(root, "latin1.txt")
+	if err := os.WriteFile(target, []byte("caf\xe9 cat\r\ncat\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(root, "link.txt")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+	decide := func(ReplaceMatch) replaceDecision { return replaceEverything }
+	pr := &ProjectReplace{Query: "cat", Replacement: "dög", Options: SearchOptions{WholeWord: true}}
+	if err := pr.Run([]string{link}, false, nil, nil, decide); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Lstat(link); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Error("expected the symbolic link to be kept")
+	}
+	data, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The file is still ISO-8859-1, and the mixed line endings are kept
+	if want := "caf\xe9 d\xf6g\r\nd\xf6g\n"; string(data) != want {
+		t.Errorf("expected %q, got %q", want, data)
+	}
+	if fi, err := os.Stat(target); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Error("expected the file permissions to be kept")
+	}
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xyproto/binary"
+	"github.com/xyproto/files"
+	"github.com/xyproto/vt100"
+)
+
+var (
+	// projectRootMarkers are the files and directories that mark the root directory of a project
+	projectRootMarkers = []string{"go.mod", "Cargo.toml", ".git"}
+
+	// Don't search through the project for longer than ~2 seconds
+	projectSearchMaxTime = 2 * time.Second
+
+	// Stop searching after this many matching lines
+	projectSearchMaxResults = 1000
+
+	// Skip files that are larger than this
+	projectSearchMaxFileSize int64 = 8 * 1024 * 1024
+
+	// The results of the most recent project search
+	projectSearch *ProjectSearch
+)
+
+// ProjectSearchResult is a line that matches a project search
+type ProjectSearchResult struct {
+	Filename string // absolute path
+	Text     string // the matching line, trimmed
+	Line     LineNumber
+	Column   ColNumber // the rune position of the first match on the line, starting at 1
+}
+
+// ProjectSearch is a search through all files in a project, and the results
+type ProjectSearch struct {
+	Root    string
+	Query   string
+	Results []ProjectSearchResult
+	Options SearchOptions
+	Current int  // the index of the result that was visited last, or -1
+	Stopped bool // the search was stopped before all files were searched, because of the time budget or the number of results
+}
+
+// String returns the result as a single line, with the filename relative to the current directory
+func (r ProjectSearchResult) String() string {
+	return files.Relative(r.Filename) + ":" + strconv.Itoa(int(r.Line)) + ": " + r.Text
+}
+
+// projectRootDir finds the root directory of the project that the given directory is in,
+// by looking for go.mod, Cargo.toml or .git in the directory and the directories above it.
+// Returns the given directory if no project root is found.
+func projectRootDir(dir string) string {
+	for d := dir; ; d = filepath.Dir(d) {
+		for _, marker := range projectRootMarkers {
+			if files.Exists(filepath.Join(d, marker)) {
+				return d
+			}
+		}
+		if parent := filepath.Dir(d); parent == d {
+			break
+		}
+	}
+	return dir
+}
+
+// NewProjectSearch prepares a search for the given query in all files below the given root directory
+func NewProjectSearch(root, query string, options SearchOptions) *ProjectSearch {
+	return &ProjectSearch{Root: root, Query: query, Options: options, Current: -1}
+}
+
+// walkProjectFiles calls visit for each regular file below the given root directory, skipping .git and .gitignore'd files and directories.
+// The walk stops if visit returns false, or if it takes longer than maxTime. Returns true if the walk was stopped.
+func walkProjectFiles(root string, maxTime time.Duration, visit func(path, relPath string, d fs.DirEntry) bool) (bool, error) {
+	errStop := errors.New("stop walking")
+	gitIgnore := &GitIgnore{}
+	startTime := time.Now()
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Skip files and directories that can not be read
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if time.Since(startTime) > maxTime {
+			return errStop
+		}
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		relPath = filepath.ToSlash(relPath)
+		if d.IsDir() {
+			if relPath != "." && (d.Name() == ".git" || gitIgnore.Ignored(relPath, true)) {
+				return filepath.SkipDir
+			}
+			gitIgnore.Load(root, relPath)
+			return nil
+		}
+		if !d.Type().IsRegular() || gitIgnore.Ignored(relPath, false) {
+			return nil
+		}
+		if !visit(path, relPath, d) {
+			return errStop
+		}
+		return nil
+	})
+	if err == errStop {
+		return true, nil
+	}
+	return false, err
+}
+
+// Run searches through all files below the root directory, skipping .gitignore'd files, binary files and large files.
+// ignoreCaseByDefault is used if the search options does not say if the case should be ignored or not.
+func (ps *ProjectSearch) Run(ignoreCaseByDefault bool, maxTime time.Duration) error {
+	m, err := NewSearchMatcher(ps.Query, ps.Options, ignoreCaseByDefault)
+	if err != nil {
+		return err
+	}
+	ps.Stopped, err = walkProjectFiles(ps.Root, maxTime, func(path, _ string, d fs.DirEntry) bool {
+		if info, err := d.Info(); err == nil && info.Size() <= projectSearchMaxFileSize {
+			ps.searchFile(path, m)
+		}
+		return len(ps.Results) < projectSearchMaxResults
+	})
+	return err
+}
+
+// searchFile adds the matching lines in the given file to the search results, unless it is a binary file
+func (ps *ProjectSearch) searchFile(path string, m *SearchMatcher) {
+	data, err := os.ReadFile(path)
+	if err != nil || binary.Data(data) {
+		return
+	}
+	absFilename, err := filepath.Abs(path)
+	if err != nil {
+		return
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		x := m.Index(line, 0)
+		if x < 0 {
+			continue
+		}
+		ps.Results = append(ps.Results, ProjectSearchResult{
+			Filename: absFilename,
+			Text:     strings.TrimSpace(strings.TrimRight(line, "\r")),
+			Line:     LineIndex(i).LineNumber(),
+			Column:   ColNumber(utf8.RuneCountInString(line[:x]) + 1),
+		})
+		if len(ps.Results) >= projectSearchMaxResults {
+			return
+		}
+	}
+}
+
+// Summary returns a short description of the search results, like "12 matches for x"
+func (ps *ProjectSearch) Summary() string {
+	extraS := ""
+	if len(ps.Results) != 1 {
+		extraS = "es"
+	}
+	s := fmt.Sprintf("%d match%s for %s", len(ps.Results), extraS, ps.Query)
+	if ps.Stopped {
+		s += " (stopped searching)"
+	}
+	return s
+}
+
+// SearchProject searches for the given query in all files in the current project, and shows the results
+func (e *Editor) SearchProject(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, query string) error {
+	absFilename, err := e.AbsFilename()
+	if err != nil {
+		return err
+	}
+	root := projectRootDir(filepath.Dir(absFilename))
+	status.ClearAll(c, false)
+	status.SetMessage("Searching " + files.Relative(root) + "...")
+	status.ShowNoTimeout(c, e)
+	ps := NewProjectSearch(root, query, e.searchOptions)
+	err = ps.Run(e.IgnoreCaseByDefault(), projectSearchMaxTime)
+	status.ClearAll(c, true)
+	if err != nil {
+		return err
+	}
+	if len(ps.Results) == 0 {
+		return errors.New(query + " not found in " + files.Relative(root))
+	}
+	projectSearch = ps
+	return e.ProjectSearchResults(c, tty, status)
+}
+
+// ProjectSearchPrompt asks the user for something to search for in all files in the current project, then searches
+func (e *Editor) ProjectSearchPrompt(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) error {
+	query, ok := e.projectSearchQuery(c, tty, status, "Search in project:")
+	if !ok {
+		return nil
+	}
+	return e.SearchProject(c, tty, status, query)
+}
+
+// projectSearchQuery asks the user for something to search for in all files in the current project.
+// ctrl-r, ctrl-k and ctrl-w toggles the same search options as for ctrl-f.
+// Returns false if the user cancelled.
+func (e *Editor) projectSearchQuery(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, basePrompt string) (string, bool) {
+	// Attempt to load the search history. Ignores errors, but does not try to load it twice if it fails.
+	if searchHistory.Len() == 0 && !searchHistory.FailedToLoad() {
+		searchHistory = LoadSearchHistory()
+	}
+
+	e.searchOptions = searchOptions
+
+	var (
+		prompt       = e.searchPromptWithOptions(basePrompt)
+		entered      string
+		historyIndex = searchHistory.Len()
+	)
+	const newestFirst = false
+
+	showPrompt := func() {
+		status.ClearAll(c, false)
+		status.SetMessage(prompt + " " + entered)
+		status.ShowNoTimeout(c, e)
+	}
+
+	showPrompt()
+	for {
+		switch key := tty.String(); key {
+		case "c:27", "c:3", "c:17": // esc, ctrl-c or ctrl-q
+			status.ClearAll(c, true)
+			return "", false
+		case "c:8", "c:127": // ctrl-h or backspace
+			if len(entered) > 0 {
+				entered = entered[:len(entered)-1]
+				showPrompt()
+			}
+		case "c:18", "c:11", "c:23": // ctrl-r, ctrl-k or ctrl-w, toggle regex, cycle through the case options or toggle whole word
+			e.toggleSearchOption(key)
+			prompt = e.searchPromptWithOptions(basePrompt)
+			showPrompt()
+		case upArrow, downArrow: // browse the search history
+			if searchHistory.Empty() {
+				break
+			}
+			if key == upArrow {
+				historyIndex--
+			} else {
+				historyIndex++
+			}
+			if historyIndex < 0 {
+				// wraparound
+				historyIndex = searchHistory.Len() - 1
+			} else if historyIndex >= searchHistory.Len() {
+				// wraparound
+				historyIndex = 0
+			}
+			entered = searchHistory.GetIndex(historyIndex, newestFirst)
+			showPrompt()
+		case "c:13": // return
+			query := entered
+			if query == "" {
+				// Search for the current word, like when pressing ctrl-f twice
+				query = e.CurrentWord()
+			}
+			if query == "" {
+				break
+			}
+			if trimmedQuery := strings.TrimSpace(query); trimmedQuery != "" && !e.slowLoad {
+				searchHistory.AddAndSave(trimmedQuery)
+			}
+			return query, true
+		default:
+			if key != "" && !strings.HasPrefix(key, "c:") {
+				entered += key
+				showPrompt()
+			}
+		}
+	}
+}
+
+// GoToProjectSearchResult opens the file of the given project search result, at the matching line
+func (e *Editor) GoToProjectSearchResult(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, index int) error {
+	if projectSearch == nil || index < 0 || index >= len(projectSearch.Results) {
+		return fmt.Errorf("no search result number %d", index+1)
+	}
+	r := projectSearch.Results[index]
+
+	oldFilename := e.filename
+	oldLineIndex := e.LineIndex()
+
+	if absFilename, err := e.AbsFilename(); err != nil || absFilename != r.Filename {
+		if _, err := os.Stat(r.Filename); err != nil {
+			return err
+		}
+		// The switch buffer is for going back and forth between two files, so forget it when going to a third file
+		if switchBuffer != nil {
+			if absSwitchFilename, err := switchBuffer.AbsFilename(); err != nil || absSwitchFilename != r.Filename {
+				switchBuffer = nil
+				switchUndoBackup = NewUndo(defaultUndoCount, defaultUndoMemory)
+			}
+		}
+		if err := e.Switch(c, tty, status, fileLock, r.Filename); err != nil {
+			return err
+		}
+		// Push a function for how to go back
+		backFunctions = append(backFunctions, func() {
+			if e.filename != oldFilename {
+				e.Switch(c, tty, status, fileLock, oldFilename)
+			}
+			redraw, _ := e.GoTo(oldLineIndex, c, status)
+			e.redraw.Store(redraw)
+		})
+	}
+	projectSearch.Current = index
+
+	// Highlight the matches, and let ctrl-n go to the next match in this file
+	e.searchOptions = projectSearch.Options
+	e.searchTerm = projectSearch.Query
+	e.stickySearchTerm = projectSearch.Query
+
+	const ignoreIndentation = false
+	e.MoveToLineColumnNumber(c, status, int(r.Line), int(r.Column), ignoreIndentation)
+	e.Center(c)
+	e.redraw.Store(true)
+	e.redrawCursor.Store(true)
+	status.SetMessageAfterRedraw(fmt.Sprintf("(%d/%d) %s", index+1, len(projectSearch.Results), r.Text))
+	return nil
+}
+
+// ProjectSearchResults shows the results of the most recent project search in a scrollable list,
+// where return opens the file at the selected line.
+func (e *Editor) ProjectSearchResults(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar) error {
+	if projectSearch == nil || len(projectSearch.Results) == 0 {
+		return errors.New("no search results, search in the project first")
+	}
+	var (
+		n        = len(projectSearch.Results)
+		selected = max(projectSearch.Current, 0)
+		offset   int
+	)
+	for {
+		canvasBox := NewCanvasBox(c)
+		resultsBox := NewBox()
+		resultsBox.FillWithMargins(canvasBox, 2, 1)
+		resultsBox.H-- // leave room for the status bar
+
+		listBox := NewBox()
+		listBox.FillWithMargins(resultsBox, 2, 1)
+		visibleCount := max(listBox.H, 1)
+
+		// Scroll the list so that the selected result is visible
+		if selected < offset {
+			offset = selected
+		} else if selected >= offset+visibleCount {
+			offset = selected - visibleCount + 1
+		}
+		end := min(offset+visibleCount, n)
+		items := make([]string, 0, end-offset)
+		for _, r := range projectSearch.Results[offset:end] {
+			items = append(items, r.String())
+		}
+		items = trimToWidth(items, listBox.W)
+
+		bt := e.NewBoxTheme()
+		e.DrawBox(bt, c, resultsBox)
+		e.DrawTitle(bt, c, resultsBox, projectSearch.Summary(), true)
+		e.DrawFooter(bt, c, resultsBox, fmt.Sprintf("%d/%d, return to open, esc to close", selected+1, n))
+		e.DrawList(bt, c, listBox, items, selected-offset)
+		c.HideCursorAndDraw()
+
+		switch tty.String() {
+		case upArrow, "c:16": // up or ctrl-p
+			if selected > 0 {
+				selected--
+			}
+		case downArrow, "c:14": // down or ctrl-n
+			if selected < n-1 {
+				selected++
+			}
+		case pgUpKey:
+			selected = max(selected-visibleCount, 0)
+		case pgDnKey:
+			selected = min(selected+visibleCount, n-1)
+		case homeKey, "c:1": // home or ctrl-a
+			selected = 0
+		case endKey, "c:5": // end or ctrl-e
+			selected = n - 1
+		case "c:13": // return
+			return e.GoToProjectSearchResult(c, tty, status, selected)
+		case "c:27", "c:3", "c:17", "q": // esc, ctrl-c, ctrl-q or q
+			e.redraw.Store(true)
+			e.redrawCursor.Store(true)
+			return nil
+		}
+	}
+}
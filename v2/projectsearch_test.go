@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestProjectSearch(t *testing.T) {
+	root := t.TempDir()
+	write := func(name, contents string) {
+		filename := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("go.mod", "module example.com/greeting\n")
+	write(".gitignore", "ignored/\n*.log\n")
+	write("main.go", "package main\n\nfunc main() {\n\thello()\n}\n")
+	write("hello/hello.go", "package main\n\nfunc hello() {\n\tprintln(\"Hello, World\")\n}\n")
+	write("hello/hello_test.go", "package main\n// helloWorld is not a whole word match\n")
+	write("ignored/hello.go", "hello\n")
+	write("debug.log", "hello\n")
+	write(".git/HEAD", "hello\n")
+	write("hello.bin", "hello\x00\x01\x02\x03\x00\x00\xff\xfe")
+
+	if got := projectRootDir(filepath.Join(root, "hello")); got != root {
+		t.Errorf("expected the project root to be %s, got %s", root, got)
+	}
+
+	ps := NewProjectSearch(root, "hello", SearchOptions{WholeWord: true})
+	if err := ps.Run(false, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if len(ps.Results) != 2 || ps.Stopped {
+		t.Fatalf("expected 2 results, got %v", ps.Results)
+	}
+	first, second := ps.Results[0], ps.Results[1]
+	if first.Filename != filepath.Join(root, "hello", "hello.go") || first.Line != 3 || first.Column != 6 || first.Text != "func hello() {" {
+		t.Errorf("unexpected first result: %+v", first)
+	}
+	if second.Filename != filepath.Join(root, "main.go") || second.Line != 4 || second.Column != 2 {
+		t.Errorf("unexpected second result: %+v", second)
+	}
+
+	// A case-insensitive regular expression, that also matches "Hello" and "helloWorld"
+	ps = NewProjectSearch(root, `hel+o`, SearchOptions{Regex: true, Case: searchCaseInsensitive})
+	if err := ps.Run(false, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if len(ps.Results) != 4 {
+		t.Errorf("expected 4 results, got %v", ps.Results)
+	}
+
+	ps = NewProjectSearch(root, "(", SearchOptions{Regex: true})
+	if err := ps.Run(false, 10*time.Second); err == nil {
+		t.Errorf("expected an error for an invalid regular expression")
+	}
+}
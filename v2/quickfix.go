@@ -0,0 +1,365 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/xyproto/files"
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+// Diagnostic is an error, warning or note from a compiler or linter, at a given location
+type Diagnostic struct {
+	Filename string
+	Severity string // "error", "warning" or "note"
+	Message  string
+	Line     int // line number, starting at 1
+	Column   int // column number, starting at 1, or 0 if not known
+}
+
+// diagnosticParser describes one format of compiler output.
+// If header is set, the severity and message are found on one line, and the location on a following line.
+// The group fields are the submatch indexes in the regular expressions, or 0 if they are not present.
+type diagnosticParser struct {
+	name            string
+	header          *regexp.Regexp // optional, for formats where the message comes before the location
+	location        *regexp.Regexp
+	defaultSeverity string
+	file            int
+	line            int
+	column          int
+	severity        int // submatch index in header if header is set, otherwise in location
+	message         int // submatch index in header if header is set, otherwise in location
+}
+
+// diagnosticParsers are tried in order, for each line of the build output
+var diagnosticParsers = []diagnosticParser{
+	{
+		// rustc and cargo:
+		// error[E0308]: mismatched types
+		//  --> src/main.rs:2:18
+		name:     "rust",
+		header:   regexp.MustCompile(`^(error|warning)(?:\[\w+\])?: (.+)$`),
+		location: regexp.MustCompile(`^\s*--> (.+):(\d+):(\d+)$`),
+		file:     1, line: 2, column: 3, severity: 1, message: 2,
+	},
+	{
+		// gcc, clang, go vet, zig and more:
+		// main.c:4:20: error: 'y' undeclared (first use in this function)
+		name:            "gnu",
+		location:        regexp.MustCompile(`^(?:vet: )?([^\s:#][^:]*):(\d+):(\d+): (?:(fatal error|error|warning|note)(?:\[[\w-]+\])?: )?(.+)$`),
+		defaultSeverity: "error",
+		file:            1, line: 2, column: 3, severity: 4, message: 5,
+	},
+	{
+		// C# and Object Pascal:
+		// Program.cs(7,13): error CS0103: The name 'x' does not exist in the current context
+		name:            "msbuild",
+		location:        regexp.MustCompile(`^(\S[^(]*)\((\d+),(\d+)\):? (error|warning|Error|Warning|Fatal|Note)(?: \w+)?: (.+)$`),
+		defaultSeverity: "error",
+		file:            1, line: 2, column: 3, severity: 4, message: 5,
+	},
+	{
+		// Odin:
+		// /home/user/main.odin(5:2) Undeclared name: x
+		name:            "odin",
+		location:        regexp.MustCompile(`^(\S[^(]*)\((\d+):(\d+)\) (.+)$`),
+		defaultSeverity: "error",
+		file:            1, line: 2, column: 3, message: 4,
+	},
+	{
+		// Lua, older Go versions and others, without a column:
+		// main.lua:3: '=' expected near 'x'
+		name:            "nocolumn",
+		location:        regexp.MustCompile(`^(?:\w+: )?([^\s:#][^:]*):(\d+): (.+)$`),
+		defaultSeverity: "error",
+		file:            1, line: 2, message: 3,
+	},
+}
+
+// normalizeSeverity converts the severity found in the compiler output to "error", "warning" or "note"
+func normalizeSeverity(severity string) string {
+	switch strings.ToLower(severity) {
+	case "warning":
+		return "warning"
+	case "note", "help", "info":
+		return "note"
+	default:
+		return "error"
+	}
+}
+
+// ParseDiagnostics finds all errors, warnings and notes in the given build output.
+// Relative filenames are resolved by looking in dir and the directories above it.
+func ParseDiagnostics(output, dir string) []Diagnostic {
+	var (
+		diagnostics []Diagnostic
+		seen        = make(map[Diagnostic]bool)
+		// For formats where the message comes before the location
+		pendingParser   *diagnosticParser
+		pendingSeverity string
+		pendingMessage  string
+	)
+	add := func(d Diagnostic) {
+		d.Filename = resolveDiagnosticFilename(d.Filename, dir)
+		if !seen[d] {
+			seen[d] = true
+			diagnostics = append(diagnostics, d)
+		}
+	}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if pendingParser != nil {
+			if m := pendingParser.location.FindStringSubmatch(line); m != nil {
+				lineNumber, _ := strconv.Atoi(m[pendingParser.line])
+				columnNumber, _ := strconv.Atoi(m[pendingParser.column])
+				add(Diagnostic{m[pendingParser.file], pendingSeverity, pendingMessage, lineNumber, columnNumber})
+				pendingParser = nil
+				continue
+			}
+		}
+	NEXTPARSER:
+		for i := range diagnosticParsers {
+			p := &diagnosticParsers[i]
+			if p.header != nil {
+				if m := p.header.FindStringSubmatch(line); m != nil {
+					pendingParser = p
+					pendingSeverity = normalizeSeverity(m[p.severity])
+					pendingMessage = strings.TrimSpace(m[p.message])
+					break NEXTPARSER
+				}
+				continue
+			}
+			m := p.location.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			d := Diagnostic{Filename: m[p.file], Severity: p.defaultSeverity}
+			d.Line, _ = strconv.Atoi(m[p.line])
+			if p.column > 0 {
+				d.Column, _ = strconv.Atoi(m[p.column])
+			}
+			if p.severity > 0 && m[p.severity] != "" {
+				d.Severity = normalizeSeverity(m[p.severity])
+			}
+			d.Message = strings.TrimSpace(m[p.message])
+			add(d)
+			break
+		}
+	}
+	return diagnostics
+}
+
+// resolveDiagnosticFilename finds the absolute path for a filename from the build output,
+// by looking in the given directory and the directories above it (for cargo workspaces, for instance).
+func resolveDiagnosticFilename(filename, dir string) string {
+	if filepath.IsAbs(filename) || dir == "" {
+		return filepath.Clean(filename)
+	}
+	for d := dir; ; d = filepath.Dir(d) {
+		if candidate := filepath.Join(d, filename); files.Exists(candidate) {
+			return candidate
+		}
+		if parent := filepath.Dir(d); parent == d {
+			break
+		}
+	}
+	return filepath.Join(dir, filename)
+}
+
+// String returns the diagnostic as a single line, with the filename relative to the current directory
+func (d Diagnostic) String() string {
+	var sb strings.Builder
+	sb.WriteString(files.Relative(d.Filename))
+	sb.WriteString(":" + strconv.Itoa(d.Line))
+	if d.Column > 0 {
+		sb.WriteString(":" + strconv.Itoa(d.Column))
+	}
+	sb.WriteString(": " + d.Severity + ": " + d.Message)
+	return sb.String()
+}
+
+// QuickfixList is the list of diagnostics from the last build, and the one that was visited last
+type QuickfixList struct {
+	diagnostics []Diagnostic
+	current     int  // index of the diagnostic that was visited last, or -1
+	visible     bool // is the quickfix panel visible
+}
+
+// quickfix is the diagnostics from the most recent build
+var quickfix = &QuickfixList{current: -1}
+
+// quickfixModes are the modes where the first error from the quickfix list is used when a build fails
+var quickfixModes = map[mode.Mode]bool{
+	mode.C:    true,
+	mode.Cpp:  true,
+	mode.Go:   true,
+	mode.Rust: true,
+	mode.Zig:  true,
+}
+
+// Set replaces the diagnostics in the quickfix list. Errors are placed before warnings and notes.
+func (q *QuickfixList) Set(diagnostics []Diagnostic) {
+	var errs, rest []Diagnostic
+	for _, d := range diagnostics {
+		if d.Severity == "error" {
+			errs = append(errs, d)
+		} else {
+			rest = append(rest, d)
+		}
+	}
+	q.diagnostics = append(errs, rest...)
+	q.current = -1
+	q.visible = len(q.diagnostics) > 1
+}
+
+// Len returns the number of diagnostics in the quickfix list
+func (q *QuickfixList) Len() int {
+	return len(q.diagnostics)
+}
+
+// Clear removes all diagnostics and hides the quickfix panel
+func (q *QuickfixList) Clear() {
+	q.diagnostics = nil
+	q.current = -1
+	q.visible = false
+}
+
+// HasErrors checks if there is at least one error (not just warnings) in the quickfix list
+func (q *QuickfixList) HasErrors() bool {
+	return len(q.diagnostics) > 0 && q.diagnostics[0].Severity == "error"
+}
+
+// Visible checks if the quickfix panel should be drawn
+func (q *QuickfixList) Visible() bool {
+	return q.visible && len(q.diagnostics) > 0
+}
+
+// Hide hides the quickfix panel, but keeps the diagnostics
+func (q *QuickfixList) Hide() {
+	q.visible = false
+}
+
+// GoToDiagnostic moves the cursor to the given diagnostic, opening the file in a new buffer if needed
+func (e *Editor) GoToDiagnostic(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, index int) error {
+	if index < 0 || index >= quickfix.Len() {
+		return fmt.Errorf("no diagnostic number %d", index+1)
+	}
+	d := quickfix.diagnostics[index]
+	if absFilename, err := e.AbsFilename(); err != nil || absFilename != d.Filename {
+		if _, err := os.Stat(d.Filename); err != nil {
+			return err
+		}
+		var lk *LockKeeper
+		if !e.monitorAndReadOnly {
+			lk = fileLock
+		}
+		if err := e.OpenBuffer(c, tty, status, lk, d.Filename); err != nil {
+			return err
+		}
+	}
+	quickfix.current = index
+	column := d.Column
+	if column < 1 {
+		column = 1
+	}
+	const ignoreIndentation = false
+	e.MoveToLineColumnNumber(c, status, d.Line, column, ignoreIndentation)
+	e.redraw.Store(true)
+	e.redrawCursor.Store(true)
+	status.SetMessageAfterRedraw(fmt.Sprintf("(%d/%d) %s: %s", index+1, quickfix.Len(), d.Severity, d.Message))
+	return nil
+}
+
+// NextDiagnostic moves to the next (or previous) diagnostic in the quickfix list, wrapping around at the ends
+func (e *Editor) NextDiagnostic(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, forward bool) error {
+	n := quickfix.Len()
+	if n == 0 {
+		return fmt.Errorf("no build errors")
+	}
+	index := quickfix.current
+	if forward {
+		index = (index + 1) % n
+	} else if index <= 0 {
+		index = n - 1
+	} else {
+		index--
+	}
+	return e.GoToDiagnostic(c, tty, status, index)
+}
+
+// firstDiagnosticError moves to the first error in the quickfix list, if it is in the current file,
+// and returns an error with the message. Returns nil if there are no errors in the quickfix list.
+func (e *Editor) firstDiagnosticError(c *vt100.Canvas, status *StatusBar) error {
+	if !quickfix.HasErrors() {
+		return nil
+	}
+	d := quickfix.diagnostics[0]
+	absFilename, err := e.AbsFilename()
+	if err != nil || absFilename != d.Filename {
+		// Let ctrl-n open the file with the first error
+		return fmt.Errorf("in %s: %s", filepath.Base(d.Filename), d.Message)
+	}
+	quickfix.current = 0
+	column := d.Column
+	if column < 1 {
+		column = 1
+	}
+	const ignoreIndentation = false
+	e.MoveToLineColumnNumber(c, status, d.Line, column, ignoreIndentation)
+	return fmt.Errorf("%s", d.Message)
+}
+
+// DrawQuickfix draws the quickfix panel, with the diagnostics from the last build
+func (e *Editor) DrawQuickfix(c *vt100.Canvas, repositionCursor bool) {
+	if !quickfix.Visible() || c == nil {
+		return
+	}
+
+	canvasBox := NewCanvasBox(c)
+	lowerBox := NewBox()
+	lowerBox.EvenLowerRightPlacement(canvasBox, 40)
+	lowerBox.X = 2
+	lowerBox.W = canvasBox.W - 4
+	lowerBox.H = min(quickfix.Len()+2, max(canvasBox.H/4, 4))
+	lowerBox.Y = canvasBox.H - lowerBox.H - 1
+
+	listBox := NewBox()
+	listBox.FillWithMargins(lowerBox, 2, 1)
+
+	// Scroll the list so that the current diagnostic is visible
+	visibleCount := listBox.H
+	offset := 0
+	if quickfix.current >= visibleCount {
+		offset = quickfix.current - visibleCount + 1
+	}
+	end := min(offset+visibleCount, quickfix.Len())
+	items := make([]string, 0, end-offset)
+	for _, d := range quickfix.diagnostics[offset:end] {
+		s := d.String()
+		if maxWidth := listBox.W; len([]rune(s)) > maxWidth && maxWidth > 3 {
+			s = string([]rune(s)[:maxWidth-3]) + "..."
+		}
+		items = append(items, s)
+	}
+
+	bt := e.NewBoxTheme()
+	bt.Background = &e.DebugInstructionsBackground
+	e.DrawBox(bt, c, lowerBox)
+	e.DrawTitle(bt, c, lowerBox, fmt.Sprintf("Build errors and warnings (%d)", quickfix.Len()), true)
+	e.DrawFooter(bt, c, lowerBox, "ctrl-n next, ctrl-p previous, esc to close")
+	e.DrawList(bt, c, listBox, items, quickfix.current-offset)
+
+	// Blit
+	c.HideCursorAndDraw()
+
+	// Reposition the cursor
+	if repositionCursor {
+		e.EnableAndPlaceCursor(c)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseDiagnostics(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		filename string
+		expected []Diagnostic
+	}{
+		{"build_go.txt", []Diagnostic{
+			{filepath.Join(dir, "main.go"), "error", "declared and not used: x", 7, 6},
+			{filepath.Join(dir, "main.go"), "error", "undefined: undefinedThing", 8, 14},
+			{filepath.Join(dir, "main.go"), "error", "declared and not used: y", 9, 2},
+			{filepath.Join(dir, "other.go"), "error", "cannot use 42 (untyped int constant) as string value in return statement", 4, 9},
+		}},
+		{"build_govet.txt", []Diagnostic{
+			{filepath.Join(dir, "main.go"), "error", "copyLock passes lock by value: sync.Mutex", 8, 17},
+			{filepath.Join(dir, "main.go"), "error", "call of copyLock copies lock value: sync.Mutex", 13, 11},
+			{filepath.Join(dir, "main.go"), "error", `fmt.Printf format %d has arg "hello" of wrong type string`, 11, 14},
+		}},
+		{"build_gcc.txt", []Diagnostic{
+			{"/tmp/qf/a.c", "warning", "initialization of 'int' from 'char *' makes integer from pointer without a cast [-Wint-conversion]", 3, 13},
+			{"/tmp/qf/a.c", "error", "'y' undeclared (first use in this function)", 4, 20},
+			{"/tmp/qf/a.c", "note", "each undeclared identifier is reported only once for each function it appears in", 4, 20},
+			{"/tmp/qf/a.c", "error", "'z' undeclared (first use in this function)", 5, 12},
+			{"/tmp/qf/a.c", "warning", "unused variable 'x' [-Wunused-variable]", 3, 9},
+		}},
+		{"build_cargo.txt", []Diagnostic{
+			{filepath.Join(dir, "src", "main.rs"), "warning", "unused variable: `unused`", 2, 9},
+			{filepath.Join(dir, "src", "main.rs"), "error", "cannot find macro `rintln` in this scope", 3, 5},
+			{filepath.Join(dir, "src", "main.rs"), "error", "mismatched types", 2, 18},
+			{filepath.Join(dir, "src", "main.rs"), "error", "cannot move out of `v` because it is borrowed", 5, 10},
+		}},
+		{"build_csharp.txt", []Diagnostic{
+			{filepath.Join(dir, "Program.cs"), "error", "The name 'x' does not exist in the current context", 7, 13},
+			{filepath.Join(dir, "Program.cs"), "warning", "The variable 'y' is declared but never used", 9, 17},
+		}},
+	}
+	for _, test := range tests {
+		data, err := os.ReadFile(filepath.Join("test", test.filename))
+		if err != nil {
+			t.Fatal(err)
+		}
+		diagnostics := ParseDiagnostics(string(data), dir)
+		if len(diagnostics) != len(test.expected) {
+			t.Errorf("%s: expected %d diagnostics, got %d: %v", test.filename, len(test.expected), len(diagnostics), diagnostics)
+			continue
+		}
+		for i, d := range diagnostics {
+			if d != test.expected[i] {
+				t.Errorf("%s: expected diagnostic %d to be %v, got %v", test.filename, i, test.expected[i], d)
+			}
+		}
+	}
+}
+
+func TestQuickfixList(t *testing.T) {
+	var q QuickfixList
+	q.Set([]Diagnostic{
+		{"a.c", "warning", "unused variable", 3, 9},
+		{"a.c", "error", "undeclared", 4, 20},
+		{"b.c", "error", "undeclared", 5, 12},
+	})
+	if q.Len() != 3 || !q.HasErrors() || !q.Visible() {
+		t.Fatalf("expected three diagnostics and a visible quickfix panel")
+	}
+	// Errors are placed before warnings
+	if q.diagnostics[0].Line != 4 || q.diagnostics[1].Filename != "b.c" || q.diagnostics[2].Severity != "warning" {
+		t.Errorf("unexpected order of diagnostics: %v", q.diagnostics)
+	}
+	q.Hide()
+	if q.Visible() || q.Len() != 3 {
+		t.Errorf("expected the diagnostics to be kept after hiding the panel")
+	}
+	q.Set([]Diagnostic{{"a.c", "warning", "unused variable", 3, 9}})
+	if q.HasErrors() || q.Visible() {
+		t.Errorf("expected only warnings, and no panel for a single diagnostic")
+	}
+}
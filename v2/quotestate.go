@@ -236,3 +236,34 @@ func (q *QuoteState) ParBraCount(line string) (int, int) {
 	qCopy.Process(line)
 	return qCopy.parCount, qCopy.braCount
 }
+
+// BracketDepth takes a line of text and modifies the current quote state, like Process.
+// Returns how much the nesting depth of (), [] and {} has changed at the end of the line,
+// and the lowest change that was reached within the line. Brackets in strings and comments are skipped.
+func (q *QuoteState) BracketDepth(line string) (int, int) {
+	q.hasSingleLineComment = false
+	q.startedMultiLineString = false
+	q.stoppedMultiLineComment = false
+	q.containsMultiLineComments = false
+	var (
+		depth, lowest int
+		prevRune      = '\n'
+		prevPrevRune  = '\n'
+	)
+	for _, r := range line {
+		q.ProcessRune(r, prevRune, prevPrevRune)
+		prevPrevRune = prevRune
+		prevRune = r
+		if !q.None() {
+			continue
+		}
+		switch r {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+			lowest = min(lowest, depth)
+		}
+	}
+	return depth, lowest
+}
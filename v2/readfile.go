@@ -1,51 +1,42 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
-	"io"
 	"os"
 	"strings"
-	"sync"
 
 	"github.com/xyproto/binary"
 )
 
 // ReadFileAndProcessLines reads the named file concurrently, processes its lines, and updates the Editor.
 func (e *Editor) ReadFileAndProcessLines(filename string) error {
+	if isLargeFile(filename) {
+		if loaded, err := e.LoadLargeFile(filename); err != nil || loaded {
+			return err
+		}
+		// Not a UTF-8 text file, so read all of it
+	}
 	data, err := os.ReadFile(filename)
 	if err != nil {
 		return err
 	}
-	if strings.HasSuffix(filename, ".gz") {
-		data, err = gUnzipData(data)
-		if err != nil {
-			return err
-		}
+	if data, err = decompressFileData(filename, data); err != nil {
+		return err
 	}
+	e.fileFormat, data = DecodeFileData(data)
 	e.binaryFile = binary.Data(data)
+	if !e.binaryFile {
+		data = []byte(lineEndingReplacer.Replace(string(data)))
+	}
 
 	var (
-		reader           = bufio.NewReader(bytes.NewReader(data))
-		lines            = make(map[int][]rune)
-		index            int
+		// Split the data into lines, that share memory with the data that was read
+		lines            = strings.Split(string(data), "\n")
 		tabIndentCounter int64
 		first            byte
 	)
 
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil && err != io.EOF {
-			return err
-		}
-		// Remove the newline character at the end of the line
-		if len(line) > 0 && line[len(line)-1] == '\n' {
-			line = line[:len(line)-1]
-		}
-		if e.binaryFile {
-			lines[index] = []rune(line)
-		} else {
-			line = opinionatedStringReplacer.Replace(line)
+	if !e.binaryFile {
+		for _, line := range lines {
 			if len(line) > 2 {
 				first = line[0]
 				if first == '\t' {
@@ -54,16 +45,10 @@ func (e *Editor) ReadFileAndProcessLines(filename string) error {
 					tabIndentCounter--
 				}
 			}
-			lines[index] = []rune(line)
-		}
-		index++
-
-		if err == io.EOF {
-			break
 		}
 	}
 	e.Clear()
-	e.lines = lines
+	e.lines = NewLines(lines)
 	if detectedTabs := tabIndentCounter > 0; !e.binaryFile && e.indentation.Spaces {
 		e.detectedTabs = &detectedTabs
 		e.indentation.Spaces = !detectedTabs
@@ -72,69 +57,52 @@ func (e *Editor) ReadFileAndProcessLines(filename string) error {
 	return nil
 }
 
-// LoadByteLine loads a single byte line
-func (e *Editor) LoadByteLine(ib IndexByteLine, eMut, tcMut *sync.RWMutex, tabIndentCounter, numLines *int, wg *sync.WaitGroup) {
-	// Require at least two bytes. Ignore lines with a single tab indentation or a single space
-	if len(ib.byteLine) > 2 {
-		first := ib.byteLine[0]
-		if first == '\t' {
-			tcMut.Lock()
-			*tabIndentCounter++ // a tab indentation counts like a positive tab indentation
-			tcMut.Unlock()
-		} else if first == ' ' && ib.byteLine[1] == ' ' { // assume that two spaces is the smallest space indentation
-			tcMut.Lock()
-			*tabIndentCounter-- // a space indentation counts like a negative tab indentation
-			tcMut.Unlock()
-		}
-	}
-	eMut.Lock()
-	e.lines[ib.index] = []rune(string(ib.byteLine))
-	*numLines++
-	eMut.Unlock()
-	wg.Done()
+// DecodeAndLoadBytes detects the character encoding and line endings of the given bytes, as read from a file or stdin,
+// and then replaces the current editor contents with the decoded text
+func (e *Editor) DecodeAndLoadBytes(data []byte) {
+	var fileFormat FileFormat
+	fileFormat, data = DecodeFileData(data)
+	e.LoadBytes(data)
+	e.fileFormat = fileFormat
 }
 
-// LoadBytes replaces the current editor contents with the given bytes
+// LoadBytes replaces the current editor contents with the given bytes.
+// The file format that is used when saving is kept as it is, since the contents are often reloaded from e.String().
 func (e *Editor) LoadBytes(data []byte) {
-	lineCount := bytes.Count(data, []byte{'\n'}) + 1
-
-	// Prepare an empty map to load the lines into
 	e.Clear()
-	e.lines = make(map[int][]rune, lineCount)
 
 	e.binaryFile = binary.Data(data)
+	if !e.binaryFile {
+		data = []byte(lineEndingReplacer.Replace(string(data)))
+	}
 
 	var (
-		// Split the bytes into lines
-		byteLines = bytes.Split(data, []byte{'\n'})
+		// Split the bytes into lines, that share memory with a single string
+		lines = strings.Split(string(data), "\n")
 
-		// Place the lines into the editor, while counting tab indentations vs space indentations
+		// Count tab indentations vs space indentations
 		tabIndentCounter int
-
-		// Count the number of lines as the lines are being processed
-		numLines int
-
-		// Mutex for the editor lines and the numLines counter
-		eMut sync.RWMutex
-
-		// Mutex for the tabIndentCounter
-		tcMut sync.RWMutex
 	)
 
-	var wg sync.WaitGroup
-	var byteLine []byte
-	for i := 0; i < lineCount; i++ {
-		byteLine = byteLines[i]
-		wg.Add(1)
-		go e.LoadByteLine(IndexByteLine{byteLine, i}, &eMut, &tcMut, &tabIndentCounter, &numLines, &wg)
+	for _, line := range lines {
+		// Require at least two bytes. Ignore lines with a single tab indentation or a single space
+		if len(line) > 2 {
+			first := line[0]
+			if first == '\t' {
+				tabIndentCounter++ // a tab indentation counts like a positive tab indentation
+			} else if first == ' ' && line[1] == ' ' { // assume that two spaces is the smallest space indentation
+				tabIndentCounter-- // a space indentation counts like a negative tab indentation
+			}
+		}
 	}
-	wg.Wait()
 
 	// If the last line is empty, delete it
-	if numLines > 0 && len(e.lines[numLines-1]) == 0 {
-		delete(e.lines, numLines-1)
+	if n := len(lines); n > 0 && len(lines[n-1]) == 0 {
+		lines = lines[:n-1]
 	}
 
+	e.lines = NewLines(lines)
+
 	if detectedTabs := tabIndentCounter > 0; detectedTabs && e.indentation.Spaces {
 		// Check if there were more tab indentations than space indentations
 		e.detectedTabs = &detectedTabs
@@ -73,7 +73,7 @@ func (e *Editor) FullResetRedraw(c *vt100.Canvas, status *StatusBar, drawLines,
 		// Go to the line we were at
 		e.ScrollUp(c, nil, e.pos.scrollSpeed)
 		e.HideCursorDrawLines(c, true, true, shouldHighlightCurrentLine)
-		canvasHeight := int(c.Height())
+		canvasHeight := int(e.pos.ViewHeight(c))
 		e.ScrollDown(c, nil, e.pos.scrollSpeed, canvasHeight)
 		e.redraw.Store(true)
 		e.redrawCursor.Store(true)
@@ -108,10 +108,9 @@ func (e *Editor) RepositionCursor(x, y uint) {
 // PlaceAndEnableCursor will enable the cursor and then place it
 func (e *Editor) PlaceAndEnableCursor() {
 	// Redraw the cursor, if needed
-	e.pos.mut.RLock()
-	x := uint(e.pos.ScreenX())
-	y := uint(e.pos.ScreenY())
-	e.pos.mut.RUnlock()
+	vx, vy := e.pos.ViewOrigin()
+	x := vx + uint(e.cursorScreenX())
+	y := vy + uint(e.cursorScreenY())
 
 	vt100.ShowCursor(true)
 	vt100.SetXY(x, y)
@@ -123,10 +122,9 @@ func (e *Editor) PlaceAndEnableCursor() {
 // RepositionCursorIfNeeded will reposition the cursor using VT100 commands, if needed
 func (e *Editor) RepositionCursorIfNeeded() {
 	// Redraw the cursor, if needed
-	e.pos.mut.RLock()
-	x := e.pos.ScreenX()
-	y := e.pos.ScreenY()
-	e.pos.mut.RUnlock()
+	vx, vy := e.pos.ViewOrigin()
+	x := int(vx) + e.cursorScreenX()
+	y := int(vy) + e.cursorScreenY()
 
 	if x != e.previousX || y != e.previousY || e.redrawCursor.Load() {
 		vt100.ShowCursor(true)
@@ -143,13 +141,25 @@ func (e *Editor) HideCursorDrawLines(c *vt100.Canvas, respectOffset, redrawCanva
 
 	// TODO: Use a channel for queuing up calls to the vt100 package to avoid race conditions
 
-	h := int(c.Height())
+	// Find the part of the canvas that belongs to this editor, if the view is split
+	if split != nil {
+		split.Layout(c, e)
+	}
+
+	h := int(e.pos.ViewHeight(c))
+	vx, vy := e.pos.ViewOrigin()
 	if respectOffset {
 		offsetY := e.pos.OffsetY()
-		e.WriteLines(c, LineIndex(offsetY), LineIndex(h+offsetY), 0, 0, shouldHighlightCurrentLine)
+		e.WriteLines(c, LineIndex(offsetY), LineIndex(h+offsetY), vx, vy, shouldHighlightCurrentLine)
 	} else {
-		e.WriteLines(c, LineIndex(0), LineIndex(h), 0, 0, shouldHighlightCurrentLine)
+		e.WriteLines(c, LineIndex(0), LineIndex(h), vx, vy, shouldHighlightCurrentLine)
 	}
+
+	// Also draw the pane that does not have the focus
+	if split != nil {
+		split.DrawOtherPane(c, e)
+	}
+
 	if redrawCanvas {
 		c.HideCursorAndRedraw()
 	} else {
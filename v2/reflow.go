@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+// reflowLine is a line that has been split into the prefix that is kept when reflowing, and the text
+type reflowLine struct {
+	prefix             string // indentation, a comment or quote marker and a list marker
+	continuationPrefix string // the prefix for the lines after a list item, where the list marker is replaced with spaces
+	text               string
+	ok                 bool // the line has text that can be reflowed
+	hardBreak          bool // the line ends with a hard line break, and can not be joined with the next line
+}
+
+// isListItem returns true if the line starts a list item
+func (rl reflowLine) isListItem() bool {
+	return rl.prefix != rl.continuationPrefix
+}
+
+// listMarkerLength returns the length of the list marker at the start of s, including the space after it, or 0
+func listMarkerLength(s string) int {
+	if len(s) >= 2 && strings.ContainsRune("-*+", rune(s[0])) && s[1] == ' ' {
+		return 2
+	}
+	digits := len(s) - len(strings.TrimLeftFunc(s, unicode.IsDigit))
+	if digits > 0 && len(s) >= digits+2 && (s[digits] == '.' || s[digits] == ')') && s[digits+1] == ' ' {
+		return digits + 2
+	}
+	return 0
+}
+
+// splitReflowLine splits the given line into the prefix that is kept when reflowing, and the text.
+// If prose is false, only comments can be reflowed.
+func (e *Editor) splitReflowLine(line string, prose bool) reflowLine {
+	var markers []string
+	if e.mode == mode.Markdown || e.mode == mode.Email {
+		markers = append(markers, ">") // quotes
+	}
+	if !prose {
+		markers = append(markers, e.SingleLineCommentMarker())
+	}
+	rest := strings.TrimLeftFunc(line, unicode.IsSpace)
+	hasMarker := false
+	for _, marker := range markers {
+		if marker != "" && strings.HasPrefix(rest, marker) {
+			rest = strings.TrimLeftFunc(rest[len(marker):], unicode.IsSpace)
+			hasMarker = true
+			break
+		}
+	}
+	var rl reflowLine
+	if n := listMarkerLength(rest); n > 0 {
+		rl.prefix = line[:len(line)-len(rest)+n]
+		rl.continuationPrefix = line[:len(line)-len(rest)] + strings.Repeat(" ", n)
+		rest = rest[n:]
+	} else {
+		rl.prefix = line[:len(line)-len(rest)]
+		rl.continuationPrefix = rl.prefix
+	}
+	rl.text = strings.TrimSpace(rest)
+	rl.hardBreak = strings.HasSuffix(line, "  ") || (e.mode == mode.Markdown && strings.HasSuffix(line, "\\"))
+	// Headers, Git comments and code blocks are not part of paragraphs
+	startsBlock := prose && !hasMarker && (strings.HasPrefix(rl.text, "#") || strings.HasPrefix(rl.text, "```") || strings.HasPrefix(rl.text, "|"))
+	rl.ok = rl.text != "" && (prose || hasMarker) && !startsBlock
+	return rl
+}
+
+// paragraphAt returns the first and the last line of the paragraph at the given line
+func (e *Editor) paragraphAt(y LineIndex) (LineIndex, LineIndex, error) {
+	prose := e.Prose()
+	if !e.splitReflowLine(e.Line(y), prose).ok {
+		if prose {
+			return y, y, errors.New("no paragraph at the cursor")
+		}
+		return y, y, errors.New("no comment at the cursor")
+	}
+	start := y
+	for start > 0 {
+		current := e.splitReflowLine(e.Line(start), prose)
+		if current.isListItem() {
+			break
+		}
+		previous := e.splitReflowLine(e.Line(start-1), prose)
+		if !previous.ok || previous.hardBreak || previous.continuationPrefix != current.prefix {
+			break
+		}
+		start--
+	}
+	first := e.splitReflowLine(e.Line(start), prose)
+	end := start
+	for int(end)+1 < e.Len() {
+		if e.splitReflowLine(e.Line(end), prose).hardBreak {
+			break
+		}
+		next := e.splitReflowLine(e.Line(end+1), prose)
+		if !next.ok || next.isListItem() || next.prefix != first.continuationPrefix {
+			break
+		}
+		end++
+	}
+	// The paragraph may start below the given line, if the given line is not a part of it
+	if end < y {
+		return y, y, errors.New("no paragraph at the cursor")
+	}
+	return start, end, nil
+}
+
+// reflowWidth returns the screen width of the given string, where tabs are expanded
+func (e *Editor) reflowWidth(s string) int {
+	return runewidth.StringWidth(strings.ReplaceAll(s, "\t", strings.Repeat(" ", e.indentation.PerTab)))
+}
+
+// ReflowParagraph joins the lines of the paragraph at the cursor and wraps them again at e.wrapWidth.
+// Comment markers, quote markers, indentation and list markers are kept, and hard line breaks at the end
+// of the paragraph are kept. In programming languages, only comments are reflowed.
+func (e *Editor) ReflowParagraph(c *vt100.Canvas, status *StatusBar) error {
+	start, end, err := e.paragraphAt(e.DataY())
+	if err != nil {
+		return err
+	}
+	width := e.wrapWidth
+	if width <= 0 {
+		width = 80
+	}
+	var (
+		prose    = e.Prose()
+		first    = e.splitReflowLine(e.Line(start), prose)
+		last     = e.Line(end)
+		words    []string
+		newLines []string
+	)
+	for y := start; y <= end; y++ {
+		words = append(words, strings.Fields(e.splitReflowLine(e.Line(y), prose).text)...)
+	}
+	line, lineHasWords := first.prefix, false
+	for _, word := range words {
+		if lineHasWords && e.reflowWidth(line+" "+word) > width {
+			newLines = append(newLines, line)
+			line, lineHasWords = first.continuationPrefix, false
+		}
+		if lineHasWords {
+			line += " "
+		}
+		line += word
+		lineHasWords = true
+	}
+	// Keep a hard line break at the end of the paragraph
+	if strings.HasSuffix(last, "  ") {
+		line += "  "
+	} else if e.mode == mode.Markdown && strings.HasSuffix(last, "\\") && !strings.HasSuffix(line, "\\") {
+		line += "\\"
+	}
+	newLines = append(newLines, line)
+
+	if equalStringSlices(newLines, e.lines.Slice(int(start), int(end)+1)) {
+		return nil
+	}
+	e.lines.Replace(int(start), int(end-start)+1, newLines)
+	e.changed.Store(true)
+	// Move to the end of the paragraph, without trimming a hard line break
+	lastY := start + LineIndex(len(newLines)-1)
+	e.GoTo(lastY, c, status)
+	e.pos.SetX(c, e.screenColumn(lastY, e.lines.RuneCount(int(lastY))))
+	e.redraw.Store(true)
+	e.redrawCursor.Store(true)
+	return nil
+}
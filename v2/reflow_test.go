@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/xyproto/mode"
+)
+
+func TestReflowComment(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.mode = mode.Go
+	e.wrapWidth = 25
+	e.LoadBytes([]byte("func f() {\n\t// one two three four five six\n\t// seven\n\tx := 1\n}"))
+	e.GoTo(2, nil, nil)
+	if err := e.ReflowParagraph(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := e.String(), "func f() {\n\t// one two three four\n\t// five six seven\n\tx := 1\n}\n"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	// Code is not reflowed
+	e.GoTo(3, nil, nil)
+	if err := e.ReflowParagraph(nil, nil); err == nil {
+		t.Error("expected an error when reflowing code")
+	}
+}
+
+func TestReflowMarkdown(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.mode = mode.Markdown
+	e.wrapWidth = 20
+	e.LoadBytes([]byte("# Title\n\n- a list item that is\n  long\n- second\n\nshort\nlines  \nafter a break"))
+
+	e.GoTo(3, nil, nil)
+	if err := e.ReflowParagraph(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := e.String(), "# Title\n\n- a list item that\n  is long\n- second\n\nshort\nlines  \nafter a break\n"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	// The hard line break ends the paragraph
+	e.GoTo(6, nil, nil)
+	if err := e.ReflowParagraph(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := e.Line(6), "short lines  "; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if got, want := e.Line(7), "after a break"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
@@ -18,3 +18,34 @@ var opinionatedStringReplacer = strings.NewReplacer(
 	// Replace any remaining \r characters with \n
 	string([]byte{'\r'}), string([]byte{'\n'}),
 )
+
+// lookalikeCharacters are the characters that are replaced by ReplaceLookalikeCharacters
+var lookalikeCharacters = string([]rune{0xa0, 0x308, 0x37e})
+
+// HasLookalikeCharacters checks if the text contains non-breaking spaces, or characters that look like tildes or semicolons
+func (e *Editor) HasLookalikeCharacters() bool {
+	for i := 0; i < e.Len(); i++ {
+		if strings.ContainsAny(e.Line(LineIndex(i)), lookalikeCharacters) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReplaceLookalikeCharacters replaces non-breaking spaces with regular spaces, and characters that look like
+// tildes or semicolons with tildes and semicolons. Returns the number of lines that were changed.
+func (e *Editor) ReplaceLookalikeCharacters() int {
+	changedLines := 0
+	for i := 0; i < e.Len(); i++ {
+		line := e.Line(LineIndex(i))
+		if !strings.ContainsAny(line, lookalikeCharacters) {
+			continue
+		}
+		e.SetLine(LineIndex(i), opinionatedStringReplacer.Replace(line))
+		changedLines++
+	}
+	if changedLines > 0 {
+		e.redraw.Store(true)
+	}
+	return changedLines
+}
@@ -175,9 +175,8 @@ func (e *Editor) ReturnPressed(c *vt100.Canvas, status *StatusBar) {
 			indent = false
 		}
 	}
-	e.MakeConsistent()
 
-	h := int(c.Height())
+	h := int(e.pos.ViewHeight(c))
 	if e.pos.sy > (h - 1) {
 		e.pos.Down(c)
 		e.redraw.Store(e.ScrollDown(c, status, 1, h))
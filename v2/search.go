@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"strings"
@@ -25,8 +24,14 @@ func (e *Editor) SetSearchTerm(c *vt100.Canvas, status *StatusBar, s string, spe
 	e.spellCheckMode = spellCheckMode
 	// Go to the first instance after the current line, if found
 	e.lineBeforeSearch = e.DataY()
+	m, err := e.SearchMatcher()
+	if err != nil || s == "" {
+		// Invalid regular expression, or nothing to search for
+		e.HideCursorDrawLines(c, true, false, false)
+		return false
+	}
 	for y := e.DataY(); y < LineIndex(e.Len()); y++ {
-		if strings.Contains(e.Line(y), s) {
+		if m.Contains(e.Line(y)) {
 			// Found an instance, scroll there
 			// GoTo returns true if the screen should be redrawn
 			redraw, _ := e.GoTo(y, c, status)
@@ -53,6 +58,12 @@ func (e *Editor) SetSearchTermWithTimeout(c *vt100.Canvas, status *StatusBar, s
 	// Go to the first instance after the current line, if found
 	e.lineBeforeSearch = e.DataY()
 
+	m, err := e.SearchMatcher()
+	if err != nil || s == "" {
+		// Invalid regular expression, or nothing to search for
+		return false
+	}
+
 	// create a channel to signal when a match is found
 	matchFound := make(chan bool)
 
@@ -62,7 +73,7 @@ func (e *Editor) SetSearchTermWithTimeout(c *vt100.Canvas, status *StatusBar, s
 	// run the search in a separate goroutine
 	go func() {
 		for y := e.DataY(); y < LineIndex(e.Len()); y++ {
-			if strings.Contains(e.Line(y), s) {
+			if m.Contains(e.Line(y)) {
 				matchFound <- true
 				foundMutex.Lock()
 				foundMatch = y
@@ -116,27 +127,29 @@ func (e *Editor) UseStickySearchTerm() {
 	}
 }
 
-// forwardSearch is a helper function for searching for a string from the given startIndex,
+// forwardSearch is a helper function for searching for the search term from the given startIndex,
 // up to the given stopIndex. -1
 // -1 is returned if there are no matches.
 // startIndex is expected to be smaller than stopIndex
 // x, y is returned.
 func (e *Editor) forwardSearch(startIndex, stopIndex LineIndex) (int, LineIndex) {
 	var (
-		s      = e.SearchTerm()
 		foundX = -1
 		foundY = LineIndex(-1)
 	)
-	if s == "" {
-		// Return -1, -1 if no search term is set
+	m, err := e.SearchMatcher()
+	if e.SearchTerm() == "" || err != nil {
+		// Return -1, -1 if no search term is set, or if it is not a valid regular expression
 		return foundX, foundY
 	}
 	currentIndex := e.DataY()
 	// Search from the given startIndex up to the given stopIndex
 	for y := startIndex; y < stopIndex; y++ {
 		lineContents := e.Line(y)
+		x := 0
 		if y == currentIndex {
-			x, err := e.DataX()
+			var err error
+			x, err = e.DataX()
 			if err != nil {
 				continue
 			}
@@ -146,61 +159,46 @@ func (e *Editor) forwardSearch(startIndex, stopIndex LineIndex) (int, LineIndex)
 			if x >= len(lineContents) {
 				continue
 			}
-			if strings.Contains(lineContents[x:], s) {
-				foundX = x + strings.Index(lineContents[x:], s)
-				foundY = y
-				break
-			}
-		} else {
-			if strings.Contains(lineContents, s) {
-				foundX = strings.Index(lineContents, s)
-				foundY = y
-				break
-			}
+		}
+		if i := m.Index(lineContents, x); i >= 0 {
+			foundX = i
+			foundY = y
+			break
 		}
 	}
 	return foundX, LineIndex(foundY)
 }
 
-// backwardSearch is a helper function for searching for a string from the given startIndex,
+// backwardSearch is a helper function for searching for the search term from the given startIndex,
 // backwards to the given stopIndex. -1, -1 is returned if there are no matches.
 // startIndex is expected to be larger than stopIndex
 func (e *Editor) backwardSearch(startIndex, stopIndex LineIndex) (int, LineIndex) {
 	var (
-		s      = e.SearchTerm()
 		foundX = -1
 		foundY = LineIndex(-1)
 	)
-	if len(s) == 0 {
-		// Return -1, -1 if no search term is set
+	m, err := e.SearchMatcher()
+	if len(e.SearchTerm()) == 0 || err != nil {
+		// Return -1, -1 if no search term is set, or if it is not a valid regular expression
 		return foundX, foundY
 	}
 	currentIndex := e.DataY()
 	// Search from the given startIndex backwards up to the given stopIndex
 	for y := startIndex; y >= stopIndex; y-- {
 		lineContents := e.Line(y)
+		x := len(lineContents) + 1
 		if y == currentIndex {
-			x, err := e.DataX()
+			var err error
+			x, err = e.DataX()
 			if err != nil {
 				continue
 			}
-			// Search from the next byte (not rune) position on this line
-			// TODO: Move forward one rune instead of one byte
-			x++
-			if x >= len(lineContents) {
-				continue
-			}
-			if strings.Contains(lineContents[x:], s) {
-				foundX = x + strings.Index(lineContents[x:], s)
-				foundY = y
-				break
-			}
-		} else {
-			if strings.Contains(lineContents, s) {
-				foundX = strings.Index(lineContents, s)
-				foundY = y
-				break
-			}
+		}
+		// Find the last match that starts before x on this line
+		if i := m.LastIndex(lineContents, x); i >= 0 {
+			foundX = i
+			foundY = y
+			break
 		}
 	}
 	return foundX, LineIndex(foundY)
@@ -209,7 +207,7 @@ func (e *Editor) backwardSearch(startIndex, stopIndex LineIndex) (int, LineIndex
 // GoToNextMatch will go to the next match, searching for "e.SearchTerm()".
 // * The search wraps around if wrap is true.
 // * The search is backawards if forward is false.
-// * The search is case-sensitive.
+// * The search uses the search options, which may be case-insensitive or use regular expressions.
 // Returns an error if the search was successful but no match was found.
 func (e *Editor) GoToNextMatch(c *vt100.Canvas, status *StatusBar, wrap, forward bool) error {
 	var (
@@ -223,6 +221,9 @@ func (e *Editor) GoToNextMatch(c *vt100.Canvas, status *StatusBar, wrap, forward
 		return nil
 	}
 
+	// For large files, wait for all the lines to be indexed, then search through them a few lines at a time
+	e.MergeLargeFileIndex(true)
+
 	// Search forward or backward
 	if forward {
 		// Forward search from the current location
@@ -274,6 +275,24 @@ func (e *Editor) GoToNextMatch(c *vt100.Canvas, status *StatusBar, wrap, forward
 	return nil
 }
 
+// ReplaceMatches replaces up to n matches of searchFor with replaceWith, or all matches if n is negative.
+// The current search options are used, so that searchFor can be a regular expression and replaceWith can refer to groups, like $1.
+// The replacements are done in one go, so that they can be undone in a single step. Returns the number of replacements.
+func (e *Editor) ReplaceMatches(searchFor, replaceWith string, n int, undo *Undo) (int, error) {
+	m, err := NewSearchMatcher(searchFor, e.searchOptions, e.IgnoreCaseByDefault())
+	if err != nil {
+		return 0, err
+	}
+	replaced, instanceCount := m.Replace(e.String(), replaceWith, n)
+	if instanceCount == 0 {
+		return 0, nil
+	}
+	undo.Snapshot(e)
+	e.LoadBytes([]byte(replaced))
+	undo.Snapshot(e)
+	return instanceCount, nil
+}
+
 // SearchMode will enter the interactive "search mode" where the user can type in a string and then press return to search
 func (e *Editor) SearchMode(c *vt100.Canvas, status *StatusBar, tty *vt100.TTY, clearSearch, searchForward bool, undo *Undo) {
 	// Attempt to load the search history. Ignores errors, but does not try to load it twice if it fails.
@@ -295,10 +314,14 @@ func (e *Editor) SearchMode(c *vt100.Canvas, status *StatusBar, tty *vt100.TTY,
 		timeout             = 500 * time.Millisecond
 	)
 
-	searchPrompt := "Search:"
+	// Use the search options that were last selected in the search prompt
+	e.searchOptions = searchOptions
+
+	basePrompt := "Search:"
 	if !searchForward {
-		searchPrompt = "Search backwards:"
+		basePrompt = "Search backwards:"
 	}
+	searchPrompt := e.searchPromptWithOptions(basePrompt)
 
 AGAIN:
 	doneCollectingLetters := false
@@ -355,6 +378,18 @@ AGAIN:
 				e.SetSearchTermWithTimeout(c, status, s, false, timeout)
 			}
 			doneCollectingLetters = true
+		case "c:18", "c:11", "c:23": // ctrl-r, ctrl-k or ctrl-w, toggle regex, cycle through the case options or toggle whole word
+			if replaceMode || !e.toggleSearchOption(key) {
+				break
+			}
+			searchPrompt = e.searchPromptWithOptions(basePrompt)
+			// Search again, with the new search options
+			e.GoToLineNumber(initialLocation, c, status, false)
+			e.SetSearchTermWithTimeout(c, status, s, false, timeout)
+			e.HideCursorDrawLines(c, true, false, false)
+			status.ClearAll(c, true)
+			status.SetMessage(searchPrompt + " " + s)
+			status.ShowNoTimeout(c, e)
 		case "c:9": // tab
 			// collect letters again, this time for the replace term
 			pressedTab = true
@@ -490,15 +525,18 @@ AGAIN:
 		replaceMode = true
 		goto AGAIN
 	} else if pressedTab && previousSearch != "" { // search text -> tab -> replace text- > tab
-		undo.Snapshot(e)
 		// replace once
 		searchFor := previousSearch
 		replaceWith := s
-		replaced := strings.Replace(e.String(), searchFor, replaceWith, 1)
-		e.LoadBytes([]byte(replaced))
-		if replaceWith == "" {
+		instanceCount, err := e.ReplaceMatches(searchFor, replaceWith, 1, undo)
+		switch {
+		case err != nil:
+			status.SetErrorAfterRedraw(err)
+		case instanceCount == 0:
+			status.SetMessageAfterRedraw(searchFor + " not found")
+		case replaceWith == "":
 			status.SetMessageAfterRedraw("Removed " + searchFor + ", once")
-		} else {
+		default:
 			status.SetMessageAfterRedraw("Replaced " + searchFor + " with " + replaceWith + ", once")
 		}
 		// Save "searchFor" to the search history, if we are on a fast enough system
@@ -513,23 +551,25 @@ AGAIN:
 		e.redraw.Store(true)
 		return
 	} else if pressedReturn && previousSearch != "" { // search text -> tab -> replace text -> return
-		undo.Snapshot(e)
 		// replace all
 		searchForBytes := []byte(previousSearch)
 		replaceWithBytes := []byte(s)
 		// check if we're searching and replacing an unicode character, like "U+0047" or "u+0000"
-		if r, err := runeFromUBytes(searchForBytes); err == nil { // success
-			searchForBytes = []byte(string(r))
-		}
-		if r, err := runeFromUBytes(replaceWithBytes); err == nil { // success
-			replaceWithBytes = []byte(string(r))
+		if !e.searchOptions.Regex {
+			if r, err := runeFromUBytes(searchForBytes); err == nil { // success
+				searchForBytes = []byte(string(r))
+			}
+			if r, err := runeFromUBytes(replaceWithBytes); err == nil { // success
+				replaceWithBytes = []byte(string(r))
+			}
 		}
 		// perform the replacements, and count the number of instances
-		allBytes := []byte(e.String())
-		instanceCount := bytes.Count(allBytes, searchForBytes)
-		allReplaced := bytes.ReplaceAll(allBytes, searchForBytes, replaceWithBytes)
-		// replace the contents
-		e.LoadBytes(allReplaced)
+		instanceCount, err := e.ReplaceMatches(string(searchForBytes), string(replaceWithBytes), -1, undo)
+		if err != nil {
+			status.SetErrorAfterRedraw(err)
+			e.redraw.Store(true)
+			return
+		}
 		// build a status message
 		extraS := ""
 		if instanceCount != 1 {
@@ -561,12 +601,19 @@ AGAIN:
 		// Save "s" to the search history, if we are on a fast enough system
 		if trimmedSearchString := strings.TrimSpace(s); trimmedSearchString != "" && !e.slowLoad {
 			searchHistory.AddAndSave(trimmedSearchString)
-		} else if !searchHistory.Empty() {
+		} else if s == "" && !searchHistory.Empty() {
 			const newestFirst = false
 			s = searchHistory.GetIndex(searchHistoryIndex, newestFirst)
 			e.SetSearchTerm(c, status, s, false) // no timeout
 		}
 	}
+	if _, err := e.SearchMatcher(); err != nil && previousSearch == "" {
+		// Not a valid regular expression
+		status.ClearAll(c, true)
+		e.redraw.Store(true)
+		status.SetErrorAfterRedraw(err)
+		return
+	}
 	if previousSearch == "" {
 		// Perform the actual search
 		if err := e.GoToNextMatch(c, status, wrap, forward); err == errNoSearchMatch {
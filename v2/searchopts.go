@@ -0,0 +1,306 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/xyproto/mode"
+	"github.com/xyproto/textoutput"
+)
+
+// SearchCase is how upper and lower case letters are treated when searching
+type SearchCase int
+
+const (
+	searchCaseDefault     SearchCase = iota // case-insensitive for Markdown and text, case-sensitive for code
+	searchCaseSensitive                     // always case-sensitive
+	searchCaseInsensitive                   // always case-insensitive
+	searchSmartCase                         // case-insensitive, unless the search term contains an uppercase letter
+)
+
+// SearchOptions are the settings that are used when searching and replacing
+type SearchOptions struct {
+	Case      SearchCase
+	Regex     bool // the search term is a regular expression, and replacements may refer to groups with $1
+	WholeWord bool // only match whole words
+}
+
+// searchOptions are the search options that were last selected by the user, in the search prompt
+var searchOptions SearchOptions
+
+// SearchMatcher can find a search term in a line, using the given search options
+type SearchMatcher struct {
+	re      *regexp.Regexp // nil for plain, case-sensitive string searches
+	literal string
+	expand  bool // expand $1 and ${name} in replacements
+}
+
+// Next returns the next search case option, when cycling through them with ctrl-k in the search prompt
+func (sc SearchCase) Next(ignoreCaseByDefault bool) SearchCase {
+	switch sc {
+	case searchCaseDefault:
+		if ignoreCaseByDefault {
+			return searchSmartCase
+		}
+		return searchCaseInsensitive
+	case searchCaseSensitive:
+		return searchCaseInsensitive
+	case searchCaseInsensitive:
+		return searchSmartCase
+	default:
+		return searchCaseSensitive
+	}
+}
+
+// IgnoreCase checks if the given search term should be searched for in a case-insensitive way
+func (so SearchOptions) IgnoreCase(s string, ignoreCaseByDefault bool) bool {
+	switch so.Case {
+	case searchCaseSensitive:
+		return false
+	case searchCaseInsensitive:
+		return true
+	case searchSmartCase:
+		return !strings.ContainsFunc(s, unicode.IsUpper)
+	default:
+		return ignoreCaseByDefault
+	}
+}
+
+// Describe returns a short description of the search options that are in effect, like "regex, ignore case", or an empty string
+func (so SearchOptions) Describe(ignoreCaseByDefault bool) string {
+	var words []string
+	if so.Regex {
+		words = append(words, "regex")
+	}
+	switch {
+	case so.Case == searchSmartCase:
+		words = append(words, "smart case")
+	case so.IgnoreCase("", ignoreCaseByDefault):
+		words = append(words, "ignore case")
+	}
+	if so.WholeWord {
+		words = append(words, "whole word")
+	}
+	return strings.Join(words, ", ")
+}
+
+// NewSearchMatcher prepares a search for the given search term.
+// Returns an error if the search term is not a valid regular expression.
+func NewSearchMatcher(s string, so SearchOptions, ignoreCaseByDefault bool) (*SearchMatcher, error) {
+	ignoreCase := so.IgnoreCase(s, ignoreCaseByDefault)
+	if !so.Regex && !ignoreCase && !so.WholeWord {
+		return &SearchMatcher{literal: s}, nil
+	}
+	pattern := s
+	if !so.Regex {
+		pattern = regexp.QuoteMeta(s)
+	}
+	if so.WholeWord {
+		pattern = `\b(?:` + pattern + `)\b`
+	}
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &SearchMatcher{re: re, literal: s, expand: so.Regex}, nil
+}
+
+// IgnoreCaseByDefault returns true if searches should be case-insensitive by default, for the current mode
+func (e *Editor) IgnoreCaseByDefault() bool {
+	switch e.mode {
+	case mode.ASCIIDoc, mode.Blank, mode.Email, mode.Markdown, mode.ReStructured, mode.SCDoc, mode.Text:
+		return true
+	}
+	return false
+}
+
+// SearchMatcher returns a SearchMatcher for the current search term and search options
+func (e *Editor) SearchMatcher() (*SearchMatcher, error) {
+	return NewSearchMatcher(e.searchTerm, e.searchOptions, e.IgnoreCaseByDefault())
+}
+
+// UseLiteralSearch makes the next search term be searched for as a plain string, regardless of the options
+// the user has selected in the search prompt. Used when searching for function signatures or typos.
+func (e *Editor) UseLiteralSearch() {
+	e.searchOptions = SearchOptions{}
+}
+
+// toggleSearchOption changes the search options if the given key is ctrl-r (regex), ctrl-k (case) or ctrl-w (whole word).
+// The search options are remembered for the next search. Returns false if the key is not one of these.
+func (e *Editor) toggleSearchOption(key string) bool {
+	switch key {
+	case "c:18": // ctrl-r
+		searchOptions.Regex = !searchOptions.Regex
+	case "c:11": // ctrl-k
+		searchOptions.Case = searchOptions.Case.Next(e.IgnoreCaseByDefault())
+	case "c:23": // ctrl-w
+		searchOptions.WholeWord = !searchOptions.WholeWord
+	default:
+		return false
+	}
+	e.searchOptions = searchOptions
+	return true
+}
+
+// searchPromptWithOptions adds the current search options to the given prompt, like "Search [regex]:"
+func (e *Editor) searchPromptWithOptions(prompt string) string {
+	if description := e.searchOptions.Describe(e.IgnoreCaseByDefault()); description != "" {
+		return strings.TrimSuffix(prompt, ":") + " [" + description + "]:"
+	}
+	return prompt
+}
+
+// FindAll returns the start and end byte positions of all matches in the given line
+func (m *SearchMatcher) FindAll(line string) [][]int {
+	if m.re != nil {
+		return m.re.FindAllStringIndex(line, -1)
+	}
+	if m.literal == "" {
+		return nil
+	}
+	var (
+		matches [][]int
+		offset  int
+	)
+	for {
+		i := strings.Index(line[offset:], m.literal)
+		if i < 0 {
+			break
+		}
+		start := offset + i
+		matches = append(matches, []int{start, start + len(m.literal)})
+		offset = start + len(m.literal)
+	}
+	return matches
+}
+
+// Index returns the byte position of the first match in the given line that starts at or after position x, or -1
+func (m *SearchMatcher) Index(line string, x int) int {
+	if m.re == nil {
+		if x > len(line) || m.literal == "" {
+			return -1
+		}
+		if i := strings.Index(line[x:], m.literal); i >= 0 {
+			return x + i
+		}
+		return -1
+	}
+	// Search the whole line, so that \b and ^ work as expected
+	for _, match := range m.re.FindAllStringIndex(line, -1) {
+		if match[0] >= x && match[1] > match[0] {
+			return match[0]
+		}
+	}
+	return -1
+}
+
+// LastIndex returns the byte position of the last match in the given line that starts before position x, or -1
+func (m *SearchMatcher) LastIndex(line string, x int) int {
+	found := -1
+	for _, match := range m.FindAll(line) {
+		if match[0] >= x {
+			break
+		}
+		if match[1] > match[0] {
+			found = match[0]
+		}
+	}
+	return found
+}
+
+// Contains checks if there is a match in the given line
+func (m *SearchMatcher) Contains(line string) bool {
+	return m.Index(line, 0) >= 0
+}
+
+// MatchLengths returns a slice with the length of each match at the rune index where the match starts, for highlighting matches.
+// The given slice is reused, if it is large enough.
+func (m *SearchMatcher) MatchLengths(runesAndAttributes []textoutput.CharAttribute, lengths []int) []int {
+	if cap(lengths) < len(runesAndAttributes) {
+		lengths = make([]int, len(runesAndAttributes))
+	}
+	lengths = lengths[:len(runesAndAttributes)]
+	clear(lengths)
+	var sb strings.Builder
+	byteToRuneIndex := make(map[int]int, len(runesAndAttributes))
+	for i, ra := range runesAndAttributes {
+		byteToRuneIndex[sb.Len()] = i
+		sb.WriteRune(ra.R)
+	}
+	byteToRuneIndex[sb.Len()] = len(runesAndAttributes)
+	for _, match := range m.FindAll(sb.String()) {
+		start, ok1 := byteToRuneIndex[match[0]]
+		end, ok2 := byteToRuneIndex[match[1]]
+		if ok1 && ok2 && end > start {
+			lengths[start] = end - start
+		}
+	}
+	return lengths
+}
+
+// replaceLine replaces the matches in the given line, up to n matches, or all matches if n is negative.
+// Returns the new line and the number of replacements.
+func (m *SearchMatcher) replaceLine(line, replacement string, n int) (string, int) {
+	var (
+		sb      strings.Builder
+		last    int
+		counter int
+	)
+	for _, match := range m.findAllSubmatches(line) {
+		if n >= 0 && counter >= n {
+			break
+		}
+		sb.WriteString(line[last:match[0]])
+		sb.WriteString(m.replacementFor(line, replacement, match))
+		last = match[1]
+		counter++
+	}
+	if counter == 0 {
+		return line, 0
+	}
+	sb.WriteString(line[last:])
+	return sb.String(), counter
+}
+
+// replacementFor returns the replacement for the given match in the given line, where $1 and ${name} are expanded for regular expressions
+func (m *SearchMatcher) replacementFor(line, replacement string, match []int) string {
+	if m.expand {
+		return string(m.re.ExpandString(nil, replacement, line, match))
+	}
+	return replacement
+}
+
+// findAllSubmatches returns the positions of all matches in the given line, including the positions of the groups
+func (m *SearchMatcher) findAllSubmatches(line string) [][]int {
+	if m.re != nil {
+		return m.re.FindAllStringSubmatchIndex(line, -1)
+	}
+	return m.FindAll(line)
+}
+
+// Replace replaces up to n matches in the given text, or all matches if n is negative.
+// The text is searched line by line, just like when searching. Returns the new text and the number of replacements.
+func (m *SearchMatcher) Replace(text, replacement string, n int) (string, int) {
+	lines := strings.Split(text, "\n")
+	total := 0
+	for i, line := range lines {
+		if n >= 0 && total >= n {
+			break
+		}
+		remaining := -1
+		if n >= 0 {
+			remaining = n - total
+		}
+		var count int
+		lines[i], count = m.replaceLine(line, replacement, remaining)
+		total += count
+	}
+	if total == 0 {
+		return text, 0
+	}
+	return strings.Join(lines, "\n"), total
+}
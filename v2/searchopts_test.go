@@ -0,0 +1,129 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/xyproto/mode"
+	"github.com/xyproto/textoutput"
+)
+
+func TestSearchMatcher(t *testing.T) {
+	tests := []struct {
+		term, line string
+		options    SearchOptions
+		ignoreCase bool // ignore case by default, like for Markdown
+		expected   [][]int
+	}{
+		{"ab", "ab Ab ab", SearchOptions{}, false, [][]int{{0, 2}, {6, 8}}},
+		{"ab", "ab Ab ab", SearchOptions{}, true, [][]int{{0, 2}, {3, 5}, {6, 8}}},
+		{"ab", "ab Ab", SearchOptions{Case: searchCaseInsensitive}, false, [][]int{{0, 2}, {3, 5}}},
+		{"ab", "ab Ab", SearchOptions{Case: searchCaseSensitive}, true, [][]int{{0, 2}}},
+		{"ab", "ab Ab", SearchOptions{Case: searchSmartCase}, false, [][]int{{0, 2}, {3, 5}}},
+		{"Ab", "ab Ab", SearchOptions{Case: searchSmartCase}, false, [][]int{{3, 5}}},
+		{"cat", "cat category cat", SearchOptions{WholeWord: true}, false, [][]int{{0, 3}, {13, 16}}},
+		{"a.c", "abc a.c", SearchOptions{}, false, [][]int{{4, 7}}},
+		{"a.c", "abc a.c", SearchOptions{Regex: true}, false, [][]int{{0, 3}, {4, 7}}},
+		{"x+", "x xx", SearchOptions{Regex: true, WholeWord: true}, false, [][]int{{0, 1}, {2, 4}}},
+		{"  ", "a  b", SearchOptions{}, false, [][]int{{1, 3}}},
+	}
+	for _, test := range tests {
+		m, err := NewSearchMatcher(test.term, test.options, test.ignoreCase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := m.FindAll(test.line)
+		if len(got) != len(test.expected) {
+			t.Errorf("searching for %q in %q: expected %v, got %v", test.term, test.line, test.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i][0] != test.expected[i][0] || got[i][1] != test.expected[i][1] {
+				t.Errorf("searching for %q in %q: expected %v, got %v", test.term, test.line, test.expected, got)
+				break
+			}
+		}
+	}
+	if _, err := NewSearchMatcher("(", SearchOptions{Regex: true}, false); err == nil {
+		t.Errorf("expected an error for an invalid regular expression")
+	}
+}
+
+func TestSearchMatcherIndex(t *testing.T) {
+	m, err := NewSearchMatcher(`\bfoo`, SearchOptions{Regex: true}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const line = "foo xfoo foo"
+	if i := m.Index(line, 1); i != 9 {
+		t.Errorf("expected the next match at 9, got %d", i)
+	}
+	if i := m.LastIndex(line, 9); i != 0 {
+		t.Errorf("expected the previous match at 0, got %d", i)
+	}
+	if i := m.Index(line, 10); i != -1 {
+		t.Errorf("expected no match, got %d", i)
+	}
+}
+
+func TestSearchMatchLengths(t *testing.T) {
+	m, err := NewSearchMatcher("øl", SearchOptions{Case: searchCaseInsensitive}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var runesAndAttributes []textoutput.CharAttribute
+	for _, r := range "Øl og øl" {
+		runesAndAttributes = append(runesAndAttributes, textoutput.CharAttribute{R: r})
+	}
+	lengths := m.MatchLengths(runesAndAttributes, nil)
+	expected := []int{2, 0, 0, 0, 0, 0, 2, 0}
+	for i := range expected {
+		if lengths[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, lengths)
+		}
+	}
+}
+
+func TestReplaceMatches(t *testing.T) {
+	u := NewUndo(defaultUndoCount, defaultUndoMemory)
+	e := NewSimpleEditor(80)
+	e.mode = mode.Go
+	const original = "a := f(1, 2)\nb := f(3, 4)\nc := g(5, 6)\n"
+	e.LoadBytes([]byte(original))
+
+	e.searchOptions = SearchOptions{Regex: true}
+	n, err := e.ReplaceMatches(`f\((\d), (\d)\)`, "f($2, $1)", -1, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 replacements, got %d", n)
+	}
+	if got := e.String(); got != "a := f(2, 1)\nb := f(4, 3)\nc := g(5, 6)\n" {
+		t.Errorf("unexpected contents after replacing: %q", got)
+	}
+
+	// All the replacements are undone in one step
+	if err := u.Restore(e); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.String(); got != original {
+		t.Errorf("unexpected contents after undoing: %q", got)
+	}
+
+	// Replacing once, without regular expressions, but ignoring case
+	e.searchOptions = SearchOptions{Case: searchCaseInsensitive}
+	if n, err := e.ReplaceMatches("F(", "h(", 1, u); err != nil || n != 1 {
+		t.Errorf("expected one replacement, got %d (%v)", n, err)
+	}
+	if got := e.String(); got != "a := h(1, 2)\nb := f(3, 4)\nc := g(5, 6)\n" {
+		t.Errorf("unexpected contents after replacing once: %q", got)
+	}
+
+	if n, err := e.ReplaceMatches("x", "y", -1, u); err != nil || n != 0 {
+		t.Errorf("expected no replacements, got %d (%v)", n, err)
+	}
+	e.searchOptions = SearchOptions{Regex: true}
+	if _, err := e.ReplaceMatches("[", "y", -1, u); err == nil {
+		t.Errorf("expected an error for an invalid regular expression")
+	}
+}
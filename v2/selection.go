@@ -0,0 +1,449 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/xyproto/clip"
+	"github.com/xyproto/vt100"
+)
+
+// SelectionKind is how the text between the anchor and the cursor is selected
+type SelectionKind int
+
+const (
+	charSelection SelectionKind = iota // from the anchor to the cursor, including the rune at the cursor
+	lineSelection                      // whole lines
+	rectSelection                      // a rectangle of screen columns, including the column of the cursor
+)
+
+// Selection is a visual selection that goes from an anchor to the cursor
+type Selection struct {
+	y    LineIndex // the line index where the selection was started
+	x    int       // the rune index where the selection was started
+	col  int       // the screen column where the selection was started, for rectangular selections
+	kind SelectionKind
+}
+
+// copiedRectangle is the text from the last rectangular selection that was copied or cut, if any
+var copiedRectangle []string
+
+// shiftArrowKeys maps from the key sequences for shift and an arrow key, to the corresponding arrow key
+var shiftArrowKeys = map[string]string{
+	shiftUpArrow:    upArrow,
+	shiftDownArrow:  downArrow,
+	shiftLeftArrow:  leftArrow,
+	shiftRightArrow: rightArrow,
+}
+
+// altShiftArrowKeys maps from the key sequences for alt, shift and an arrow key, to the corresponding arrow key
+var altShiftArrowKeys = map[string]string{
+	altShiftUpArrow:    upArrow,
+	altShiftDownArrow:  downArrow,
+	altShiftLeftArrow:  leftArrow,
+	altShiftRightArrow: rightArrow,
+}
+
+// StartSelection starts a selection of the given kind at the cursor.
+// If a selection of the same kind is already active, it is cleared instead, and if a selection of another kind
+// is active, it is changed to this kind. Returns true if a selection is active afterwards.
+func (e *Editor) StartSelection(kind SelectionKind) bool {
+	if e.selection != nil {
+		if e.selection.kind == kind {
+			e.selection = nil
+			return false
+		}
+		e.selection.kind = kind
+		return true
+	}
+	e.selection = &Selection{e.DataY(), e.cursorRuneIndex(), e.cursorColumn(), kind}
+	return true
+}
+
+// ClearSelection clears the selection. Returns true if there was a selection.
+func (e *Editor) ClearSelection() bool {
+	hadSelection := e.selection != nil
+	e.selection = nil
+	return hadSelection
+}
+
+// Selecting returns true if there is an active selection
+func (e *Editor) Selecting() bool {
+	return e.selection != nil
+}
+
+// cursorRuneIndex returns the rune index of the cursor on the current line,
+// or the length of the line if the cursor is placed after the end of the line
+func (e *Editor) cursorRuneIndex() int {
+	x, _ := e.DataX()
+	return x
+}
+
+// cursorColumn returns the screen column of the cursor, where tabs are expanded
+func (e *Editor) cursorColumn() int {
+	e.pos.mut.RLock()
+	defer e.pos.mut.RUnlock()
+	return e.pos.sx + e.pos.offsetX
+}
+
+// screenColumn returns the screen column of the given rune index on the given line, where tabs are expanded
+func (e *Editor) screenColumn(y LineIndex, x int) int {
+	runes, _ := e.lines.Runes(int(y))
+	x = min(x, len(runes))
+	tabs := 0
+	for _, r := range runes[:x] {
+		if r == '\t' {
+			tabs++
+		}
+	}
+	return x + tabs*(e.indentation.PerTab-1)
+}
+
+// runeIndexAtColumn returns the index of the first rune that starts at or after the given screen column
+// on the given line, or the length of the line if the line is shorter
+func (e *Editor) runeIndexAtColumn(y LineIndex, col int) int {
+	runes, _ := e.lines.Runes(int(y))
+	column := 0
+	for i, r := range runes {
+		if column >= col {
+			return i
+		}
+		if r == '\t' {
+			column += e.indentation.PerTab
+		} else {
+			column++
+		}
+	}
+	return len(runes)
+}
+
+// padToColumn adds spaces to the end of the given line, if it is shorter than the given screen column.
+// Returns the rune index at the given column.
+func (e *Editor) padToColumn(y LineIndex, col int) int {
+	runeCount := e.lines.RuneCount(int(y))
+	if width := e.screenColumn(y, runeCount); width < col {
+		e.SetLine(y, e.Line(y)+strings.Repeat(" ", col-width))
+		return runeCount + col - width
+	}
+	return e.runeIndexAtColumn(y, col)
+}
+
+// SelectedRectangle returns the lines and the screen columns of a rectangular selection. toCol is exclusive.
+func (e *Editor) SelectedRectangle() (startY, endY LineIndex, fromCol, toCol int) {
+	lastIndex := LineIndex(max(e.Len()-1, 0))
+	startY, endY = min(e.selection.y, lastIndex), min(e.DataY(), lastIndex)
+	fromCol, toCol = e.selection.col, e.cursorColumn()
+	return min(startY, endY), max(startY, endY), min(fromCol, toCol), max(fromCol, toCol) + 1
+}
+
+// SelectionRange returns the start and end of the selection, in document order. endX is exclusive.
+// For line-wise and rectangular selections, startX is 0 and endX is the length of the last line.
+func (e *Editor) SelectionRange() (startY LineIndex, startX int, endY LineIndex, endX int) {
+	lastIndex := LineIndex(max(e.Len()-1, 0))
+	startY, startX = min(e.selection.y, lastIndex), e.selection.x
+	endY, endX = min(e.DataY(), lastIndex), e.cursorRuneIndex()
+	if endY < startY || (endY == startY && endX < startX) {
+		startY, startX, endY, endX = endY, endX, startY, startX
+	}
+	if e.selection.kind != charSelection {
+		return startY, 0, endY, e.lines.RuneCount(int(endY))
+	}
+	// Include the rune at the end of the selection
+	return startY, min(startX, e.lines.RuneCount(int(startY))), endY, min(endX+1, e.lines.RuneCount(int(endY)))
+}
+
+// SelectedLineRange returns the index of the first and the last line that are touched by the selection
+func (e *Editor) SelectedLineRange() (LineIndex, LineIndex) {
+	startY, _, endY, _ := e.SelectionRange()
+	return startY, endY
+}
+
+// SelectedText returns the selected text. Lines are separated by "\n", and there is no trailing newline.
+func (e *Editor) SelectedText() string {
+	if e.selection.kind == rectSelection {
+		return strings.Join(e.rectangleLines(), "\n")
+	}
+	startY, startX, endY, endX := e.SelectionRange()
+	lines := e.lines.Slice(int(startY), int(endY)+1)
+	if len(lines) == 0 {
+		return ""
+	}
+	// Cut the end of the last line first, in case the first and the last line are the same
+	lastIndex := len(lines) - 1
+	lines[lastIndex] = string([]rune(lines[lastIndex])[:endX])
+	firstRunes := []rune(lines[0])
+	lines[0] = string(firstRunes[min(startX, len(firstRunes)):])
+	return strings.Join(lines, "\n")
+}
+
+// rectangleLines returns the text within the columns of the rectangular selection, for each selected line.
+// Lines that end within the rectangle are padded with spaces.
+func (e *Editor) rectangleLines() []string {
+	startY, endY, fromCol, toCol := e.SelectedRectangle()
+	lines := make([]string, 0, endY-startY+1)
+	for y := startY; y <= endY; y++ {
+		runes, _ := e.lines.Runes(int(y))
+		line := string(runes[e.runeIndexAtColumn(y, fromCol):e.runeIndexAtColumn(y, toCol)])
+		// Pad short lines, so that the rectangle keeps its shape when it is pasted
+		if width := e.screenColumn(y, len(runes)); width < toCol {
+			line += strings.Repeat(" ", toCol-max(width, fromCol))
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// selectedColumns returns the range of screen columns that are selected on the given line, where tabs are expanded.
+// The end is exclusive. Returns false if no part of the line is selected.
+func (e *Editor) selectedColumns(y LineIndex, startY LineIndex, startX int, endY LineIndex, endX int) (int, int, bool) {
+	if y < startY || y > endY {
+		return 0, 0, false
+	}
+	if e.selection != nil && e.selection.kind == rectSelection {
+		_, _, fromCol, toCol := e.SelectedRectangle()
+		return fromCol, toCol, true
+	}
+	from, to := 0, e.lines.RuneCount(int(y))
+	if y == startY {
+		from = startX
+	}
+	if y == endY {
+		to = endX
+	}
+	return e.screenColumn(y, from), e.screenColumn(y, to), true
+}
+
+// goToRuneIndex moves the cursor to the given line index and rune index
+func (e *Editor) goToRuneIndex(c *vt100.Canvas, status *StatusBar, y LineIndex, x int) {
+	e.GoTo(y, c, status)
+	col := e.screenColumn(y, x)
+	e.pos.mut.Lock()
+	e.pos.sx = col
+	e.pos.offsetX = 0
+	e.pos.mut.Unlock()
+}
+
+// InsertRectangle inserts the given lines at the given screen column, on the given line and the lines below.
+// Lines that are too short are padded with spaces, and lines are added to the end of the document if needed.
+func (e *Editor) InsertRectangle(y LineIndex, col int, lines []string) {
+	for i, s := range lines {
+		ly := y + LineIndex(i)
+		for int(ly) >= e.Len() {
+			e.lines.Insert(e.Len(), "")
+		}
+		x := e.padToColumn(ly, col)
+		runes, _ := e.lines.Runes(int(ly))
+		e.SetLine(ly, string(runes[:x])+s+string(runes[x:]))
+	}
+	e.changed.Store(true)
+}
+
+// ReplaceSelection replaces the selected text with the given string, clears the selection and
+// places the cursor at the start of the inserted text. A trailing newline is ignored for line-wise selections.
+func (e *Editor) ReplaceSelection(c *vt100.Canvas, status *StatusBar, s string) {
+	if e.selection == nil {
+		return
+	}
+	if e.selection.kind == rectSelection {
+		e.replaceRectangle(c, status, s)
+		return
+	}
+	startY, startX, endY, endX := e.SelectionRange()
+	var newLines []string
+	if e.selection.kind == lineSelection {
+		if s != "" {
+			newLines = strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+		}
+	} else {
+		firstRunes, _ := e.lines.Runes(int(startY))
+		lastRunes, _ := e.lines.Runes(int(endY))
+		newLines = strings.Split(string(firstRunes[:startX])+s+string(lastRunes[endX:]), "\n")
+	}
+	e.lines.Replace(int(startY), int(endY-startY)+1, newLines)
+	if e.lines.Len() == 0 {
+		e.lines = NewLines([]string{""})
+	}
+	e.changed.Store(true)
+	e.selection = nil
+	e.goToRuneIndex(c, status, min(startY, LineIndex(e.Len()-1)), startX)
+	e.redraw.Store(true)
+	e.redrawCursor.Store(true)
+}
+
+// replaceRectangle removes the text within the rectangular selection, and then inserts the lines of the given
+// string at the left edge of the rectangle, on the first selected line and the lines below
+func (e *Editor) replaceRectangle(c *vt100.Canvas, status *StatusBar, s string) {
+	startY, endY, fromCol, toCol := e.SelectedRectangle()
+	for y := startY; y <= endY; y++ {
+		runes, _ := e.lines.Runes(int(y))
+		if from, to := e.runeIndexAtColumn(y, fromCol), e.runeIndexAtColumn(y, toCol); from < to {
+			e.SetLine(y, string(runes[:from])+string(runes[to:]))
+		}
+	}
+	if s != "" {
+		e.InsertRectangle(startY, fromCol, strings.Split(s, "\n"))
+	}
+	e.changed.Store(true)
+	e.selection = nil
+	e.goToRuneIndex(c, status, startY, e.runeIndexAtColumn(startY, fromCol))
+	e.redraw.Store(true)
+	e.redrawCursor.Store(true)
+}
+
+// DeleteSelection removes the selected text and clears the selection
+func (e *Editor) DeleteSelection(c *vt100.Canvas, status *StatusBar) {
+	e.ReplaceSelection(c, status, "")
+}
+
+// CopySelection places the selected text in the clipboard and in copyLines.
+// If the selection is rectangular, the text can be pasted as a rectangle afterwards.
+// Returns the number of lines that were copied.
+func (e *Editor) CopySelection(copyLines *[]string) (int, error) {
+	s := e.SelectedText()
+	*copyLines = strings.Split(s, "\n")
+	copiedRectangle = nil
+	if e.selection.kind == rectSelection {
+		copiedRectangle = *copyLines
+	}
+	var err error
+	if isDarwin {
+		err = pbcopy(s)
+	} else {
+		// Place it in the non-primary clipboard
+		err = clip.WriteAll(s, e.primaryClipboard)
+	}
+	return len(*copyLines), err
+}
+
+// RectangleToPaste returns the lines of the last copied rectangle, if it is what would be pasted next
+func (e *Editor) RectangleToPaste(copyLines []string) []string {
+	if len(copiedRectangle) == 0 {
+		return nil
+	}
+	var (
+		s   string
+		err error
+	)
+	if isDarwin {
+		s, err = pbpaste()
+	} else {
+		s, err = clip.ReadAll(false) // non-primary clipboard
+	}
+	if err == nil && s != strings.Join(copiedRectangle, "\n") {
+		// Something else has been copied to the clipboard since then
+		return nil
+	}
+	if err != nil && !equalStringSlices(copyLines, copiedRectangle) {
+		return nil
+	}
+	return copiedRectangle
+}
+
+// PasteRectangle inserts the given lines at the cursor column, on the current line and the lines below
+func (e *Editor) PasteRectangle(lines []string) {
+	e.InsertRectangle(e.DataY(), e.cursorColumn(), lines)
+	e.redraw.Store(true)
+	e.redrawCursor.Store(true)
+}
+
+// mapSelectedLines replaces each line that is touched by the selection with the result of the given function.
+// The selection is kept.
+func (e *Editor) mapSelectedLines(f func(string) string) {
+	startY, endY := e.SelectedLineRange()
+	for y := startY; y <= endY; y++ {
+		line := e.Line(y)
+		if newLine := f(line); newLine != line {
+			e.SetLine(y, newLine)
+		}
+	}
+	e.redraw.Store(true)
+	e.redrawCursor.Store(true)
+}
+
+// IndentSelection indents or dedents the lines that are touched by the selection, by one level.
+// Blank lines are not indented.
+func (e *Editor) IndentSelection(dedent bool) {
+	oneIndentation := e.indentation.String()
+	e.mapSelectedLines(func(line string) string {
+		if strings.TrimSpace(line) == "" {
+			return line
+		}
+		if !dedent {
+			return oneIndentation + line
+		}
+		if strings.HasPrefix(line, "\t") {
+			return line[1:]
+		}
+		spaces := len(line) - len(strings.TrimLeft(line, " "))
+		return line[min(spaces, e.indentation.PerTab):]
+	})
+	// Keep the cursor within the current line
+	if e.AfterEndOfLine() {
+		e.End(nil)
+	}
+}
+
+// ToggleCommentSelection comments out the lines that are touched by the selection, or comments them in
+// again if most of the non-blank lines are already comments. Blank lines are left as they are.
+func (e *Editor) ToggleCommentSelection() {
+	var (
+		commentMarker = e.SingleLineCommentMarker()
+		nonBlank      int
+		commented     int
+	)
+	startY, endY := e.SelectedLineRange()
+	for y := startY; y <= endY; y++ {
+		trimmedLine := e.TrimmedLineAt(y)
+		if trimmedLine == "" {
+			continue
+		}
+		nonBlank++
+		if strings.HasPrefix(trimmedLine, commentMarker) {
+			commented++
+		}
+	}
+	uncomment := nonBlank > 0 && commented*2 >= nonBlank
+	e.mapSelectedLines(func(line string) string {
+		if strings.TrimSpace(line) == "" {
+			return line
+		}
+		if uncomment {
+			newLine, _ := uncommentedLine(line, commentMarker)
+			return newLine
+		}
+		return e.commentedLine(line, commentMarker)
+	})
+	if e.AfterEndOfLine() {
+		e.End(nil)
+	}
+}
+
+// SortSelection sorts the lines of the selected text
+func (e *Editor) SortSelection(c *vt100.Canvas, status *StatusBar) {
+	lines := strings.Split(e.SelectedText(), "\n")
+	sort.Strings(lines)
+	e.ReplaceSelection(c, status, strings.Join(lines, "\n"))
+}
+
+// FormatSelection formats the selected text on its own, with the formatter for the current mode,
+// and then replaces the selection with the formatted text
+func (e *Editor) FormatSelection(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, jsonFormatToggle *bool) {
+	text := e.SelectedText()
+
+	// Format the selected text in a separate editor, that has the same filename and mode
+	sub := e.Copy()
+	sub.pos = Position{mut: &sync.RWMutex{}, scrollSpeed: e.pos.scrollSpeed}
+	sub.selection = nil
+	sub.LoadBytes([]byte(text))
+	sub.formatCode(c, tty, status, jsonFormatToggle)
+
+	// Formatters add a final newline
+	formatted := strings.TrimRight(sub.String(), "\n")
+	if formatted == text {
+		e.ClearSelection()
+		e.redraw.Store(true)
+		return
+	}
+	e.ReplaceSelection(c, status, formatted)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/xyproto/mode"
+	"github.com/xyproto/vt100"
+)
+
+func TestSelectedText(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.LoadBytes([]byte("alpha beta\ngamma delta\nepsilon"))
+
+	// Select from "beta" to "gamma", backwards
+	e.pos.sy, e.pos.sx = 1, 4
+	e.StartSelection(charSelection)
+	e.pos.sy, e.pos.sx = 0, 6
+	if got, want := e.SelectedText(), "beta\ngamma"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	// Switch to a line-wise selection
+	if !e.StartSelection(lineSelection) {
+		t.Fatal("expected the selection to stay active when switching to a line-wise selection")
+	}
+	if got, want := e.SelectedText(), "alpha beta\ngamma delta"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	// Starting the same kind of selection again stops it
+	if e.StartSelection(lineSelection) || e.Selecting() {
+		t.Error("expected the selection to be cleared")
+	}
+}
+
+func TestReplaceSelection(t *testing.T) {
+	c := vt100.NewCanvas()
+	e := NewSimpleEditor(80)
+	e.LoadBytes([]byte("one two\nthree four\nfive"))
+
+	e.pos.sy, e.pos.sx = 0, 4
+	e.StartSelection(charSelection)
+	e.pos.sy, e.pos.sx = 1, 4
+	e.ReplaceSelection(c, nil, "2\n3")
+	if got, want := e.String(), "one 2\n3 four\nfive\n"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if e.Selecting() || e.DataY() != 0 || e.cursorRuneIndex() != 4 {
+		t.Errorf("expected the selection to be cleared and the cursor to be at the start of the replaced text")
+	}
+
+	// Deleting a line-wise selection removes the lines
+	e.pos.sy = 1
+	e.StartSelection(lineSelection)
+	e.pos.sy = 2
+	e.DeleteSelection(c, nil)
+	if got, want := e.String(), "one 2\n"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestSelectionLineOperations(t *testing.T) {
+	c := vt100.NewCanvas()
+	e := NewSimpleEditor(80)
+	e.mode = mode.Go
+	e.indentation = mode.TabsSpaces{PerTab: 4, Spaces: false}
+	e.LoadBytes([]byte("b := 2\n\na := 1\nc := 3"))
+
+	e.StartSelection(lineSelection)
+	e.pos.sy = 2
+
+	e.IndentSelection(false)
+	if got, want := e.String(), "\tb := 2\n\n\ta := 1\nc := 3\n"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	e.IndentSelection(true)
+	e.ToggleCommentSelection()
+	if got, want := e.String(), "// b := 2\n\n// a := 1\nc := 3\n"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	e.ToggleCommentSelection()
+	if got, want := e.String(), "b := 2\n\na := 1\nc := 3\n"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	e.SortSelection(c, nil)
+	if got, want := e.String(), "\na := 1\nb := 2\nc := 3\n"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestSelectedColumns(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.indentation = mode.TabsSpaces{PerTab: 4, Spaces: false}
+	e.LoadBytes([]byte("\tab\ncd"))
+	if from, to, ok := e.selectedColumns(0, 0, 1, 1, 1); !ok || from != 4 || to != 6 {
+		t.Errorf("expected columns 4 to 6, got %d to %d", from, to)
+	}
+	if _, to, ok := e.selectedColumns(1, 0, 1, 1, 1); !ok || to != 1 {
+		t.Errorf("expected the selection to end at column 1, got %d", to)
+	}
+	if _, _, ok := e.selectedColumns(2, 0, 1, 1, 1); ok {
+		t.Error("expected no selected columns after the selection")
+	}
+}
+
+func TestRectangularSelection(t *testing.T) {
+	c := vt100.NewCanvas()
+	e := NewSimpleEditor(80)
+	e.LoadBytes([]byte("| a | b |\n| cc | d |\n| e |"))
+
+	// Select the second column of the table
+	e.pos.sx = 4
+	e.StartSelection(rectSelection)
+	e.pos.sy, e.pos.sx = 2, 6
+	if got, want := e.SelectedText(), "| b\n | \n|  "; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	startY, startX, endY, endX := e.SelectionRange()
+	if _, to, ok := e.selectedColumns(1, startY, startX, endY, endX); !ok || to != 7 {
+		t.Errorf("expected the rectangle to end at column 7, got %d", to)
+	}
+
+	// Cut the rectangle and paste it again at the start of the lines
+	var copyLines []string
+	e.CopySelection(&copyLines) // the clipboard may not be available when testing
+	e.DeleteSelection(c, nil)
+	if got, want := e.String(), "| a  |\n| ccd |\n| e \n"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	e.pos.sy, e.pos.sx = 0, 0
+	e.PasteRectangle(copiedRectangle)
+	if got, want := e.String(), "| b| a  |\n | | ccd |\n|  | e \n"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	copiedRectangle = nil
+}
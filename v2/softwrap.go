@@ -0,0 +1,191 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/xyproto/vt100"
+)
+
+// softWrapBreaks returns the indices where the visual rows after the first one start, when the given line
+// (where the tabs have been expanded) is wrapped to the given width. Lines are broken after a space, if possible.
+func softWrapBreaks(runes []rune, width int) []int {
+	if width <= 0 {
+		return nil
+	}
+	var breaks []int
+	start := 0
+	for len(runes)-start > width {
+		end := start + width // the first index that does not fit on this row
+		brk := end
+		for i := end; i > start+1; i-- {
+			if runes[i-1] == ' ' {
+				brk = i
+				break
+			}
+		}
+		breaks = append(breaks, brk)
+		start = brk
+	}
+	return breaks
+}
+
+// expandedLineRunes returns the runes of the given line, where the tabs have been expanded, as when the line is drawn
+func (e *Editor) expandedLineRunes(y LineIndex) []rune {
+	return []rune(strings.ReplaceAll(trimRightSpace(e.Line(y)), "\t", strings.Repeat(" ", e.indentation.PerTab)))
+}
+
+// visualRow returns which visual row of a soft wrapped line the given screen column is on,
+// and the column within that row
+func visualRow(breaks []int, col int) (int, int) {
+	row, rowStart := 0, 0
+	for _, brk := range breaks {
+		if col < brk {
+			break
+		}
+		row++
+		rowStart = brk
+	}
+	return row, col - rowStart
+}
+
+// softWrapRows returns the number of screen rows that the given line takes up when soft wrapping
+func (e *Editor) softWrapRows(y LineIndex) int {
+	return len(softWrapBreaks(e.expandedLineRunes(y), e.softWrapWidth)) + 1
+}
+
+// softWrapCursor returns the screen row of the cursor relative to the current line, and the screen column,
+// when soft wrapping. The cursor is placed at the start of the next row if it is right after a full row.
+func (e *Editor) softWrapCursor() (int, int) {
+	breaks := softWrapBreaks(e.expandedLineRunes(e.DataY()), e.softWrapWidth)
+	row, x := visualRow(breaks, e.cursorColumn())
+	if e.softWrapWidth > 0 && x >= e.softWrapWidth {
+		row += x / e.softWrapWidth
+		x %= e.softWrapWidth
+	}
+	return row, x
+}
+
+// cursorScreenX returns the screen column of the cursor within the view
+func (e *Editor) cursorScreenX() int {
+	if !e.softWrap {
+		return e.pos.ScreenX()
+	}
+	_, x := e.softWrapCursor()
+	return x
+}
+
+// softWrapRowsAbove returns the number of additional screen rows that are used by soft wrapped lines,
+// from the top of the view and up to the cursor, including the rows of the cursor line that are above the cursor
+func (e *Editor) softWrapRowsAbove() int {
+	offsetY := LineIndex(e.pos.OffsetY())
+	rows := 0
+	for y := offsetY; y < e.DataY(); y++ {
+		if !e.isHidden(y) {
+			rows += e.softWrapRows(y) - 1
+		}
+	}
+	row, _ := e.softWrapCursor()
+	return rows + row
+}
+
+// ScrollToCursorWhenWrapping scrolls down if soft wrapped lines push the cursor below the bottom of the view.
+// Returns true if the view was scrolled.
+func (e *Editor) ScrollToCursorWhenWrapping(c *vt100.Canvas) bool {
+	if !e.softWrap || c == nil {
+		return false
+	}
+	h := int(e.pos.ViewHeight(c))
+	scrolled := false
+	for e.cursorScreenY() >= h && e.pos.ScreenY() > 0 {
+		e.pos.mut.Lock()
+		e.pos.offsetY++
+		e.pos.sy--
+		e.pos.mut.Unlock()
+		scrolled = true
+	}
+	if scrolled {
+		e.redraw.Store(true)
+		e.redrawCursor.Store(true)
+	}
+	return scrolled
+}
+
+// ToggleSoftWrap enables or disables soft wrapping, where long lines are wrapped when they are drawn,
+// without changing the text. Returns true if soft wrapping is enabled afterwards.
+func (e *Editor) ToggleSoftWrap() bool {
+	e.softWrap = !e.softWrap
+	e.redraw.Store(true)
+	e.redrawCursor.Store(true)
+	return e.softWrap
+}
+
+// setCursorColumn moves the cursor to the given screen column on the current line, or to the end of the line
+func (e *Editor) setCursorColumn(c *vt100.Canvas, col int) {
+	y := e.DataY()
+	col = e.screenColumn(y, e.runeIndexAtColumn(y, col))
+	e.pos.SetX(c, col)
+	e.redrawCursor.Store(true)
+}
+
+// SoftWrapDown moves the cursor down one visual row, when soft wrapping.
+// Returns false if the cursor is already at the last visual row of the document.
+func (e *Editor) SoftWrapDown(c *vt100.Canvas, status *StatusBar) bool {
+	y := e.DataY()
+	col := e.cursorColumn()
+	breaks := softWrapBreaks(e.expandedLineRunes(y), e.softWrapWidth)
+	row, x := visualRow(breaks, col)
+	if row < len(breaks) {
+		// Move to the next visual row of the same line
+		nextRowStart := breaks[row]
+		nextRowEnd := len(e.expandedLineRunes(y))
+		if row+1 < len(breaks) {
+			nextRowEnd = breaks[row+1] - 1
+		}
+		e.setCursorColumn(c, min(nextRowStart+x, nextRowEnd))
+		return true
+	}
+	nextY := e.nextVisibleLine(y)
+	if int(nextY) >= e.Len() {
+		return false
+	}
+	e.GoTo(nextY, c, status)
+	// Move to the first visual row of the next line, at the same column within the row
+	nextBreaks := softWrapBreaks(e.expandedLineRunes(nextY), e.softWrapWidth)
+	rowEnd := len(e.expandedLineRunes(nextY))
+	if len(nextBreaks) > 0 {
+		rowEnd = nextBreaks[0] - 1
+	}
+	e.setCursorColumn(c, min(x, rowEnd))
+	return true
+}
+
+// SoftWrapUp moves the cursor up one visual row, when soft wrapping.
+// Returns false if the cursor is already at the first visual row of the document.
+func (e *Editor) SoftWrapUp(c *vt100.Canvas, status *StatusBar) bool {
+	y := e.DataY()
+	col := e.cursorColumn()
+	breaks := softWrapBreaks(e.expandedLineRunes(y), e.softWrapWidth)
+	row, x := visualRow(breaks, col)
+	if row > 0 {
+		// Move to the previous visual row of the same line
+		prevRowStart := 0
+		if row > 1 {
+			prevRowStart = breaks[row-2]
+		}
+		e.setCursorColumn(c, min(prevRowStart+x, breaks[row-1]-1))
+		return true
+	}
+	if y == 0 {
+		return false
+	}
+	prevY := e.visibleLineAbove(y)
+	e.GoTo(prevY, c, status)
+	// Move to the last visual row of the previous line, at the same column within the row
+	prevBreaks := softWrapBreaks(e.expandedLineRunes(prevY), e.softWrapWidth)
+	rowStart := 0
+	if len(prevBreaks) > 0 {
+		rowStart = prevBreaks[len(prevBreaks)-1]
+	}
+	e.setCursorColumn(c, min(rowStart+x, len(e.expandedLineRunes(prevY))))
+	return true
+}
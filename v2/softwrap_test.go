@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSoftWrapBreaks(t *testing.T) {
+	runes := []rune("one two three four")
+	if got, want := softWrapBreaks(runes, 9), []int{8, 14}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	// Long words are broken at the width
+	if got, want := softWrapBreaks([]rune("abcdefghij"), 4), []int{4, 8}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if got := softWrapBreaks(runes, 80); len(got) != 0 {
+		t.Errorf("expected no breaks, got %v", got)
+	}
+}
+
+func TestSoftWrapCursorMovement(t *testing.T) {
+	e := NewSimpleEditor(80)
+	e.LoadBytes([]byte("one two three four\nfive"))
+	e.softWrap = true
+	e.softWrapWidth = 9
+
+	// "one two " / "three " / "four"
+	e.pos.sx = 2
+	if !e.SoftWrapDown(nil, nil) || e.DataY() != 0 || e.cursorColumn() != 10 {
+		t.Fatalf("expected the cursor to move to the second visual row, got line %d column %d", e.DataY(), e.cursorColumn())
+	}
+	if row, x := e.softWrapCursor(); row != 1 || x != 2 {
+		t.Errorf("expected the cursor to be drawn at row 1 column 2, got row %d column %d", row, x)
+	}
+	e.SoftWrapDown(nil, nil)
+	if !e.SoftWrapDown(nil, nil) || e.DataY() != 1 || e.cursorColumn() != 2 {
+		t.Fatalf("expected the cursor to move to the next line, got line %d column %d", e.DataY(), e.cursorColumn())
+	}
+	if !e.SoftWrapUp(nil, nil) || e.DataY() != 0 || e.cursorColumn() != 16 {
+		t.Errorf("expected the cursor to move to the last visual row of the first line, got line %d column %d", e.DataY(), e.cursorColumn())
+	}
+	if rows := e.softWrapRowsAbove(); rows != 2 {
+		t.Errorf("expected 2 soft wrapped rows above the cursor, got %d", rows)
+	}
+}
@@ -206,6 +206,7 @@ func (e *Editor) NanoNextTypo(c *vt100.Canvas, status *StatusBar) (string, strin
 			e.ClearSearch()
 			return "", ""
 		}
+		e.UseLiteralSearch()
 		e.SetSearchTerm(c, status, typo, true) // true for spellCheckMode
 		if err := e.GoToNextMatch(c, status, true, true); err == errNoSearchMatch {
 			status.ClearAll(c, false)
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/xyproto/files"
+	"github.com/xyproto/vt100"
+)
+
+// SplitDirection is how the canvas is divided between two panes
+type SplitDirection int
+
+const (
+	splitHorizontal SplitDirection = iota // one pane above the other
+	splitVertical                         // the panes are side by side
+)
+
+// Split is a view where the canvas is divided between two panes, that may show two regions of the same file, or two different files.
+// The pane that has the focus is the current Editor, while the Editor for the other pane is kept here.
+type Split struct {
+	other      *Editor // the editor in the pane that does not have the focus
+	otherUndo  *Undo   // the undo history of the other pane, if it shows another file
+	direction  SplitDirection
+	sameFile   bool // both panes show the same file, and edits in one pane are shown in the other
+	otherFirst bool // the other pane is the upper or the left pane
+}
+
+// split is the current split view, or nil if the editor is shown full screen
+var split *Split
+
+// String returns a short description of the split direction
+func (sd SplitDirection) String() string {
+	if sd == splitVertical {
+		return "vertical"
+	}
+	return "horizontal"
+}
+
+// Boxes returns the upper/left and the lower/right pane, for the given canvas.
+// For vertical splits, there is a column between the two panes, for drawing a separator.
+func (s *Split) Boxes(c *vt100.Canvas) (*Box, *Box) {
+	w, h := int(c.W()), int(c.H())
+	if s.direction == splitVertical {
+		leftWidth := w / 2
+		return &Box{0, 0, leftWidth, h}, &Box{leftWidth + 1, 0, max(w-leftWidth-1, 1), h}
+	}
+	topHeight := h / 2
+	return &Box{0, 0, w, topHeight}, &Box{0, topHeight, w, max(h-topHeight, 1)}
+}
+
+// Layout assigns a part of the canvas to each pane, and makes sure that the other pane shows
+// the same contents as the current editor, if both panes show the same file
+func (s *Split) Layout(c *vt100.Canvas, e *Editor) {
+	first, second := s.Boxes(c)
+	if s.otherFirst {
+		s.other.pos.view, e.pos.view = first, second
+	} else {
+		e.pos.view, s.other.pos.view = first, second
+	}
+	if s.sameFile {
+		s.syncOther(e)
+	}
+}
+
+// syncOther makes the other pane show the same lines as the given editor, while keeping the position of the other pane
+func (s *Split) syncOther(e *Editor) {
+	o := s.other
+	o.lines = e.lines
+	o.changed.Store(e.changed.Load())
+	// Open the closed folds in the other pane that no longer match the text
+	o.OpenStaleFolds()
+	// Make sure that the cursor in the other pane is not placed after the end of the document
+	if lastIndex := max(o.Len()-1, 0); o.pos.OffsetY()+o.pos.ScreenY() > lastIndex {
+		if o.pos.OffsetY() > lastIndex {
+			o.pos.SetOffsetY(lastIndex)
+		}
+		o.pos.SetY(lastIndex - o.pos.OffsetY())
+	}
+}
+
+// DrawOtherPane draws the lines, the progress indicator and the separator for the pane that does not have the focus
+func (s *Split) DrawOtherPane(c *vt100.Canvas, e *Editor) {
+	o := s.other
+	h := int(o.pos.ViewHeight(c))
+	vx, vy := o.pos.ViewOrigin()
+	offsetY := o.pos.OffsetY()
+	o.WriteLines(c, LineIndex(offsetY), LineIndex(h+offsetY), vx, vy, false)
+	o.WriteProgress(c)
+	if s.direction == splitVertical {
+		first, _ := s.Boxes(c)
+		x := uint(first.X + first.W)
+		for y := uint(0); y < c.H(); y++ {
+			c.WriteRune(x, y, e.StatusForeground, e.StatusBackground, '│')
+		}
+	}
+}
+
+// newPaneEditor creates an editor for a new pane that shows the same file as the given editor,
+// with its own position, so that the two panes can show different regions of the file
+func newPaneEditor(e *Editor) *Editor {
+	e2 := e.Copy()
+	e2.pos.mut = &sync.RWMutex{}
+	e2.pos.view = nil
+	e2.selection = nil
+	e2.multiCursor = nil
+	e2.folds = nil
+	return e2
+}
+
+// SplitView divides the canvas between two panes. If filename is empty, or is the file that is being edited,
+// both panes show the same file. Otherwise the given file is opened in the new pane. The new pane gets the focus.
+// If the view is already split, only the direction is changed.
+func (e *Editor) SplitView(c *vt100.Canvas, tty *vt100.TTY, status *StatusBar, lk *LockKeeper, direction SplitDirection, filename string) error {
+	if split != nil {
+		split.direction = direction
+		e.adjustPanesAfterLayout(c)
+		return nil
+	}
+	absFilename, err := e.AbsFilename()
+	if err != nil {
+		return err
+	}
+	otherAbsFilename := absFilename
+	if filename = strings.TrimSpace(filename); filename != "" {
+		if strings.HasPrefix(filename, "~") {
+			fnord := FilenameOrData{filename, []byte{}, 0, false, nil}
+			fnord.ExpandUser()
+			filename = fnord.filename
+		}
+		if otherAbsFilename, err = filepath.Abs(filename); err != nil {
+			return err
+		}
+		otherAbsFilename = filepath.Clean(otherAbsFilename)
+	}
+
+	if otherAbsFilename == absFilename {
+		split = &Split{other: newPaneEditor(e), direction: direction, sameFile: true}
+		// The new pane is the lower or right pane, and gets the focus
+		split.otherFirst = true
+		e.adjustPanesAfterLayout(c)
+		status.SetMessageAfterRedraw(fmt.Sprintf("Split %s, F6 to switch panes", direction))
+		return nil
+	}
+
+	if files.IsDir(otherAbsFilename) {
+		return errors.New("can not open directories")
+	}
+	if openBuffers.Index(otherAbsFilename) >= 0 {
+		return errors.New(filepath.Base(otherAbsFilename) + " is already open in another buffer")
+	}
+
+	// Lock the file for the new pane
+	if lk != nil {
+		lk.Load()
+		if err := lk.Lock(otherAbsFilename); err != nil {
+			return fmt.Errorf("%s is locked by another instance of this editor", filepath.Base(otherAbsFilename))
+		}
+		lk.Save()
+	}
+
+	fnord := FilenameOrData{otherAbsFilename, []byte{}, 0, false, nil}
+	e2, _, displayedImage, err := NewEditor(tty, c, fnord, LineNumber(0), ColNumber(0), e.Theme, e.syntaxHighlight, false, e.monitorAndReadOnly, e.nanoMode.Load(), e.createDirectoriesIfMissing, e.displayQuickHelp)
+	if err != nil || displayedImage || e2 == nil {
+		if lk != nil {
+			lk.Unlock(otherAbsFilename)
+			lk.Save()
+		}
+		if err == nil && displayedImage {
+			// The file was displayed as an image, or in the hex editor
+			e.redraw.Store(true)
+			e.redrawCursor.Store(true)
+			return nil
+		}
+		if err == nil {
+			err = errors.New("could not open " + filename)
+		}
+		return err
+	}
+
+	// The current editor moves to the upper or left pane, and the new file gets the focus
+	openBuffers.registerCurrent(e)
+	split = &Split{other: e.Copy(), otherUndo: undo, direction: direction, otherFirst: true}
+	e.Replace(e2)
+	undo = NewUndo(defaultUndoCount, defaultUndoMemory)
+	undo.LoadHistory(e, otherAbsFilename)
+	// The file in the new pane is also an open buffer, which is the current one while its pane has the focus
+	openBuffers.buffers = append(openBuffers.buffers, &Buffer{absFilename: otherAbsFilename})
+	openBuffers.current = openBuffers.Len() - 1
+	e.adjustPanesAfterLayout(c)
+	status.SetMessageAfterRedraw(fmt.Sprintf("Split %s with %s, F6 to switch panes", direction, files.Relative(otherAbsFilename)))
+	return nil
+}
+
+// adjustPanesAfterLayout assigns the parts of the canvas to the panes, and scrolls each pane so that the cursor is visible
+func (e *Editor) adjustPanesAfterLayout(c *vt100.Canvas) {
+	if split != nil {
+		split.Layout(c, e)
+	}
+	for _, pe := range []*Editor{e, split.otherOrNil()} {
+		if pe == nil {
+			continue
+		}
+		if h := int(pe.pos.ViewHeight(c)); pe.pos.ScreenY() >= h {
+			pe.Center(c)
+			// Center does not move the cursor if the line is close to the top of the document
+			if pe.pos.ScreenY() >= h {
+				y := pe.pos.OffsetY() + pe.pos.ScreenY()
+				pe.pos.SetOffsetY(y - (h - 1))
+				pe.pos.SetY(h - 1)
+			}
+		}
+	}
+	e.redraw.Store(true)
+	e.redrawCursor.Store(true)
+}
+
+// otherOrNil returns the editor for the other pane, or nil if the view is not split
+func (s *Split) otherOrNil() *Editor {
+	if s == nil {
+		return nil
+	}
+	return s.other
+}
+
+// otherBufferIndex returns the index of the open buffer that is shown in the other pane,
+// or -1 if the view is not split or if both panes show the same file
+func (s *Split) otherBufferIndex() int {
+	if s == nil || s.sameFile {
+		return -1
+	}
+	absFilename, err := s.other.AbsFilename()
+	if err != nil {
+		return -1
+	}
+	return openBuffers.Index(absFilename)
+}
+
+// FocusOtherPane moves the focus to the other pane, if the view is split
+func (e *Editor) FocusOtherPane(c *vt100.Canvas) error {
+	if split == nil {
+		return errors.New("the view is not split")
+	}
+	if split.sameFile {
+		split.syncOther(e)
+	} else if index := split.otherBufferIndex(); index >= 0 {
+		openBuffers.current = index
+	}
+	// Each pane has its own Position, since it is copied by Copy and Replace
+	current := e.Copy()
+	e.Replace(split.other)
+	split.other = current
+	split.otherFirst = !split.otherFirst
+	if !split.sameFile {
+		undo, split.otherUndo = split.otherUndo, undo
+	}
+	e.redraw.Store(true)
+	e.redrawCursor.Store(true)
+	return nil
+}
+
+// Unsplit closes the pane that does not have the focus, and shows the current editor full screen.
+// Returns an error if the other pane shows another file that has unsaved changes.
+func (e *Editor) Unsplit(c *vt100.Canvas, lk *LockKeeper) error {
+	if split == nil {
+		return errors.New("the view is not split")
+	}
+	if !split.sameFile {
+		o := split.other
+		if o.changed.Load() {
+			return errors.New(filepath.Base(o.filename) + " has unsaved changes, switch to it with F6 and save it first")
+		}
+		if index := split.otherBufferIndex(); index >= 0 {
+			openBuffers.remove(index)
+		}
+		if absFilename, err := o.AbsFilename(); err == nil {
+			if locationHistory != nil {
+				o.SaveLocation(absFilename, locationHistory)
+			}
+			if lk != nil {
+				lk.Load()
+				lk.Unlock(absFilename)
+				lk.Save()
+			}
+		}
+	}
+	split = nil
+	e.pos.view = nil
+	e.redraw.Store(true)
+	e.redrawCursor.Store(true)
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/xyproto/vt100"
+)
+
+func TestSplitBoxes(t *testing.T) {
+	c := vt100.NewCanvas()
+	w, h := int(c.W()), int(c.H())
+
+	s := &Split{direction: splitHorizontal}
+	top, bottom := s.Boxes(c)
+	if top.Y != 0 || bottom.Y != top.H || top.H+bottom.H != h || top.W != w || bottom.W != w {
+		t.Errorf("unexpected horizontal split: %+v and %+v for a %dx%d canvas", top, bottom, w, h)
+	}
+
+	s.direction = splitVertical
+	left, right := s.Boxes(c)
+	if left.X != 0 || right.X != left.W+1 || left.W+1+right.W != w || left.H != h || right.H != h {
+		t.Errorf("unexpected vertical split: %+v and %+v for a %dx%d canvas", left, right, w, h)
+	}
+}
+
+func TestSplitSameFile(t *testing.T) {
+	defer func() { split = nil }()
+
+	e := NewSimpleEditor(80)
+	e.filename = "a.txt"
+	e.LoadBytes([]byte("one\ntwo\nthree\nfour"))
+	e.pos.sy = 3
+
+	split = &Split{other: newPaneEditor(e), sameFile: true, otherFirst: true}
+	if split.other.pos.mut == e.pos.mut {
+		t.Fatal("expected the new pane to have its own position")
+	}
+
+	// Edits in the focused pane should be shown in the other pane
+	e.SetLine(0, "ONE")
+	c := vt100.NewCanvas()
+	split.Layout(c, e)
+	if got := split.other.Line(0); got != "ONE" {
+		t.Errorf("expected the other pane to show the edited line, got %q", got)
+	}
+	if e.pos.view == nil || split.other.pos.view == nil || e.pos.view.Y < split.other.pos.view.Y+split.other.pos.view.H {
+		t.Errorf("expected the focused pane to be below the other pane")
+	}
+
+	// Moving the focus should keep the position of each pane
+	split.other.pos.sy = 1
+	if err := e.FocusOtherPane(c); err != nil {
+		t.Fatal(err)
+	}
+	if e.pos.sy != 1 || split.other.pos.sy != 3 || split.otherFirst {
+		t.Errorf("unexpected positions after moving the focus: %d and %d", e.pos.sy, split.other.pos.sy)
+	}
+
+	// Deleting lines should move the cursor in the other pane within the document
+	e.LoadBytes([]byte("one"))
+	split.syncOther(e)
+	if y := split.other.pos.OffsetY() + split.other.pos.ScreenY(); y != 0 {
+		t.Errorf("expected the cursor in the other pane to be moved to the last line, got line index %d", y)
+	}
+
+	if err := e.Unsplit(c, nil); err != nil {
+		t.Fatal(err)
+	}
+	if split != nil || e.pos.view != nil {
+		t.Error("expected the view to be shown full screen after unsplitting")
+	}
+}
+
+func TestSplitOtherFileBuffer(t *testing.T) {
+	origBuffers, origUndo := openBuffers, undo
+	defer func() { split, openBuffers, undo = nil, origBuffers, origUndo }()
+
+	e := NewSimpleEditor(80)
+	e.filename = "b.txt"
+	other := NewSimpleEditor(80)
+	other.filename = "a.txt"
+	aFilename, _ := filepath.Abs("a.txt")
+	bFilename, _ := filepath.Abs("b.txt")
+
+	// Both files are open buffers, and the focused pane shows the current one
+	openBuffers = &BufferList{buffers: []*Buffer{{absFilename: aFilename}, {absFilename: bFilename}}, current: 1}
+	split = &Split{other: other, otherUndo: NewUndo(defaultUndoCount, defaultUndoMemory), otherFirst: true}
+	if split.otherBufferIndex() != 0 {
+		t.Fatal("expected a.txt in the other pane to be the first buffer")
+	}
+
+	// Switching to the buffer in the other pane moves the focus there
+	c := vt100.NewCanvas()
+	if err := e.SwitchToBuffer(c, nil, nil, 0); err != nil {
+		t.Fatal(err)
+	}
+	if e.filename != "a.txt" || openBuffers.current != 0 {
+		t.Errorf("expected a.txt to be the current buffer, got %s (%d)", e.filename, openBuffers.current)
+	}
+
+	// Closing the other pane also closes its buffer
+	if err := e.Unsplit(c, nil); err != nil {
+		t.Fatal(err)
+	}
+	if openBuffers.Len() != 1 || openBuffers.Index(aFilename) != 0 || openBuffers.current != 0 {
+		t.Errorf("expected only a.txt to be open after unsplitting, got %d buffers", openBuffers.Len())
+	}
+}
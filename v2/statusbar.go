@@ -43,32 +43,34 @@ func (e *Editor) NewStatusBar(statusDuration time.Duration, initialMessageAfterR
 
 // Draw will draw the status bar to the canvas
 func (sb *StatusBar) Draw(c *vt100.Canvas, offsetY int) {
-	w := int(c.W())
+	// The status bar is drawn at the bottom of the pane that has the focus, if the view is split
+	w := int(sb.editor.pos.ViewWidth(c))
+	vx, vy := sb.editor.pos.ViewOrigin()
 
 	// Shorten the status message if it's longer than the terminal width
 	if len(sb.msg) >= w && w > 4 {
 		sb.msg = sb.msg[:w-4] + "..."
 	}
 
-	h := c.H() - 1
+	h := vy + sb.editor.pos.ViewHeight(c) - 1
 	if sb.nanoMode {
 		h -= 2
 	}
 
 	if sb.IsError() {
 		mut.RLock()
-		c.Write(uint((w-len(sb.msg))/2), h, sb.errfg, sb.errbg, sb.msg)
+		c.Write(vx+uint((w-len(sb.msg))/2), h, sb.errfg, sb.errbg, sb.msg)
 		mut.RUnlock()
 	} else {
 		mut.RLock()
-		c.Write(uint((w-len(sb.msg))/2), h, sb.fg, sb.bg, sb.msg)
+		c.Write(vx+uint((w-len(sb.msg))/2), h, sb.fg, sb.bg, sb.msg)
 		mut.RUnlock()
 	}
 
 	if sb.nanoMode {
 		mut.RLock()
 		// x-align
-		x := uint((w - len(nanoHelpString1)) / 2)
+		x := vx + uint((w-len(nanoHelpString1))/2)
 		c.Write(x, h+1, sb.editor.NanoHelpForeground, sb.editor.NanoHelpBackground, nanoHelpString1)
 		c.Write(x, h+2, sb.editor.NanoHelpForeground, sb.editor.NanoHelpBackground, nanoHelpString2)
 		mut.RUnlock()
@@ -133,7 +135,8 @@ func (sb *StatusBar) SetErrorMessage(msg string) {
 
 // SetError is for setting the error message
 func (sb *StatusBar) SetError(err error) {
-	sb.SetErrorMessage(err.Error())
+	// Error strings start with a lowercase letter, but messages in the status bar start with an uppercase letter
+	sb.SetErrorMessage(capitalizeFirst(err.Error()))
 }
 
 // Clear will set the message to nothing and then use the editor contents
@@ -152,12 +155,13 @@ func (sb *StatusBar) Clear(c *vt100.Canvas, repositionCursorAfterDrawing bool) {
 	}
 
 	// Then clear/redraw the bottom line
-	h := int(c.H())
+	h := int(sb.editor.pos.ViewHeight(c))
 	if sb.nanoMode {
 		h -= 2
 	}
 	offsetY := sb.editor.pos.OffsetY()
-	sb.editor.WriteLines(c, LineIndex(offsetY), LineIndex(h+offsetY), 0, 0, false)
+	vx, vy := sb.editor.pos.ViewOrigin()
+	sb.editor.WriteLines(c, LineIndex(offsetY), LineIndex(h+offsetY), vx, vy, false)
 
 	c.HideCursorAndDraw()
 
@@ -184,12 +188,13 @@ func (sb *StatusBar) ClearAll(c *vt100.Canvas, repositionCursorAfterDrawing bool
 	}
 
 	// Then clear/redraw the bottom line
-	h := int(c.H())
+	h := int(sb.editor.pos.ViewHeight(c))
 	if sb.nanoMode {
 		h -= 2
 	}
 	offsetY := sb.editor.pos.OffsetY()
-	sb.editor.WriteLines(c, LineIndex(offsetY), LineIndex(h+offsetY), 0, 0, false)
+	vx, vy := sb.editor.pos.ViewOrigin()
+	sb.editor.WriteLines(c, LineIndex(offsetY), LineIndex(h+offsetY), vx, vy, false)
 
 	c.HideCursorAndDraw()
 
@@ -325,11 +330,12 @@ func (e *Editor) IndentationDescription() string {
 // * the current word count
 // * the currently detected file mode
 // * the current indentation mode (tabs or spaces)
+// * the current character encoding and line endings
 // func FilenamePositionPercentageAndModeInfo(e *Editor) string {
 func (sb *StatusBar) ShowFilenameLineColWordCount(c *vt100.Canvas, e *Editor) {
 	indentation := e.IndentationDescription()
 	percentage, lineNumber, lastLineNumber := e.PLA()
-	statusLine := fmt.Sprintf("%s: line %d/%d (%d%%) col %d rune %U words %d, [%s] %s", e.filename, lineNumber, lastLineNumber, percentage, e.ColNumber(), e.Rune(), e.WordCount(), e.mode, indentation)
+	statusLine := fmt.Sprintf("%s: line %d/%d (%d%%) col %d rune %U words %d, [%s] %s, %s", e.filename, lineNumber, lastLineNumber, percentage, e.ColNumber(), e.Rune(), e.WordCount(), e.mode, indentation, e.FileFormatDescription())
 	sb.SetMessage(statusLine)
 	sb.ShowNoTimeout(c, e)
 }
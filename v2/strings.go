@@ -63,6 +63,15 @@ func capitalizeWords(s string) string {
 	return strings.Join(newWords, " ")
 }
 
+// capitalizeFirst can change "in main.go: undefined" to "In main.go: undefined"
+func capitalizeFirst(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError {
+		return s
+	}
+	return string(unicode.ToUpper(r)) + s[size:]
+}
+
 // onlyAZaz checks if the given string only contains letters a-z and A-Z
 func onlyAZaz(s string) bool {
 	for _, r := range s {
@@ -10,6 +10,15 @@ func TestCapitalizeWords(t *testing.T) {
 	}
 }
 
+func TestCapitalizeFirst(t *testing.T) {
+	if capitalizeFirst("in main.go: undefined: x") != "In main.go: undefined: x" {
+		t.Fail()
+	}
+	if capitalizeFirst("") != "" || capitalizeFirst("ære") != "Ære" {
+		t.Fail()
+	}
+}
+
 func TestWithinBackticks(t *testing.T) {
 	tests := []struct {
 		line     string
@@ -97,6 +97,8 @@ type Theme struct {
 	NanoHelpBackground          vt100.AttributeColor
 	HighlightForeground         vt100.AttributeColor
 	HighlightBackground         vt100.AttributeColor
+	SelectionForeground         vt100.AttributeColor
+	SelectionBackground         vt100.AttributeColor
 	StatusMode                  bool
 	Light                       bool
 }
@@ -117,6 +119,8 @@ func NewDefaultTheme() Theme {
 		MultiLineString:             vt100.Magenta,
 		HighlightForeground:         vt100.White,
 		HighlightBackground:         vt100.BackgroundDefault,
+		SelectionForeground:         vt100.White,
+		SelectionBackground:         vt100.BackgroundBlue,
 		Git:                         vt100.LightGreen,
 		String:                      "lightyellow",
 		Keyword:                     "lightred",
@@ -204,6 +208,8 @@ func NewOrbTheme() Theme {
 		MultiLineString:             vt100.LightCyan,
 		HighlightForeground:         vt100.White,
 		HighlightBackground:         vt100.BackgroundBlack,
+		SelectionForeground:         vt100.White,
+		SelectionBackground:         vt100.BackgroundBlue,
 		Git:                         vt100.LightCyan,
 		String:                      "cyan",
 		Keyword:                     "lightcyan",
@@ -291,6 +297,8 @@ func NewPinetreeTheme() Theme {
 		MultiLineString:             vt100.Magenta,
 		HighlightForeground:         vt100.LightGreen,
 		HighlightBackground:         vt100.BackgroundBlack,
+		SelectionForeground:         vt100.Black,
+		SelectionBackground:         vt100.BackgroundGreen,
 		Git:                         vt100.LightGreen,
 		String:                      "lightgreen",
 		Keyword:                     "lightred",
@@ -378,6 +386,8 @@ func NewLitmusTheme() Theme {
 		MultiLineString:             vt100.Magenta,
 		HighlightForeground:         vt100.LightRed,
 		HighlightBackground:         vt100.BackgroundGray,
+		SelectionForeground:         vt100.White,
+		SelectionBackground:         vt100.BackgroundBlue,
 		Git:                         vt100.Black,
 		String:                      "blue",
 		Keyword:                     "lightred",
@@ -465,6 +475,8 @@ func NewSynthwaveTheme() Theme {
 		MultiLineString:             vt100.Magenta,
 		HighlightForeground:         vt100.White,
 		HighlightBackground:         vt100.BackgroundDefault,
+		SelectionForeground:         vt100.White,
+		SelectionBackground:         vt100.BackgroundMagenta,
 		Git:                         vt100.Cyan,
 		String:                      "lightgray",
 		Keyword:                     "magenta",
@@ -552,6 +564,8 @@ func NewTealTheme() Theme {
 		MultiLineString:             vt100.Blue,
 		HighlightForeground:         vt100.White,
 		HighlightBackground:         vt100.BackgroundDefault,
+		SelectionForeground:         vt100.Black,
+		SelectionBackground:         vt100.BackgroundCyan,
 		Git:                         vt100.Blue,
 		String:                      "lightcyan",
 		Keyword:                     "lightgray",
@@ -640,6 +654,8 @@ func NewRedBlackTheme() Theme {
 		MultiLineString:             vt100.LightGray,
 		HighlightForeground:         vt100.LightGray,
 		HighlightBackground:         vt100.BackgroundBlack,
+		SelectionForeground:         vt100.White,
+		SelectionBackground:         vt100.BackgroundRed,
 		Git:                         vt100.LightGreen,
 		String:                      "white",
 		Keyword:                     "darkred",
@@ -728,6 +744,8 @@ func NewLightBlueEditTheme() Theme {
 		MultiLineString:             vt100.LightYellow,
 		HighlightForeground:         vt100.LightYellow,
 		HighlightBackground:         vt100.BackgroundBlue,
+		SelectionForeground:         vt100.Black,
+		SelectionBackground:         vt100.BackgroundCyan,
 		Git:                         vt100.White,
 		String:                      "lightyellow",
 		Keyword:                     "lightcyan",
@@ -816,6 +834,8 @@ func NewDarkBlueEditTheme() Theme {
 		MultiLineString:             vt100.White,
 		HighlightForeground:         vt100.LightYellow,
 		HighlightBackground:         vt100.BackgroundBlue,
+		SelectionForeground:         vt100.Black,
+		SelectionBackground:         vt100.BackgroundCyan,
 		Git:                         vt100.White,
 		String:                      "lightyellow",
 		Keyword:                     "lightyellow",
@@ -903,6 +923,8 @@ func NewLightVSTheme() Theme {
 		MultiLineString:             vt100.Red,
 		HighlightForeground:         vt100.Red,
 		HighlightBackground:         vt100.BackgroundDefault,
+		SelectionForeground:         vt100.White,
+		SelectionBackground:         vt100.BackgroundBlue,
 		Git:                         vt100.Blue,
 		String:                      "red",
 		Keyword:                     "blue",
@@ -990,6 +1012,8 @@ func NewDarkVSTheme() Theme {
 		MultiLineString:             vt100.Red,
 		HighlightForeground:         vt100.Black,
 		HighlightBackground:         vt100.BackgroundWhite,
+		SelectionForeground:         vt100.White,
+		SelectionBackground:         vt100.BackgroundBlue,
 		Git:                         vt100.Blue,
 		String:                      "red",
 		Keyword:                     "blue",
@@ -1119,6 +1143,8 @@ func NewNoColorDarkBackgroundTheme() Theme {
 		MultiLineString:             vt100.Default,
 		HighlightForeground:         vt100.White,
 		HighlightBackground:         vt100.BackgroundDefault,
+		SelectionForeground:         vt100.Black,
+		SelectionBackground:         vt100.BackgroundWhite,
 		Git:                         vt100.White,
 		String:                      "",
 		Keyword:                     "",
@@ -1206,6 +1232,8 @@ func NewNoColorLightBackgroundTheme() Theme {
 		MultiLineString:             vt100.Default,
 		HighlightForeground:         vt100.Default,
 		HighlightBackground:         vt100.BackgroundDefault,
+		SelectionForeground:         vt100.White,
+		SelectionBackground:         vt100.BackgroundBlack,
 		Git:                         vt100.Black,
 		String:                      "",
 		Keyword:                     "",
@@ -1,79 +1,166 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"os"
+	"path/filepath"
 	"sync"
 	"unsafe"
 )
 
-// Undo is a struct that can store several states of the editor and position
+// UndoPosition is the cursor position and scroll offset before or after an edit
+type UndoPosition struct {
+	SX      int `json:"sx"`
+	SY      int `json:"sy"`
+	OffsetX int `json:"ox"`
+	OffsetY int `json:"oy"`
+}
+
+// UndoEdit is a single edit operation, where a range of lines starting at Y were replaced by other lines
+type UndoEdit struct {
+	Removed  []string     `json:"removed,omitempty"`  // the lines before the edit
+	Inserted []string     `json:"inserted,omitempty"` // the lines after the edit
+	Y        int          `json:"y"`                  // the index of the first line that was changed
+	Before   UndoPosition `json:"before"`             // the cursor position before the edit
+	After    UndoPosition `json:"after"`              // the cursor position after the edit
+	Join     bool         `json:"join,omitempty"`     // undo this edit together with the previous one
+}
+
+// Undo is a history of edit operations, that can be undone and redone.
+// Snapshot is called before the editor contents are changed. The next call to Snapshot, Restore or Redo
+// then finds the lines that were changed since the last snapshot, and records them as an edit.
 type Undo struct {
-	mut                  *sync.RWMutex
-	editorCopies         []Editor
-	editorLineCopies     []map[int][]rune
-	editorPositionCopies []Position
-	index                int
-	size                 int
-	maxMemoryUse         uint64 // can be <= 0 to not check for memory use
-	ignoreSnapshots      bool   // used when playing back macros
+	mut             *sync.RWMutex
+	edits           []UndoEdit // edits that can be undone, the last one is the most recent one
+	redos           []UndoEdit // edits that can be redone, the last one is the next one to redo
+	base            Lines      // the lines at the time of the last snapshot
+	basePos         UndoPosition
+	hasBase         bool
+	size            int    // the maximum number of edits to keep
+	maxMemoryUse    uint64 // can be <= 0 to not check for memory use
+	ignoreSnapshots bool   // used when recording macros
+	groupDepth      int    // larger than 0 while recording an undo group
+	groupHasEdits   bool   // has an edit been recorded in the current undo group
+	joinNext        bool   // should the next recorded edit be joined with the previous one
 }
 
 const (
-	// number of undo actions possible to store in the circular buffer
+	// number of undo actions possible to store
 	defaultUndoCount = 1024
 
-	// maximum amount of memory the undo buffers can use before re-using buffers, 0 to disable
+	// maximum amount of memory the undo history can use before dropping the oldest edits, 0 to disable
 	defaultUndoMemory = 0 // 32 * 1024 * 1024
 )
 
 var (
-	// Circular undo buffer with room for N actions, change false to true to check for too limit memory use
+	// Undo history with room for N actions
 	undo = NewUndo(defaultUndoCount, defaultUndoMemory)
 
 	// Save the contents of one switch.
 	// Used when switching between a .c or .cpp file to the corresponding .h file.
-	switchBuffer = NewUndo(1, defaultUndoMemory)
+	switchBuffer *Editor
 
-	// Save a copy of the undo stack when switching between files
+	// Save a copy of the undo history when switching between files
 	switchUndoBackup = NewUndo(defaultUndoCount, defaultUndoMemory)
+
+	// Keep the undo history between sessions, in undoHistoryDir
+	persistentUndo bool
+
+	// Where the undo history is stored, one file per edited file
+	undoHistoryDir = filepath.Join(userCacheDir, "o", "undo")
 )
 
-// NewUndo takes arguments that are only for initializing the undo buffers.
-// The *Position and *vt100.Canvas is used only as a default values for the elements in the undo buffers.
+// NewUndo takes arguments that are only for initializing the undo history.
 func NewUndo(size int, maxMemoryUse uint64) *Undo {
-	return &Undo{&sync.RWMutex{}, make([]Editor, size), make([]map[int][]rune, size), make([]Position, size), 0, size, maxMemoryUse, false}
+	return &Undo{mut: &sync.RWMutex{}, size: size, maxMemoryUse: maxMemoryUse}
 }
 
-// IgnoreSnapshots is used when playing back macros, to snapshot the macro playback as a whole instead
+// IgnoreSnapshots is used when recording macros, to snapshot the macro as a whole instead
 func (u *Undo) IgnoreSnapshots(b bool) {
 	u.ignoreSnapshots = b
 }
 
-func lineMapMemoryFootprint(m map[int][]rune) uint64 {
+// editsMemoryFootprint returns how much memory the given edits are using
+func editsMemoryFootprint(edits []UndoEdit) uint64 {
 	var sum uint64
-	for _, v := range m {
-		sum += uint64(cap(v))
+	for _, edit := range edits {
+		sum += uint64(unsafe.Sizeof(edit))
+		for _, s := range edit.Removed {
+			sum += uint64(unsafe.Sizeof(s)) + uint64(len(s))
+		}
+		for _, s := range edit.Inserted {
+			sum += uint64(unsafe.Sizeof(s)) + uint64(len(s))
+		}
 	}
 	return sum
 }
 
 // MemoryFootprint returns how much memory one Undo struct is using
-// TODO: Check if the size of the slices that contains structs are correct
 func (u *Undo) MemoryFootprint() uint64 {
 	var sum uint64
-	for _, m := range u.editorLineCopies {
-		sum += lineMapMemoryFootprint(m)
-	}
-	sum += uint64(unsafe.Sizeof(u.index))
-	sum += uint64(unsafe.Sizeof(u.size))
-	sum += uint64(unsafe.Sizeof(u.editorCopies))
-	sum += uint64(unsafe.Sizeof(u.editorPositionCopies))
-	sum += uint64(unsafe.Sizeof(u.mut))
-	sum += uint64(unsafe.Sizeof(u.maxMemoryUse))
+	sum += editsMemoryFootprint(u.edits)
+	sum += editsMemoryFootprint(u.redos)
+	sum += uint64(unsafe.Sizeof(*u))
 	return sum
 }
 
-// Snapshot will store a snapshot, and move to the next position in the circular buffer
+// undoPosition returns the current cursor position and scroll offset of the editor
+func undoPosition(e *Editor) UndoPosition {
+	return UndoPosition{e.pos.sx, e.pos.sy, e.pos.offsetX, e.pos.offsetY}
+}
+
+// setPosition moves the cursor of the editor to the given position
+func (up UndoPosition) setPosition(e *Editor) {
+	e.pos.sx = up.SX
+	e.pos.sy = up.SY
+	e.pos.offsetX = up.OffsetX
+	e.pos.offsetY = up.OffsetY
+}
+
+// setBase remembers the current lines and cursor position, for comparing with at the next snapshot
+func (u *Undo) setBase(e *Editor) {
+	u.base = e.lines
+	u.basePos = undoPosition(e)
+	u.hasBase = true
+	u.joinNext = false
+}
+
+// record finds the lines that have changed since the last snapshot, and stores them as an edit.
+// Returns true if an edit was recorded.
+func (u *Undo) record(e *Editor) bool {
+	if !u.hasBase {
+		return false
+	}
+	start, baseEnd, end := diffLines(&u.base, &e.lines)
+	if start == baseEnd && start == end {
+		return false
+	}
+	u.edits = append(u.edits, UndoEdit{
+		Removed:  u.base.Slice(start, baseEnd),
+		Inserted: e.lines.Slice(start, end),
+		Y:        start,
+		Before:   u.basePos,
+		After:    undoPosition(e),
+		Join:     u.joinNext || (u.groupDepth > 0 && u.groupHasEdits),
+	})
+	if u.groupDepth > 0 {
+		u.groupHasEdits = true
+	}
+	// A new edit makes it impossible to redo the edits that were undone
+	u.redos = nil
+	// Drop the oldest edits if there are too many, or if they use too much memory
+	for len(u.edits) > u.size || (u.maxMemoryUse > 0 && len(u.edits) > 1 && u.MemoryFootprint() > u.maxMemoryUse) {
+		u.edits = u.edits[1:]
+		u.edits[0].Join = false
+	}
+	return true
+}
+
+// Snapshot is called before the editor contents are changed.
+// It records the changes since the previous snapshot as one edit that can be undone.
 func (u *Undo) Snapshot(e *Editor) {
 	if u.ignoreSnapshots {
 		return
@@ -82,89 +169,187 @@ func (u *Undo) Snapshot(e *Editor) {
 	u.mut.Lock()
 	defer u.mut.Unlock()
 
-	u.editorCopies[u.index] = *e.Copy()
-	u.editorLineCopies[u.index] = e.CopyLines()
-	u.editorPositionCopies[u.index] = e.pos
+	u.record(e)
+	u.setBase(e)
+}
 
-	// Go forward 1 step in the circular buffer
-	u.index++
-	// Circular buffer wrap
-	if u.index >= u.size {
-		u.index = 0
-	}
+// Join makes the edit that comes after the last snapshot be undone together with the edit before it.
+// Used when pasting with ctrl-v twice, for instance.
+func (u *Undo) Join() {
+	u.mut.Lock()
+	defer u.mut.Unlock()
 
-	// If the undo buffer uses too much memory, reduce the size to half of the current size, but use a minimum of 10
-	if u.maxMemoryUse > 0 && u.MemoryFootprint() > u.maxMemoryUse {
-		newSize := u.size / 2
-		if newSize < 10 {
-			newSize = 10
-		}
+	u.joinNext = u.hasBase && len(u.edits) > 0
+}
 
-		smallest := newSize
-		if u.size < smallest {
-			smallest = u.size
-		}
+// BeginGroup starts an undo group. All edits until EndGroup is called are undone as one unit.
+func (u *Undo) BeginGroup(e *Editor) {
+	u.Snapshot(e)
 
-		newUndo := NewUndo(newSize, u.maxMemoryUse)
-		newUndo.index = u.index
-		if newUndo.index >= newUndo.size {
-			newUndo.index = 0
-		}
-		newUndo.mut = u.mut
-
-		u.mut.Lock()
-		defer u.mut.Unlock()
-
-		// Copy over the contents to the new undo struct
-		offset := u.index
-		for i := 0; i < smallest; i++ {
-			copyFromPos := i + offset
-			if copyFromPos > u.size {
-				copyFromPos -= u.size
-			}
-			copyToPos := i
-
-			newUndo.editorCopies[copyToPos] = u.editorCopies[copyFromPos]
-			newUndo.editorLineCopies[copyToPos] = u.editorLineCopies[copyFromPos]
-			newUndo.editorPositionCopies[copyToPos] = u.editorPositionCopies[copyFromPos]
-		}
+	u.mut.Lock()
+	defer u.mut.Unlock()
 
-		// Replace the undo struct
-		*u = *newUndo
+	if u.groupDepth == 0 {
+		u.groupHasEdits = false
+	}
+	u.groupDepth++
+}
 
-		// Adjust the index after the size has been changed
-		if u.index >= u.size {
-			u.index = 0
-		}
+// EndGroup ends an undo group. Does nothing if no undo group was started.
+func (u *Undo) EndGroup(e *Editor) {
+	u.mut.Lock()
+	defer u.mut.Unlock()
+
+	if u.groupDepth == 0 {
+		return
 	}
+	if !u.ignoreSnapshots {
+		u.record(e)
+		u.setBase(e)
+	}
+	u.groupDepth--
 }
 
-// Restore will restore a previous snapshot, and move to the previous position in the circular buffer
+// Restore will undo the most recent edit, or group of edits
 func (u *Undo) Restore(e *Editor) error {
 	u.mut.Lock()
 	defer u.mut.Unlock()
 
-	// Go back 1 step in the circular buffer
-	u.index--
-	// Circular buffer wrap
-	if u.index < 0 {
-		u.index = u.size - 1
+	u.record(e)
+	if len(u.edits) == 0 {
+		u.setBase(e)
+		return errors.New("nothing to undo")
+	}
+	for len(u.edits) > 0 {
+		edit := u.edits[len(u.edits)-1]
+		u.edits = u.edits[:len(u.edits)-1]
+		e.lines.Replace(edit.Y, len(edit.Inserted), edit.Removed)
+		edit.Before.setPosition(e)
+		u.redos = append(u.redos, edit)
+		if !edit.Join {
+			break
+		}
 	}
+	e.changed.Store(true)
+	u.setBase(e)
+	return nil
+}
+
+// Redo will redo the most recently undone edit, or group of edits
+func (u *Undo) Redo(e *Editor) error {
+	u.mut.Lock()
+	defer u.mut.Unlock()
 
-	// Restore the state from this index, if there is something there
-	if lines := u.editorLineCopies[u.index]; len(lines) > 0 {
+	// If the editor contents were changed after the last undo, there is nothing to redo
+	u.record(e)
+	if len(u.redos) == 0 {
+		u.setBase(e)
+		return errors.New("nothing to redo")
+	}
+	for first := true; len(u.redos) > 0; first = false {
+		edit := u.redos[len(u.redos)-1]
+		if !first && !edit.Join {
+			break
+		}
+		u.redos = u.redos[:len(u.redos)-1]
+		e.lines.Replace(edit.Y, len(edit.Removed), edit.Inserted)
+		edit.After.setPosition(e)
+		u.edits = append(u.edits, edit)
+	}
+	e.changed.Store(true)
+	u.setBase(e)
+	return nil
+}
+
+// Len will return the current number of edits that can be undone
+func (u *Undo) Len() int {
+	u.mut.RLock()
+	defer u.mut.RUnlock()
+
+	return len(u.edits)
+}
+
+// undoHistory is the undo history for one file, as it is stored in the cache directory
+type undoHistory struct {
+	FileHash  string     `json:"filehash"`  // the hash of the file contents, as it was saved
+	LinesHash string     `json:"lineshash"` // the hash of the editor contents, when the file was saved
+	Edits     []UndoEdit `json:"edits"`
+	Redos     []UndoEdit `json:"redos,omitempty"`
+}
+
+// hashString returns the SHA-256 hash of the given data, as a hex string
+func hashString(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
 
-		*e = u.editorCopies[u.index]
-		e.lines = lines
-		e.pos = u.editorPositionCopies[u.index]
+// undoHistoryFilename returns the filename that is used for storing the undo history for the given file
+func undoHistoryFilename(absFilename string) string {
+	return filepath.Join(undoHistoryDir, hashString([]byte(absFilename))[:32]+".json")
+}
 
+// SaveHistory stores the undo history for the given file in the cache directory, if persistent undo is enabled.
+// It should be called right after the file has been saved.
+func (u *Undo) SaveHistory(e *Editor, absFilename string) error {
+	if !persistentUndo || noWriteToCache || e.largeFile != nil {
 		return nil
 	}
-	return errors.New("no undo state at this index")
+	data, err := os.ReadFile(absFilename)
+	if err != nil {
+		return err
+	}
+
+	u.mut.Lock()
+	u.record(e)
+	u.setBase(e)
+	h := undoHistory{
+		FileHash:  hashString(data),
+		LinesHash: hashString([]byte(e.String())),
+		Edits:     u.edits,
+		Redos:     u.redos,
+	}
+	u.mut.Unlock()
+
+	jsonData, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	// First create the folder, if needed, in a best effort attempt
+	os.MkdirAll(undoHistoryDir, 0o700)
+	return os.WriteFile(undoHistoryFilename(absFilename), jsonData, 0o600)
 }
 
-// Len will return the current number of stored undo snapshots.
-// This is the same as the index int that points to the next free slot.
-func (u *Undo) Len() int {
-	return u.index
+// LoadHistory loads the undo history for the given file from the cache directory, if persistent undo is enabled.
+// If the file has been changed since the undo history was saved, the undo history is removed.
+func (u *Undo) LoadHistory(e *Editor, absFilename string) error {
+	if !persistentUndo || e.largeFile != nil {
+		return nil
+	}
+	historyFilename := undoHistoryFilename(absFilename)
+	jsonData, err := os.ReadFile(historyFilename)
+	if err != nil {
+		return err
+	}
+	var h undoHistory
+	if err := json.Unmarshal(jsonData, &h); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(absFilename)
+	if err != nil {
+		return err
+	}
+	if h.FileHash != hashString(data) || h.LinesHash != hashString([]byte(e.String())) {
+		if !noWriteToCache {
+			os.Remove(historyFilename)
+		}
+		return errors.New("the undo history is outdated")
+	}
+
+	u.mut.Lock()
+	defer u.mut.Unlock()
+
+	u.edits = h.Edits
+	u.redos = h.Redos
+	u.setBase(e)
+	return nil
 }
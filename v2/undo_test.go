@@ -0,0 +1,149 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUndoRedo(t *testing.T) {
+	u := NewUndo(defaultUndoCount, defaultUndoMemory)
+	e := NewSimpleEditor(80)
+	e.LoadBytes([]byte("one\ntwo\nthree\n"))
+
+	u.Snapshot(e)
+	e.SetLine(1, "TWO")
+	u.Snapshot(e)
+	e.InsertLineBelowAt(2)
+	e.SetLine(3, "four")
+
+	if err := u.Restore(e); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.String(); got != "one\nTWO\nthree\n" {
+		t.Errorf("unexpected contents after the first undo: %q", got)
+	}
+	if err := u.Restore(e); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.String(); got != "one\ntwo\nthree\n" {
+		t.Errorf("unexpected contents after the second undo: %q", got)
+	}
+	if err := u.Restore(e); err == nil {
+		t.Errorf("expected nothing more to undo")
+	}
+
+	if err := u.Redo(e); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Redo(e); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.String(); got != "one\nTWO\nthree\nfour\n" {
+		t.Errorf("unexpected contents after redoing: %q", got)
+	}
+	if err := u.Redo(e); err == nil {
+		t.Errorf("expected nothing more to redo")
+	}
+
+	// A new edit after undoing makes it impossible to redo
+	u.Restore(e)
+	u.Snapshot(e)
+	e.SetLine(0, "ONE")
+	if err := u.Redo(e); err == nil {
+		t.Errorf("expected nothing to redo after a new edit")
+	}
+}
+
+func TestUndoGroups(t *testing.T) {
+	u := NewUndo(defaultUndoCount, defaultUndoMemory)
+	e := NewSimpleEditor(80)
+	e.LoadBytes([]byte("a\nb\n"))
+
+	// Several edits in a group, like when playing back a macro
+	u.BeginGroup(e)
+	for i := 0; i < 3; i++ {
+		u.Snapshot(e)
+		e.SetLine(0, e.Line(0)+"x")
+	}
+	u.EndGroup(e)
+
+	// Two edits that are joined, like when pressing ctrl-v twice
+	u.Snapshot(e)
+	e.SetLine(1, "pasted")
+	u.Snapshot(e)
+	u.Join()
+	e.InsertLineBelowAt(1)
+	e.SetLine(2, "more")
+
+	if err := u.Restore(e); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.String(); got != "axxx\nb\n" {
+		t.Errorf("expected the joined edits to be undone together, got %q", got)
+	}
+	if err := u.Restore(e); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.String(); got != "a\nb\n" {
+		t.Errorf("expected the group to be undone as one unit, got %q", got)
+	}
+	if err := u.Redo(e); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.String(); got != "axxx\nb\n" {
+		t.Errorf("expected the group to be redone as one unit, got %q", got)
+	}
+}
+
+func TestUndoHistoryPersistence(t *testing.T) {
+	origPersistentUndo, origUndoHistoryDir, origNoWriteToCache := persistentUndo, undoHistoryDir, noWriteToCache
+	defer func() {
+		persistentUndo, undoHistoryDir, noWriteToCache = origPersistentUndo, origUndoHistoryDir, origNoWriteToCache
+	}()
+	persistentUndo, noWriteToCache = true, false
+	undoHistoryDir = t.TempDir()
+
+	filename := filepath.Join(t.TempDir(), "file.txt")
+	data := []byte("hello\nthere\n")
+	if err := os.WriteFile(filename, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Edit the file and save the undo history, as if the file was saved
+	u := NewUndo(defaultUndoCount, defaultUndoMemory)
+	e := NewSimpleEditor(80)
+	e.LoadBytes([]byte("hello\nworld\n"))
+	u.Snapshot(e)
+	e.SetLine(1, "there")
+	if err := u.SaveHistory(e, filename); err != nil {
+		t.Fatal(err)
+	}
+
+	// Open the file again, in a new session
+	u2 := NewUndo(defaultUndoCount, defaultUndoMemory)
+	e2 := NewSimpleEditor(80)
+	e2.LoadBytes(data)
+	if err := u2.LoadHistory(e2, filename); err != nil {
+		t.Fatal(err)
+	}
+	if err := u2.Restore(e2); err != nil {
+		t.Fatal(err)
+	}
+	if got := e2.String(); got != "hello\nworld\n" {
+		t.Errorf("unexpected contents after undoing the previous session: %q", got)
+	}
+
+	// Change the file on disk, which should invalidate the undo history
+	if err := os.WriteFile(filename, []byte("changed\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	e3 := NewSimpleEditor(80)
+	e3.LoadBytes([]byte("changed\n"))
+	if err := NewUndo(defaultUndoCount, defaultUndoMemory).LoadHistory(e3, filename); err == nil {
+		t.Errorf("expected the undo history to be invalid after the file was changed")
+	}
+	if _, err := os.Stat(undoHistoryFilename(filename)); err == nil {
+		t.Errorf("expected the outdated undo history to be removed")
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// replaceFile lets the given function write the new contents of the given file to a temporary file in the same
+// directory, which then replaces the file, so that the file is never left half-written. If the file is a symbolic
+// link, the file it points to is replaced. The permissions and the owner of an existing file are kept,
+// while perm is used for new files.
+func replaceFile(filename string, perm os.FileMode, write func(w io.Writer) error) error {
+	if resolved, err := filepath.EvalSymlinks(filename); err == nil {
+		filename = resolved
+	}
+	fi, statErr := os.Stat(filename)
+	if statErr == nil {
+		perm = fi.Mode().Perm()
+	}
+	f, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tempFilename := f.Name()
+	w := bufio.NewWriter(f)
+	err = write(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tempFilename, perm)
+	}
+	if err == nil && statErr == nil {
+		if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+			// Keep the owner, in a best effort attempt, since only root can give a file to another user
+			os.Chown(tempFilename, int(st.Uid), int(st.Gid))
+		}
+	}
+	if err == nil {
+		err = os.Rename(tempFilename, filename)
+	}
+	if err != nil {
+		os.Remove(tempFilename)
+	}
+	return err
+}
+
+// writeFileAtomically writes the data to the given file by using replaceFile.
+// The permissions and the owner of an existing file are kept.
+func writeFileAtomically(filename string, data []byte) error {
+	return replaceFile(filename, 0o644, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
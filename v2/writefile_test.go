@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomically(t *testing.T) {
+	root := t.TempDir()
+	target := filepath.Join(root, "script.sh")
+	if err := os.WriteFile(target, []byte("#!/bin/sh\n"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(root, "link.sh")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomically(link, []byte("#!/bin/sh\necho hi\n")); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Lstat(link); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Error("expected the symbolic link to be kept")
+	}
+	if data, err := os.ReadFile(target); err != nil || string(data) != "#!/bin/sh\necho hi\n" {
+		t.Errorf("expected the file the link points to to be written, got %q (%v)", data, err)
+	}
+	if fi, err := os.Stat(target); err != nil || fi.Mode().Perm() != 0o750 {
+		t.Error("expected the file permissions to be kept")
+	}
+	if matches, _ := filepath.Glob(filepath.Join(root, ".*.tmp")); len(matches) != 0 {
+		t.Errorf("expected no temporary files to be left behind, got %v", matches)
+	}
+
+	// New files get the given permissions
+	newFilename := filepath.Join(root, "new.txt")
+	if err := writeFileAtomically(newFilename, []byte("new\n")); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(newFilename); err != nil || fi.Mode().Perm() != 0o644 {
+		t.Error("expected a new file to have 0644 permissions")
+	}
+}